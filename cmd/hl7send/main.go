@@ -0,0 +1,34 @@
+package main
+
+import (
+	"HealthHub360/hl7"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+/*
+* Local client to send a sample HL7 file to the MLLP listener
+* go run ./cmd/hl7send -addr localhost:2575 -file hl7/testdata/oru_r01.hl7
+ */
+func main() {
+	addr := flag.String("addr", "localhost:2575", "address of the MLLP listener")
+	file := flag.String("file", "", "HL7 message file to send")
+	flag.Parse()
+	if *file == "" {
+		log.Fatal("file is required")
+	}
+	content, err := os.ReadFile(*file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	message := strings.ReplaceAll(strings.ReplaceAll(string(content), "\r\n", "\r"), "\n", "\r")
+	ack, err := hl7.Send(*addr, message, 10*time.Second)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(strings.ReplaceAll(ack, "\r", "\n"))
+}
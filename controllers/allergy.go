@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"HealthHub360/services"
+
+	authorization "github.com/KanapuramVaishnavi/Core/config/authorization"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Allergy(router *gin.Engine) {
+	allergy := router.Group("/allergy")
+	allergy.POST("/create/:patientId", authorization.Authorize("medicalRecord", "update"), CreateAllergy)
+	allergy.PATCH("/update/:allergyId", authorization.Authorize("medicalRecord", "update"), UpdateAllergy)
+	allergy.PATCH("/verify/:allergyId", authorization.Authorize("medicalRecord", "update"), VerifyAllergy)
+	allergy.GET("/fetchAll/:patientId", authorization.Authorize("medicalRecord", "view"), FetchAllergies)
+	allergy.POST("/check/:patientId", authorization.Authorize("medicalRecord", "view"), CheckMedicineAllergies)
+
+	immunization := router.Group("/immunization")
+	immunization.POST("/create/:patientId", authorization.Authorize("medicalRecord", "update"), CreateImmunization)
+	immunization.GET("/fetchAll/:patientId", authorization.Authorize("medicalRecord", "view"), FetchImmunizations)
+	immunization.GET("/due", authorization.Authorize("medicalRecord", "view"), FetchDueImmunizations)
+}
+
+func CreateAllergy(c *gin.Context) {
+	patientId := c.Param("patientId")
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	code, err := services.CreateAllergy(c, patientId, data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(code))
+}
+
+func UpdateAllergy(c *gin.Context) {
+	allergyId := c.Param("allergyId")
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	allergy, err := services.UpdateAllergy(c, allergyId, data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(allergy))
+}
+
+/*
+* Body {verificationStatus: CONFIRMED | REFUTED}
+ */
+func VerifyAllergy(c *gin.Context) {
+	allergyId := c.Param("allergyId")
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	allergy, err := services.VerifyAllergy(c, allergyId, data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(allergy))
+}
+
+/*
+* Optional query param status(ACTIVE, INACTIVE)
+ */
+func FetchAllergies(c *gin.Context) {
+	allergies, err := services.FetchAllergies(c, c.Param("patientId"), c.Query("status"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(allergies))
+}
+
+/*
+* Body {medicines: [{medicineId}]}, returns the allergies conflicting with the medicines
+ */
+func CheckMedicineAllergies(c *gin.Context) {
+	var data struct {
+		Medicines []interface{} `json:"medicines"`
+	}
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	conflicts, err := services.CheckMedicineAllergies(c, c.Param("patientId"), data.Medicines)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(conflicts))
+}
+
+func CreateImmunization(c *gin.Context) {
+	patientId := c.Param("patientId")
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	code, err := services.CreateImmunization(c, patientId, data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(code))
+}
+
+func FetchImmunizations(c *gin.Context) {
+	immunizations, err := services.FetchImmunizations(c, c.Param("patientId"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(immunizations))
+}
+
+/*
+* Optional query param days, doses due within the days(default 7)
+ */
+func FetchDueImmunizations(c *gin.Context) {
+	due, err := services.FetchDueImmunizations(c, c.Query("days"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(due))
+}
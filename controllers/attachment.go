@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"HealthHub360/services"
+
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	authorization "github.com/KanapuramVaishnavi/Core/config/authorization"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Attachment(router *gin.Engine) {
+	attachment := router.Group("/attachment")
+	attachment.POST("/upload/:patientId", authorization.Authorize("medicalRecord", "update"), UploadAttachment)
+	attachment.GET("/fetchAll/:patientId", authorization.Authorize("medicalRecord", "view"), FetchAttachments)
+	attachment.GET("/download/:attachmentId", authorization.Authorize("medicalRecord", "view"), DownloadAttachment)
+	attachment.GET("/thumbnail/:attachmentId", authorization.Authorize("medicalRecord", "view"), DownloadAttachmentThumbnail)
+	attachment.DELETE("/delete/:attachmentId", authorization.Authorize("medicalRecord", "update"), DeleteAttachment)
+}
+
+/*
+* Multipart form with the file and the optional fields medicalRecordId, category and description
+ */
+func UploadAttachment(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, services.MAX_ATTACHMENT_SIZE+(1<<20))
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(400, util.FailedResponse(errors.New(services.ATTACHMENT_FILE_REQUIRED)))
+		return
+	}
+	if fileHeader.Size > services.MAX_ATTACHMENT_SIZE {
+		c.JSON(400, util.FailedResponse(errors.New(services.ATTACHMENT_TOO_LARGE)))
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(io.LimitReader(file, services.MAX_ATTACHMENT_SIZE+1))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	data := map[string]string{
+		"medicalRecordId": c.PostForm("medicalRecordId"),
+		"category":        c.PostForm("category"),
+		"description":     c.PostForm("description"),
+	}
+	attachment, err := services.UploadAttachment(c, c.Param("patientId"), fileHeader.Filename, content, data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(attachment))
+}
+
+/*
+* Optional query params medicalRecordId and category
+ */
+func FetchAttachments(c *gin.Context) {
+	query := map[string]string{
+		"medicalRecordId": c.Query("medicalRecordId"),
+		"category":        c.Query("category"),
+	}
+	attachments, err := services.FetchAttachments(c, c.Param("patientId"), query)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(attachments))
+}
+
+func DownloadAttachment(c *gin.Context) {
+	sendAttachment(c, false)
+}
+
+func DownloadAttachmentThumbnail(c *gin.Context) {
+	sendAttachment(c, true)
+}
+
+func sendAttachment(c *gin.Context, thumbnail bool) {
+	attachment, content, err := services.DownloadAttachment(c, c.Param("attachmentId"), thumbnail)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	contentType, _ := attachment["contentType"].(string)
+	fileName, _ := attachment["fileName"].(string)
+	disposition := "attachment"
+	if thumbnail {
+		disposition = "inline"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("%s; filename=%q", disposition, fileName))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, contentType, content)
+}
+
+func DeleteAttachment(c *gin.Context) {
+	if err := services.DeleteAttachment(c, c.Param("attachmentId")); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse("Attachment deleted successfully"))
+}
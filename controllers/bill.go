@@ -16,6 +16,8 @@ func Bill(router *gin.Engine) {
 	bill.GET("/fetch/:code", authorization.Authorize("bill", "view"), FetchBillByCode)
 	bill.GET("/generate/:patientId", GenerateBillingReport)
 	bill.DELETE("/delete/:billId", authorization.Authorize("bill", "delete"), DeleteBillByCode)
+	bill.POST("/settle/:billId", authorization.Authorize("bill", "update"), SettleBill)
+	bill.POST("/approveCredit/:billId", authorization.Authorize("bill", "update"), ApproveBillCredit)
 }
 func CreateBill(c *gin.Context) {
 	patientId := c.Param("code")
@@ -60,3 +62,39 @@ func DeleteBillByCode(c *gin.Context) {
 	}
 	c.JSON(200, util.SuccessResponse(data))
 }
+
+/*
+* Body {paymentMode, reference}
+ */
+func SettleBill(c *gin.Context) {
+	billId := c.Param("billId")
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	bill, err := services.SettleBill(c, billId, data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(bill))
+}
+
+/*
+* Body {reason}
+ */
+func ApproveBillCredit(c *gin.Context) {
+	billId := c.Param("billId")
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	bill, err := services.ApproveBillCredit(c, billId, data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(bill))
+}
@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"HealthHub360/services"
+
+	authorization "github.com/KanapuramVaishnavi/Core/config/authorization"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ClinicalNote(router *gin.Engine) {
+	template := router.Group("/noteTemplate")
+	template.POST("/create", authorization.Authorize("medicalRecord", "create"), CreateNoteTemplate)
+	template.GET("/fetch/:templateId", authorization.Authorize("medicalRecord", "view"), FetchNoteTemplateByCode)
+	template.GET("/fetchAll", authorization.Authorize("medicalRecord", "view"), FetchNoteTemplates)
+	template.PATCH("/update/:templateId", authorization.Authorize("medicalRecord", "create"), UpdateNoteTemplate)
+
+	note := router.Group("/clinicalNote")
+	note.POST("/create/:medicalRecordId", authorization.Authorize("medicalRecord", "update"), CreateClinicalNote)
+	note.PATCH("/update/:noteId", authorization.Authorize("medicalRecord", "update"), UpdateClinicalNote)
+	note.PATCH("/lock/:noteId", authorization.Authorize("medicalRecord", "update"), LockClinicalNote)
+	note.POST("/addendum/:noteId", authorization.Authorize("medicalRecord", "update"), AddClinicalNoteAddendum)
+	note.GET("/fetch/:noteId", authorization.Authorize("medicalRecord", "view"), FetchClinicalNoteByCode)
+	note.GET("/fetchAll/:medicalRecordId", authorization.Authorize("medicalRecord", "view"), FetchClinicalNotes)
+	note.GET("/verify/:noteId", authorization.Authorize("medicalRecord", "view"), VerifyClinicalNote)
+}
+
+/*
+* Body: name, department and sections{subjective, objective, assessment, plan: [{key, label, type, options, required}]}
+ */
+func CreateNoteTemplate(c *gin.Context) {
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	code, err := services.CreateNoteTemplate(c, data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(code))
+}
+
+func FetchNoteTemplateByCode(c *gin.Context) {
+	template, err := services.FetchNoteTemplateByCode(c, c.Param("templateId"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(template))
+}
+
+/*
+* Optional query param department
+ */
+func FetchNoteTemplates(c *gin.Context) {
+	templates, err := services.FetchNoteTemplates(c, c.Query("department"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(templates))
+}
+
+func UpdateNoteTemplate(c *gin.Context) {
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	template, err := services.UpdateNoteTemplate(c, c.Param("templateId"), data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(template))
+}
+
+/*
+* Body: optional templateId and the sections subjective, objective, assessment, plan
+ */
+func CreateClinicalNote(c *gin.Context) {
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	note, err := services.CreateClinicalNote(c, c.Param("medicalRecordId"), data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(note))
+}
+
+func UpdateClinicalNote(c *gin.Context) {
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	note, err := services.UpdateClinicalNote(c, c.Param("noteId"), data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(note))
+}
+
+func LockClinicalNote(c *gin.Context) {
+	note, err := services.LockClinicalNote(c, c.Param("noteId"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(note))
+}
+
+/*
+* Body: text and optional reason
+ */
+func AddClinicalNoteAddendum(c *gin.Context) {
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	note, err := services.AddClinicalNoteAddendum(c, c.Param("noteId"), data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(note))
+}
+
+func FetchClinicalNoteByCode(c *gin.Context) {
+	note, err := services.FetchClinicalNoteByCode(c, c.Param("noteId"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(note))
+}
+
+func FetchClinicalNotes(c *gin.Context) {
+	notes, err := services.FetchClinicalNotes(c, c.Param("medicalRecordId"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(notes))
+}
+
+func VerifyClinicalNote(c *gin.Context) {
+	result, err := services.VerifyClinicalNote(c, c.Param("noteId"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(result))
+}
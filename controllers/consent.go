@@ -15,6 +15,12 @@ func Consent(router *gin.Engine) {
 	consent.GET("/fetch/:consentId", authorization.Authorize("consent", "view"), FetchConsentByCode)
 	consent.GET("/fetchAll", authorization.Authorize("consent", "view"), FetchAllConsents)
 	consent.DELETE("/delete/:consentId", authorization.Authorize("consent", "delete"), DeleteConsent)
+	consent.POST("/withdraw/:consentId", authorization.Authorize("consent", "update"), WithdrawConsent)
+	consent.GET("/verify/:consentId", authorization.Authorize("consent", "view"), VerifyConsentSignature)
+	consent.POST("/form/create", authorization.Authorize("consent", "create"), PublishConsentForm)
+	consent.GET("/form/fetch/:formId", authorization.Authorize("consent", "view"), FetchConsentForm)
+	consent.GET("/form/current/:consentType", authorization.Authorize("consent", "view"), FetchCurrentConsentForm)
+	consent.GET("/form/fetchAll", authorization.Authorize("consent", "view"), FetchConsentForms)
 }
 
 func CreateConsent(c *gin.Context) {
@@ -63,3 +69,79 @@ func DeleteConsent(c *gin.Context) {
 	}
 	c.JSON(200, util.SuccessResponse(msg))
 }
+
+/*
+* Body {reason}
+ */
+func WithdrawConsent(c *gin.Context) {
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	consent, err := services.WithdrawConsent(c, c.Param("consentId"), data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(consent))
+}
+
+/*
+* Tamper check of the guardian signature of the consent
+ */
+func VerifyConsentSignature(c *gin.Context) {
+	result, err := services.VerifyConsentSignature(c, c.Param("consentId"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(result))
+}
+
+/*
+* Body {consentType, title, text, validityDays}
+ */
+func PublishConsentForm(c *gin.Context) {
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	form, err := services.PublishConsentForm(c, data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(form))
+}
+
+func FetchConsentForm(c *gin.Context) {
+	form, err := services.FetchConsentForm(c, c.Param("formId"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(form))
+}
+
+func FetchCurrentConsentForm(c *gin.Context) {
+	form, err := services.FetchCurrentConsentForm(c, c.Param("consentType"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(form))
+}
+
+/*
+* consentType is an optional query param
+ */
+func FetchConsentForms(c *gin.Context) {
+	forms, err := services.FetchConsentForms(c, c.Query("consentType"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(forms))
+}
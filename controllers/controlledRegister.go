@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"HealthHub360/services"
+
+	authorization "github.com/KanapuramVaishnavi/Core/config/authorization"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ControlledRegister(router *gin.Engine) {
+	register := router.Group("/controlledRegister")
+	register.GET("/awaitingWitness", authorization.Authorize("bill", "view"), FetchAwaitingControlledDispenses)
+	register.POST("/witness/:dispenseId", authorization.Authorize("bill", "update"), WitnessControlledDispense)
+	register.GET("/report", authorization.Authorize("medicine", "view"), FetchControlledRegister)
+}
+
+func FetchAwaitingControlledDispenses(c *gin.Context) {
+	result, err := services.FetchAwaitingControlledDispenses(c)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(result))
+}
+
+func WitnessControlledDispense(c *gin.Context) {
+	dispenseId := c.Param("dispenseId")
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	result, err := services.WitnessControlledDispense(c, dispenseId, data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(result))
+}
+
+/*
+* Optional query params hospitalId(for tenant and superAdmin) and medicineId
+ */
+func FetchControlledRegister(c *gin.Context) {
+	result, err := services.FetchControlledRegister(c, c.Query("hospitalId"), c.Query("medicineId"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(result))
+}
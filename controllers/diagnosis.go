@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"HealthHub360/services"
+
+	"io"
+
+	authorization "github.com/KanapuramVaishnavi/Core/config/authorization"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Diagnosis(router *gin.Engine) {
+	icd10 := router.Group("/icd10")
+	icd10.POST("/import", authorization.Authorize("superAdmin", "update"), ImportICD10Codes)
+	icd10.GET("/search", authorization.Authorize("medicalRecord", "view"), SearchICD10)
+
+	problem := router.Group("/problem")
+	problem.POST("/create/:patientId", authorization.Authorize("medicalRecord", "update"), CreateProblem)
+	problem.PATCH("/update/:problemId", authorization.Authorize("medicalRecord", "update"), UpdateProblem)
+	problem.GET("/fetchAll/:patientId", authorization.Authorize("medicalRecord", "view"), FetchProblems)
+
+	router.GET("/diagnosis/report", authorization.Authorize("medicalRecord", "view"), DiagnosisReport)
+}
+
+/*
+* csv/xlsx file with the columns code, description and chapter(optional)
+ */
+func ImportICD10Codes(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	result, err := services.ImportICD10Codes(c, fileHeader.Filename, content)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(result))
+}
+
+/*
+* Query params q(code prefix or a word of the description) and optional limit
+ */
+func SearchICD10(c *gin.Context) {
+	codes, err := services.SearchICD10(c, c.Query("q"), c.Query("limit"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(codes))
+}
+
+func CreateProblem(c *gin.Context) {
+	patientId := c.Param("patientId")
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	code, err := services.CreateProblem(c, patientId, data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(code))
+}
+
+func UpdateProblem(c *gin.Context) {
+	problemId := c.Param("problemId")
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	problem, err := services.UpdateProblem(c, problemId, data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(problem))
+}
+
+/*
+* Optional query param status(ACTIVE, INACTIVE, RESOLVED)
+ */
+func FetchProblems(c *gin.Context) {
+	problems, err := services.FetchProblems(c, c.Param("patientId"), c.Query("status"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(problems))
+}
+
+/*
+* Optional query params from and to(YYYY-MM-DD), icdCode(prefix), type and status
+ */
+func DiagnosisReport(c *gin.Context) {
+	query := map[string]string{
+		"from":    c.Query("from"),
+		"to":      c.Query("to"),
+		"icdCode": c.Query("icdCode"),
+		"type":    c.Query("type"),
+		"status":  c.Query("status"),
+	}
+	report, err := services.DiagnosisReport(c, query)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(report))
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"HealthHub360/services"
+
+	authorization "github.com/KanapuramVaishnavi/Core/config/authorization"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Discharge(router *gin.Engine) {
+	discharge := router.Group("/discharge")
+	discharge.POST("/create/:patientId", authorization.Authorize("medicalRecord", "update"), CreateDischarge)
+	discharge.GET("/fetch/:dischargeId", authorization.Authorize("medicalRecord", "view"), FetchDischarge)
+	discharge.GET("/fetchAll/:patientId", authorization.Authorize("medicalRecord", "view"), FetchDischarges)
+	discharge.GET("/pdf/:dischargeId", authorization.Authorize("medicalRecord", "view"), GenerateDischargeSummaryPDF)
+}
+
+/*
+* Public routes, registered before the JWT middleware
+ */
+func DischargeVerification(router *gin.Engine) {
+	router.GET("/verify/discharge/:dischargeId", VerifyDischarge)
+}
+
+/*
+* Body {dischargeType, dischargeAt, referredTo, causeOfDeath, finalDiagnoses, procedures,
+* conditionAtDischarge, medications, allergyOverrideReason, followUpAdvice, followUpDate}
+ */
+func CreateDischarge(c *gin.Context) {
+	patientId := c.Param("patientId")
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	discharge, err := services.CreateDischarge(c, patientId, data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(discharge))
+}
+
+func FetchDischarge(c *gin.Context) {
+	discharge, err := services.FetchDischarge(c, c.Param("dischargeId"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(discharge))
+}
+
+func FetchDischarges(c *gin.Context) {
+	discharges, err := services.FetchDischarges(c, c.Param("patientId"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(discharges))
+}
+
+func GenerateDischargeSummaryPDF(c *gin.Context) {
+	files, err := services.GenerateDischargeSummaryPDF(c, c.Param("dischargeId"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(files))
+}
+
+/*
+* token is the query param printed in the QR code along with the dischargeId
+ */
+func VerifyDischarge(c *gin.Context) {
+	result, err := services.VerifyDischarge(c, c.Param("dischargeId"), c.Query("token"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(result))
+}
@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"HealthHub360/fhir"
+	"HealthHub360/services"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	authorization "github.com/KanapuramVaishnavi/Core/config/authorization"
+
+	"github.com/gin-gonic/gin"
+)
+
+/*
+* FHIR R4 endpoints for the health exchanges, the resources are returned as they are(application/fhir+json)
+* and the errors as an OperationOutcome instead of the usual response wrapper
+ */
+func FHIR(router *gin.Engine) {
+	fhirRoutes := router.Group("/fhir")
+	fhirRoutes.POST("", authorization.Authorize("patient", "create"), ImportFHIRBundle)
+	fhirRoutes.GET("/Patient/:id", authorization.Authorize("patient", "view"), FetchFHIRPatient)
+	fhirRoutes.GET("/Patient/:id/$everything", authorization.Authorize("patient", "view"), ExportFHIRPatientBundle)
+	fhirRoutes.GET("/Practitioner/:id", authorization.Authorize("doctor", "view"), FetchFHIRPractitioner)
+	fhirRoutes.GET("/Encounter", authorization.Authorize("appointment", "view"), searchFHIR(fhir.ResourceEncounter))
+	fhirRoutes.GET("/Encounter/:id", authorization.Authorize("appointment", "view"), FetchFHIREncounter)
+	fhirRoutes.GET("/Observation", authorization.Authorize("medicalRecord", "view"), searchFHIR(fhir.ResourceObservation))
+	fhirRoutes.GET("/Observation/:id", authorization.Authorize("medicalRecord", "view"), FetchFHIRObservation)
+	fhirRoutes.GET("/MedicationRequest", authorization.Authorize("prescription", "view"), searchFHIR(fhir.ResourceMedicationRequest))
+	fhirRoutes.GET("/MedicationRequest/:id", authorization.Authorize("prescription", "view"), FetchFHIRMedicationRequest)
+	fhirRoutes.GET("/DiagnosticReport", authorization.Authorize("testReport", "view"), searchFHIR(fhir.ResourceDiagnosticReport))
+	fhirRoutes.GET("/DiagnosticReport/:id", authorization.Authorize("testReport", "view"), FetchFHIRDiagnosticReport)
+	fhirRoutes.GET("/Consent", authorization.Authorize("consent", "view"), searchFHIR(fhir.ResourceConsent))
+	fhirRoutes.GET("/Consent/:id", authorization.Authorize("consent", "view"), FetchFHIRConsent)
+	fhirRoutes.GET("/Invoice", authorization.Authorize("bill", "view"), searchFHIR(fhir.ResourceInvoice))
+	fhirRoutes.GET("/Invoice/:id", authorization.Authorize("bill", "view"), FetchFHIRInvoice)
+}
+
+func sendFHIR(c *gin.Context, status int, resource interface{}) {
+	body, err := json.Marshal(resource)
+	if err != nil {
+		sendFHIRError(c, err)
+		return
+	}
+	c.Data(status, fhir.ContentType, body)
+}
+
+func sendFHIRError(c *gin.Context, err error) {
+	body, _ := json.Marshal(fhir.NewOperationOutcome("error", "processing", err.Error()))
+	c.Data(http.StatusBadRequest, fhir.ContentType, body)
+}
+
+/*
+* Search by the patient(?patient=<patientId>), MedicationRequest also by ?prescription=<prescriptionId>
+ */
+func searchFHIR(resourceType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := map[string]string{
+			"patient":      c.Query("patient"),
+			"prescription": c.Query("prescription"),
+		}
+		bundle, err := services.SearchFHIRResources(c, resourceType, query)
+		if err != nil {
+			sendFHIRError(c, err)
+			return
+		}
+		sendFHIR(c, http.StatusOK, bundle)
+	}
+}
+
+func FetchFHIRPatient(c *gin.Context) {
+	resource, err := services.FetchFHIRPatient(c, c.Param("id"))
+	if err != nil {
+		sendFHIRError(c, err)
+		return
+	}
+	sendFHIR(c, http.StatusOK, resource)
+}
+
+func ExportFHIRPatientBundle(c *gin.Context) {
+	bundle, err := services.ExportFHIRPatientBundle(c, c.Param("id"))
+	if err != nil {
+		sendFHIRError(c, err)
+		return
+	}
+	sendFHIR(c, http.StatusOK, bundle)
+}
+
+func FetchFHIRPractitioner(c *gin.Context) {
+	resource, err := services.FetchFHIRPractitioner(c, c.Param("id"))
+	if err != nil {
+		sendFHIRError(c, err)
+		return
+	}
+	sendFHIR(c, http.StatusOK, resource)
+}
+
+func FetchFHIREncounter(c *gin.Context) {
+	resource, err := services.FetchFHIREncounter(c, c.Param("id"))
+	if err != nil {
+		sendFHIRError(c, err)
+		return
+	}
+	sendFHIR(c, http.StatusOK, resource)
+}
+
+func FetchFHIRObservation(c *gin.Context) {
+	resource, err := services.FetchFHIRObservation(c, c.Param("id"))
+	if err != nil {
+		sendFHIRError(c, err)
+		return
+	}
+	sendFHIR(c, http.StatusOK, resource)
+}
+
+func FetchFHIRMedicationRequest(c *gin.Context) {
+	resource, err := services.FetchFHIRMedicationRequest(c, c.Param("id"))
+	if err != nil {
+		sendFHIRError(c, err)
+		return
+	}
+	sendFHIR(c, http.StatusOK, resource)
+}
+
+func FetchFHIRDiagnosticReport(c *gin.Context) {
+	resource, err := services.FetchFHIRDiagnosticReport(c, c.Param("id"))
+	if err != nil {
+		sendFHIRError(c, err)
+		return
+	}
+	sendFHIR(c, http.StatusOK, resource)
+}
+
+func FetchFHIRConsent(c *gin.Context) {
+	resource, err := services.FetchFHIRConsent(c, c.Param("id"))
+	if err != nil {
+		sendFHIRError(c, err)
+		return
+	}
+	sendFHIR(c, http.StatusOK, resource)
+}
+
+func FetchFHIRInvoice(c *gin.Context) {
+	resource, err := services.FetchFHIRInvoice(c, c.Param("id"))
+	if err != nil {
+		sendFHIRError(c, err)
+		return
+	}
+	sendFHIR(c, http.StatusOK, resource)
+}
+
+/*
+* Bundle of Patient resources in the body
+* Query params roleCode(patient role) and guardianRoleCode are needed when a patient is created
+ */
+func ImportFHIRBundle(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		sendFHIRError(c, err)
+		return
+	}
+	query := map[string]string{
+		"roleCode":         c.Query("roleCode"),
+		"guardianRoleCode": c.Query("guardianRoleCode"),
+	}
+	response, err := services.ImportFHIRBundle(c, body, query)
+	if err != nil {
+		sendFHIRError(c, err)
+		return
+	}
+	sendFHIR(c, http.StatusOK, response)
+}
@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"HealthHub360/services"
+	"errors"
+	"io"
+	"strings"
+
+	authorization "github.com/KanapuramVaishnavi/Core/config/authorization"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func HL7(router *gin.Engine) {
+	hl7 := router.Group("/hl7")
+	hl7.POST("/mapping/create", authorization.Authorize("test", "create"), CreateHL7Mapping)
+	hl7.GET("/mapping/fetchAll", authorization.Authorize("test", "view"), FetchHL7Mappings)
+	hl7.DELETE("/mapping/delete/:code", authorization.Authorize("test", "delete"), DeleteHL7Mapping)
+	hl7.POST("/sender/create", authorization.Authorize("test", "create"), CreateHL7Sender)
+	hl7.GET("/sender/fetchAll", authorization.Authorize("test", "view"), FetchHL7Senders)
+	hl7.DELETE("/sender/delete/:code", authorization.Authorize("test", "delete"), DeleteHL7Sender)
+	hl7.POST("/import", authorization.Authorize("testReport", "update"), ImportHL7Message)
+	hl7.GET("/errors/fetchAll", authorization.Authorize("testReport", "view"), FetchHL7Errors)
+	hl7.POST("/errors/retry/:code", authorization.Authorize("testReport", "update"), RetryHL7Error)
+	hl7.POST("/errors/discard/:code", authorization.Authorize("testReport", "update"), DiscardHL7Error)
+	hl7.GET("/orm/:testReportId", authorization.Authorize("testReport", "view"), ExportLabOrderORM)
+}
+
+/*
+* Bind the mapping({source, externalCode, testId, analyteCode}) and pass to the service
+ */
+func CreateHL7Mapping(c *gin.Context) {
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	mapping, err := services.CreateHL7Mapping(c, data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(mapping))
+}
+
+func FetchHL7Mappings(c *gin.Context) {
+	mappings, err := services.FetchHL7Mappings(c)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(mappings))
+}
+
+func DeleteHL7Mapping(c *gin.Context) {
+	code := c.Param("code")
+	if err := services.DeleteHL7Mapping(c, code); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse("Code mapping deleted successfully"))
+}
+
+/*
+* Bind the sender({application, facility, hospitalId}) and pass to the service
+ */
+func CreateHL7Sender(c *gin.Context) {
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	sender, err := services.CreateHL7Sender(c, data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(sender))
+}
+
+func FetchHL7Senders(c *gin.Context) {
+	senders, err := services.FetchHL7Senders(c)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(senders))
+}
+
+func DeleteHL7Sender(c *gin.Context) {
+	code := c.Param("code")
+	if err := services.DeleteHL7Sender(c, code); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse("HL7 sender deleted successfully"))
+}
+
+/*
+* Raw HL7 message in the body(for the systems which cannot use MLLP), the ACK is returned as text
+ */
+func ImportHL7Message(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	if strings.TrimSpace(string(body)) == "" {
+		c.JSON(400, util.FailedResponse(errors.New(services.HL7_MESSAGE_REQUIRED)))
+		return
+	}
+	ack := services.ProcessHL7Message(c, string(body), services.HL7_VIA_HTTP)
+	c.String(200, ack)
+}
+
+/*
+* Optional query param status(PENDING, RESOLVED, DISCARDED)
+ */
+func FetchHL7Errors(c *gin.Context) {
+	errs, err := services.FetchHL7Errors(c, c.Query("status"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(errs))
+}
+
+func RetryHL7Error(c *gin.Context) {
+	code := c.Param("code")
+	entry, err := services.RetryHL7Error(c, code)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(entry))
+}
+
+/*
+* Bind the reason and pass to the service
+ */
+func DiscardHL7Error(c *gin.Context) {
+	code := c.Param("code")
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	entry, err := services.DiscardHL7Error(c, code, data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(entry))
+}
+
+func ExportLabOrderORM(c *gin.Context) {
+	testReportId := c.Param("testReportId")
+	response, err := services.ExportLabOrderORM(c, testReportId)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(response))
+}
@@ -16,6 +16,8 @@ func MedicalRecord(c *gin.Engine) {
 		medicalRecord.GET("/fetchAll", authorization.Authorize("medicalRecord", "view"), FetchAllMedicalRecords)
 		medicalRecord.PATCH("/update/:medicalRecordId", authorization.Authorize("medicalRecord", "update"), UpdateMedicalRecord)
 		medicalRecord.DELETE("/delete/:medicalRecordId", authorization.Authorize("medicalRecord", "delete"), DeleteMedicalRecordByCode)
+		medicalRecord.GET("/history/:medicalRecordId", authorization.Authorize("medicalRecord", "view"), FetchMedicalRecordHistory)
+		medicalRecord.GET("/asOf/:medicalRecordId", authorization.Authorize("medicalRecord", "view"), FetchMedicalRecordAt)
 	}
 }
 
@@ -62,3 +64,32 @@ func DeleteMedicalRecordByCode(c *gin.Context) {
 	}
 	c.JSON(200, util.SuccessResponse(data))
 }
+
+/*
+* Optional query params field and the date range from/to(YYYY-MM-DD)
+ */
+func FetchMedicalRecordHistory(c *gin.Context) {
+	query := map[string]string{
+		"field": c.Query("field"),
+		"from":  c.Query("from"),
+		"to":    c.Query("to"),
+	}
+	history, err := services.FetchMedicalRecordHistory(c, c.Param("medicalRecordId"), query)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(history))
+}
+
+/*
+* Query param at, RFC3339 timestamp or a date YYYY-MM-DD(end of the day)
+ */
+func FetchMedicalRecordAt(c *gin.Context) {
+	record, err := services.FetchMedicalRecordAt(c, c.Param("medicalRecordId"), c.Query("at"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(record))
+}
@@ -3,6 +3,8 @@ package controllers
 import (
 	"HealthHub360/services"
 
+	"errors"
+	"io"
 	"net/http"
 
 	authorization "github.com/KanapuramVaishnavi/Core/config/authorization"
@@ -19,6 +21,10 @@ func Medicines(router *gin.Engine) {
 		medicines.GET("/fetchAll", authorization.Authorize("medicine", "view"), FetchAllMedicines)
 		medicines.PATCH("/update/:medicineCode", authorization.Authorize("medicine", "update"), UpdateMedicines)
 		medicines.DELETE("/delete/:medicineCode", authorization.Authorize("medicine", "delete"), DeleteMedicine)
+		medicines.POST("/import", authorization.Authorize("medicine", "create"), ImportMedicines)
+		medicines.GET("/export", authorization.Authorize("medicine", "view"), ExportMedicines)
+		medicines.GET("/substitutes/:medicineCode", authorization.Authorize("medicine", "view"), FetchMedicineSubstitutes)
+		medicines.PATCH("/restock/:medicineCode", authorization.Authorize("medicine", "update"), RestockMedicine)
 	}
 }
 func CreateMedicines(c *gin.Context) {
@@ -78,3 +84,77 @@ func DeleteMedicine(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, util.SuccessResponse(msg))
 }
+
+/*
+* Read the uploaded csv/xlsx file from the form field "file"
+* dryRun=true only validates the rows without saving
+ */
+func ImportMedicines(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, services.MAX_IMPORT_FILE_SIZE+(1<<20))
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.FailedResponse(err))
+		return
+	}
+	if fileHeader.Size > services.MAX_IMPORT_FILE_SIZE {
+		c.JSON(http.StatusBadRequest, util.FailedResponse(errors.New(services.IMPORT_FILE_TOO_LARGE)))
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.FailedResponse(err))
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(io.LimitReader(file, services.MAX_IMPORT_FILE_SIZE+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.FailedResponse(err))
+		return
+	}
+	if int64(len(content)) > services.MAX_IMPORT_FILE_SIZE {
+		c.JSON(http.StatusBadRequest, util.FailedResponse(errors.New(services.IMPORT_FILE_TOO_LARGE)))
+		return
+	}
+	dryRun := c.Query("dryRun") == "true"
+	result, err := services.ImportMedicines(c, fileHeader.Filename, content, dryRun)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.FailedResponse(err))
+		return
+	}
+	c.JSON(http.StatusOK, util.SuccessResponse(result))
+}
+
+func ExportMedicines(c *gin.Context) {
+	content, err := services.ExportMedicines(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.FailedResponse(err))
+		return
+	}
+	c.Header("Content-Disposition", "attachment; filename=medicines.csv")
+	c.Data(http.StatusOK, "text/csv", content)
+}
+
+func FetchMedicineSubstitutes(c *gin.Context) {
+	medicineId := c.Param("medicineCode")
+	substitutes, err := services.FetchMedicineSubstitutes(c, medicineId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.FailedResponse(err))
+		return
+	}
+	c.JSON(http.StatusOK, util.SuccessResponse(substitutes))
+}
+
+func RestockMedicine(c *gin.Context) {
+	medicineId := c.Param("medicineCode")
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, util.FailedResponse(err))
+		return
+	}
+	msg, err := services.RestockMedicine(c, medicineId, data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.FailedResponse(err))
+		return
+	}
+	c.JSON(http.StatusOK, util.SuccessResponse(msg))
+}
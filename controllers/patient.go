@@ -19,6 +19,7 @@ func Patient(router *gin.Engine) {
 		patient.PATCH("/update/:patientId", authorization.Authorize("patient", "update"), UpdatePatientByCode)
 		patient.GET("/fetchAll", authorization.Authorize("patient", "view"), FetchAllPatients)
 		patient.DELETE("/delete/:patientId", authorization.Authorize("patient", "delete"), DeletePatient)
+		patient.GET("/timeline/:patientId", authorization.Authorize("patient", "view"), FetchPatientTimeline)
 	}
 }
 
@@ -80,3 +81,22 @@ func DeletePatient(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, util.SuccessResponse(msg))
 }
+
+/*
+* Query params types(comma separated), from/to(YYYY-MM-DD), page and pageSize
+ */
+func FetchPatientTimeline(c *gin.Context) {
+	query := map[string]string{
+		"types":    c.Query("types"),
+		"from":     c.Query("from"),
+		"to":       c.Query("to"),
+		"page":     c.Query("page"),
+		"pageSize": c.Query("pageSize"),
+	}
+	timeline, err := services.FetchPatientTimeline(c, c.Param("patientId"), query)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(timeline))
+}
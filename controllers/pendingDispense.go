@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"HealthHub360/services"
+
+	authorization "github.com/KanapuramVaishnavi/Core/config/authorization"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func PendingDispense(router *gin.Engine) {
+	pending := router.Group("/pendingDispense")
+	pending.GET("/fetchAll", authorization.Authorize("bill", "view"), FetchAllPendingDispenses)
+	pending.GET("/fetch/:patientId", authorization.Authorize("bill", "view"), FetchPendingDispensesOfPatient)
+	pending.POST("/dispense/:patientId", authorization.Authorize("bill", "create"), DispensePendingMedicines)
+}
+
+/*
+* Optional query params patientId and status filter the queue
+ */
+func FetchAllPendingDispenses(c *gin.Context) {
+	result, err := services.FetchAllPendingDispenses(c, c.Query("patientId"), c.Query("status"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(result))
+}
+
+func FetchPendingDispensesOfPatient(c *gin.Context) {
+	patientId := c.Param("patientId")
+	result, err := services.FetchAllPendingDispenses(c, patientId, c.Query("status"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(result))
+}
+
+func DispensePendingMedicines(c *gin.Context) {
+	patientId := c.Param("patientId")
+	result, err := services.DispensePendingMedicines(c, patientId)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(result))
+}
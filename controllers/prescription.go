@@ -18,9 +18,23 @@ func Prescription(router *gin.Engine) {
 		prescription.GET("/fetch/:prescriptionId", authorization.Authorize("prescription", "view"), FetchPrescriptionByCode)
 		prescription.GET("/fetchAll", authorization.Authorize("prescription", "view"), FetchAllPrescriptions)
 		prescription.PATCH("/update/:prescriptionId/:medicineId", authorization.Authorize("prescription", "update"), UpdatePrescription)
+		prescription.PATCH("/amend/:prescriptionId", authorization.Authorize("prescription", "update"), AmendPrescription)
+		prescription.GET("/versions/:prescriptionId", authorization.Authorize("prescription", "view"), FetchPrescriptionVersions)
+		prescription.GET("/diff/:prescriptionId", authorization.Authorize("prescription", "view"), DiffPrescriptionVersions)
+		prescription.GET("/pdf/:prescriptionId", authorization.Authorize("prescription", "view"), GeneratePrescriptionPDF)
+		prescription.GET("/signingKey", authorization.Authorize("prescription", "create"), FetchSigningKey)
+		prescription.POST("/signingKey/rotate", authorization.Authorize("prescription", "create"), RotateSigningKey)
 		prescription.DELETE("/delete/:prescriptionId", authorization.Authorize("prescription", "delete"), DeletePrescriptionByCode)
 	}
 }
+
+/*
+* Public route used by the pharmacies to verify a printed prescription(from the QR code)
+ */
+func PrescriptionVerification(router *gin.Engine) {
+	router.GET("/verify/prescription/:prescriptionId", VerifyPrescription)
+}
+
 func CreatePrescription(c *gin.Context) {
 	medicalRecordId := c.Param("medicalRecordId")
 	data := make(map[string]interface{})
@@ -71,6 +85,85 @@ func UpdatePrescription(c *gin.Context) {
 	c.JSON(http.StatusOK, util.SuccessResponse(msg))
 }
 
+func AmendPrescription(c *gin.Context) {
+	prescriptionId := c.Param("prescriptionId")
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, util.FailedResponse(err))
+		return
+	}
+	msg, err := services.AmendPrescription(c, prescriptionId, data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.FailedResponse(err))
+		return
+	}
+	c.JSON(http.StatusOK, util.SuccessResponse(msg))
+}
+
+func FetchPrescriptionVersions(c *gin.Context) {
+	prescriptionId := c.Param("prescriptionId")
+	versions, err := services.FetchPrescriptionVersions(c, prescriptionId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.FailedResponse(err))
+		return
+	}
+	c.JSON(http.StatusOK, util.SuccessResponse(versions))
+}
+
+/*
+* Optional query param against compares with that version instead of the previous one
+ */
+func DiffPrescriptionVersions(c *gin.Context) {
+	prescriptionId := c.Param("prescriptionId")
+	diff, err := services.DiffPrescriptionVersions(c, prescriptionId, c.Query("against"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.FailedResponse(err))
+		return
+	}
+	c.JSON(http.StatusOK, util.SuccessResponse(diff))
+}
+
+func GeneratePrescriptionPDF(c *gin.Context) {
+	prescriptionId := c.Param("prescriptionId")
+	files, err := services.GeneratePrescriptionPDF(c, prescriptionId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.FailedResponse(err))
+		return
+	}
+	c.JSON(http.StatusOK, util.SuccessResponse(files))
+}
+
+func FetchSigningKey(c *gin.Context) {
+	signingKey, err := services.FetchSigningKey(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.FailedResponse(err))
+		return
+	}
+	c.JSON(http.StatusOK, util.SuccessResponse(signingKey))
+}
+
+func RotateSigningKey(c *gin.Context) {
+	signingKey, err := services.RotateSigningKey(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.FailedResponse(err))
+		return
+	}
+	c.JSON(http.StatusOK, util.SuccessResponse(signingKey))
+}
+
+/*
+* token is the query param printed in the QR code along with the prescriptionId
+ */
+func VerifyPrescription(c *gin.Context) {
+	prescriptionId := c.Param("prescriptionId")
+	result, err := services.VerifyPrescription(c, prescriptionId, c.Query("token"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, util.FailedResponse(err))
+		return
+	}
+	c.JSON(http.StatusOK, util.SuccessResponse(result))
+}
+
 func DeletePrescriptionByCode(c *gin.Context) {
 	prescripitonId := c.Param("prescriptionId")
 	data, err := services.DeletePrescriptionByCode(c, prescripitonId)
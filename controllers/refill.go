@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"HealthHub360/services"
+
+	authorization "github.com/KanapuramVaishnavi/Core/config/authorization"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Refill(router *gin.Engine) {
+	refill := router.Group("/refill")
+	refill.GET("/status/:prescriptionId", authorization.Authorize("prescription", "view"), FetchRefillStatus)
+	refill.POST("/dispense/:prescriptionId", authorization.Authorize("bill", "create"), DispenseRefill)
+}
+
+func FetchRefillStatus(c *gin.Context) {
+	prescriptionId := c.Param("prescriptionId")
+	result, err := services.FetchRefillStatus(c, prescriptionId)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(result))
+}
+
+func DispenseRefill(c *gin.Context) {
+	prescriptionId := c.Param("prescriptionId")
+	result, err := services.DispenseRefill(c, prescriptionId)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(result))
+}
@@ -15,6 +15,26 @@ func TestReport(router *gin.Engine) {
 	test := router.Group("/testReport")
 	test.POST("/create/:patientId", authorization.Authorize("testReport", "create"), CreateTestReport)
 	test.GET("/fetch/:testReportId", authorization.Authorize("testReport", "view"), FetchTestReportByCode)
+	test.GET("/fetchAll", authorization.Authorize("testReport", "view"), FetchAllTestReports)
+	test.GET("/trend/:patientId/:analyteCode", authorization.Authorize("testReport", "view"), FetchAnalyteTrend)
+	test.PATCH("/results/:testReportId", authorization.Authorize("testReport", "update"), EnterTestResults)
+	test.POST("/verify/:testReportId", authorization.Authorize("testReport", "verify"), VerifyTestResults)
+	test.POST("/reject/:testReportId", authorization.Authorize("testReport", "verify"), RejectTestResults)
+	test.POST("/collect/:testReportId", authorization.Authorize("testReport", "update"), CollectSample)
+	test.POST("/receive/:accessionNo", authorization.Authorize("testReport", "update"), ReceiveSample)
+	test.POST("/process/:accessionNo", authorization.Authorize("testReport", "update"), StartSampleProcessing)
+	test.POST("/rejectSample/:accessionNo", authorization.Authorize("testReport", "update"), RejectSample)
+	test.GET("/label/:accessionNo", authorization.Authorize("testReport", "view"), GenerateSpecimenLabel)
+	test.GET("/worklist", authorization.Authorize("testReport", "view"), FetchLabWorklist)
+	test.GET("/pdf/:testReportId", authorization.Authorize("testReport", "view"), GenerateLabReportPDF)
+	test.GET("/orderPdf/:medicalRecordId", authorization.Authorize("testReport", "view"), GenerateLabOrderPDF)
+}
+
+/*
+* Public route to verify a printed lab report(from the QR code)
+ */
+func LabReportVerification(router *gin.Engine) {
+	router.GET("/verify/labReport/:testReportId", VerifyLabReport)
 }
 
 /*
@@ -34,10 +54,189 @@ func CreateTestReport(c *gin.Context) {
 
 func FetchTestReportByCode(c *gin.Context) {
 	testReportId := c.Param("testReportId")
-	testReport, err := services.FetchTestByCode(c, testReportId)
+	testReport, err := services.FetchTestReportByCode(c, testReportId)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(testReport))
+}
+
+/*
+* Optional query params patientId, testId, status, medicalRecordId, from and to(YYYY-MM-DD)
+ */
+func FetchAllTestReports(c *gin.Context) {
+	query := map[string]string{}
+	for _, field := range []string{"patientId", "testId", "status", "medicalRecordId", "from", "to"} {
+		query[field] = c.Query(field)
+	}
+	testReports, err := services.FetchAllTestReports(c, query)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(testReports))
+}
+
+func FetchAnalyteTrend(c *gin.Context) {
+	patientId := c.Param("patientId")
+	analyteCode := c.Param("analyteCode")
+	trend, err := services.FetchAnalyteTrend(c, patientId, analyteCode)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(trend))
+}
+
+/*
+* Bind the results({analyteCode, value, comment}) and pass to the service
+ */
+func EnterTestResults(c *gin.Context) {
+	testReportId := c.Param("testReportId")
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	testReport, err := services.EnterTestResults(c, testReportId, data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(testReport))
+}
+
+func VerifyTestResults(c *gin.Context) {
+	testReportId := c.Param("testReportId")
+	testReport, err := services.VerifyTestResults(c, testReportId)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(testReport))
+}
+
+/*
+* Bind the reason and pass to the service
+ */
+func RejectTestResults(c *gin.Context) {
+	testReportId := c.Param("testReportId")
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	testReport, err := services.RejectTestResults(c, testReportId, data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(testReport))
+}
+
+func CollectSample(c *gin.Context) {
+	testReportId := c.Param("testReportId")
+	testReport, err := services.CollectSample(c, testReportId)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(testReport))
+}
+
+func ReceiveSample(c *gin.Context) {
+	accessionNo := c.Param("accessionNo")
+	testReport, err := services.ReceiveSample(c, accessionNo)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(testReport))
+}
+
+func StartSampleProcessing(c *gin.Context) {
+	accessionNo := c.Param("accessionNo")
+	testReport, err := services.StartSampleProcessing(c, accessionNo)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(testReport))
+}
+
+/*
+* Bind the reason(HEMOLYSED, INSUFFICIENT...) and an optional note
+ */
+func RejectSample(c *gin.Context) {
+	accessionNo := c.Param("accessionNo")
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	testReport, err := services.RejectSample(c, accessionNo, data)
 	if err != nil {
 		c.JSON(400, util.FailedResponse(err))
 		return
 	}
 	c.JSON(200, util.SuccessResponse(testReport))
 }
+
+func GenerateSpecimenLabel(c *gin.Context) {
+	accessionNo := c.Param("accessionNo")
+	files, err := services.GenerateSpecimenLabel(c, accessionNo)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(files))
+}
+
+/*
+* Optional query params status and specimenType
+ */
+func FetchLabWorklist(c *gin.Context) {
+	worklist, err := services.FetchLabWorklist(c, c.Query("status"), c.Query("specimenType"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(worklist))
+}
+
+/*
+* Optional query param sign=true adds the digital signature of the verifier
+ */
+func GenerateLabReportPDF(c *gin.Context) {
+	testReportId := c.Param("testReportId")
+	files, err := services.GenerateLabReportPDF(c, testReportId, c.Query("sign") == "true")
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(files))
+}
+
+func GenerateLabOrderPDF(c *gin.Context) {
+	medicalRecordId := c.Param("medicalRecordId")
+	files, err := services.GenerateLabOrderPDF(c, medicalRecordId, c.Query("sign") == "true")
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(files))
+}
+
+/*
+* token is the query param printed in the QR code along with the testReportId
+ */
+func VerifyLabReport(c *gin.Context) {
+	testReportId := c.Param("testReportId")
+	result, err := services.VerifyLabReport(c, testReportId, c.Query("token"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(result))
+}
@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"HealthHub360/services"
+
+	authorization "github.com/KanapuramVaishnavi/Core/config/authorization"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Vitals(router *gin.Engine) {
+	vitals := router.Group("/vitals")
+	vitals.POST("/record/:medicalRecordId", authorization.Authorize("medicalRecord", "update"), RecordVitals)
+	vitals.GET("/trend/:patientId", authorization.Authorize("medicalRecord", "view"), FetchVitalsTrend)
+	vitals.GET("/earlyWarning", authorization.Authorize("medicalRecord", "view"), FetchEarlyWarningBoard)
+}
+
+/*
+* Bind the readings and pass to the service
+ */
+func RecordVitals(c *gin.Context) {
+	medicalRecordId := c.Param("medicalRecordId")
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	vitals, err := services.RecordVitals(c, medicalRecordId, data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(vitals))
+}
+
+/*
+* Optional query params parameters(comma separated), from and to(YYYY-MM-DD)
+ */
+func FetchVitalsTrend(c *gin.Context) {
+	patientId := c.Param("patientId")
+	trend, err := services.FetchVitalsTrend(c, patientId, c.Query("parameters"), c.Query("from"), c.Query("to"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(trend))
+}
+
+func FetchEarlyWarningBoard(c *gin.Context) {
+	board, err := services.FetchEarlyWarningBoard(c)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(board))
+}
@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"HealthHub360/services"
+
+	authorization "github.com/KanapuramVaishnavi/Core/config/authorization"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Ward(router *gin.Engine) {
+	ward := router.Group("/ward")
+	ward.POST("/create", authorization.Authorize("bed", "create"), CreateWard)
+	ward.POST("/room/create/:wardId", authorization.Authorize("bed", "create"), CreateRoom)
+	ward.POST("/bed/create/:roomId", authorization.Authorize("bed", "create"), CreateBed)
+	ward.PATCH("/bed/status/:bedId", authorization.Authorize("bed", "update"), UpdateBedStatus)
+	ward.GET("/fetchAll", authorization.Authorize("bed", "view"), FetchWards)
+	ward.GET("/board", authorization.Authorize("bed", "view"), FetchBedBoard)
+	ward.GET("/census", authorization.Authorize("bed", "view"), FetchCensus)
+}
+
+/*
+* Admission, transfer and discharge of the inpatients
+* Discharge is done with the discharge summary(/discharge/create), which frees the bed
+ */
+func ADT(router *gin.Engine) {
+	adt := router.Group("/adt")
+	adt.POST("/admit/:patientId", authorization.Authorize("bed", "update"), AdmitPatient)
+	adt.POST("/transfer/:patientId", authorization.Authorize("bed", "update"), TransferPatient)
+	adt.GET("/history/:patientId", authorization.Authorize("bed", "view"), FetchBedHistory)
+}
+
+/*
+* Body {name, wardType, floor, dailyTariff}
+ */
+func CreateWard(c *gin.Context) {
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	ward, err := services.CreateWard(c, data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(ward))
+}
+
+/*
+* Body {roomNo, roomType, dailyTariff}
+ */
+func CreateRoom(c *gin.Context) {
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	room, err := services.CreateRoom(c, c.Param("wardId"), data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(room))
+}
+
+/*
+* Body {bedNo, bedType, dailyTariff}
+ */
+func CreateBed(c *gin.Context) {
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	bed, err := services.CreateBed(c, c.Param("roomId"), data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(bed))
+}
+
+/*
+* Body {status} AVAILABLE or MAINTENANCE
+ */
+func UpdateBedStatus(c *gin.Context) {
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	bed, err := services.UpdateBedStatus(c, c.Param("bedId"), data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(bed))
+}
+
+func FetchWards(c *gin.Context) {
+	wards, err := services.FetchWards(c)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(wards))
+}
+
+/*
+* Query params(optional) wardId, bedType, status
+ */
+func FetchBedBoard(c *gin.Context) {
+	query := map[string]string{
+		"wardId":  c.Query("wardId"),
+		"bedType": c.Query("bedType"),
+		"status":  c.Query("status"),
+	}
+	board, err := services.FetchBedBoard(c, query)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(board))
+}
+
+/*
+* Query param date(YYYY-MM-DD), defaults to today
+ */
+func FetchCensus(c *gin.Context) {
+	census, err := services.FetchCensus(c, c.Query("date"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(census))
+}
+
+/*
+* Body {bedId, admissionDate}
+ */
+func AdmitPatient(c *gin.Context) {
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	assignment, err := services.AdmitPatient(c, c.Param("patientId"), data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(assignment))
+}
+
+/*
+* Body {bedId, reason}
+ */
+func TransferPatient(c *gin.Context) {
+	data := make(map[string]interface{})
+	if err := c.BindJSON(&data); err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	assignment, err := services.TransferPatient(c, c.Param("patientId"), data)
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(assignment))
+}
+
+func FetchBedHistory(c *gin.Context) {
+	history, err := services.FetchBedHistory(c, c.Param("patientId"))
+	if err != nil {
+		c.JSON(400, util.FailedResponse(err))
+		return
+	}
+	c.JSON(200, util.SuccessResponse(history))
+}
@@ -0,0 +1,473 @@
+package fhir
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+/*
+* Minimal HL7 FHIR R4 resources used for the exchange with the health exchanges
+* Only the elements we can fill from our documents are modelled, everything is JSON(application/fhir+json)
+ */
+
+const (
+	ContentType = "application/fhir+json"
+	Version     = "4.0.1"
+
+	ResourcePatient           = "Patient"
+	ResourcePractitioner      = "Practitioner"
+	ResourceEncounter         = "Encounter"
+	ResourceObservation       = "Observation"
+	ResourceMedicationRequest = "MedicationRequest"
+	ResourceDiagnosticReport  = "DiagnosticReport"
+	ResourceConsent           = "Consent"
+	ResourceInvoice           = "Invoice"
+	ResourceBundle            = "Bundle"
+	ResourceOperationOutcome  = "OperationOutcome"
+
+	BundleCollection          = "collection"
+	BundleSearchSet           = "searchset"
+	BundleTransaction         = "transaction"
+	BundleBatch               = "batch"
+	BundleTransactionResponse = "transaction-response"
+	BundleBatchResponse       = "batch-response"
+
+	SystemLOINC         = "http://loinc.org"
+	SystemUCUM          = "http://unitsofmeasure.org"
+	SystemActCode       = "http://terminology.hl7.org/CodeSystem/v3-ActCode"
+	SystemObsCategory   = "http://terminology.hl7.org/CodeSystem/observation-category"
+	SystemInterpret     = "http://terminology.hl7.org/CodeSystem/v3-ObservationInterpretation"
+	SystemConsentScope  = "http://terminology.hl7.org/CodeSystem/consentscope"
+	SystemConsentCat    = "http://loinc.org"
+	SystemDiagService   = "http://terminology.hl7.org/CodeSystem/v2-0074"
+	SystemRoleCode      = "http://terminology.hl7.org/CodeSystem/v3-RoleCode"
+	SystemParticipation = "http://terminology.hl7.org/CodeSystem/v3-ParticipationType"
+	SystemICD10         = "http://hl7.org/fhir/sid/icd-10"
+
+	// DateTimeFormat is the FHIR dateTime/instant with the timezone
+	DateTimeFormat = time.RFC3339
+	DateFormat     = "2006-01-02"
+)
+
+var (
+	ErrNotBundle   = errors.New("resourceType must be Bundle")
+	ErrEmptyBundle = errors.New("bundle has no entries")
+)
+
+type Meta struct {
+	VersionID   string   `json:"versionId,omitempty"`
+	LastUpdated string   `json:"lastUpdated,omitempty"`
+	Profile     []string `json:"profile,omitempty"`
+}
+
+type Identifier struct {
+	Use    string `json:"use,omitempty"`
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+type HumanName struct {
+	Use    string   `json:"use,omitempty"`
+	Text   string   `json:"text,omitempty"`
+	Family string   `json:"family,omitempty"`
+	Given  []string `json:"given,omitempty"`
+}
+
+type ContactPoint struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+	Use    string `json:"use,omitempty"`
+}
+
+type Reference struct {
+	Reference string `json:"reference,omitempty"`
+	Display   string `json:"display,omitempty"`
+}
+
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+type Period struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+type Quantity struct {
+	Value  *float64 `json:"value,omitempty"`
+	Unit   string   `json:"unit,omitempty"`
+	System string   `json:"system,omitempty"`
+	Code   string   `json:"code,omitempty"`
+}
+
+type Extension struct {
+	URL         string `json:"url"`
+	ValueString string `json:"valueString,omitempty"`
+	ValueDate   string `json:"valueDate,omitempty"`
+}
+
+type Money struct {
+	Value    float64 `json:"value"`
+	Currency string  `json:"currency,omitempty"`
+}
+
+type Patient struct {
+	ResourceType         string           `json:"resourceType"`
+	ID                   string           `json:"id,omitempty"`
+	Meta                 *Meta            `json:"meta,omitempty"`
+	Identifier           []Identifier     `json:"identifier,omitempty"`
+	Active               *bool            `json:"active,omitempty"`
+	Name                 []HumanName      `json:"name,omitempty"`
+	Telecom              []ContactPoint   `json:"telecom,omitempty"`
+	Gender               string           `json:"gender,omitempty"`
+	BirthDate            string           `json:"birthDate,omitempty"`
+	ManagingOrganization *Reference       `json:"managingOrganization,omitempty"`
+	Contact              []PatientContact `json:"contact,omitempty"`
+}
+
+/*
+* Guardians of a minor, govtId and birthDate are carried as extensions
+ */
+type PatientContact struct {
+	Extension    []Extension       `json:"extension,omitempty"`
+	Relationship []CodeableConcept `json:"relationship,omitempty"`
+	Name         *HumanName        `json:"name,omitempty"`
+	Telecom      []ContactPoint    `json:"telecom,omitempty"`
+}
+
+type Practitioner struct {
+	ResourceType string         `json:"resourceType"`
+	ID           string         `json:"id,omitempty"`
+	Meta         *Meta          `json:"meta,omitempty"`
+	Extension    []Extension    `json:"extension,omitempty"`
+	Identifier   []Identifier   `json:"identifier,omitempty"`
+	Active       *bool          `json:"active,omitempty"`
+	Name         []HumanName    `json:"name,omitempty"`
+	Telecom      []ContactPoint `json:"telecom,omitempty"`
+	Gender       string         `json:"gender,omitempty"`
+}
+
+type EncounterParticipant struct {
+	Type       []CodeableConcept `json:"type,omitempty"`
+	Individual *Reference        `json:"individual,omitempty"`
+}
+
+type Encounter struct {
+	ResourceType    string                 `json:"resourceType"`
+	ID              string                 `json:"id,omitempty"`
+	Meta            *Meta                  `json:"meta,omitempty"`
+	Identifier      []Identifier           `json:"identifier,omitempty"`
+	Status          string                 `json:"status"`
+	Class           Coding                 `json:"class"`
+	Subject         *Reference             `json:"subject,omitempty"`
+	Participant     []EncounterParticipant `json:"participant,omitempty"`
+	Period          *Period                `json:"period,omitempty"`
+	ReasonCode      []CodeableConcept      `json:"reasonCode,omitempty"`
+	ServiceProvider *Reference             `json:"serviceProvider,omitempty"`
+}
+
+type ObservationReferenceRange struct {
+	Low  *Quantity `json:"low,omitempty"`
+	High *Quantity `json:"high,omitempty"`
+	Text string    `json:"text,omitempty"`
+}
+
+type ObservationComponent struct {
+	Code          CodeableConcept `json:"code"`
+	ValueQuantity *Quantity       `json:"valueQuantity,omitempty"`
+	ValueString   string          `json:"valueString,omitempty"`
+}
+
+type Observation struct {
+	ResourceType      string                      `json:"resourceType"`
+	ID                string                      `json:"id,omitempty"`
+	Meta              *Meta                       `json:"meta,omitempty"`
+	Status            string                      `json:"status"`
+	Category          []CodeableConcept           `json:"category,omitempty"`
+	Code              CodeableConcept             `json:"code"`
+	Subject           *Reference                  `json:"subject,omitempty"`
+	Encounter         *Reference                  `json:"encounter,omitempty"`
+	EffectiveDateTime string                      `json:"effectiveDateTime,omitempty"`
+	Issued            string                      `json:"issued,omitempty"`
+	Performer         []Reference                 `json:"performer,omitempty"`
+	ValueQuantity     *Quantity                   `json:"valueQuantity,omitempty"`
+	ValueString       string                      `json:"valueString,omitempty"`
+	Interpretation    []CodeableConcept           `json:"interpretation,omitempty"`
+	ReferenceRange    []ObservationReferenceRange `json:"referenceRange,omitempty"`
+	Component         []ObservationComponent      `json:"component,omitempty"`
+}
+
+type TimingRepeat struct {
+	BoundsDuration *Quantity `json:"boundsDuration,omitempty"`
+	Frequency      int       `json:"frequency,omitempty"`
+	FrequencyMax   int       `json:"frequencyMax,omitempty"`
+	Period         float64   `json:"period,omitempty"`
+	PeriodUnit     string    `json:"periodUnit,omitempty"`
+	When           []string  `json:"when,omitempty"`
+}
+
+type Timing struct {
+	Repeat *TimingRepeat `json:"repeat,omitempty"`
+}
+
+type DoseAndRate struct {
+	DoseQuantity *Quantity `json:"doseQuantity,omitempty"`
+}
+
+type Dosage struct {
+	Sequence              int               `json:"sequence,omitempty"`
+	Text                  string            `json:"text,omitempty"`
+	PatientInstruction    string            `json:"patientInstruction,omitempty"`
+	Timing                *Timing           `json:"timing,omitempty"`
+	AsNeededBoolean       bool              `json:"asNeededBoolean,omitempty"`
+	DoseAndRate           []DoseAndRate     `json:"doseAndRate,omitempty"`
+	AdditionalInstruction []CodeableConcept `json:"additionalInstruction,omitempty"`
+}
+
+type MedicationRequest struct {
+	ResourceType              string            `json:"resourceType"`
+	ID                        string            `json:"id,omitempty"`
+	Meta                      *Meta             `json:"meta,omitempty"`
+	Identifier                []Identifier      `json:"identifier,omitempty"`
+	Status                    string            `json:"status"`
+	Intent                    string            `json:"intent"`
+	MedicationCodeableConcept CodeableConcept   `json:"medicationCodeableConcept"`
+	Subject                   Reference         `json:"subject"`
+	Encounter                 *Reference        `json:"encounter,omitempty"`
+	AuthoredOn                string            `json:"authoredOn,omitempty"`
+	Requester                 *Reference        `json:"requester,omitempty"`
+	ReasonCode                []CodeableConcept `json:"reasonCode,omitempty"`
+	GroupIdentifier           *Identifier       `json:"groupIdentifier,omitempty"`
+	DosageInstruction         []Dosage          `json:"dosageInstruction,omitempty"`
+}
+
+type DiagnosticReport struct {
+	ResourceType      string            `json:"resourceType"`
+	ID                string            `json:"id,omitempty"`
+	Meta              *Meta             `json:"meta,omitempty"`
+	Identifier        []Identifier      `json:"identifier,omitempty"`
+	Status            string            `json:"status"`
+	Category          []CodeableConcept `json:"category,omitempty"`
+	Code              CodeableConcept   `json:"code"`
+	Subject           *Reference        `json:"subject,omitempty"`
+	Encounter         *Reference        `json:"encounter,omitempty"`
+	EffectiveDateTime string            `json:"effectiveDateTime,omitempty"`
+	Issued            string            `json:"issued,omitempty"`
+	Performer         []Reference       `json:"performer,omitempty"`
+	Result            []Reference       `json:"result,omitempty"`
+}
+
+type ConsentProvision struct {
+	Type   string  `json:"type,omitempty"`
+	Period *Period `json:"period,omitempty"`
+}
+
+type Consent struct {
+	ResourceType string            `json:"resourceType"`
+	ID           string            `json:"id,omitempty"`
+	Meta         *Meta             `json:"meta,omitempty"`
+	Identifier   []Identifier      `json:"identifier,omitempty"`
+	Status       string            `json:"status"`
+	Scope        CodeableConcept   `json:"scope"`
+	Category     []CodeableConcept `json:"category"`
+	Patient      *Reference        `json:"patient,omitempty"`
+	DateTime     string            `json:"dateTime,omitempty"`
+	Performer    []Reference       `json:"performer,omitempty"`
+	Provision    *ConsentProvision `json:"provision,omitempty"`
+}
+
+type InvoicePriceComponent struct {
+	Type   string `json:"type"`
+	Amount *Money `json:"amount,omitempty"`
+}
+
+type InvoiceLineItem struct {
+	Sequence                  int                     `json:"sequence,omitempty"`
+	ChargeItemCodeableConcept CodeableConcept         `json:"chargeItemCodeableConcept"`
+	PriceComponent            []InvoicePriceComponent `json:"priceComponent,omitempty"`
+}
+
+type Invoice struct {
+	ResourceType string            `json:"resourceType"`
+	ID           string            `json:"id,omitempty"`
+	Meta         *Meta             `json:"meta,omitempty"`
+	Identifier   []Identifier      `json:"identifier,omitempty"`
+	Status       string            `json:"status"`
+	Type         *CodeableConcept  `json:"type,omitempty"`
+	Subject      *Reference        `json:"subject,omitempty"`
+	Date         string            `json:"date,omitempty"`
+	Issuer       *Reference        `json:"issuer,omitempty"`
+	LineItem     []InvoiceLineItem `json:"lineItem,omitempty"`
+	TotalNet     *Money            `json:"totalNet,omitempty"`
+	TotalGross   *Money            `json:"totalGross,omitempty"`
+}
+
+type OperationOutcomeIssue struct {
+	Severity    string `json:"severity"`
+	Code        string `json:"code"`
+	Diagnostics string `json:"diagnostics,omitempty"`
+}
+
+type OperationOutcome struct {
+	ResourceType string                  `json:"resourceType"`
+	Issue        []OperationOutcomeIssue `json:"issue"`
+}
+
+type BundleRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+type BundleResponse struct {
+	Status   string            `json:"status"`
+	Location string            `json:"location,omitempty"`
+	Outcome  *OperationOutcome `json:"outcome,omitempty"`
+}
+
+/*
+* Resource is kept raw, so the entries of an imported bundle can be decoded by their resourceType
+ */
+type BundleEntry struct {
+	FullURL  string          `json:"fullUrl,omitempty"`
+	Resource json.RawMessage `json:"resource,omitempty"`
+	Request  *BundleRequest  `json:"request,omitempty"`
+	Response *BundleResponse `json:"response,omitempty"`
+}
+
+type Bundle struct {
+	ResourceType string        `json:"resourceType"`
+	ID           string        `json:"id,omitempty"`
+	Meta         *Meta         `json:"meta,omitempty"`
+	Type         string        `json:"type"`
+	Timestamp    string        `json:"timestamp,omitempty"`
+	Total        *int          `json:"total,omitempty"`
+	Entry        []BundleEntry `json:"entry,omitempty"`
+}
+
+func NewBundle(bundleType string) *Bundle {
+	return &Bundle{
+		ResourceType: ResourceBundle,
+		Type:         bundleType,
+		Timestamp:    time.Now().UTC().Format(DateTimeFormat),
+		Entry:        []BundleEntry{},
+	}
+}
+
+/*
+* Append a resource, fullUrl is the relative url Type/id
+ */
+func (b *Bundle) Add(resourceType, id string, resource interface{}) error {
+	raw, err := json.Marshal(resource)
+	if err != nil {
+		return err
+	}
+	b.Entry = append(b.Entry, BundleEntry{FullURL: resourceType + "/" + id, Resource: raw})
+	return nil
+}
+
+/*
+* Searchset bundles carry the number of matches
+ */
+func (b *Bundle) SetTotal() {
+	total := len(b.Entry)
+	b.Total = &total
+}
+
+func NewOperationOutcome(severity, code, diagnostics string) *OperationOutcome {
+	return &OperationOutcome{
+		ResourceType: ResourceOperationOutcome,
+		Issue:        []OperationOutcomeIssue{{Severity: severity, Code: code, Diagnostics: diagnostics}},
+	}
+}
+
+/*
+* Decode a bundle sent for import, the entries are decoded later by ResourceType
+ */
+func ParseBundle(raw []byte) (*Bundle, error) {
+	bundle := &Bundle{}
+	if err := json.Unmarshal(raw, bundle); err != nil {
+		return nil, err
+	}
+	if bundle.ResourceType != ResourceBundle {
+		return nil, ErrNotBundle
+	}
+	if len(bundle.Entry) == 0 {
+		return nil, ErrEmptyBundle
+	}
+	return bundle, nil
+}
+
+/*
+* resourceType of a raw resource, empty when it cannot be read
+ */
+func ResourceType(raw json.RawMessage) string {
+	var head struct {
+		ResourceType string `json:"resourceType"`
+	}
+	if err := json.Unmarshal(raw, &head); err != nil {
+		return ""
+	}
+	return head.ResourceType
+}
+
+/*
+* Value of the identifier with the system
+ */
+func IdentifierValue(identifiers []Identifier, system string) string {
+	for _, identifier := range identifiers {
+		if identifier.System == system {
+			return identifier.Value
+		}
+	}
+	return ""
+}
+
+/*
+* Value of the telecom with the system(phone, email)
+ */
+func TelecomValue(telecom []ContactPoint, system string) string {
+	for _, contact := range telecom {
+		if contact.System == system && contact.Value != "" {
+			return contact.Value
+		}
+	}
+	return ""
+}
+
+/*
+* Value of the extension with the url, valueString or valueDate
+ */
+func ExtensionValue(extensions []Extension, url string) string {
+	for _, extension := range extensions {
+		if extension.URL == url {
+			if extension.ValueString != "" {
+				return extension.ValueString
+			}
+			return extension.ValueDate
+		}
+	}
+	return ""
+}
+
+/*
+* text of the name, or the given names and the family joined
+ */
+func (n HumanName) Display() string {
+	if n.Text != "" {
+		return n.Text
+	}
+	return strings.TrimSpace(strings.Join(append(n.Given, n.Family), " "))
+}
+
+func Decimal(v float64) *float64 {
+	return &v
+}
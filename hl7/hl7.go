@@ -0,0 +1,273 @@
+package hl7
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+/*
+* Minimal HL7 v2 parser and builder for the lab interface(ORU^R01, ORM^O01 and ACK)
+* Fields are numbered as in the HL7 spec, for MSH field 1 is the field separator
+ */
+
+const TimeFormat = "20060102150405"
+
+var (
+	ErrEmptyMessage = errors.New("hl7 message is empty")
+	ErrMissingMSH   = errors.New("hl7 message must start with an MSH segment")
+)
+
+type Delimiters struct {
+	Field        string
+	Component    string
+	Repetition   string
+	Escape       string
+	Subcomponent string
+}
+
+var DefaultDelimiters = Delimiters{Field: "|", Component: "^", Repetition: "~", Escape: "\\", Subcomponent: "&"}
+
+type Segment struct {
+	Name       string
+	Fields     []string
+	delimiters Delimiters
+}
+
+type Message struct {
+	Segments   []Segment
+	Delimiters Delimiters
+}
+
+/*
+* One OBR with the OBX segments following it
+ */
+type Order struct {
+	OBR Segment
+	OBX []Segment
+}
+
+/*
+* Segments are separated by CR, LF or CRLF(files dropped from windows machines)
+* The delimiters are read from MSH-1 and MSH-2
+ */
+func Parse(raw string) (*Message, error) {
+	raw = strings.ReplaceAll(raw, "\r\n", "\r")
+	raw = strings.ReplaceAll(raw, "\n", "\r")
+	raw = strings.Trim(raw, "\r \t\x0b\x1c")
+	if raw == "" {
+		return nil, ErrEmptyMessage
+	}
+	if !strings.HasPrefix(raw, "MSH") || len(raw) < 8 {
+		return nil, ErrMissingMSH
+	}
+	d := Delimiters{
+		Field:        raw[3:4],
+		Component:    raw[4:5],
+		Repetition:   raw[5:6],
+		Escape:       raw[6:7],
+		Subcomponent: raw[7:8],
+	}
+	msg := &Message{Delimiters: d}
+	for _, line := range strings.Split(raw, "\r") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, d.Field)
+		if fields[0] == "MSH" {
+			fields = append([]string{"MSH", d.Field}, fields[1:]...)
+		}
+		msg.Segments = append(msg.Segments, Segment{Name: fields[0], Fields: fields, delimiters: d})
+	}
+	return msg, nil
+}
+
+/*
+* Raw value of the field(1 based), empty when the field is not present
+ */
+func (s Segment) Field(index int) string {
+	if index <= 0 || index >= len(s.Fields) {
+		return ""
+	}
+	return s.Fields[index]
+}
+
+/*
+* Unescaped component(1 based) of the first repetition of the field
+ */
+func (s Segment) Component(index int, component int) string {
+	value := s.Field(index)
+	if s.Name != "MSH" || index > 2 {
+		value = strings.SplitN(value, s.delimiters.Repetition, 2)[0]
+	}
+	parts := strings.Split(value, s.delimiters.Component)
+	if component <= 0 || component > len(parts) {
+		return ""
+	}
+	return Unescape(parts[component-1], s.delimiters)
+}
+
+/*
+* Unescaped value of the field, only the first component
+ */
+func (s Segment) Value(index int) string {
+	return s.Component(index, 1)
+}
+
+func (m *Message) First(name string) (Segment, bool) {
+	for _, s := range m.Segments {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Segment{}, false
+}
+
+func (m *Message) header() Segment {
+	msh, _ := m.First("MSH")
+	return msh
+}
+
+/*
+* Message type with the trigger event e.g. ORU^R01
+ */
+func (m *Message) Type() string {
+	msh := m.header()
+	return msh.Component(9, 1) + "^" + msh.Component(9, 2)
+}
+
+func (m *Message) ControlID() string {
+	return m.header().Value(10)
+}
+
+func (m *Message) SendingApplication() string {
+	return m.header().Value(3)
+}
+
+func (m *Message) SendingFacility() string {
+	return m.header().Value(4)
+}
+
+/*
+* OBR segments with their OBX segments
+ */
+func (m *Message) Orders() []Order {
+	var orders []Order
+	for _, s := range m.Segments {
+		switch s.Name {
+		case "OBR":
+			orders = append(orders, Order{OBR: s})
+		case "OBX":
+			if len(orders) > 0 {
+				orders[len(orders)-1].OBX = append(orders[len(orders)-1].OBX, s)
+			}
+		}
+	}
+	return orders
+}
+
+var escapeSequences = []struct{ code, field string }{
+	{"F", "Field"}, {"S", "Component"}, {"T", "Subcomponent"}, {"R", "Repetition"},
+}
+
+func delimiterOf(d Delimiters, name string) string {
+	switch name {
+	case "Field":
+		return d.Field
+	case "Component":
+		return d.Component
+	case "Subcomponent":
+		return d.Subcomponent
+	default:
+		return d.Repetition
+	}
+}
+
+/*
+* \F\ \S\ \T\ \R\ \E\ escape sequences
+ */
+func Unescape(value string, d Delimiters) string {
+	if !strings.Contains(value, d.Escape) {
+		return value
+	}
+	for _, e := range escapeSequences {
+		value = strings.ReplaceAll(value, d.Escape+e.code+d.Escape, delimiterOf(d, e.field))
+	}
+	return strings.ReplaceAll(value, d.Escape+"E"+d.Escape, d.Escape)
+}
+
+func Escape(value string, d Delimiters) string {
+	value = strings.ReplaceAll(value, d.Escape, d.Escape+"E"+d.Escape)
+	for _, e := range escapeSequences {
+		value = strings.ReplaceAll(value, delimiterOf(d, e.field), d.Escape+e.code+d.Escape)
+	}
+	return value
+}
+
+/*
+* Builder joins the segments with the default delimiters
+* Values passed to Components are escaped, fields passed to Add are used as they are
+ */
+type Builder struct {
+	segments []string
+}
+
+func (b *Builder) Add(name string, fields ...string) *Builder {
+	if name == "MSH" {
+		b.segments = append(b.segments, "MSH"+DefaultDelimiters.Field+strings.Join(fields, DefaultDelimiters.Field))
+		return b
+	}
+	b.segments = append(b.segments, name+DefaultDelimiters.Field+strings.Join(fields, DefaultDelimiters.Field))
+	return b
+}
+
+func (b *Builder) String() string {
+	return strings.Join(b.segments, "\r") + "\r"
+}
+
+func Components(values ...string) string {
+	escaped := make([]string, len(values))
+	for i, v := range values {
+		escaped[i] = Escape(v, DefaultDelimiters)
+	}
+	return strings.TrimRight(strings.Join(escaped, DefaultDelimiters.Component), DefaultDelimiters.Component)
+}
+
+/*
+* MSH segment fields(from MSH-2) for an outgoing message
+ */
+func Header(sendingApp, sendingFacility, receivingApp, receivingFacility, messageType, controlId string) []string {
+	return []string{
+		"^~\\&",
+		Components(sendingApp),
+		Components(sendingFacility),
+		Components(receivingApp),
+		Components(receivingFacility),
+		time.Now().Format(TimeFormat),
+		"",
+		messageType,
+		controlId,
+		"P",
+		"2.5",
+	}
+}
+
+/*
+* ACK for a received message, code is AA(accepted), AE(error) or AR(rejected)
+ */
+func BuildACK(msg *Message, code string, text string, application string, facility string) string {
+	trigger := ""
+	controlId := ""
+	receivingApp, receivingFacility := "", ""
+	if msg != nil {
+		msh := msg.header()
+		trigger = msh.Component(9, 2)
+		controlId = msg.ControlID()
+		receivingApp, receivingFacility = msg.SendingApplication(), msg.SendingFacility()
+	}
+	b := &Builder{}
+	b.Add("MSH", Header(application, facility, receivingApp, receivingFacility, "ACK^"+trigger, "ACK"+time.Now().Format(TimeFormat))...)
+	b.Add("MSA", code, Components(controlId), Components(text))
+	return b.String()
+}
@@ -0,0 +1,138 @@
+package hl7
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func loadSample(t *testing.T) *Message {
+	raw, err := os.ReadFile("testdata/oru_r01.hl7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := Parse(string(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestParseORU(t *testing.T) {
+	msg := loadSample(t)
+	if msg.Type() != "ORU^R01" {
+		t.Errorf("type = %q", msg.Type())
+	}
+	if msg.ControlID() != "MSG00001" || msg.SendingApplication() != "COBAS" {
+		t.Errorf("header = %q %q", msg.ControlID(), msg.SendingApplication())
+	}
+	orders := msg.Orders()
+	if len(orders) != 1 || len(orders[0].OBX) != 3 {
+		t.Fatalf("orders = %+v", orders)
+	}
+	obr := orders[0].OBR
+	if obr.Value(2) != "TR0001" || obr.Value(3) != "AC0001" || obr.Component(4, 2) != "Complete blood count" {
+		t.Errorf("obr = %v", obr.Fields)
+	}
+	hgb := orders[0].OBX[0]
+	if hgb.Component(3, 1) != "HGB" || hgb.Value(5) != "13.2" || hgb.Value(6) != "g/dL" {
+		t.Errorf("obx = %v", hgb.Fields)
+	}
+	comment := orders[0].OBX[2]
+	if comment.Value(5) != "Sample slightly lipemic& repeated" || comment.Value(11) != "X" {
+		t.Errorf("comment = %q status = %q", comment.Value(5), comment.Value(11))
+	}
+}
+
+func TestParseRejectsInvalid(t *testing.T) {
+	if _, err := Parse(" \r\n"); err != ErrEmptyMessage {
+		t.Errorf("err = %v", err)
+	}
+	if _, err := Parse("PID|1"); err != ErrMissingMSH {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestEscapeRoundTrip(t *testing.T) {
+	value := `a|b^c~d\e&f`
+	if got := Unescape(Escape(value, DefaultDelimiters), DefaultDelimiters); got != value {
+		t.Errorf("round trip = %q", got)
+	}
+}
+
+func TestBuildACK(t *testing.T) {
+	msg := loadSample(t)
+	ack, err := Parse(BuildACK(msg, "AE", "No code mapping", "HEALTHHUB360", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msa, ok := ack.First("MSA")
+	if !ok || msa.Value(1) != "AE" || msa.Value(2) != "MSG00001" || msa.Value(3) != "No code mapping" {
+		t.Errorf("msa = %v", msa.Fields)
+	}
+	if ack.Type() != "ACK^R01" || ack.SendingApplication() != "HEALTHHUB360" {
+		t.Errorf("ack header = %q %q", ack.Type(), ack.SendingApplication())
+	}
+}
+
+func TestMLLPRoundTrip(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan string, 1)
+	go Serve(listener, func(message string) string {
+		received <- message
+		msg, err := Parse(message)
+		if err != nil {
+			return BuildACK(nil, "AR", err.Error(), "TEST", "")
+		}
+		return BuildACK(msg, "AA", "", "TEST", "")
+	})
+
+	raw, err := os.ReadFile("testdata/oru_r01.hl7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ack, err := Send(listener.Addr().String(), string(raw), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; got != string(raw) {
+		t.Errorf("received = %q", got)
+	}
+	msg, err := Parse(ack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msa, _ := msg.First("MSA")
+	if msa.Value(1) != "AA" || msa.Value(2) != "MSG00001" {
+		t.Errorf("msa = %v", msa.Fields)
+	}
+}
+
+func TestMLLPClosesIdleConnection(t *testing.T) {
+	previous := ReadTimeout
+	ReadTimeout = 100 * time.Millisecond
+	defer func() { ReadTimeout = previous }()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go Serve(listener, func(message string) string { return message })
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("idle connection read = %v, want EOF from the server closing it", err)
+	}
+}
@@ -0,0 +1,140 @@
+package hl7
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"time"
+)
+
+/*
+* MLLP framing: <VT> message <FS><CR>
+ */
+const (
+	startBlock     byte = 0x0b
+	endBlock       byte = 0x1c
+	carriageReturn byte = 0x0d
+)
+
+var ErrFrameTooLarge = errors.New("mllp frame exceeds the maximum size")
+
+const maxFrameSize = 1 << 20
+
+/*
+* A connection which sends nothing for this long is closed, so idle or stalled senders donot hold a goroutine forever
+ */
+var ReadTimeout = 5 * time.Minute
+
+/*
+* Handler receives the message text and returns the ACK to send back
+ */
+type Handler func(message string) string
+
+func WriteFrame(w io.Writer, message string) error {
+	frame := make([]byte, 0, len(message)+3)
+	frame = append(frame, startBlock)
+	frame = append(frame, message...)
+	frame = append(frame, endBlock, carriageReturn)
+	_, err := w.Write(frame)
+	return err
+}
+
+/*
+* Bytes before the start block are ignored
+ */
+func ReadFrame(r *bufio.Reader) (string, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b == startBlock {
+			break
+		}
+	}
+	var frame []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b == endBlock {
+			next, err := r.ReadByte()
+			if err != nil {
+				return "", err
+			}
+			if next == carriageReturn {
+				return string(frame), nil
+			}
+			frame = append(frame, b, next)
+			continue
+		}
+		frame = append(frame, b)
+		if len(frame) > maxFrameSize {
+			return "", ErrFrameTooLarge
+		}
+	}
+}
+
+/*
+* Accept the connections and handle each one in its own goroutine
+* Returns when the listener is closed
+ */
+func Serve(listener net.Listener, handler Handler) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go serveConn(conn, handler)
+	}
+}
+
+func ListenAndServe(addr string, handler Handler) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Println("HL7 MLLP listener started on ", addr)
+	return Serve(listener, handler)
+}
+
+func serveConn(conn net.Conn, handler Handler) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(ReadTimeout)); err != nil {
+			log.Println("Error from setReadDeadline: ", err)
+			return
+		}
+		message, err := ReadFrame(reader)
+		if err != nil {
+			if err != io.EOF {
+				log.Println("Error from readFrame: ", err)
+			}
+			return
+		}
+		if err := WriteFrame(conn, handler(message)); err != nil {
+			log.Println("Error from writeFrame: ", err)
+			return
+		}
+	}
+}
+
+/*
+* Client to send one message and wait for the ACK(used by the sample sender and the tests)
+ */
+func Send(addr string, message string, timeout time.Duration) (string, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err := WriteFrame(conn, message); err != nil {
+		return "", err
+	}
+	return ReadFrame(bufio.NewReader(conn))
+}
@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"HealthHub360/services"
+
+	"context"
+	"log"
+
+	"github.com/robfig/cron/v3"
+)
+
+/*
+* Runs every day at 00:10 AM and charges the occupied beds for the day which ended to the running bills
+ */
+func StartBedCharges() {
+	c := cron.New()
+	c.AddFunc("10 0 * * *", func() {
+		log.Println("Running Bed Charge Scheduler...")
+		charged, err := services.AccrueDailyBedCharges(context.Background())
+		if err != nil {
+			log.Println("Error from accrueDailyBedCharges: ", err)
+			return
+		}
+		log.Println("Bed days charged: ", charged)
+	})
+	c.Start()
+}
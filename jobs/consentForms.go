@@ -0,0 +1,16 @@
+package jobs
+
+import (
+	"HealthHub360/services"
+
+	"log"
+)
+
+/*
+* Global consent forms(general, surgery, data sharing) are seeded once
+ */
+func SeedConsentForms() {
+	if err := services.SeedDefaultConsentForms(); err != nil {
+		log.Println("Error from seedDefaultConsentForms: ", err)
+	}
+}
@@ -0,0 +1,37 @@
+package jobs
+
+import (
+	"HealthHub360/hl7"
+	"HealthHub360/services"
+
+	"context"
+	"log"
+	"os"
+
+	"github.com/robfig/cron/v3"
+)
+
+/*
+* HL7 lab interface
+* HL7_MLLP_ADDR(e.g. :2575) starts the MLLP listener for the ORU^R01 results
+* HL7_DROP_DIR is checked every minute for the dropped result files
+ */
+func StartHL7Interface() {
+	if addr := os.Getenv("HL7_MLLP_ADDR"); addr != "" {
+		go func() {
+			err := hl7.ListenAndServe(addr, func(message string) string {
+				return services.ProcessHL7Message(context.Background(), message, services.HL7_VIA_MLLP)
+			})
+			if err != nil {
+				log.Println("Error from hl7 listenAndServe: ", err)
+			}
+		}()
+	}
+	if dir := os.Getenv("HL7_DROP_DIR"); dir != "" {
+		c := cron.New()
+		c.AddFunc("@every 1m", func() {
+			services.ImportHL7DropFolder(dir)
+		})
+		c.Start()
+	}
+}
@@ -0,0 +1,22 @@
+package jobs
+
+import (
+	"HealthHub360/services"
+
+	"log"
+	"os"
+)
+
+/*
+* ICD10_CODES_FILE(csv/xlsx with code, description, chapter) seeds the local ICD-10 code set
+* The file is loaded only once, when the code set is still empty
+ */
+func SeedICD10Codes() {
+	path := os.Getenv("ICD10_CODES_FILE")
+	if path == "" {
+		return
+	}
+	if err := services.LoadICD10File(path); err != nil {
+		log.Println("Error from loadICD10File: ", err)
+	}
+}
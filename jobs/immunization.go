@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"HealthHub360/services"
+
+	"context"
+	"log"
+
+	"github.com/robfig/cron/v3"
+)
+
+/*
+* Runs every day at 08:00 AM and reminds the patients and guardians about the vaccines due in a week
+ */
+func StartVaccinationReminders() {
+	c := cron.New()
+	c.AddFunc("0 8 * * *", func() {
+		log.Println("Running Vaccination Reminder Scheduler...")
+		sent, err := services.SendImmunizationReminders(context.Background())
+		if err != nil {
+			log.Println("Error from sendImmunizationReminders: ", err)
+			return
+		}
+		log.Println("Vaccination reminders sent: ", sent)
+	})
+	c.Start()
+}
@@ -0,0 +1,16 @@
+package jobs
+
+import (
+	"HealthHub360/services"
+
+	"log"
+)
+
+/*
+* Global consultation templates(general, cardiology, pediatrics) are seeded once
+ */
+func SeedNoteTemplates() {
+	if err := services.SeedDefaultNoteTemplates(); err != nil {
+		log.Println("Error from seedDefaultNoteTemplates: ", err)
+	}
+}
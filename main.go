@@ -4,6 +4,7 @@ import (
 	"HealthHub360/jobs"
 	"HealthHub360/routes"
 	"log"
+	"os"
 
 	server "github.com/KanapuramVaishnavi/Core/server"
 	"github.com/gin-contrib/cors"
@@ -25,6 +26,9 @@ func run() {
 	if err != nil {
 		log.Println("Error in loading the ENV")
 	}
+	if os.Getenv("SIGNING_KEY_SECRET") == "" {
+		log.Println("SIGNING_KEY_SECRET is not set, prescriptions, lab reports, discharge summaries and guardian consents cannot be signed until it is configured")
+	}
 
 	defaultopts := server.GetDefaultOptions()
 
@@ -40,7 +44,13 @@ func run() {
 				return
 			}
 			jobs.SeedDoctorLeaves()
+			jobs.SeedICD10Codes()
+			jobs.SeedNoteTemplates()
+			jobs.SeedConsentForms()
 			jobs.StartDailyScheduler()
+			jobs.StartVaccinationReminders()
+			jobs.StartBedCharges()
+			jobs.StartHL7Interface()
 		},
 
 		WebServerPreHandler: func(r *gin.Engine) {
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+* category is DRUG, FOOD, ENVIRONMENT or OTHER
+* severity is MILD, MODERATE, SEVERE or LIFE_THREATENING
+* verificationStatus is UNVERIFIED, CONFIRMED or REFUTED
+ */
+type Allergy struct {
+	ID                 primitive.ObjectID `json:"id" bson:"id"`
+	Code               string             `json:"code" bson:"code"`
+	PatientID          string             `json:"patientId" bson:"patientId"`
+	Substance          string             `json:"substance" bson:"substance"`
+	Category           string             `json:"category" bson:"category"`
+	Reaction           string             `json:"reaction" bson:"reaction"`
+	Severity           string             `json:"severity" bson:"severity"`
+	Status             string             `json:"status" bson:"status"`
+	VerificationStatus string             `json:"verificationStatus" bson:"verificationStatus"`
+	VerifiedBy         string             `json:"verifiedBy,omitempty" bson:"verifiedBy,omitempty"`
+	VerifiedAt         *time.Time         `json:"verifiedAt,omitempty" bson:"verifiedAt,omitempty"`
+	OnsetDate          *time.Time         `json:"onsetDate,omitempty" bson:"onsetDate,omitempty"`
+	Notes              string             `json:"notes,omitempty" bson:"notes,omitempty"`
+	HospitalID         string             `json:"hospitalId" bson:"hospitalId"`
+	TenantID           string             `json:"tenantId" bson:"tenantId"`
+	RecordedBy         string             `json:"recordedBy" bson:"recordedBy"`
+	CreatedAt          time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedBy          string             `json:"updatedBy" bson:"updatedBy"`
+	UpdatedAt          time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+/*
+* Saved on the prescription when a medicine is prescribed in spite of an allergy
+ */
+type AllergyOverride struct {
+	Reason       string                   `json:"reason" bson:"reason"`
+	Conflicts    []map[string]interface{} `json:"conflicts" bson:"conflicts"`
+	OverriddenBy string                   `json:"overriddenBy" bson:"overriddenBy"`
+	OverriddenAt time.Time                `json:"overriddenAt" bson:"overriddenAt"`
+}
+
+/*
+* One administered dose of a vaccine
+* completedByDose is set when the next dose is recorded, so no reminder is sent for nextDueDate
+ */
+type Immunization struct {
+	ID               primitive.ObjectID `json:"id" bson:"id"`
+	Code             string             `json:"code" bson:"code"`
+	PatientID        string             `json:"patientId" bson:"patientId"`
+	Vaccine          string             `json:"vaccine" bson:"vaccine"`
+	DoseNumber       int                `json:"doseNumber" bson:"doseNumber"`
+	LotNumber        string             `json:"lotNumber" bson:"lotNumber"`
+	AdministeredDate time.Time          `json:"administeredDate" bson:"administeredDate"`
+	NextDueDate      *time.Time         `json:"nextDueDate,omitempty" bson:"nextDueDate,omitempty"`
+	Site             string             `json:"site,omitempty" bson:"site,omitempty"`
+	Notes            string             `json:"notes,omitempty" bson:"notes,omitempty"`
+	CompletedByDose  string             `json:"completedByDose,omitempty" bson:"completedByDose,omitempty"`
+	ReminderSentAt   *time.Time         `json:"reminderSentAt,omitempty" bson:"reminderSentAt,omitempty"`
+	HospitalID       string             `json:"hospitalId" bson:"hospitalId"`
+	TenantID         string             `json:"tenantId" bson:"tenantId"`
+	AdministeredBy   string             `json:"administeredBy" bson:"administeredBy"`
+	CreatedAt        time.Time          `json:"createdAt" bson:"createdAt"`
+}
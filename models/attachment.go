@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+* A file(scan, image or pdf) attached to a patient and optionally to one of the medical records
+* The content is kept in the storage(local or s3), storageKey and thumbnailKey are the keys in the storage
+ */
+type Attachment struct {
+	ID              primitive.ObjectID `json:"id" bson:"id"`
+	Code            string             `json:"code" bson:"code"`
+	PatientID       string             `json:"patientId" bson:"patientId"`
+	MedicalRecordID string             `json:"medicalRecordId,omitempty" bson:"medicalRecordId,omitempty"`
+	FileName        string             `json:"fileName" bson:"fileName"`
+	ContentType     string             `json:"contentType" bson:"contentType"`
+	Size            int64              `json:"size" bson:"size"`
+	SHA256          string             `json:"sha256" bson:"sha256"`
+	Category        string             `json:"category" bson:"category"`
+	Description     string             `json:"description,omitempty" bson:"description,omitempty"`
+	StorageKey      string             `json:"-" bson:"storageKey"`
+	ThumbnailKey    string             `json:"-" bson:"thumbnailKey,omitempty"`
+	HasThumbnail    bool               `json:"hasThumbnail" bson:"hasThumbnail"`
+	ScanStatus      string             `json:"scanStatus" bson:"scanStatus"`
+	HospitalID      string             `json:"hospitalId" bson:"hospitalId"`
+	TenantID        string             `json:"tenantId" bson:"tenantId"`
+	UploadedBy      string             `json:"uploadedBy" bson:"uploadedBy"`
+	UploadedByRole  string             `json:"uploadedByRole" bson:"uploadedByRole"`
+	CreatedAt       time.Time          `json:"createdAt" bson:"createdAt"`
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+* Field of a template section, type is TEXT, NUMBER, BOOLEAN or CHOICE(with options)
+ */
+type TemplateField struct {
+	Key      string   `json:"key" bson:"key"`
+	Label    string   `json:"label" bson:"label"`
+	Type     string   `json:"type" bson:"type"`
+	Options  []string `json:"options,omitempty" bson:"options,omitempty"`
+	Required bool     `json:"required" bson:"required"`
+}
+
+/*
+* Department specific consultation template
+* Templates without hospitalId and tenantId are available to every hospital
+ */
+type NoteTemplate struct {
+	ID         primitive.ObjectID         `json:"id" bson:"id"`
+	Code       string                     `json:"code" bson:"code"`
+	Name       string                     `json:"name" bson:"name"`
+	Department string                     `json:"department" bson:"department"`
+	Sections   map[string][]TemplateField `json:"sections" bson:"sections"`
+	IsActive   bool                       `json:"isActive" bson:"isActive"`
+	HospitalID string                     `json:"hospitalId,omitempty" bson:"hospitalId,omitempty"`
+	TenantID   string                     `json:"tenantId,omitempty" bson:"tenantId,omitempty"`
+	CreatedBy  string                     `json:"createdBy" bson:"createdBy"`
+	CreatedAt  time.Time                  `json:"createdAt" bson:"createdAt"`
+	UpdatedBy  string                     `json:"updatedBy" bson:"updatedBy"`
+	UpdatedAt  time.Time                  `json:"updatedAt" bson:"updatedAt"`
+}
+
+/*
+* SOAP note of a consultation, every section is text or the fields of the template
+* The author can edit it until lockAt, after that only addenda can be added
+ */
+type ClinicalNote struct {
+	ID              primitive.ObjectID `json:"id" bson:"id"`
+	Code            string             `json:"code" bson:"code"`
+	MedicalRecordID string             `json:"medicalRecordId" bson:"medicalRecordId"`
+	PatientID       string             `json:"patientId" bson:"patientId"`
+	HospitalID      string             `json:"hospitalId" bson:"hospitalId"`
+	TenantID        string             `json:"tenantId" bson:"tenantId"`
+	TemplateID      string             `json:"templateId,omitempty" bson:"templateId,omitempty"`
+	VitalsID        string             `json:"vitalsId,omitempty" bson:"vitalsId,omitempty"`
+	Subjective      interface{}        `json:"subjective,omitempty" bson:"subjective,omitempty"`
+	Objective       interface{}        `json:"objective,omitempty" bson:"objective,omitempty"`
+	Assessment      interface{}        `json:"assessment,omitempty" bson:"assessment,omitempty"`
+	Plan            interface{}        `json:"plan,omitempty" bson:"plan,omitempty"`
+	Revision        int                `json:"revision" bson:"revision"`
+	Revisions       []NoteRevision     `json:"revisions,omitempty" bson:"revisions,omitempty"`
+	Status          string             `json:"status" bson:"status"`
+	LockAt          time.Time          `json:"lockAt" bson:"lockAt"`
+	LockedAt        *time.Time         `json:"lockedAt,omitempty" bson:"lockedAt,omitempty"`
+	Signature       *Signature         `json:"signature,omitempty" bson:"signature,omitempty"`
+	Addenda         []Addendum         `json:"addenda,omitempty" bson:"addenda,omitempty"`
+	CreatedBy       string             `json:"createdBy" bson:"createdBy"`
+	CreatedAt       time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedBy       string             `json:"updatedBy" bson:"updatedBy"`
+	UpdatedAt       time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+/*
+* Earlier content of the note, kept when the author edits it before the lock
+ */
+type NoteRevision struct {
+	Revision   int         `json:"revision" bson:"revision"`
+	Subjective interface{} `json:"subjective,omitempty" bson:"subjective,omitempty"`
+	Objective  interface{} `json:"objective,omitempty" bson:"objective,omitempty"`
+	Assessment interface{} `json:"assessment,omitempty" bson:"assessment,omitempty"`
+	Plan       interface{} `json:"plan,omitempty" bson:"plan,omitempty"`
+	Signature  *Signature  `json:"signature,omitempty" bson:"signature,omitempty"`
+	EditedAt   time.Time   `json:"editedAt" bson:"editedAt"`
+}
+
+type Addendum struct {
+	Text      string     `json:"text" bson:"text"`
+	Reason    string     `json:"reason,omitempty" bson:"reason,omitempty"`
+	AddedBy   string     `json:"addedBy" bson:"addedBy"`
+	AddedAt   time.Time  `json:"addedAt" bson:"addedAt"`
+	Signature *Signature `json:"signature,omitempty" bson:"signature,omitempty"`
+}
@@ -7,13 +7,58 @@ import (
 )
 
 type Consent struct {
-	ID                primitive.ObjectID `json:"id" bson:"id"`
-	Code              string             `json:"code" bson:"code"`
-	ConsentType       string             `json:"consentType" bson:"consentType"` // General,Surgery,DataSharing
-	ConsentPermission string             `json:"consentPermission" bson:"consentPermission"`
-	RefID             string             `json:"refID" bson:"refID"` // PatientID
-	CreatedAt         time.Time          `json:"createdAt" bson:"createdAt"`
-	CreatedBy         string             `json:"createdBy" bson:"createdBy"`
-	UpdatedAt         time.Time          `json:"updatedAt" bson:"updatedAt"`
-	UpdatedBy         string             `json:"updatedBy" bson:"updatedBy"`
+	ID                    primitive.ObjectID       `json:"id" bson:"id"`
+	Code                  string                   `json:"code" bson:"code"`
+	ConsentType           string                   `json:"consentType" bson:"consentType"` // GENERAL,SURGERY,DATA_SHARING
+	ConsentPermission     string                   `json:"consentPermission" bson:"consentPermission"`
+	RefID                 string                   `json:"refID" bson:"refID"` // PatientID
+	GuardianID            string                   `json:"guardianId,omitempty" bson:"guardianId,omitempty"`
+	Guardian              *ConsentGuardian         `json:"guardian,omitempty" bson:"guardian,omitempty"` // minors only
+	FormID                string                   `json:"formId" bson:"formId"`
+	FormVersion           int                      `json:"formVersion" bson:"formVersion"`
+	FormTextHash          string                   `json:"formTextHash" bson:"formTextHash"`
+	Status                string                   `json:"status" bson:"status"` // ACTIVE,WITHDRAWN
+	ValidFrom             time.Time                `json:"validFrom" bson:"validFrom"`
+	ExpiresAt             time.Time                `json:"expiresAt" bson:"expiresAt"`
+	WithdrawalReason      string                   `json:"withdrawalReason,omitempty" bson:"withdrawalReason,omitempty"`
+	WithdrawnBy           string                   `json:"withdrawnBy,omitempty" bson:"withdrawnBy,omitempty"`
+	WithdrawnByCollection string                   `json:"withdrawnByCollection,omitempty" bson:"withdrawnByCollection,omitempty"`
+	WithdrawnAt           *time.Time               `json:"withdrawnAt,omitempty" bson:"withdrawnAt,omitempty"`
+	History               []map[string]interface{} `json:"history" bson:"history"`
+	CreatedAt             time.Time                `json:"createdAt" bson:"createdAt"`
+	CreatedBy             string                   `json:"createdBy" bson:"createdBy"`
+	UpdatedAt             time.Time                `json:"updatedAt" bson:"updatedAt"`
+	UpdatedBy             string                   `json:"updatedBy" bson:"updatedBy"`
+}
+
+/*
+* Guardian who gave the consent of the minor, Signature is the RSA signature over the consent, the form and the guardian
+ */
+type ConsentGuardian struct {
+	GuardianID string                 `json:"guardianId" bson:"guardianId"`
+	Name       string                 `json:"name" bson:"name"`
+	Relation   string                 `json:"relation" bson:"relation"`
+	SignedAt   string                 `json:"signedAt" bson:"signedAt"`
+	Signature  map[string]interface{} `json:"signature" bson:"signature"` // keyId, algorithm, value, payloadHash
+}
+
+/*
+* Versioned text of a consent form of the hospital, a revision is saved as a new version
+ */
+type ConsentForm struct {
+	ID           primitive.ObjectID `json:"id" bson:"id"`
+	Code         string             `json:"code" bson:"code"`
+	ConsentType  string             `json:"consentType" bson:"consentType"`
+	Version      int                `json:"version" bson:"version"`
+	Title        string             `json:"title" bson:"title"`
+	Text         string             `json:"text" bson:"text"`
+	TextHash     string             `json:"textHash" bson:"textHash"` // sha256 of the text
+	ValidityDays int                `json:"validityDays" bson:"validityDays"`
+	Status       string             `json:"status" bson:"status"` // CURRENT,SUPERSEDED
+	SupersededBy string             `json:"supersededBy,omitempty" bson:"supersededBy,omitempty"`
+	SupersededAt *time.Time         `json:"supersededAt,omitempty" bson:"supersededAt,omitempty"`
+	HospitalID   string             `json:"hospitalId" bson:"hospitalId"`
+	TenantID     string             `json:"tenantId" bson:"tenantId"`
+	CreatedAt    time.Time          `json:"createdAt" bson:"createdAt"`
+	CreatedBy    string             `json:"createdBy" bson:"createdBy"`
 }
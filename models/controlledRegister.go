@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ControlledDispense struct {
+	ID             primitive.ObjectID `json:"id" bson:"id"`
+	Code           string             `json:"code" bson:"code"`
+	BillID         string             `json:"billId" bson:"billId"`
+	PatientID      string             `json:"patientId" bson:"patientId"`
+	PrescriptionID string             `json:"prescriptionId" bson:"prescriptionId"`
+	PrescribedBy   string             `json:"prescribedBy" bson:"prescribedBy"`
+	MedicineID     string             `json:"medicineId" bson:"medicineId"`
+	Quantity       string             `json:"quantity" bson:"quantity"`
+	BatchNo        string             `json:"batchNo" bson:"batchNo"`
+	DispensedBy    string             `json:"dispensedBy" bson:"dispensedBy"`
+	WitnessedBy    string             `json:"witnessedBy" bson:"witnessedBy"`
+	WitnessedAt    time.Time          `json:"witnessedAt" bson:"witnessedAt"`
+	Status         string             `json:"status" bson:"status"`
+	RegisterID     string             `json:"registerId" bson:"registerId"`
+	HospitalID     string             `json:"hospitalId" bson:"hospitalId"`
+	TenantID       string             `json:"tenantId" bson:"tenantId"`
+	CreatedAt      time.Time          `json:"createdAt" bson:"createdAt"`
+	CreatedBy      string             `json:"createdBy" bson:"createdBy"`
+	UpdatedAt      time.Time          `json:"updatedAt" bson:"updatedAt"`
+	UpdatedBy      string             `json:"updatedBy" bson:"updatedBy"`
+}
+
+type ControlledRegisterEntry struct {
+	ID             primitive.ObjectID `json:"id" bson:"id"`
+	Code           string             `json:"code" bson:"code"`
+	SerialNo       int                `json:"serialNo" bson:"serialNo"`
+	HospitalID     string             `json:"hospitalId" bson:"hospitalId"`
+	EntryType      string             `json:"entryType" bson:"entryType"`
+	MedicineID     string             `json:"medicineId" bson:"medicineId"`
+	BatchNo        string             `json:"batchNo" bson:"batchNo"`
+	Quantity       string             `json:"quantity" bson:"quantity"`
+	BalanceBefore  string             `json:"balanceBefore" bson:"balanceBefore"`
+	BalanceAfter   string             `json:"balanceAfter" bson:"balanceAfter"`
+	PatientID      string             `json:"patientId" bson:"patientId"`
+	PrescriptionID string             `json:"prescriptionId" bson:"prescriptionId"`
+	PrescribedBy   string             `json:"prescribedBy" bson:"prescribedBy"`
+	DispensedBy    string             `json:"dispensedBy" bson:"dispensedBy"`
+	WitnessedBy    string             `json:"witnessedBy" bson:"witnessedBy"`
+	ReceivedBy     string             `json:"receivedBy" bson:"receivedBy"`
+	RecordedAt     string             `json:"recordedAt" bson:"recordedAt"`
+	PreviousHash   string             `json:"previousHash" bson:"previousHash"`
+	Hash           string             `json:"hash" bson:"hash"`
+	CreatedAt      time.Time          `json:"createdAt" bson:"createdAt"`
+	CreatedBy      string             `json:"createdBy" bson:"createdBy"`
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+* ICD-10 code loaded from the local code set, the code itself is the key
+ */
+type ICD10Code struct {
+	ID          primitive.ObjectID `json:"id" bson:"id"`
+	Code        string             `json:"code" bson:"code"`
+	Description string             `json:"description" bson:"description"`
+	Chapter     string             `json:"chapter,omitempty" bson:"chapter,omitempty"`
+	UpdatedAt   time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+/*
+* Coded diagnosis as given on the prescription
+* type is PRIMARY or SECONDARY, status is PROVISIONAL or FINAL
+ */
+type CodedDiagnosis struct {
+	ICDCode     string `json:"icdCode" bson:"icdCode"`
+	Description string `json:"description" bson:"description"`
+	Type        string `json:"type" bson:"type"`
+	Status      string `json:"status" bson:"status"`
+	Chronic     bool   `json:"chronic" bson:"chronic"`
+	Note        string `json:"note,omitempty" bson:"note,omitempty"`
+}
+
+/*
+* One row per coded diagnosis of the latest prescription version, used for the reports
+ */
+type Diagnosis struct {
+	ID                 primitive.ObjectID `json:"id" bson:"id"`
+	Code               string             `json:"code" bson:"code"`
+	CodedDiagnosis     `bson:",inline"`
+	RootPrescriptionID string    `json:"rootPrescriptionId" bson:"rootPrescriptionId"`
+	PrescriptionID     string    `json:"prescriptionId" bson:"prescriptionId"`
+	MedicalRecordID    string    `json:"medicalRecordId" bson:"medicalRecordId"`
+	PatientID          string    `json:"patientId" bson:"patientId"`
+	DoctorID           string    `json:"doctorId" bson:"doctorId"`
+	HospitalID         string    `json:"hospitalId" bson:"hospitalId"`
+	TenantID           string    `json:"tenantId" bson:"tenantId"`
+	DiagnosedAt        time.Time `json:"diagnosedAt" bson:"diagnosedAt"`
+}
+
+/*
+* Entry of the longitudinal problem list of a patient
+* status is ACTIVE, INACTIVE or RESOLVED, chronic problems are carried across the visits
+ */
+type Problem struct {
+	ID                   primitive.ObjectID `json:"id" bson:"id"`
+	Code                 string             `json:"code" bson:"code"`
+	PatientID            string             `json:"patientId" bson:"patientId"`
+	ICDCode              string             `json:"icdCode" bson:"icdCode"`
+	Description          string             `json:"description" bson:"description"`
+	Chronic              bool               `json:"chronic" bson:"chronic"`
+	Status               string             `json:"status" bson:"status"`
+	OnsetDate            *time.Time         `json:"onsetDate,omitempty" bson:"onsetDate,omitempty"`
+	ResolvedAt           *time.Time         `json:"resolvedAt,omitempty" bson:"resolvedAt,omitempty"`
+	Notes                string             `json:"notes,omitempty" bson:"notes,omitempty"`
+	SourcePrescriptionID string             `json:"sourcePrescriptionId,omitempty" bson:"sourcePrescriptionId,omitempty"`
+	HospitalID           string             `json:"hospitalId" bson:"hospitalId"`
+	TenantID             string             `json:"tenantId" bson:"tenantId"`
+	CreatedBy            string             `json:"createdBy" bson:"createdBy"`
+	CreatedAt            time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedBy            string             `json:"updatedBy" bson:"updatedBy"`
+	UpdatedAt            time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+* Discharge summary of an admission, signed by the discharging doctor
+* dischargeType is NORMAL, LAMA, REFERRED or DEATH
+ */
+type Discharge struct {
+	ID                   primitive.ObjectID       `json:"id" bson:"id"`
+	Code                 string                   `json:"code" bson:"code"`
+	PatientID            string                   `json:"patientId" bson:"patientId"`
+	HospitalID           string                   `json:"hospitalId" bson:"hospitalId"`
+	TenantID             string                   `json:"tenantId" bson:"tenantId"`
+	AdmissionDate        string                   `json:"admissionDate" bson:"admissionDate"`
+	DischargeAt          time.Time                `json:"dischargeAt" bson:"dischargeAt"`
+	DischargeType        string                   `json:"dischargeType" bson:"dischargeType"`
+	ReferredTo           string                   `json:"referredTo,omitempty" bson:"referredTo,omitempty"`
+	CauseOfDeath         string                   `json:"causeOfDeath,omitempty" bson:"causeOfDeath,omitempty"`
+	FinalDiagnoses       []map[string]interface{} `json:"finalDiagnoses" bson:"finalDiagnoses"`
+	Procedures           []map[string]interface{} `json:"procedures" bson:"procedures"`
+	ConditionAtDischarge string                   `json:"conditionAtDischarge" bson:"conditionAtDischarge"`
+	Medications          []map[string]interface{} `json:"medications" bson:"medications"`
+	AllergyOverride      map[string]interface{}   `json:"allergyOverride,omitempty" bson:"allergyOverride,omitempty"`
+	FollowUpAdvice       string                   `json:"followUpAdvice,omitempty" bson:"followUpAdvice,omitempty"`
+	FollowUpDate         string                   `json:"followUpDate,omitempty" bson:"followUpDate,omitempty"`
+	DischargedBy         string                   `json:"dischargedBy" bson:"dischargedBy"`
+	Signature            map[string]interface{}   `json:"signature" bson:"signature"`
+	CreatedAt            time.Time                `json:"createdAt" bson:"createdAt"`
+}
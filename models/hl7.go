@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+* Code sent by an analyzer/LIS mapped to a test(OBR-4) or an analyte(OBX-3) of our catalog
+* Source is the sending application(MSH-3), empty for every source
+ */
+type HL7Mapping struct {
+	ID           primitive.ObjectID `json:"id" bson:"id"`
+	Code         string             `json:"code" bson:"code"`
+	Source       string             `json:"source" bson:"source"`
+	ExternalCode string             `json:"externalCode" bson:"externalCode"`
+	TestID       string             `json:"testId" bson:"testId"`
+	AnalyteCode  string             `json:"analyteCode" bson:"analyteCode"`
+	TenantID     string             `json:"tenantId" bson:"tenantId"`
+	CreatedBy    string             `json:"createdBy" bson:"createdBy"`
+	CreatedAt    time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+/*
+* HL7 message which could not be imported
+* status PENDING -> RESOLVED(imported on retry) or DISCARDED
+ */
+type HL7Error struct {
+	ID            primitive.ObjectID `json:"id" bson:"id"`
+	Code          string             `json:"code" bson:"code"`
+	RawMessage    string             `json:"rawMessage" bson:"rawMessage"`
+	MessageType   string             `json:"messageType,omitempty" bson:"messageType,omitempty"`
+	ControlID     string             `json:"controlId,omitempty" bson:"controlId,omitempty"`
+	Source        string             `json:"source,omitempty" bson:"source,omitempty"`
+	Error         string             `json:"error" bson:"error"`
+	Status        string             `json:"status" bson:"status"`
+	ReceivedVia   string             `json:"receivedVia" bson:"receivedVia"`
+	ReceivedAt    time.Time          `json:"receivedAt" bson:"receivedAt"`
+	Attempts      int                `json:"attempts" bson:"attempts"`
+	LastAttemptAt *time.Time         `json:"lastAttemptAt,omitempty" bson:"lastAttemptAt,omitempty"`
+	TestReportID  string             `json:"testReportId,omitempty" bson:"testReportId,omitempty"`
+	TenantID      string             `json:"tenantId,omitempty" bson:"tenantId,omitempty"`
+	HospitalID    string             `json:"hospitalId,omitempty" bson:"hospitalId,omitempty"`
+	DiscardReason string             `json:"discardReason,omitempty" bson:"discardReason,omitempty"`
+	ResolvedBy    string             `json:"resolvedBy,omitempty" bson:"resolvedBy,omitempty"`
+	ResolvedAt    *time.Time         `json:"resolvedAt,omitempty" bson:"resolvedAt,omitempty"`
+}
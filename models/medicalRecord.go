@@ -15,6 +15,7 @@ type MedicalRecord struct {
 	BloodGroup    string             `json:"bloodGroup" bson:"bloodGroup"`
 	Weight        float64            `json:"weight" bson:"weight"`
 	Bp            string             `json:"bp" bson:"bp"`
+	LatestVitals  string             `json:"latestVitalsId,omitempty" bson:"latestVitalsId,omitempty"`
 	RefID         string             `json:"refID" bson:"refID"`
 	Status        string             `json:"status" bson:"status"`
 	CreatedAt     time.Time          `json:"createdAt" bson:"createdAt"`
@@ -10,10 +10,16 @@ type Medicine struct {
 	ID           primitive.ObjectID `json:"id" bson:"id"`
 	Code         string             `json:"code" bson:"code"`
 	MedicineName string             `json:"medicineName" bson:"medicineName"`
+	GenericName  string             `json:"genericName" bson:"genericName"`
+	BrandName    string             `json:"brandName" bson:"brandName"`
+	Strength     string             `json:"strength" bson:"strength"`
 	DrugType     string             `json:"drugType" bson:"drugType"`
 	Dosage       string             `json:"dosage" bson:"dosage"`
 	NoOfStrips   int                `json:"noOfStrips" bson:"noOfStrips"`
 	Required     bool               `json:"required" bson:"required"`
+	IsControlled bool               `json:"isControlled" bson:"isControlled"`
+	Schedule     string             `json:"schedule" bson:"schedule"`
+	MaxDays      string             `json:"maxDays" bson:"maxDays"`
 	CreatedAt    time.Time          `json:"createdAt" bson:"createdAt"`
 	CreatedBy    string             `json:"createdBy" bson:"createdBy"`
 	UpdatedAt    time.Time          `json:"updatedAt" bson:"updatedAt"`
@@ -7,15 +7,100 @@ import (
 )
 
 type Prescription struct {
-	ID            primitive.ObjectID `json:"id" bson:"id"`
-	Code          string             `json:"code" bson:"code"`
-	AppointmentID string             `json:"appointmentID" bson:"appointmentID"`
-	PatientID     string             `json:"patientID" bson:"patientID"`
-	Medicines     []string           `json:"medicines" bson:"medicines"`
-	Dosage        map[string]string  `json:"dosage" bson:"dosage"`
-	Limit         []string           `json:"limit" bson:"limit"`
-	CreatedAt     time.Time          `json:"createdAt" bson:"createdAt"`
-	CreatedBy     string             `json:"createdBy" bson:"createdBy"`
-	UpdatedAt     time.Time          `json:"updatedAt" bson:"updatedAt"`
-	UpdatedBy     string             `json:"updatedBy" bson:"updatedBy"`
+	ID                 primitive.ObjectID `json:"id" bson:"id"`
+	Code               string             `json:"code" bson:"code"`
+	AppointmentID      string             `json:"appointmentID" bson:"appointmentID"`
+	PatientID          string             `json:"patientID" bson:"patientID"`
+	Medicines          []string           `json:"medicines" bson:"medicines"`
+	Dosage             map[string]string  `json:"dosage" bson:"dosage"`
+	Limit              []string           `json:"limit" bson:"limit"`
+	Diagnosis          string             `json:"diagnosis" bson:"diagnosis"`
+	Diagnoses          []CodedDiagnosis   `json:"diagnoses,omitempty" bson:"diagnoses,omitempty"`
+	AllergyOverride    *AllergyOverride   `json:"allergyOverride,omitempty" bson:"allergyOverride,omitempty"`
+	MedicalRecordID    string             `json:"medicalRecordId" bson:"medicalRecordId"`
+	Version            int                `json:"version" bson:"version"`
+	RootPrescriptionID string             `json:"rootPrescriptionId" bson:"rootPrescriptionId"`
+	PreviousVersionID  string             `json:"previousVersionId" bson:"previousVersionId"`
+	Status             string             `json:"status" bson:"status"`
+	SupersededBy       string             `json:"supersededBy" bson:"supersededBy"`
+	Amendment          *Amendment         `json:"amendment,omitempty" bson:"amendment,omitempty"`
+	IsRepeatable       bool               `json:"isRepeatable" bson:"isRepeatable"`
+	Refills            int                `json:"refills" bson:"refills"`
+	RefillIntervalDays int                `json:"refillIntervalDays" bson:"refillIntervalDays"`
+	IssuedAt           time.Time          `json:"issuedAt" bson:"issuedAt"`
+	Signature          *Signature         `json:"signature,omitempty" bson:"signature,omitempty"`
+	CreatedAt          time.Time          `json:"createdAt" bson:"createdAt"`
+	CreatedBy          string             `json:"createdBy" bson:"createdBy"`
+	UpdatedAt          time.Time          `json:"updatedAt" bson:"updatedAt"`
+	UpdatedBy          string             `json:"updatedBy" bson:"updatedBy"`
+}
+
+type Amendment struct {
+	Reason    string    `json:"reason" bson:"reason"`
+	AmendedBy string    `json:"amendedBy" bson:"amendedBy"`
+	AmendedAt time.Time `json:"amendedAt" bson:"amendedAt"`
+}
+
+/*
+* Signature over the canonical serialization of the issued prescription
+ */
+type Signature struct {
+	KeyID       string    `json:"keyId" bson:"keyId"`
+	Algorithm   string    `json:"algorithm" bson:"algorithm"`
+	Value       string    `json:"value" bson:"value"`
+	PayloadHash string    `json:"payloadHash" bson:"payloadHash"`
+	SignedBy    string    `json:"signedBy" bson:"signedBy"`
+	SignedAt    time.Time `json:"signedAt" bson:"signedAt"`
+}
+
+/*
+* Signing key of a doctor, the private key is stored encrypted
+* Rotated keys are kept to verify the prescriptions signed earlier
+ */
+type SigningKey struct {
+	ID         primitive.ObjectID `json:"id" bson:"id"`
+	Code       string             `json:"code" bson:"code"`
+	DoctorID   string             `json:"doctorId" bson:"doctorId"`
+	HospitalID string             `json:"hospitalId" bson:"hospitalId"`
+	TenantID   string             `json:"tenantId" bson:"tenantId"`
+	Algorithm  string             `json:"algorithm" bson:"algorithm"`
+	PublicKey  string             `json:"publicKey" bson:"publicKey"`
+	PrivateKey string             `json:"-" bson:"privateKey"`
+	Status     string             `json:"status" bson:"status"`
+	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+	RotatedAt  *time.Time         `json:"rotatedAt,omitempty" bson:"rotatedAt,omitempty"`
+}
+
+/*
+* Dosage schedule of a prescription line, type decides which fields are used
+* FIXED_TIMES(dose,timesPerDay,noOfDays), INTERVAL(dose,everyHours,noOfDays),
+* WEEKLY(dose,timesPerWeek,noOfWeeks), TAPERING(steps), PRN(dose,maxPerDay,noOfDays)
+ */
+type DosageSchedule struct {
+	Type         string           `json:"type" bson:"type"`
+	Unit         string           `json:"unit" bson:"unit"`
+	Dose         float64          `json:"dose,omitempty" bson:"dose,omitempty"`
+	TimesPerDay  float64          `json:"timesPerDay,omitempty" bson:"timesPerDay,omitempty"`
+	EveryHours   float64          `json:"everyHours,omitempty" bson:"everyHours,omitempty"`
+	TimesPerWeek float64          `json:"timesPerWeek,omitempty" bson:"timesPerWeek,omitempty"`
+	NoOfWeeks    float64          `json:"noOfWeeks,omitempty" bson:"noOfWeeks,omitempty"`
+	MaxPerDay    float64          `json:"maxPerDay,omitempty" bson:"maxPerDay,omitempty"`
+	NoOfDays     float64          `json:"noOfDays,omitempty" bson:"noOfDays,omitempty"`
+	Steps        []DosageSchedule `json:"steps,omitempty" bson:"steps,omitempty"`
+}
+
+type Refill struct {
+	ID                  primitive.ObjectID `json:"id" bson:"id"`
+	Code                string             `json:"code" bson:"code"`
+	RefillNo            int                `json:"refillNo" bson:"refillNo"`
+	RootPrescriptionID  string             `json:"rootPrescriptionId" bson:"rootPrescriptionId"`
+	PrescriptionID      string             `json:"prescriptionId" bson:"prescriptionId"`
+	PrescriptionVersion int                `json:"prescriptionVersion" bson:"prescriptionVersion"`
+	BillID              string             `json:"billId" bson:"billId"`
+	PatientID           string             `json:"patientId" bson:"patientId"`
+	RemainingRefills    int                `json:"remainingRefills" bson:"remainingRefills"`
+	NextEligibleDate    time.Time          `json:"nextEligibleDate" bson:"nextEligibleDate"`
+	DispensedBy         string             `json:"dispensedBy" bson:"dispensedBy"`
+	CreatedAt           time.Time          `json:"createdAt" bson:"createdAt"`
+	CreatedBy           string             `json:"createdBy" bson:"createdBy"`
 }
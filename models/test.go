@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+* Lab test in the catalog, a PANEL groups SINGLE tests(components)
+* pricingMode of a panel is BUNDLE(price) or PER_ITEM(sum of the component prices)
+ */
+type Test struct {
+	ID              primitive.ObjectID `json:"id" bson:"id"`
+	Code            string             `json:"code" bson:"code"`
+	TestName        string             `json:"testname" bson:"testname"`
+	Price           string             `json:"price" bson:"price"`
+	Type            string             `json:"type" bson:"type"`
+	SpecimenType    string             `json:"specimenType" bson:"specimenType"`
+	TurnaroundHours int                `json:"turnaroundHours" bson:"turnaroundHours"`
+	Analytes        []Analyte          `json:"analytes,omitempty" bson:"analytes,omitempty"`
+	Components      []string           `json:"components,omitempty" bson:"components,omitempty"`
+	PricingMode     string             `json:"pricingMode,omitempty" bson:"pricingMode,omitempty"`
+	TenantID        string             `json:"tenantId" bson:"tenantId"`
+	CreatedAt       time.Time          `json:"createdAt" bson:"createdAt"`
+	CreatedBy       string             `json:"createdBy" bson:"createdBy"`
+	UpdatedAt       time.Time          `json:"updatedAt" bson:"updatedAt"`
+	UpdatedBy       string             `json:"updatedBy" bson:"updatedBy"`
+}
+
+type Analyte struct {
+	Code              string           `json:"code" bson:"code"`
+	Name              string           `json:"name" bson:"name"`
+	Unit              string           `json:"unit" bson:"unit"`
+	ReferenceRanges   []ReferenceRange `json:"referenceRanges" bson:"referenceRanges"`
+	CriticalLow       *float64         `json:"criticalLow,omitempty" bson:"criticalLow,omitempty"`
+	CriticalHigh      *float64         `json:"criticalHigh,omitempty" bson:"criticalHigh,omitempty"`
+	DeltaCheckPercent *float64         `json:"deltaCheckPercent,omitempty" bson:"deltaCheckPercent,omitempty"`
+}
+
+/*
+* Sex is M, F or ANY, the age limits are in years
+ */
+type ReferenceRange struct {
+	Sex         string   `json:"sex" bson:"sex"`
+	MinAgeYears *float64 `json:"minAgeYears,omitempty" bson:"minAgeYears,omitempty"`
+	MaxAgeYears *float64 `json:"maxAgeYears,omitempty" bson:"maxAgeYears,omitempty"`
+	Low         *float64 `json:"low,omitempty" bson:"low,omitempty"`
+	High        *float64 `json:"high,omitempty" bson:"high,omitempty"`
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+* Report of a test ordered for a patient(the lab order)
+* status ORDERED -> COLLECTED -> RECEIVED -> IN_PROCESS -> RESULTED -> VERIFIED
+* Results are released to the patient only after another user verifies them
+ */
+type TestReport struct {
+	ID                 primitive.ObjectID `json:"id" bson:"id"`
+	Code               string             `json:"code" bson:"code"`
+	TestID             string             `json:"testId" bson:"testId"`
+	TestName           string             `json:"testName" bson:"testName"`
+	Type               string             `json:"type" bson:"type"`
+	SpecimenType       string             `json:"specimenType" bson:"specimenType"`
+	TurnaroundHours    int                `json:"turnaroundHours" bson:"turnaroundHours"`
+	Price              string             `json:"price" bson:"price"`
+	PatientID          string             `json:"patientId" bson:"patientId"`
+	DoctorID           string             `json:"doctorId" bson:"doctorId"`
+	TenantID           string             `json:"tenantId" bson:"tenantId"`
+	HospitalID         string             `json:"hospitalId" bson:"hospitalId"`
+	Status             string             `json:"status" bson:"status"`
+	StatusHistory      []StatusStep       `json:"statusHistory" bson:"statusHistory"`
+	AccessionNo        string             `json:"accessionNo,omitempty" bson:"accessionNo,omitempty"`
+	RecollectionNeeded bool               `json:"recollectionRequired" bson:"recollectionRequired"`
+	SampleRejection    *SampleRejection   `json:"sampleRejection,omitempty" bson:"sampleRejection,omitempty"`
+	DueAt              *time.Time         `json:"dueAt,omitempty" bson:"dueAt,omitempty"`
+	Results            []AnalyteResult    `json:"results" bson:"results"`
+	HasCritical        bool               `json:"hasCritical" bson:"hasCritical"`
+	CriticalNotifiedAt *time.Time         `json:"criticalNotifiedAt,omitempty" bson:"criticalNotifiedAt,omitempty"`
+	ResultedBy         string             `json:"resultedBy" bson:"resultedBy"`
+	ResultedAt         *time.Time         `json:"resultedAt,omitempty" bson:"resultedAt,omitempty"`
+	VerifiedBy         string             `json:"verifiedBy" bson:"verifiedBy"`
+	VerifiedByColl     string             `json:"verifiedByCollection,omitempty" bson:"verifiedByCollection,omitempty"`
+	VerifiedAt         *time.Time         `json:"verifiedAt,omitempty" bson:"verifiedAt,omitempty"`
+	ReleasedAt         *time.Time         `json:"releasedAt,omitempty" bson:"releasedAt,omitempty"`
+	Rejection          *Rejection         `json:"rejection,omitempty" bson:"rejection,omitempty"`
+	Signature          *Signature         `json:"signature,omitempty" bson:"signature,omitempty"`
+	CreatedAt          time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+/*
+* Flag is N, L, H or the critical LL, HH
+* deltaFailed is set when the change from previousValue exceeds deltaCheckPercent
+ */
+type AnalyteResult struct {
+	AnalyteCode       string          `json:"analyteCode" bson:"analyteCode"`
+	AnalyteName       string          `json:"analyteName" bson:"analyteName"`
+	TestID            string          `json:"testId" bson:"testId"`
+	Unit              string          `json:"unit" bson:"unit"`
+	ReferenceRange    *ReferenceRange `json:"referenceRange,omitempty" bson:"referenceRange,omitempty"`
+	CriticalLow       *float64        `json:"criticalLow,omitempty" bson:"criticalLow,omitempty"`
+	CriticalHigh      *float64        `json:"criticalHigh,omitempty" bson:"criticalHigh,omitempty"`
+	DeltaCheckPercent *float64        `json:"deltaCheckPercent,omitempty" bson:"deltaCheckPercent,omitempty"`
+	Value             interface{}     `json:"value" bson:"value"`
+	Flag              string          `json:"flag,omitempty" bson:"flag,omitempty"`
+	IsCritical        bool            `json:"isCritical" bson:"isCritical"`
+	PreviousValue     *float64        `json:"previousValue,omitempty" bson:"previousValue,omitempty"`
+	PreviousReportID  string          `json:"previousReportId,omitempty" bson:"previousReportId,omitempty"`
+	DeltaPercent      *float64        `json:"deltaPercent,omitempty" bson:"deltaPercent,omitempty"`
+	DeltaFailed       bool            `json:"deltaFailed" bson:"deltaFailed"`
+	Comment           string          `json:"comment,omitempty" bson:"comment,omitempty"`
+	EnteredBy         string          `json:"enteredBy,omitempty" bson:"enteredBy,omitempty"`
+	EnteredAt         *time.Time      `json:"enteredAt,omitempty" bson:"enteredAt,omitempty"`
+}
+
+type Rejection struct {
+	Reason     string    `json:"reason" bson:"reason"`
+	RejectedBy string    `json:"rejectedBy" bson:"rejectedBy"`
+	RejectedAt time.Time `json:"rejectedAt" bson:"rejectedAt"`
+}
+
+type StatusStep struct {
+	Status string    `json:"status" bson:"status"`
+	By     string    `json:"by" bson:"by"`
+	At     time.Time `json:"at" bson:"at"`
+	Note   string    `json:"note,omitempty" bson:"note,omitempty"`
+}
+
+/*
+* Specimen collected for a test report, code is the accession number
+* A rejected specimen is recollected with a new accession number(recollectionOf is the old one)
+ */
+type Specimen struct {
+	ID             primitive.ObjectID `json:"id" bson:"id"`
+	Code           string             `json:"code" bson:"code"`
+	TestReportID   string             `json:"testReportId" bson:"testReportId"`
+	TestID         string             `json:"testId" bson:"testId"`
+	TestName       string             `json:"testName" bson:"testName"`
+	SpecimenType   string             `json:"specimenType" bson:"specimenType"`
+	PatientID      string             `json:"patientId" bson:"patientId"`
+	HospitalID     string             `json:"hospitalId" bson:"hospitalId"`
+	TenantID       string             `json:"tenantId" bson:"tenantId"`
+	Status         string             `json:"status" bson:"status"`
+	RecollectionOf string             `json:"recollectionOf,omitempty" bson:"recollectionOf,omitempty"`
+	CollectedBy    string             `json:"collectedBy" bson:"collectedBy"`
+	CollectedAt    time.Time          `json:"collectedAt" bson:"collectedAt"`
+	ReceivedBy     string             `json:"receivedBy,omitempty" bson:"receivedBy,omitempty"`
+	ReceivedAt     *time.Time         `json:"receivedAt,omitempty" bson:"receivedAt,omitempty"`
+	ProcessedBy    string             `json:"processedBy,omitempty" bson:"processedBy,omitempty"`
+	ProcessingAt   *time.Time         `json:"processingAt,omitempty" bson:"processingAt,omitempty"`
+	Rejection      *SampleRejection   `json:"rejection,omitempty" bson:"rejection,omitempty"`
+}
+
+/*
+* Reason is HEMOLYSED, INSUFFICIENT, CLOTTED, MISLABELED, CONTAMINATED or OTHER
+ */
+type SampleRejection struct {
+	Reason     string    `json:"reason" bson:"reason"`
+	Note       string    `json:"note,omitempty" bson:"note,omitempty"`
+	RejectedBy string    `json:"rejectedBy" bson:"rejectedBy"`
+	RejectedAt time.Time `json:"rejectedAt" bson:"rejectedAt"`
+}
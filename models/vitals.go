@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+* One set of vital signs recorded by a nurse
+* temperature in celsius, height in cm, weight in kg, bloodGlucose in mg/dL
+ */
+type Vitals struct {
+	ID                 primitive.ObjectID `json:"id" bson:"id"`
+	Code               string             `json:"code" bson:"code"`
+	MedicalRecordID    string             `json:"medicalRecordId" bson:"medicalRecordId"`
+	PatientID          string             `json:"patientId" bson:"patientId"`
+	DoctorID           string             `json:"doctorId" bson:"doctorId"`
+	HospitalID         string             `json:"hospitalId" bson:"hospitalId"`
+	TenantID           string             `json:"tenantId" bson:"tenantId"`
+	Systolic           *float64           `json:"systolic,omitempty" bson:"systolic,omitempty"`
+	Diastolic          *float64           `json:"diastolic,omitempty" bson:"diastolic,omitempty"`
+	Pulse              *float64           `json:"pulse,omitempty" bson:"pulse,omitempty"`
+	Temperature        *float64           `json:"temperature,omitempty" bson:"temperature,omitempty"`
+	SpO2               *float64           `json:"spo2,omitempty" bson:"spo2,omitempty"`
+	RespiratoryRate    *float64           `json:"respiratoryRate,omitempty" bson:"respiratoryRate,omitempty"`
+	Height             *float64           `json:"height,omitempty" bson:"height,omitempty"`
+	Weight             *float64           `json:"weight,omitempty" bson:"weight,omitempty"`
+	BMI                *float64           `json:"bmi,omitempty" bson:"bmi,omitempty"`
+	PainScore          *float64           `json:"painScore,omitempty" bson:"painScore,omitempty"`
+	BloodGlucose       *float64           `json:"bloodGlucose,omitempty" bson:"bloodGlucose,omitempty"`
+	Consciousness      string             `json:"consciousness,omitempty" bson:"consciousness,omitempty"`
+	OnOxygen           bool               `json:"onOxygen" bson:"onOxygen"`
+	SpO2Scale          int                `json:"spo2Scale" bson:"spo2Scale"`
+	NEWS2              *NEWS2             `json:"news2,omitempty" bson:"news2,omitempty"`
+	EscalationRequired bool               `json:"escalationRequired" bson:"escalationRequired"`
+	RecordedBy         string             `json:"recordedBy" bson:"recordedBy"`
+	TakenAt            time.Time          `json:"takenAt" bson:"takenAt"`
+	CreatedAt          time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+/*
+* Risk is LOW, LOW_MEDIUM, MEDIUM or HIGH
+ */
+type NEWS2 struct {
+	Score      int            `json:"score" bson:"score"`
+	Risk       string         `json:"risk" bson:"risk"`
+	Components map[string]int `json:"components" bson:"components"`
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+* Ward of a hospital, dailyTariff is used for the rooms and beds which do not have their own
+ */
+type Ward struct {
+	ID          primitive.ObjectID `json:"id" bson:"id"`
+	Code        string             `json:"code" bson:"code"`
+	Name        string             `json:"name" bson:"name"`
+	WardType    string             `json:"wardType" bson:"wardType"`
+	Floor       string             `json:"floor" bson:"floor"`
+	DailyTariff int                `json:"dailyTariff" bson:"dailyTariff"`
+	HospitalID  string             `json:"hospitalId" bson:"hospitalId"`
+	TenantID    string             `json:"tenantId" bson:"tenantId"`
+	CreatedBy   string             `json:"createdBy" bson:"createdBy"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+type Room struct {
+	ID          primitive.ObjectID `json:"id" bson:"id"`
+	Code        string             `json:"code" bson:"code"`
+	WardID      string             `json:"wardId" bson:"wardId"`
+	RoomNo      string             `json:"roomNo" bson:"roomNo"`
+	RoomType    string             `json:"roomType" bson:"roomType"`
+	DailyTariff int                `json:"dailyTariff" bson:"dailyTariff"`
+	HospitalID  string             `json:"hospitalId" bson:"hospitalId"`
+	TenantID    string             `json:"tenantId" bson:"tenantId"`
+	CreatedBy   string             `json:"createdBy" bson:"createdBy"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+/*
+* status is AVAILABLE, OCCUPIED or MAINTENANCE, patientId is set while it is occupied
+ */
+type Bed struct {
+	ID              primitive.ObjectID `json:"id" bson:"id"`
+	Code            string             `json:"code" bson:"code"`
+	WardID          string             `json:"wardId" bson:"wardId"`
+	RoomID          string             `json:"roomId" bson:"roomId"`
+	RoomNo          string             `json:"roomNo" bson:"roomNo"`
+	BedNo           string             `json:"bedNo" bson:"bedNo"`
+	BedType         string             `json:"bedType" bson:"bedType"`
+	DailyTariff     int                `json:"dailyTariff" bson:"dailyTariff"`
+	Status          string             `json:"status" bson:"status"`
+	PatientID       string             `json:"patientId,omitempty" bson:"patientId,omitempty"`
+	BedAssignmentID string             `json:"bedAssignmentId,omitempty" bson:"bedAssignmentId,omitempty"`
+	OccupiedSince   *time.Time         `json:"occupiedSince,omitempty" bson:"occupiedSince,omitempty"`
+	HospitalID      string             `json:"hospitalId" bson:"hospitalId"`
+	TenantID        string             `json:"tenantId" bson:"tenantId"`
+	CreatedBy       string             `json:"createdBy" bson:"createdBy"`
+	CreatedAt       time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+/*
+* Stay of the patient in one bed, from the admission or transfer(startReason) to the transfer or discharge(endReason)
+* chargedThrough is the last day(YYYY-MM-DD) charged to the running bill
+ */
+type BedAssignment struct {
+	ID             primitive.ObjectID `json:"id" bson:"id"`
+	Code           string             `json:"code" bson:"code"`
+	PatientID      string             `json:"patientId" bson:"patientId"`
+	HospitalID     string             `json:"hospitalId" bson:"hospitalId"`
+	TenantID       string             `json:"tenantId" bson:"tenantId"`
+	WardID         string             `json:"wardId" bson:"wardId"`
+	RoomID         string             `json:"roomId" bson:"roomId"`
+	RoomNo         string             `json:"roomNo" bson:"roomNo"`
+	BedID          string             `json:"bedId" bson:"bedId"`
+	BedNo          string             `json:"bedNo" bson:"bedNo"`
+	BedType        string             `json:"bedType" bson:"bedType"`
+	DailyTariff    int                `json:"dailyTariff" bson:"dailyTariff"`
+	AdmissionDate  string             `json:"admissionDate" bson:"admissionDate"`
+	From           time.Time          `json:"from" bson:"from"`
+	To             *time.Time         `json:"to,omitempty" bson:"to,omitempty"`
+	StartReason    string             `json:"startReason" bson:"startReason"`
+	EndReason      string             `json:"endReason,omitempty" bson:"endReason,omitempty"`
+	TransferReason string             `json:"transferReason,omitempty" bson:"transferReason,omitempty"`
+	ChargedThrough string             `json:"chargedThrough,omitempty" bson:"chargedThrough,omitempty"`
+	ChargedDays    int                `json:"chargedDays" bson:"chargedDays"`
+	ChargedAmount  int                `json:"chargedAmount" bson:"chargedAmount"`
+	CreatedBy      string             `json:"createdBy" bson:"createdBy"`
+	ClosedBy       string             `json:"closedBy,omitempty" bson:"closedBy,omitempty"`
+	CreatedAt      time.Time          `json:"createdAt" bson:"createdAt"`
+}
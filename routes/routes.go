@@ -15,6 +15,9 @@ func Routes(r *gin.Engine) {
 	r.POST("/SUPERADMIN/create", controllers.CreateSuperAdmin)
 	r.GET("/roles/fetchAll", controllers.ReadRoles)
 	controllers.Auth(r)
+	controllers.PrescriptionVerification(r)
+	controllers.LabReportVerification(r)
+	controllers.DischargeVerification(r)
 	//privateroutes
 	r.Use(authorization.JWTAuth())
 	controllers.SuperAdmin(r)
@@ -27,12 +30,25 @@ func Routes(r *gin.Engine) {
 	controllers.Patient(r)
 	controllers.Guardian(r)
 	controllers.MedicalRecord(r)
+	controllers.Vitals(r)
+	controllers.Diagnosis(r)
+	controllers.ClinicalNote(r)
+	controllers.Allergy(r)
+	controllers.Attachment(r)
 	controllers.Medicines(r)
 	controllers.Appointment(r)
 	controllers.Prescription(r)
 	controllers.TestReport(r)
 	controllers.Test(r)
 	controllers.Bill(r)
+	controllers.Discharge(r)
+	controllers.Ward(r)
+	controllers.ADT(r)
+	controllers.PendingDispense(r)
+	controllers.ControlledRegister(r)
+	controllers.Refill(r)
+	controllers.HL7(r)
+	controllers.FHIR(r)
 	controllers.Report(r)
 	controllers.Consent(r)
 	controllers.Role(r)
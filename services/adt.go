@@ -0,0 +1,383 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	redis "github.com/KanapuramVaishnavi/Core/config/redis"
+	common "github.com/KanapuramVaishnavi/Core/coreServices"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+* Occupy the bed only when it is still available
+* The status in the filter makes the claim atomic, two admissions to the same bed cannot both match
+ */
+func claimBed(c context.Context, bedId string, hospitalId string, patientId string, assignmentId string) error {
+	filter := bson.M{"code": bedId, "hospitalId": hospitalId, "status": BED_STATUS_AVAILABLE}
+	update := bson.M{"$set": bson.M{
+		"status":          BED_STATUS_OCCUPIED,
+		"patientId":       patientId,
+		"bedAssignmentId": assignmentId,
+		"occupiedSince":   time.Now(),
+	}}
+	result, err := db.UpdateOne(c, db.OpenCollections(BedCollection), filter, update)
+	if err != nil {
+		log.Println("Error from updateOne(bed): ", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New(BED_NOT_AVAILABLE + bedId)
+	}
+	return nil
+}
+
+/*
+* Free the bed, only the patient in the bed can free it
+ */
+func releaseBed(c context.Context, bedId string, patientId string) error {
+	filter := bson.M{"code": bedId, "patientId": patientId, "status": BED_STATUS_OCCUPIED}
+	update := bson.M{
+		"$set":   bson.M{"status": BED_STATUS_AVAILABLE, "updatedAt": time.Now()},
+		"$unset": bson.M{"patientId": "", "bedAssignmentId": "", "occupiedSince": ""},
+	}
+	if _, err := db.UpdateOne(c, db.OpenCollections(BedCollection), filter, update); err != nil {
+		log.Println("Error from updateOne(bed): ", err)
+		return err
+	}
+	return nil
+}
+
+/*
+* Bed assignment the patient is in now(not closed yet)
+ */
+func openBedAssignment(c context.Context, patientId string) (map[string]interface{}, error) {
+	assignment := make(map[string]interface{})
+	err := db.FindOne(c, db.OpenCollections(BedAssignmentCollection), bson.M{"patientId": patientId, "to": nil}, assignment)
+	if err != nil {
+		log.Println("Error from findOne(bedAssignment): ", err)
+		return nil, errors.New(PATIENT_NOT_IN_BED + patientId)
+	}
+	return assignment, nil
+}
+
+/*
+* Claim the bed first and then save the assignment, the bed is freed again when the save fails
+* The tariff of the bed is kept on the assignment, later changes apply to the next assignments
+ */
+func startBedAssignment(c *gin.Context, patient map[string]interface{}, bed map[string]interface{}, admissionDate string, reason string, transferReason string) (map[string]interface{}, error) {
+	patientId := getString(patient["code"])
+	bedId := getString(bed["code"])
+	code, err := GenerateCode(BedAssignmentCollection)
+	if err != nil {
+		log.Println("Error from generateCode: ", err)
+		return nil, err
+	}
+	if err := claimBed(c, bedId, getString(bed["hospitalId"]), patientId, code); err != nil {
+		return nil, err
+	}
+	assignment := map[string]interface{}{
+		"code":          code,
+		"patientId":     patientId,
+		"hospitalId":    bed["hospitalId"],
+		"tenantId":      patient["tenantId"],
+		"wardId":        bed["wardId"],
+		"roomId":        bed["roomId"],
+		"roomNo":        bed["roomNo"],
+		"bedId":         bedId,
+		"bedNo":         bed["bedNo"],
+		"bedType":       bed["bedType"],
+		"dailyTariff":   toInt(bed["dailyTariff"]),
+		"admissionDate": admissionDate,
+		"from":          time.Now(),
+		"startReason":   reason,
+		"chargedDays":   0,
+		"chargedAmount": 0,
+		"createdBy":     c.GetString("code"),
+		"createdAt":     time.Now(),
+	}
+	if transferReason != "" {
+		assignment["transferReason"] = transferReason
+	}
+	if _, err := db.CreateOne(c, db.OpenCollections(BedAssignmentCollection), assignment); err != nil {
+		log.Println("Error from createOne(bedAssignment): ", err)
+		if err := releaseBed(c, bedId, patientId); err != nil {
+			log.Println("Error from releaseBed: ", err)
+		}
+		return nil, err
+	}
+	return assignment, nil
+}
+
+/*
+* Undo startBedAssignment when the admission or the transfer cannot be completed
+ */
+func abandonBedAssignment(c context.Context, assignment map[string]interface{}) {
+	if _, err := db.DeleteOne(c, db.OpenCollections(BedAssignmentCollection), bson.M{"code": assignment["code"]}); err != nil {
+		log.Println("Error from deleteOne(bedAssignment): ", err)
+	}
+	if err := releaseBed(c, getString(assignment["bedId"]), getString(assignment["patientId"])); err != nil {
+		log.Println("Error from releaseBed: ", err)
+	}
+}
+
+/*
+* Close the assignment at the given time and free the bed
+* Charges up to the day before are accrued first, the night of that day is charged to the next bed
+ */
+func closeBedAssignment(c context.Context, assignment map[string]interface{}, at time.Time, reason string, by string) error {
+	if from, ok := toTime(assignment["from"]); ok && at.Before(from) {
+		at = from
+	}
+	if _, err := accrueBedCharges(c, assignment, chargeDay(at).AddDate(0, 0, -1), by); err != nil {
+		log.Println("Error from accrueBedCharges: ", err)
+		return err
+	}
+	filter := bson.M{"code": assignment["code"], "to": nil}
+	update := bson.M{"$set": bson.M{"to": at, "endReason": reason, "closedBy": by}}
+	result, err := db.UpdateOne(c, db.OpenCollections(BedAssignmentCollection), filter, update)
+	if err != nil {
+		log.Println("Error from updateOne(bedAssignment): ", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New(BED_ASSIGNMENT_CLOSED + getString(assignment["code"]))
+	}
+	return releaseBed(c, getString(assignment["bedId"]), getString(assignment["patientId"]))
+}
+
+/*
+* Update the bed of the patient only when it is still the bed that was read(empty when the patient is not in a bed)
+* Two admissions or transfers of the same patient running together cannot both move the patient
+ */
+func updatePatientBed(c *gin.Context, patientId string, currentBedId string, update bson.M) error {
+	filter := bson.M{"code": patientId, "currentBedId": currentBedId}
+	if currentBedId == "" {
+		filter["currentBedId"] = bson.M{"$in": bson.A{nil, ""}}
+	}
+	result, err := db.UpdateOne(c, db.OpenCollections(util.PatientCollection), filter, update)
+	if err != nil {
+		log.Println("Error from updateOne(patient): ", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New(PATIENT_BED_CHANGED + patientId)
+	}
+	if err := redis.DeleteCache(c, util.PatientKey+patientId); err != nil {
+		log.Println("Failed deleting old patient cache: ", err)
+	}
+	return nil
+}
+
+/*
+* Staff of the hospital of the patient, the patient must be of the same hospital as the user
+ */
+func fetchPatientForBed(c *gin.Context, patientId string) (map[string]interface{}, string, error) {
+	hospitalId, err := wardHospital(c)
+	if err != nil {
+		return nil, "", err
+	}
+	patient, err := FetchPatientByCode(c, patientId)
+	if err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, "", err
+	}
+	if getString(patient["hospitalId"]) != hospitalId {
+		return nil, "", errors.New(ONLY_STAFF_CAN_MOVE_PATIENTS)
+	}
+	return patient, hospitalId, nil
+}
+
+/*
+* Admit the patient to the bed{bedId, admissionDate}
+* admissionDate defaults to today, a patient admitted earlier without a bed keeps the admissionDate
+ */
+func AdmitPatient(c *gin.Context, patientId string, data map[string]interface{}) (map[string]interface{}, error) {
+	patient, hospitalId, err := fetchPatientForBed(c, patientId)
+	if err != nil {
+		return nil, err
+	}
+	if bedId := getString(patient["currentBedId"]); bedId != "" {
+		return nil, errors.New(PATIENT_ALREADY_IN_BED + bedId)
+	}
+	admissionDate := strings.TrimSpace(getString(patient["admissionDate"]))
+	if admissionDate == "" {
+		admissionDate = time.Now().Format(QUERY_DATE_FORMAT)
+		if given := strings.TrimSpace(getString(data["admissionDate"])); given != "" {
+			admissionDate, err = common.NormalizeDate(given)
+			if err != nil {
+				log.Println("Error from normalizeDate: ", err)
+				return nil, err
+			}
+		}
+	}
+	bed, err := fetchBed(c, strings.TrimSpace(getString(data["bedId"])), hospitalId)
+	if err != nil {
+		return nil, err
+	}
+	assignment, err := startBedAssignment(c, patient, bed, admissionDate, BED_MOVE_ADMIT, "")
+	if err != nil {
+		log.Println("Error from startBedAssignment: ", err)
+		return nil, err
+	}
+	update := bson.M{"$set": bson.M{
+		"admissionDate": admissionDate,
+		"currentBedId":  bed["code"],
+		"currentWardId": bed["wardId"],
+		"updatedBy":     c.GetString("code"),
+		"updatedAt":     time.Now(),
+	}}
+	if err := updatePatientBed(c, patientId, "", update); err != nil {
+		abandonBedAssignment(c, assignment)
+		return nil, err
+	}
+	return assignment, nil
+}
+
+/*
+* Move the admitted patient to another bed{bedId, reason}
+* The new bed is claimed before the old one is freed, so a failed transfer leaves the patient in the old bed
+* The new bed is freed again when the old assignment cannot be closed(another transfer closed it meanwhile)
+* When the patient cannot be moved after that, the new assignment is abandoned and the old one is opened again
+ */
+func TransferPatient(c *gin.Context, patientId string, data map[string]interface{}) (map[string]interface{}, error) {
+	patient, hospitalId, err := fetchPatientForBed(c, patientId)
+	if err != nil {
+		return nil, err
+	}
+	current, err := openBedAssignment(c, patientId)
+	if err != nil {
+		return nil, err
+	}
+	bedId := strings.TrimSpace(getString(data["bedId"]))
+	if bedId == getString(current["bedId"]) {
+		return nil, errors.New(SAME_BED_TRANSFER + bedId)
+	}
+	bed, err := fetchBed(c, bedId, hospitalId)
+	if err != nil {
+		return nil, err
+	}
+	reason := strings.TrimSpace(getString(data["reason"]))
+	assignment, err := startBedAssignment(c, patient, bed, getString(current["admissionDate"]), BED_MOVE_TRANSFER, reason)
+	if err != nil {
+		log.Println("Error from startBedAssignment: ", err)
+		return nil, err
+	}
+	if err := closeBedAssignment(c, current, time.Now(), BED_MOVE_TRANSFER, c.GetString("code")); err != nil {
+		log.Println("Error from closeBedAssignment: ", err)
+		abandonBedAssignment(c, assignment)
+		return nil, err
+	}
+	update := bson.M{"$set": bson.M{
+		"currentBedId":  bed["code"],
+		"currentWardId": bed["wardId"],
+		"updatedBy":     c.GetString("code"),
+		"updatedAt":     time.Now(),
+	}}
+	if err := updatePatientBed(c, patientId, getString(current["bedId"]), update); err != nil {
+		abandonBedAssignment(c, assignment)
+		if err := reopenBedAssignment(c, current); err != nil {
+			log.Println("Error from reopenBedAssignment: ", err)
+		}
+		return nil, err
+	}
+	return assignment, nil
+}
+
+/*
+* Bed charges up to the discharge, called before the bills are checked so the final bill has them
+* The nights before the discharge day are charged, a stay without any night is charged for one day
+ */
+func accrueDischargeBedCharges(c *gin.Context, patient map[string]interface{}, dischargeAt time.Time) error {
+	patientId := getString(patient["code"])
+	if getString(patient["currentBedId"]) == "" {
+		return nil
+	}
+	assignment, err := openBedAssignment(c, patientId)
+	if err != nil {
+		return err
+	}
+	if _, err := accrueBedCharges(c, assignment, chargeDay(dischargeAt).AddDate(0, 0, -1), c.GetString("code")); err != nil {
+		log.Println("Error from accrueBedCharges: ", err)
+		return err
+	}
+	assignments, err := db.FindAll(c, db.OpenCollections(BedAssignmentCollection), bson.M{"patientId": patientId, "admissionDate": assignment["admissionDate"]}, nil)
+	if err != nil {
+		log.Println("Error from findAll(bedAssignment): ", err)
+		return err
+	}
+	chargedDays := 0
+	for _, a := range assignments {
+		chargedDays += toInt(a.(map[string]interface{})["chargedDays"])
+	}
+	if chargedDays > 0 {
+		return nil
+	}
+	assignment, err = openBedAssignment(c, patientId)
+	if err != nil {
+		return err
+	}
+	if _, err := accrueBedCharges(c, assignment, chargeDay(dischargeAt), c.GetString("code")); err != nil {
+		log.Println("Error from accrueBedCharges: ", err)
+		return err
+	}
+	return nil
+}
+
+/*
+* Open the assignment closed by closeBedAssignment again and occupy its bed, when the move cannot be completed
+ */
+func reopenBedAssignment(c context.Context, assignment map[string]interface{}) error {
+	if err := claimBed(c, getString(assignment["bedId"]), getString(assignment["hospitalId"]), getString(assignment["patientId"]), getString(assignment["code"])); err != nil {
+		log.Println("Error from claimBed: ", err)
+		return err
+	}
+	update := bson.M{"$set": bson.M{"to": nil}, "$unset": bson.M{"endReason": "", "closedBy": ""}}
+	if _, err := db.UpdateOne(c, db.OpenCollections(BedAssignmentCollection), bson.M{"code": assignment["code"]}, update); err != nil {
+		log.Println("Error from updateOne(bedAssignment): ", err)
+		return err
+	}
+	return nil
+}
+
+/*
+* Free the bed of the discharged patient, the closed assignment is returned(nil when the patient is not in a bed)
+ */
+func releaseDischargedBed(c *gin.Context, patient map[string]interface{}, dischargeAt time.Time) (map[string]interface{}, error) {
+	if getString(patient["currentBedId"]) == "" {
+		return nil, nil
+	}
+	assignment, err := openBedAssignment(c, getString(patient["code"]))
+	if err != nil {
+		return nil, err
+	}
+	if err := closeBedAssignment(c, assignment, dischargeAt, BED_MOVE_DISCHARGE, c.GetString("code")); err != nil {
+		return nil, err
+	}
+	return assignment, nil
+}
+
+/*
+* Beds the patient was in, oldest first
+ */
+func FetchBedHistory(c *gin.Context, patientId string) ([]interface{}, error) {
+	if _, err := FetchPatientByCode(c, patientId); err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, err
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "from", Value: 1}})
+	assignments, err := db.FindAll(c, db.OpenCollections(BedAssignmentCollection), bson.M{"patientId": patientId}, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	return assignments, nil
+}
@@ -0,0 +1,415 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	common "github.com/KanapuramVaishnavi/Core/coreServices"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+* Doctor or nurse of the hospital of the patient
+ */
+func verifyClinicalStaff(c *gin.Context, patient map[string]interface{}) error {
+	collection := c.GetString("collection")
+	if collection != util.DoctorCollection && collection != util.NurseCollection {
+		return errors.New(ONLY_CLINICAL_STAFF_CAN_RECORD)
+	}
+	hospitalId, err := fetchStaffHospital(c)
+	if err != nil {
+		return err
+	}
+	if hospitalId != getString(patient["hospitalId"]) {
+		return errors.New(ONLY_CLINICAL_STAFF_CAN_RECORD)
+	}
+	return nil
+}
+
+func upperChoice(data map[string]interface{}, field string, allowed []string, message string) (string, error) {
+	value := strings.ToUpper(strings.TrimSpace(getString(data[field])))
+	if !slices.Contains(allowed, value) {
+		return "", errors.New(message)
+	}
+	return value, nil
+}
+
+func fetchAllergy(c *gin.Context, allergyId string) (map[string]interface{}, error) {
+	allergy := make(map[string]interface{})
+	collection := db.OpenCollections(AllergyCollection)
+	if err := db.FindOne(c, collection, bson.M{"code": allergyId}, allergy); err != nil {
+		log.Println("Error from findOne(allergy): ", err)
+		return nil, errors.New(ALLERGY_NOT_FOUND + allergyId)
+	}
+	return allergy, nil
+}
+
+/*
+* Record an allergy{substance, category, reaction, severity, onsetDate, notes}
+* A substance can be active only once for the patient
+* Allergy recorded by a doctor is verified by that doctor, otherwise it stays UNVERIFIED
+ */
+func CreateAllergy(c *gin.Context, patientId string, data map[string]interface{}) (string, error) {
+	patient, err := FetchPatientByCode(c, patientId)
+	if err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return "", err
+	}
+	if err := verifyClinicalStaff(c, patient); err != nil {
+		return "", err
+	}
+	for _, field := range []string{"substance", "reaction"} {
+		if err := common.GetTrimmedString(data, field); err != nil {
+			log.Println("Error from getTrimmedString: ", err)
+			return "", err
+		}
+	}
+	category, err := upperChoice(data, "category", AllergyCategories, INVALID_ALLERGY_CATEGORY)
+	if err != nil {
+		return "", err
+	}
+	severity, err := upperChoice(data, "severity", AllergySeverities, INVALID_ALLERGY_SEVERITY)
+	if err != nil {
+		return "", err
+	}
+	substance := getString(data["substance"])
+	collection := db.OpenCollections(AllergyCollection)
+	existing := make(map[string]interface{})
+	filter := bson.M{
+		"patientId": patientId,
+		"substance": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(substance) + "$", Options: "i"},
+		"status":    ALLERGY_STATUS_ACTIVE,
+	}
+	if err := db.FindOne(c, collection, filter, existing); err == nil {
+		return "", errors.New(ALLERGY_ALREADY_RECORDED + getString(existing["code"]))
+	}
+	code, err := GenerateCode(AllergyCollection)
+	if err != nil {
+		log.Println("Error from generateCode: ", err)
+		return "", err
+	}
+	userId := c.GetString("code")
+	now := time.Now()
+	allergy := map[string]interface{}{
+		"code":               code,
+		"patientId":          patientId,
+		"substance":          substance,
+		"category":           category,
+		"reaction":           data["reaction"],
+		"severity":           severity,
+		"status":             ALLERGY_STATUS_ACTIVE,
+		"verificationStatus": ALLERGY_VERIFICATION_UNVERIFIED,
+		"hospitalId":         patient["hospitalId"],
+		"tenantId":           patient["tenantId"],
+		"recordedBy":         userId,
+		"createdAt":          now,
+		"updatedBy":          userId,
+		"updatedAt":          now,
+	}
+	if c.GetString("collection") == util.DoctorCollection {
+		allergy["verificationStatus"] = ALLERGY_VERIFICATION_CONFIRMED
+		allergy["verifiedBy"] = userId
+		allergy["verifiedAt"] = now
+	}
+	if _, exists := data["onsetDate"]; exists {
+		onset, err := parseOnsetDate(data["onsetDate"])
+		if err != nil {
+			return "", err
+		}
+		allergy["onsetDate"] = onset
+	}
+	if notes := strings.TrimSpace(getString(data["notes"])); notes != "" {
+		allergy["notes"] = notes
+	}
+	if _, err := db.CreateOne(c, collection, allergy); err != nil {
+		log.Println("Error from createOne: ", err)
+		return "", err
+	}
+	return code, nil
+}
+
+/*
+* Update reaction, severity, status(ACTIVE, INACTIVE, ENTERED_IN_ERROR) or notes of an allergy
+ */
+func UpdateAllergy(c *gin.Context, allergyId string, data map[string]interface{}) (map[string]interface{}, error) {
+	allergy, err := fetchAllergy(c, allergyId)
+	if err != nil {
+		return nil, err
+	}
+	patient, err := FetchPatientByCode(c, getString(allergy["patientId"]))
+	if err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, err
+	}
+	if err := verifyClinicalStaff(c, patient); err != nil {
+		return nil, err
+	}
+	set := bson.M{"updatedBy": c.GetString("code"), "updatedAt": time.Now()}
+	if _, exists := data["reaction"]; exists {
+		if err := common.GetTrimmedString(data, "reaction"); err != nil {
+			log.Println("Error from getTrimmedString: ", err)
+			return nil, err
+		}
+		set["reaction"] = data["reaction"]
+	}
+	if _, exists := data["severity"]; exists {
+		severity, err := upperChoice(data, "severity", AllergySeverities, INVALID_ALLERGY_SEVERITY)
+		if err != nil {
+			return nil, err
+		}
+		set["severity"] = severity
+	}
+	if _, exists := data["status"]; exists {
+		status, err := upperChoice(data, "status", AllergyStatuses, INVALID_ALLERGY_STATUS)
+		if err != nil {
+			return nil, err
+		}
+		set["status"] = status
+	}
+	if notes, exists := data["notes"]; exists {
+		set["notes"] = strings.TrimSpace(getString(notes))
+	}
+	collection := db.OpenCollections(AllergyCollection)
+	if _, err := db.UpdateOne(c, collection, bson.M{"code": allergyId}, bson.M{"$set": set}); err != nil {
+		log.Println("Error from updateOne: ", err)
+		return nil, err
+	}
+	for key, value := range set {
+		allergy[key] = value
+	}
+	return allergy, nil
+}
+
+/*
+* Doctor confirms or refutes the allergy, verifiedBy and verifiedAt are recorded
+ */
+func VerifyAllergy(c *gin.Context, allergyId string, data map[string]interface{}) (map[string]interface{}, error) {
+	if c.GetString("collection") != util.DoctorCollection {
+		return nil, errors.New(ONLY_DOCTOR_CAN_VERIFY_ALLERGY)
+	}
+	status, err := upperChoice(data, "verificationStatus", []string{ALLERGY_VERIFICATION_CONFIRMED, ALLERGY_VERIFICATION_REFUTED}, INVALID_ALLERGY_VERIFICATION)
+	if err != nil {
+		return nil, err
+	}
+	allergy, err := fetchAllergy(c, allergyId)
+	if err != nil {
+		return nil, err
+	}
+	patient, err := FetchPatientByCode(c, getString(allergy["patientId"]))
+	if err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, err
+	}
+	if err := verifyClinicalStaff(c, patient); err != nil {
+		return nil, err
+	}
+	doctorId := c.GetString("code")
+	set := bson.M{
+		"verificationStatus": status,
+		"verifiedBy":         doctorId,
+		"verifiedAt":         time.Now(),
+		"updatedBy":          doctorId,
+		"updatedAt":          time.Now(),
+	}
+	collection := db.OpenCollections(AllergyCollection)
+	if _, err := db.UpdateOne(c, collection, bson.M{"code": allergyId}, bson.M{"$set": set}); err != nil {
+		log.Println("Error from updateOne: ", err)
+		return nil, err
+	}
+	for key, value := range set {
+		allergy[key] = value
+	}
+	return allergy, nil
+}
+
+/*
+* Allergies of the patient, most severe first
+* Optional status filter, ENTERED_IN_ERROR entries are left out unless asked for
+ */
+func FetchAllergies(c *gin.Context, patientId string, status string) ([]interface{}, error) {
+	if _, err := FetchPatientByCode(c, patientId); err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, err
+	}
+	filter := bson.M{"patientId": patientId, "status": bson.M{"$ne": ALLERGY_STATUS_ENTERED_IN_ERROR}}
+	if status != "" {
+		normalized, err := upperChoice(map[string]interface{}{"status": status}, "status", AllergyStatuses, INVALID_ALLERGY_STATUS)
+		if err != nil {
+			return nil, err
+		}
+		filter["status"] = normalized
+	}
+	collection := db.OpenCollections(AllergyCollection)
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	allergies, err := db.FindAll(c, collection, filter, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	severityRank := func(a interface{}) int {
+		allergy, _ := a.(map[string]interface{})
+		return slices.Index(AllergySeverities, getString(allergy["severity"]))
+	}
+	slices.SortStableFunc(allergies, func(a, b interface{}) int {
+		return severityRank(b) - severityRank(a)
+	})
+	return allergies, nil
+}
+
+/*
+* Substance matches the medicine when it is part of its name, genericName or brandName(or the other way)
+ */
+func allergyMatchesMedicine(substance string, medicine map[string]interface{}) bool {
+	substance = strings.ToLower(strings.TrimSpace(substance))
+	if substance == "" {
+		return false
+	}
+	for _, field := range []string{"name", "genericName", "brandName"} {
+		value := strings.ToLower(strings.TrimSpace(getString(medicine[field])))
+		if value == "" {
+			continue
+		}
+		if strings.Contains(value, substance) || strings.Contains(substance, value) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+* Active DRUG allergies of the patient(not refuted) which match the medicines of the prescription
+* Every conflict has the medicine and the allergy with its reaction and severity
+ */
+func CheckMedicineAllergies(c *gin.Context, patientId string, rawMedicines []interface{}) ([]interface{}, error) {
+	filter := bson.M{
+		"patientId":          patientId,
+		"category":           ALLERGY_CATEGORY_DRUG,
+		"status":             ALLERGY_STATUS_ACTIVE,
+		"verificationStatus": bson.M{"$ne": ALLERGY_VERIFICATION_REFUTED},
+	}
+	allergies, err := db.FindAll(c, db.OpenCollections(AllergyCollection), filter, nil)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	conflicts := []interface{}{}
+	if len(allergies) == 0 {
+		return conflicts, nil
+	}
+	medicineColl := db.OpenCollections(util.MedicineCollection)
+	for _, m := range rawMedicines {
+		line, ok := m.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		medicine := make(map[string]interface{})
+		if err := db.FindOne(c, medicineColl, bson.M{"code": line["medicineId"]}, medicine); err != nil {
+			log.Println("Error from findOne(medicine): ", err)
+			return nil, err
+		}
+		for _, a := range allergies {
+			allergy, ok := a.(map[string]interface{})
+			if !ok || !allergyMatchesMedicine(getString(allergy["substance"]), medicine) {
+				continue
+			}
+			conflicts = append(conflicts, map[string]interface{}{
+				"medicineId":         medicine["code"],
+				"medicineName":       medicine["name"],
+				"allergyId":          allergy["code"],
+				"substance":          allergy["substance"],
+				"reaction":           allergy["reaction"],
+				"severity":           allergy["severity"],
+				"verificationStatus": allergy["verificationStatus"],
+			})
+		}
+	}
+	return conflicts, nil
+}
+
+/*
+* Prescribing a medicine the patient is allergic to needs allergyOverrideReason
+* An amendment without a reason keeps the previous override when it already covers every conflicting substance
+* The override(reason and the conflicts) is saved on the prescription
+ */
+func checkPrescriptionAllergies(c *gin.Context, patientId string, rawMedicines []interface{}, overrideReason string, previousOverride interface{}) (map[string]interface{}, error) {
+	conflicts, err := CheckMedicineAllergies(c, patientId, rawMedicines)
+	if err != nil {
+		log.Println("Error from checkMedicineAllergies: ", err)
+		return nil, err
+	}
+	if len(conflicts) == 0 {
+		return nil, nil
+	}
+	if strings.TrimSpace(overrideReason) == "" {
+		overrideReason = carriedOverrideReason(previousOverride, conflicts)
+	}
+	if strings.TrimSpace(overrideReason) == "" {
+		return nil, errors.New(ALLERGY_CONFLICT + strings.Join(conflictSubstances(conflicts), ", "))
+	}
+	return map[string]interface{}{
+		"reason":       strings.TrimSpace(overrideReason),
+		"conflicts":    conflicts,
+		"overriddenBy": c.GetString("code"),
+		"overriddenAt": time.Now(),
+	}, nil
+}
+
+/*
+* Distinct substances of the allergy conflicts
+ */
+func conflictSubstances(conflicts []interface{}) []string {
+	substances := []string{}
+	for _, raw := range conflicts {
+		var conflict map[string]interface{}
+		switch v := raw.(type) {
+		case map[string]interface{}:
+			conflict = v
+		case primitive.M:
+			conflict = v
+		default:
+			continue
+		}
+		substance := getString(conflict["substance"])
+		if !slices.Contains(substances, substance) {
+			substances = append(substances, substance)
+		}
+	}
+	return substances
+}
+
+/*
+* Reason of the previous override when its conflicts cover every substance in conflict now
+* Empty when there is no previous override or a new substance conflicts
+ */
+func carriedOverrideReason(previousOverride interface{}, conflicts []interface{}) string {
+	var override map[string]interface{}
+	switch v := previousOverride.(type) {
+	case map[string]interface{}:
+		override = v
+	case primitive.M:
+		override = v
+	default:
+		return ""
+	}
+	previousConflicts, err := normalizeMongoArray(override["conflicts"])
+	if err != nil {
+		return ""
+	}
+	covered := conflictSubstances(previousConflicts)
+	for _, substance := range conflictSubstances(conflicts) {
+		if !slices.Contains(covered, substance) {
+			return ""
+		}
+	}
+	return getString(override["reason"])
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCarriedOverrideReason(t *testing.T) {
+	previous := primitive.M{
+		"reason": "Tolerated before",
+		"conflicts": primitive.A{
+			primitive.M{"medicineId": "MED0001", "substance": "penicillin"},
+			primitive.M{"medicineId": "MED0002", "substance": "sulfa"},
+		},
+	}
+	cases := []struct {
+		name      string
+		previous  interface{}
+		conflicts []interface{}
+		want      string
+	}{
+		{"same substance", previous, []interface{}{map[string]interface{}{"substance": "penicillin"}}, "Tolerated before"},
+		{"all substances", previous, []interface{}{map[string]interface{}{"substance": "sulfa"}, map[string]interface{}{"substance": "penicillin"}}, "Tolerated before"},
+		{"new substance", previous, []interface{}{map[string]interface{}{"substance": "penicillin"}, map[string]interface{}{"substance": "aspirin"}}, ""},
+		{"no previous override", nil, []interface{}{map[string]interface{}{"substance": "penicillin"}}, ""},
+		{"previous without conflicts", map[string]interface{}{"reason": "Tolerated before"}, []interface{}{map[string]interface{}{"substance": "penicillin"}}, ""},
+	}
+	for _, tc := range cases {
+		if got := carriedOverrideReason(tc.previous, tc.conflicts); got != tc.want {
+			t.Errorf("%s: carriedOverrideReason = %q want %q", tc.name, got, tc.want)
+		}
+	}
+}
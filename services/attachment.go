@@ -0,0 +1,417 @@
+package services
+
+import (
+	"HealthHub360/storage"
+
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	attachmentStoreOnce sync.Once
+	attachmentStore     storage.Store
+	attachmentStoreErr  error
+)
+
+/*
+* Storage of the attachments is chosen from the env(STORAGE_DRIVER) on the first use
+ */
+func fetchAttachmentStore() (storage.Store, error) {
+	attachmentStoreOnce.Do(func() {
+		attachmentStore, attachmentStoreErr = storage.FromEnv()
+		if attachmentStoreErr != nil {
+			log.Println("Error from storage.FromEnv: ", attachmentStoreErr)
+		}
+	})
+	return attachmentStore, attachmentStoreErr
+}
+
+/*
+* Hook to scan the uploaded files, Scan returns an error naming the signature when the file is infected
+ */
+type VirusScanner interface {
+	Scan(ctx context.Context, data []byte) error
+}
+
+var AttachmentScanner VirusScanner
+
+/*
+* ClamAV daemon(clamd) scanner using the INSTREAM command, enabled by CLAMAV_ADDR(host:port)
+ */
+type clamdScanner struct {
+	addr string
+}
+
+func (s clamdScanner) Scan(ctx context.Context, data []byte) error {
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(60 * time.Second))
+	return clamdInstream(conn, data)
+}
+
+/*
+* INSTREAM sends the data in chunks, each prefixed with its length(4 bytes, big endian)
+* A zero length chunk ends the stream, clamd replies "stream: OK" or "stream: <signature> FOUND" and closes
+ */
+func clamdInstream(conn io.ReadWriter, data []byte) error {
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return err
+	}
+	const chunkSize = 64 << 10
+	size := make([]byte, 4)
+	for start := 0; start < len(data); start += chunkSize {
+		end := min(start+chunkSize, len(data))
+		binary.BigEndian.PutUint32(size, uint32(end-start))
+		if _, err := conn.Write(append(size, data[start:end]...)); err != nil {
+			return err
+		}
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return err
+	}
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		return err
+	}
+	result := strings.TrimSpace(strings.TrimRight(string(reply), "\x00"))
+	if strings.HasSuffix(result, "FOUND") {
+		return errors.New(ATTACHMENT_INFECTED + strings.TrimSuffix(strings.TrimPrefix(result, "stream: "), " FOUND"))
+	}
+	if !strings.HasSuffix(result, "OK") {
+		return errors.New("virus scan failed: " + result)
+	}
+	return nil
+}
+
+func fetchVirusScanner() VirusScanner {
+	if AttachmentScanner != nil {
+		return AttachmentScanner
+	}
+	if addr := os.Getenv("CLAMAV_ADDR"); addr != "" {
+		return clamdScanner{addr: addr}
+	}
+	return nil
+}
+
+/*
+* Content type from the bytes of the file, DICOM files have the DICM marker after a 128 byte preamble
+ */
+func sniffContentType(data []byte) string {
+	if len(data) > 132 && string(data[128:132]) == "DICM" {
+		return "application/dicom"
+	}
+	contentType := http.DetectContentType(data)
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return contentType
+}
+
+/*
+* JPEG thumbnail which fits in THUMBNAIL_MAX_DIMENSION, every pixel is the average of the pixels it covers
+* Very large images(decompression bombs) are skipped
+ */
+func generateThumbnail(data []byte) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > 50_000_000 {
+		return nil, errors.New("image is too large for a thumbnail")
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	scale := float64(THUMBNAIL_MAX_DIMENSION) / float64(max(width, height))
+	if scale > 1 {
+		scale = 1
+	}
+	dstWidth, dstHeight := max(1, int(float64(width)*scale)), max(1, int(float64(height)*scale))
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		y0, y1 := y*height/dstHeight, max((y+1)*height/dstHeight, y*height/dstHeight+1)
+		for x := 0; x < dstWidth; x++ {
+			x0, x1 := x*width/dstWidth, max((x+1)*width/dstWidth, x*width/dstWidth+1)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+					r, g, b, a, n = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = uint8(r/n>>8), uint8(g/n>>8), uint8(b/n>>8), uint8(a/n>>8)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+/*
+* storageKey and thumbnailKey are internal, they are not returned to the users
+ */
+func publicAttachment(attachment map[string]interface{}) map[string]interface{} {
+	delete(attachment, "storageKey")
+	delete(attachment, "thumbnailKey")
+	return attachment
+}
+
+/*
+* Upload a file for the patient, optionally linked to a medical record of the patient
+* The user should be able to access the patient(CanAccess), the medical record is checked in the same way
+* The type is sniffed from the content, images get a thumbnail and every file goes through the virus scan hook
+ */
+func UploadAttachment(c *gin.Context, patientId string, fileName string, content []byte, data map[string]string) (map[string]interface{}, error) {
+	patient, err := FetchPatientByCode(c, patientId)
+	if err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, err
+	}
+	medicalRecordId := strings.TrimSpace(data["medicalRecordId"])
+	if medicalRecordId != "" {
+		medicalRecord, err := FetchMedicalRecordByCode(c, medicalRecordId)
+		if err != nil {
+			log.Println("Error from fetchMedicalRecordByCode: ", err)
+			return nil, err
+		}
+		if getString(medicalRecord["patientId"]) != patientId {
+			return nil, errors.New(MEDICAL_RECORD_OF_ANOTHER_PATIENT)
+		}
+	}
+	if len(content) == 0 {
+		return nil, errors.New(ATTACHMENT_IS_EMPTY)
+	}
+	if int64(len(content)) > MAX_ATTACHMENT_SIZE {
+		return nil, errors.New(ATTACHMENT_TOO_LARGE)
+	}
+	category := ATTACHMENT_CATEGORY_OTHER
+	if raw := strings.ToUpper(strings.TrimSpace(data["category"])); raw != "" {
+		if !slices.Contains(AttachmentCategories, raw) {
+			return nil, errors.New(INVALID_ATTACHMENT_CATEGORY)
+		}
+		category = raw
+	}
+	contentType := sniffContentType(content)
+	extension, ok := AttachmentContentTypes[contentType]
+	if !ok {
+		return nil, errors.New(UNSUPPORTED_ATTACHMENT_TYPE + contentType)
+	}
+
+	scanStatus := "NOT_SCANNED"
+	if scanner := fetchVirusScanner(); scanner != nil {
+		if err := scanner.Scan(c, content); err != nil {
+			log.Println("Error from virus scan: ", err)
+			return nil, err
+		}
+		scanStatus = "CLEAN"
+	}
+	store, err := fetchAttachmentStore()
+	if err != nil {
+		return nil, err
+	}
+	code, err := GenerateCode(AttachmentCollection)
+	if err != nil {
+		log.Println("Error from generateCode: ", err)
+		return nil, err
+	}
+	storageKey := "attachments/" + patientId + "/" + code + extension
+	if err := store.Put(c, storageKey, contentType, content); err != nil {
+		log.Println("Error from store.Put: ", err)
+		return nil, err
+	}
+	sum := sha256.Sum256(content)
+	attachment := map[string]interface{}{
+		"code":           code,
+		"patientId":      patientId,
+		"fileName":       filepath.Base(fileName),
+		"contentType":    contentType,
+		"size":           int64(len(content)),
+		"sha256":         hex.EncodeToString(sum[:]),
+		"category":       category,
+		"storageKey":     storageKey,
+		"hasThumbnail":   false,
+		"scanStatus":     scanStatus,
+		"hospitalId":     patient["hospitalId"],
+		"tenantId":       patient["tenantId"],
+		"uploadedBy":     c.GetString("code"),
+		"uploadedByRole": c.GetString("collection"),
+		"createdAt":      time.Now(),
+	}
+	if medicalRecordId != "" {
+		attachment["medicalRecordId"] = medicalRecordId
+	}
+	if description := strings.TrimSpace(data["description"]); description != "" {
+		attachment["description"] = description
+	}
+	if strings.HasPrefix(contentType, "image/") {
+		thumbnail, err := generateThumbnail(content)
+		if err != nil {
+			log.Println("Thumbnail is not generated: ", err)
+		} else {
+			thumbnailKey := "attachments/" + patientId + "/" + code + "_thumb.jpg"
+			if err := store.Put(c, thumbnailKey, "image/jpeg", thumbnail); err != nil {
+				log.Println("Error from store.Put(thumbnail): ", err)
+			} else {
+				attachment["thumbnailKey"] = thumbnailKey
+				attachment["hasThumbnail"] = true
+			}
+		}
+	}
+	collection := db.OpenCollections(AttachmentCollection)
+	if _, err := db.CreateOne(c, collection, attachment); err != nil {
+		log.Println("Error from createOne: ", err)
+		if err := store.Delete(context.Background(), storageKey); err != nil {
+			log.Println("Error from store.Delete: ", err)
+		}
+		return nil, err
+	}
+	return publicAttachment(attachment), nil
+}
+
+/*
+* Attachment metadata, access follows the patient of the attachment(CanAccess)
+ */
+func fetchAttachment(c *gin.Context, attachmentId string) (map[string]interface{}, error) {
+	attachment := make(map[string]interface{})
+	collection := db.OpenCollections(AttachmentCollection)
+	if err := db.FindOne(c, collection, bson.M{"code": attachmentId}, attachment); err != nil {
+		log.Println("Error from findOne: ", err)
+		return nil, errors.New(ATTACHMENT_NOT_FOUND + attachmentId)
+	}
+	if _, err := FetchPatientByCode(c, getString(attachment["patientId"])); err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, err
+	}
+	return attachment, nil
+}
+
+/*
+* Metadata and the content of the attachment, or of its thumbnail
+ */
+func DownloadAttachment(c *gin.Context, attachmentId string, thumbnail bool) (map[string]interface{}, []byte, error) {
+	attachment, err := fetchAttachment(c, attachmentId)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := getString(attachment["storageKey"])
+	if thumbnail {
+		key = getString(attachment["thumbnailKey"])
+		if key == "" {
+			return nil, nil, errors.New(THUMBNAIL_NOT_AVAILABLE)
+		}
+		attachment["contentType"] = "image/jpeg"
+	}
+	store, err := fetchAttachmentStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	content, err := store.Get(c, key)
+	if err != nil {
+		log.Println("Error from store.Get: ", err)
+		return nil, nil, err
+	}
+	return publicAttachment(attachment), content, nil
+}
+
+/*
+* Attachments of the patient, newest first
+* Optional filters medicalRecordId and category
+ */
+func FetchAttachments(c *gin.Context, patientId string, query map[string]string) ([]interface{}, error) {
+	if _, err := FetchPatientByCode(c, patientId); err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, err
+	}
+	filter := bson.M{"patientId": patientId}
+	if medicalRecordId := strings.TrimSpace(query["medicalRecordId"]); medicalRecordId != "" {
+		filter["medicalRecordId"] = medicalRecordId
+	}
+	if category := strings.ToUpper(strings.TrimSpace(query["category"])); category != "" {
+		if !slices.Contains(AttachmentCategories, category) {
+			return nil, errors.New(INVALID_ATTACHMENT_CATEGORY)
+		}
+		filter["category"] = category
+	}
+	collection := db.OpenCollections(AttachmentCollection)
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	attachments, err := db.FindAll(c, collection, filter, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	for _, a := range attachments {
+		if attachment, ok := a.(map[string]interface{}); ok {
+			publicAttachment(attachment)
+		}
+	}
+	return attachments, nil
+}
+
+/*
+* Only the uploader or the admin of the hospital of the patient can delete an attachment
+* The document is removed first, so a failure in the storage only leaves an orphan file
+ */
+func DeleteAttachment(c *gin.Context, attachmentId string) error {
+	attachment, err := fetchAttachment(c, attachmentId)
+	if err != nil {
+		return err
+	}
+	isHospitalAdmin := c.GetString("collection") == util.HospitalCollection
+	if !isHospitalAdmin && !c.GetBool("isSuperAdmin") && getString(attachment["uploadedBy"]) != c.GetString("code") {
+		return errors.New(ONLY_UPLOADER_CAN_DELETE_ATTACHMENT)
+	}
+	collection := db.OpenCollections(AttachmentCollection)
+	if _, err := db.DeleteMany(c, collection, bson.M{"code": attachmentId}); err != nil {
+		log.Println("Error from deleteMany: ", err)
+		return err
+	}
+	store, err := fetchAttachmentStore()
+	if err != nil {
+		return err
+	}
+	for _, key := range []string{getString(attachment["storageKey"]), getString(attachment["thumbnailKey"])} {
+		if key == "" {
+			continue
+		}
+		if err := store.Delete(c, key); err != nil {
+			log.Println("Error from store.Delete: ", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+/*
+* Fake clamd on the other end of the pipe, reads one INSTREAM request and writes the reply
+ */
+func fakeClamd(t *testing.T, conn net.Conn, reply string) (<-chan []int, <-chan []byte) {
+	chunks := make(chan []int, 1)
+	received := make(chan []byte, 1)
+	go func() {
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		command := make([]byte, len("zINSTREAM\x00"))
+		if _, err := io.ReadFull(conn, command); err != nil || string(command) != "zINSTREAM\x00" {
+			t.Errorf("command = %q, err = %v", command, err)
+			return
+		}
+		var sizes []int
+		var data bytes.Buffer
+		size := make([]byte, 4)
+		for {
+			if _, err := io.ReadFull(conn, size); err != nil {
+				t.Errorf("reading chunk size: %v", err)
+				return
+			}
+			n := binary.BigEndian.Uint32(size)
+			if n == 0 {
+				break
+			}
+			sizes = append(sizes, int(n))
+			if _, err := io.CopyN(&data, conn, int64(n)); err != nil {
+				t.Errorf("reading chunk: %v", err)
+				return
+			}
+		}
+		conn.Write([]byte(reply + "\x00"))
+		chunks <- sizes
+		received <- data.Bytes()
+	}()
+	return chunks, received
+}
+
+func TestClamdInstream(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 13_117)
+	cases := []struct {
+		name    string
+		reply   string
+		wantErr string
+	}{
+		{"clean", "stream: OK", ""},
+		{"infected", "stream: Eicar-Test-Signature FOUND", ATTACHMENT_INFECTED + "Eicar-Test-Signature"},
+		{"clamd error", "INSTREAM size limit exceeded. ERROR", "virus scan failed: INSTREAM size limit exceeded. ERROR"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			client.SetDeadline(time.Now().Add(5 * time.Second))
+			chunks, received := fakeClamd(t, server, tc.reply)
+			err := clamdInstream(client, data)
+			if tc.wantErr == "" && err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			if tc.wantErr != "" && (err == nil || err.Error() != tc.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tc.wantErr)
+			}
+			sizes := <-chunks
+			if len(sizes) != 3 || sizes[0] != 64<<10 || sizes[1] != 64<<10 || sizes[2] != len(data)-2*(64<<10) {
+				t.Errorf("chunk sizes = %v", sizes)
+			}
+			if !bytes.Equal(<-received, data) {
+				t.Error("clamd received different data")
+			}
+		})
+	}
+}
+
+func TestClamdInstreamEmptyFile(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	chunks, received := fakeClamd(t, server, "stream: OK")
+	if err := clamdInstream(client, nil); err != nil {
+		t.Fatal(err)
+	}
+	if sizes := <-chunks; len(sizes) != 0 {
+		t.Errorf("chunk sizes = %v", sizes)
+	}
+	if data := <-received; len(data) != 0 {
+		t.Errorf("received %d bytes", len(data))
+	}
+}
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	redis "github.com/KanapuramVaishnavi/Core/config/redis"
+	common "github.com/KanapuramVaishnavi/Core/coreServices"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+* Start of the local day, the bed is charged per day it is occupied at the midnight
+ */
+func chargeDay(t time.Time) time.Time {
+	t = t.In(time.Local)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+/*
+* One line per day after the chargedThrough date(from the day the bed was taken when nothing is charged yet) up to the through date
+ */
+func bedChargeLines(assignment map[string]interface{}, through time.Time) ([]interface{}, error) {
+	from, ok := toTime(assignment["from"])
+	if !ok {
+		return nil, errors.New(PATIENT_NOT_IN_BED + getString(assignment["patientId"]))
+	}
+	start := chargeDay(from)
+	chargedThrough := getString(assignment["chargedThrough"])
+	if chargedThrough != "" {
+		last, err := time.ParseInLocation(QUERY_DATE_FORMAT, chargedThrough, time.Local)
+		if err != nil {
+			log.Println("Error from parse(chargedThrough): ", err)
+			return nil, err
+		}
+		start = last.AddDate(0, 0, 1)
+	}
+	through = chargeDay(through)
+	lines := []interface{}{}
+	for day := start; !day.After(through); day = day.AddDate(0, 0, 1) {
+		lines = append(lines, bson.M{
+			"date":            day.Format(QUERY_DATE_FORMAT),
+			"bedAssignmentId": assignment["code"],
+			"bedId":           assignment["bedId"],
+			"wardId":          assignment["wardId"],
+			"bedType":         assignment["bedType"],
+			"tariff":          toInt(assignment["dailyTariff"]),
+		})
+	}
+	return lines, nil
+}
+
+/*
+* Charge the assignment for every day after the chargedThrough date up to the through date
+* The days are claimed on the assignment first(chargedThrough in the filter), so the job and a discharge
+* running together cannot charge the same day twice, the claim is undone when the bill cannot be updated
+ */
+func accrueBedCharges(c context.Context, assignment map[string]interface{}, through time.Time, by string) (int, error) {
+	lines, err := bedChargeLines(assignment, through)
+	if err != nil {
+		return 0, err
+	}
+	if len(lines) == 0 {
+		return 0, nil
+	}
+	total := toInt(assignment["dailyTariff"]) * len(lines)
+	through = chargeDay(through)
+
+	collection := db.OpenCollections(BedAssignmentCollection)
+	filter := bson.M{"code": assignment["code"], "chargedThrough": assignment["chargedThrough"]}
+	claim := bson.M{
+		"$set": bson.M{"chargedThrough": through.Format(QUERY_DATE_FORMAT)},
+		"$inc": bson.M{"chargedDays": len(lines), "chargedAmount": total},
+	}
+	result, err := db.UpdateOne(c, collection, filter, claim)
+	if err != nil {
+		log.Println("Error from updateOne(bedAssignment): ", err)
+		return 0, err
+	}
+	if result.MatchedCount == 0 {
+		return 0, nil
+	}
+	if err := addBedChargesToBill(c, assignment, lines, total, by); err != nil {
+		undo := bson.M{
+			"$set": bson.M{"chargedThrough": assignment["chargedThrough"]},
+			"$inc": bson.M{"chargedDays": -len(lines), "chargedAmount": -total},
+		}
+		if _, err := db.UpdateOne(c, collection, bson.M{"code": assignment["code"]}, undo); err != nil {
+			log.Println("Error from updateOne(bedAssignment): ", err)
+		}
+		return 0, err
+	}
+	assignment["chargedThrough"] = through.Format(QUERY_DATE_FORMAT)
+	assignment["chargedDays"] = toInt(assignment["chargedDays"]) + len(lines)
+	assignment["chargedAmount"] = toInt(assignment["chargedAmount"]) + total
+	return len(lines), nil
+}
+
+/*
+* Running bill of the admission is the latest INPATIENT bill which is not settled yet
+* Charges after the running bill is settled go to a new bill, which has to be settled before the discharge
+* amount is saved as a string, so the update is conditioned on the amount and the paymentStatus read and
+* the bill is read again when it was changed or settled meanwhile
+ */
+func addBedChargesToBill(c context.Context, assignment map[string]interface{}, lines []interface{}, total int, by string) error {
+	collection := db.OpenCollections(util.BillCollection)
+	unsettled := bson.M{"$nin": []string{BILL_PAYMENT_PAID, BILL_PAYMENT_CREDIT_APPROVED}}
+	filter := bson.M{
+		"patientId":     assignment["patientId"],
+		"billType":      BILL_TYPE_INPATIENT,
+		"admissionDate": assignment["admissionDate"],
+		"paymentStatus": unsettled,
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(1)
+	for attempt := 0; attempt < BILL_UPDATE_ATTEMPTS; attempt++ {
+		bills, err := db.FindAll(c, collection, filter, opts)
+		if err != nil {
+			log.Println("Error from findAll(bill): ", err)
+			return err
+		}
+		if len(bills) == 0 {
+			return createBedChargeBill(c, assignment, lines, total, by)
+		}
+
+		bill := bills[0].(map[string]interface{})
+		amount, _ := strconv.Atoi(getString(bill["amount"]))
+		amountForBeds, _ := strconv.Atoi(getString(bill["amountForBeds"]))
+		billCode := getString(bill["code"])
+		billFilter := bson.M{"code": billCode, "paymentStatus": unsettled, "amount": bill["amount"]}
+		update := bson.M{
+			"$set": bson.M{
+				"amount":        strconv.Itoa(amount + total),
+				"amountForBeds": strconv.Itoa(amountForBeds + total),
+				"updatedBy":     by,
+				"updatedAt":     time.Now(),
+			},
+			"$push": bson.M{"bedCharges": bson.M{"$each": lines}},
+		}
+		result, err := db.UpdateOne(c, collection, billFilter, update)
+		if err != nil {
+			log.Println("Error from updateOne(bill): ", err)
+			return err
+		}
+		if result.MatchedCount == 1 {
+			if err := redis.DeleteCache(c, util.BillKey+billCode); err != nil {
+				log.Println("Failed deleting old bill cache: ", err)
+			}
+			return nil
+		}
+		log.Println("Bill changed while adding the bed charges, retrying: ", billCode)
+	}
+	return errors.New(BILL_UPDATE_CONFLICT + getString(assignment["patientId"]))
+}
+
+func createBedChargeBill(c context.Context, assignment map[string]interface{}, lines []interface{}, total int, by string) error {
+	billCode, err := common.GenerateEmpCode(util.BillCollection)
+	if err != nil {
+		log.Println("Error from generateEmpCode: ", err)
+		return err
+	}
+	bill := bson.M{
+		"code":                billCode,
+		"billType":            BILL_TYPE_INPATIENT,
+		"admissionDate":       assignment["admissionDate"],
+		"medicines":           []interface{}{},
+		"tests":               []interface{}{},
+		"bedCharges":          lines,
+		"amountForTests":      "0",
+		"amountForMedicine":   "0",
+		"amountForBeds":       strconv.Itoa(total),
+		"amount":              strconv.Itoa(total),
+		"hasPendingMedicines": false,
+		"paymentStatus":       BILL_PAYMENT_UNPAID,
+		"tenantId":            assignment["tenantId"],
+		"hospitalId":          assignment["hospitalId"],
+		"patientId":           assignment["patientId"],
+		"createdBy":           by,
+		"updatedBy":           by,
+		"createdAt":           time.Now(),
+		"updatedAt":           time.Now(),
+	}
+	if _, err := db.CreateOne(c, db.OpenCollections(util.BillCollection), bill); err != nil {
+		log.Println("Error from createOne(bill): ", err)
+		return err
+	}
+	return nil
+}
+
+/*
+* Daily job, every occupied bed is charged up to yesterday
+* Days missed while the job was not running are charged on the next run
+ */
+func AccrueDailyBedCharges(c context.Context) (int, error) {
+	assignments, err := db.FindAll(c, db.OpenCollections(BedAssignmentCollection), bson.M{"to": nil}, nil)
+	if err != nil {
+		log.Println("Error from findAll(bedAssignment): ", err)
+		return 0, err
+	}
+	yesterday := chargeDay(time.Now()).AddDate(0, 0, -1)
+	charged := 0
+	for _, a := range assignments {
+		assignment := a.(map[string]interface{})
+		days, err := accrueBedCharges(c, assignment, yesterday, BED_CHARGE_JOB)
+		if err != nil {
+			log.Println("Error charging the bed assignment: ", assignment["code"], err)
+			continue
+		}
+		charged += days
+	}
+	return charged, nil
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestBedChargeLines(t *testing.T) {
+	day := func(d int, hour int) time.Time {
+		return time.Date(2026, 3, d, hour, 30, 0, 0, time.Local)
+	}
+	cases := []struct {
+		name           string
+		from           time.Time
+		chargedThrough string
+		through        time.Time
+		dates          []string
+	}{
+		{"admitted today, charged through yesterday", day(10, 22), "", day(9, 0), nil},
+		{"first night", day(10, 22), "", day(10, 23), []string{"2026-03-10"}},
+		{"missed job runs", day(10, 8), "", day(12, 1), []string{"2026-03-10", "2026-03-11", "2026-03-12"}},
+		{"after the charged days", day(10, 8), "2026-03-11", day(13, 0), []string{"2026-03-12", "2026-03-13"}},
+		{"already charged", day(10, 8), "2026-03-13", day(13, 18), nil},
+		{"across the month", time.Date(2026, 2, 27, 9, 0, 0, 0, time.Local), "2026-02-27", day(1, 9), []string{"2026-02-28", "2026-03-01"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assignment := map[string]interface{}{"code": "BA1", "from": tc.from, "dailyTariff": 1500}
+			if tc.chargedThrough != "" {
+				assignment["chargedThrough"] = tc.chargedThrough
+			}
+			lines, err := bedChargeLines(assignment, tc.through)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(lines) != len(tc.dates) {
+				t.Fatalf("lines = %v, want %v", lines, tc.dates)
+			}
+			for i, line := range lines {
+				fields := line.(bson.M)
+				if getString(fields["date"]) != tc.dates[i] || toInt(fields["tariff"]) != 1500 {
+					t.Errorf("line %d = %v, want date %s", i, fields, tc.dates[i])
+				}
+			}
+		})
+	}
+
+	if _, err := bedChargeLines(map[string]interface{}{"patientId": "P1"}, day(10, 0)); err == nil {
+		t.Error("assignment without from is charged")
+	}
+	bad := map[string]interface{}{"from": day(10, 0), "chargedThrough": "10-03-2026"}
+	if _, err := bedChargeLines(bad, day(12, 0)); err == nil {
+		t.Error("invalid chargedThrough is accepted")
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"time"
 
@@ -22,6 +23,7 @@ import (
 	util "github.com/KanapuramVaishnavi/Core/util"
 
 	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
@@ -119,15 +121,11 @@ func GenerateBillForTests(c *gin.Context, medicalRecord map[string]interface{})
 			log.Println("Error from fetchTestByCode: ", err)
 			return nil, 0, err
 		}
-		billTest := make(map[string]interface{})
-		priceVal, ok := test["price"].(string)
-		if !ok {
-			log.Println("Unable to get price from single test")
-			return nil, 0, errors.New(util.UNABLE_TO_FETCH_PRICE_FROM_TEST)
+		billTest, price, err := BuildTestBillLine(c, test)
+		if err != nil {
+			log.Println("Error from buildTestBillLine: ", err)
+			return nil, 0, err
 		}
-		price, _ := strconv.Atoi(priceVal)
-		billTest["testId"] = t
-		billTest["price"] = priceVal
 		incTestPrice = incTestPrice + price
 		billTests = append(billTests, billTest)
 	}
@@ -209,34 +207,11 @@ func FetchMedicineFieldsFromPrescription(medicine map[string]interface{}) (strin
 		log.Println("Unable to fetch medicineId or type assertion")
 		return "", 0, errors.New("Unable to fetch medicineId")
 	}
-
-	dosagePerFrequencyVal, ok := medicine["dosagePerFrequency"].(string)
-	if !ok {
-		log.Println("Unable to fetch dosagePerFrequency or type assertion")
-		return "", 0, errors.New(util.UNABLE_TO_FETCH_DOSAGE_PER_FREQUENCY)
-	}
-	dosagePerFrequency, _ := strconv.Atoi(dosagePerFrequencyVal)
-
-	noOfDaysVal, ok := medicine["noOfDays"].(string)
-	if !ok {
-		log.Println("Unable to fetch noOfDays")
-		return "", 0, errors.New(util.UNABLE_TO_FETCH_NO_OF_DAYS)
-	}
-	noOfDays, _ := strconv.Atoi(noOfDaysVal)
-
-	log.Printf("frequncy type %T", medicine["frequency"])
-	freq := medicine["frequency"].(map[string]interface{})
-	timesPerDay := 0
-	if freq["morning"].(bool) {
-		timesPerDay++
-	}
-	if freq["afternoon"].(bool) {
-		timesPerDay++
-	}
-	if freq["night"].(bool) {
-		timesPerDay++
+	totalTablets, _, err := CalculatePrescribedQuantity(medicine)
+	if err != nil {
+		log.Println("Error from calculatePrescribedQuantity: ", err)
+		return "", 0, err
 	}
-	totalTablets := dosagePerFrequency * timesPerDay * noOfDays
 	return medicineId, totalTablets, nil
 }
 
@@ -262,6 +237,7 @@ func fetchPrescriptionFromMedicalRecord(
 }
 
 // calcuate and updates the medicine stock if we needed and give the data we want update the medicines after dispenesed
+// when the stock is short, dispense whatever is available and keep the rest as pendingTablets
 func calculateAndUpdateMedicine(
 	c *gin.Context,
 	medicineId string,
@@ -271,57 +247,100 @@ func calculateAndUpdateMedicine(
 	availableTablets int,
 ) (map[string]interface{}, int, error) {
 
-	singleMedicine := make(map[string]interface{})
-	costPerTablet := pricePerStrip / tabletsPerStrip
-	remainingTablets := availableTablets - requiredTablets
-
-	singleMedicine["medicineId"] = medicineId
-	singleMedicine["requiredTablets"] = strconv.Itoa(requiredTablets)
-	singleMedicine["costPerTablet"] = strconv.Itoa(costPerTablet)
-	singleMedicine["totalNoOfTablets"] = strconv.Itoa(availableTablets)
-
-	if remainingTablets < 0 {
-		singleMedicine["isDispensed"] = false
-		singleMedicine["pricePerMedicine"] = "0"
+	singleMedicine, price := calculateMedicineLine(medicineId, requiredTablets, pricePerStrip, tabletsPerStrip, availableTablets)
+	dispensedTablets, _ := strconv.Atoi(getString(singleMedicine["dispensedTablets"]))
+	if dispensedTablets == 0 {
 		return singleMedicine, 0, nil
 	}
 
-	price := requiredTablets * costPerTablet
-	singleMedicine["isDispensed"] = true
-	singleMedicine["pricePerMedicine"] = strconv.Itoa(price)
+	// controlled medicines are billed now, but the stock is reduced only after the witness sign-off
+	medicine, err := FetchMedicineByCode(c, medicineId)
+	if err != nil {
+		log.Println("Error from fetchMedicineByCode: ", err)
+		return nil, 0, err
+	}
+	if IsControlledMedicine(medicine) {
+		singleMedicine["isControlled"] = true
+		singleMedicine["awaitingWitness"] = true
+		singleMedicine["isDispensed"] = false
+		return singleMedicine, price, nil
+	}
 
-	if err := updateMedicineStock(
-		c,
-		medicineId,
-		remainingTablets,
-		tabletsPerStrip,
-	); err != nil {
+	// availableTablets can be stale(cache), the stock is taken from the current value
+	if _, _, err := adjustMedicineStock(c, medicineId, -dispensedTablets); err != nil {
+		log.Println("Error from adjustMedicineStock: ", err)
 		return nil, 0, err
 	}
 
 	return singleMedicine, price, nil
 }
 
-// medicne stock after dispensed gets updated here
-func updateMedicineStock(
-	c *gin.Context,
+// bill line of the medicine, whatever is available is dispensed and the rest is kept as pendingTablets
+func calculateMedicineLine(
 	medicineId string,
-	remainingTablets int,
+	requiredTablets int,
+	pricePerStrip int,
 	tabletsPerStrip int,
-) error {
+	availableTablets int,
+) (map[string]interface{}, int) {
+	singleMedicine := make(map[string]interface{})
+	costPerTablet := pricePerStrip / tabletsPerStrip
+	dispensedTablets := requiredTablets
+	if availableTablets < requiredTablets {
+		dispensedTablets = availableTablets
+	}
+	if dispensedTablets < 0 {
+		dispensedTablets = 0
+	}
+	pendingTablets := requiredTablets - dispensedTablets
 
-	update := map[string]interface{}{
-		"noOfstrips":       strconv.Itoa(remainingTablets / tabletsPerStrip),
-		"totalNoOfTablets": strconv.Itoa(remainingTablets),
+	singleMedicine["medicineId"] = medicineId
+	singleMedicine["requiredTablets"] = strconv.Itoa(requiredTablets)
+	singleMedicine["dispensedTablets"] = strconv.Itoa(dispensedTablets)
+	singleMedicine["pendingTablets"] = strconv.Itoa(pendingTablets)
+	singleMedicine["costPerTablet"] = strconv.Itoa(costPerTablet)
+	singleMedicine["totalNoOfTablets"] = strconv.Itoa(availableTablets)
+	singleMedicine["isDispensed"] = pendingTablets == 0
+	singleMedicine["isPartiallyDispensed"] = dispensedTablets > 0 && pendingTablets > 0
+
+	if dispensedTablets == 0 {
+		singleMedicine["pricePerMedicine"] = "0"
+		return singleMedicine, 0
 	}
 
-	_, err := UpdateMedicines(c, medicineId, update)
-	if err != nil {
-		log.Println("Unable to update medicine stock:", err)
-		return errors.New("unable to update totalNoOfTablets")
+	// multiply before dividing, so the units cheaper than 1(e.g. ml of a syrup) are not billed as 0
+	price := dispensedTablets * pricePerStrip / tabletsPerStrip
+	singleMedicine["pricePerMedicine"] = strconv.Itoa(price)
+
+	return singleMedicine, price
+}
+
+/*
+* Give back the stock taken for the dispensed lines of a bill which could not be saved
+* Controlled lines are not taken until the witness, so there is nothing to give back for them
+ */
+func giveBackBillStock(c *gin.Context, billMedicines []map[string]interface{}) {
+	for _, item := range billMedicines {
+		if awaiting, _ := item["awaitingWitness"].(bool); awaiting {
+			continue
+		}
+		dispensed, _ := strconv.Atoi(getString(item["dispensedTablets"]))
+		if dispensed <= 0 {
+			continue
+		}
+		medicineId := getString(item["medicineId"])
+		if _, _, err := adjustMedicineStock(c, medicineId, dispensed); err != nil {
+			log.Println("Error while giving back the stock of the bill: ", medicineId, err)
+		}
 	}
+}
 
-	return nil
+/*
+* Whether the bill was inserted, SaveBill can fail after the insert(pending or controlled dispenses)
+ */
+func billSaved(c *gin.Context, billCode string) bool {
+	saved := make(map[string]interface{})
+	return db.FindOne(c, db.OpenCollections(util.BillCollection), bson.M{"code": billCode}, saved) == nil
 }
 
 // here it calcualtes and update each and evry single medicine we mentioned in the medical record (Prescription one)
@@ -345,8 +364,13 @@ func processSingleMedicine(
 	if err != nil {
 		return nil, 0, err
 	}
+	medicineFetched, err := FetchMedicineByCode(c, medicineId)
+	if err != nil {
+		return nil, 0, err
+	}
+	requiredTablets = RoundQuantityToPacks(medicineFetched, requiredTablets, tabletsPerStrip)
 
-	return calculateAndUpdateMedicine(
+	item, price, err := calculateAndUpdateMedicine(
 		c,
 		medicineId,
 		requiredTablets,
@@ -354,6 +378,28 @@ func processSingleMedicine(
 		tabletsPerStrip,
 		totalTablets,
 	)
+	if err != nil {
+		return nil, 0, err
+	}
+	if pending, _ := strconv.Atoi(getString(item["pendingTablets"])); pending > 0 {
+		attachSubstitutes(c, item, medicineId, pending)
+	}
+	return item, price, nil
+}
+
+// out of stock medicines carry the in stock generic substitutes, so the pharmacist can offer them
+func attachSubstitutes(c *gin.Context, item map[string]interface{}, medicineId string, requiredTablets int) {
+	medicine, err := FetchMedicineByCode(c, medicineId)
+	if err != nil {
+		log.Println("Unable to fetch medicine for substitutes: ", err)
+		return
+	}
+	substitutes, err := FindGenericSubstitutes(c, medicine, requiredTablets)
+	if err != nil {
+		log.Println("Unable to find substitutes: ", err)
+		return
+	}
+	item["substitutes"] = substitutes
 }
 
 func GenerateBillForMedicines(
@@ -366,6 +412,10 @@ func GenerateBillForMedicines(
 		return nil, 0, err
 	}
 
+	if getString(prescription["status"]) == PRESCRIPTION_STATUS_SUPERSEDED {
+		return nil, 0, errors.New(PRESCRIPTION_ALREADY_SUPERSEDED + getString(prescription["supersededBy"]))
+	}
+
 	medicines, err := ExtractMedicines(prescription)
 	if err != nil {
 		return nil, 0, err
@@ -379,6 +429,7 @@ func GenerateBillForMedicines(
 	for _, m := range medicines {
 		item, price, err := processSingleMedicine(c, m)
 		if err != nil {
+			giveBackBillStock(c, billMedicines)
 			return nil, 0, err
 		}
 
@@ -398,7 +449,7 @@ func GenerateBillForMedicines(
 * Combine all the remaining data and prepare it
 * Get tests and prescriptionId from the medicalRecord
 * Generate a bill of cost per medicines and cost per tests and return the amount for all of them
-* Save to db and cache
+* Save to db and cache, the stock taken for the medicines is given back when the bill is not saved
  */
 func CreateBill(c *gin.Context, patientId string) (string, error) {
 	patient, err := FetchPatientByCode(c, patientId)
@@ -449,9 +500,12 @@ func CreateBill(c *gin.Context, patientId string) (string, error) {
 	bill["amountForTests"] = strconv.Itoa(incTestPrice)
 	bill["amountForMedicine"] = strconv.Itoa(incMedicinePrice)
 	bill["amount"] = strconv.Itoa(incMedicinePrice + incTestPrice)
+	bill["billType"] = BILL_TYPE_REGULAR
+	bill["hasPendingMedicines"] = HasPendingMedicines(billMedicines)
 	code, err := common.GenerateEmpCode(util.BillCollection)
 	if err != nil {
 		log.Println("Error from generateEmpCode: ", err)
+		giveBackBillStock(c, billMedicines)
 		return "", err
 	}
 	bill["code"] = code
@@ -460,36 +514,73 @@ func CreateBill(c *gin.Context, patientId string) (string, error) {
 	_, err = UpdateMedicalRecord(c, medicalId, updMedicalRecord)
 	if err != nil {
 		log.Println("Error from updateMedicalRecord: ", err)
+		giveBackBillStock(c, billMedicines)
 		return "", err
 	}
 
 	pharmacistId, err := common.GetFromContext[string](c, "code")
 	if err != nil {
 		log.Println("Error from GetFromContext: ", err)
+		giveBackBillStock(c, billMedicines)
 		return "", err
 	}
 	bill["tenantId"] = medicalRecord["tenantId"].(string)
 	bill["hospitalId"] = medicalRecord["hospitalId"].(string)
 	bill["prescripitonId"] = medicalRecord["prescriptionId"].(string)
+	// the bill keeps the exact prescription version it was dispensed from
+	prescription, err := fetchPrescriptionFromMedicalRecord(c, medicalRecord)
+	if err != nil {
+		log.Println("Error from fetchPrescriptionFromMedicalRecord: ", err)
+		giveBackBillStock(c, billMedicines)
+		return "", err
+	}
+	bill["prescriptionVersion"] = prescriptionVersionOf(prescription)
 	bill["medicalId"] = medicalId
 	bill["patientId"] = patientId
 	bill["createdBy"] = pharmacistId
 	bill["updatedBy"] = pharmacistId
 	bill["createdAt"] = time.Now()
 	bill["updatedAt"] = time.Now()
+	err = SaveBill(c, bill, billMedicines)
+	if err != nil {
+		log.Println("Error from saveBill: ", err)
+		if !billSaved(c, code) {
+			giveBackBillStock(c, billMedicines)
+		}
+		return "", err
+	}
+	return "created successfully", nil
+}
+
+/*
+* Save the bill to db and cache
+* Medicines which are not dispensed completely go to the pending dispense queue
+* Controlled medicines wait for the witness
+ */
+func SaveBill(c *gin.Context, bill map[string]interface{}, billMedicines []map[string]interface{}) error {
 	collection := db.OpenCollections(util.BillCollection)
 	inserted, err := db.CreateOne(c, collection, bill)
 	if err != nil {
 		log.Println("Error from createOne: ", err)
-		return "", err
+		return err
 	}
 	log.Println("inserted: ", inserted.InsertedID)
-	key := util.BillKey + code
+	key := util.BillKey + getString(bill["code"])
 	err = redis.SetCache(c, key, bill)
 	if err != nil {
 		log.Println("Error while setting cache")
 	}
-	return "created successfully", nil
+	err = CreatePendingDispenses(c, bill, billMedicines)
+	if err != nil {
+		log.Println("Error from createPendingDispenses: ", err)
+		return err
+	}
+	err = CreateControlledDispenses(c, bill, billMedicines)
+	if err != nil {
+		log.Println("Error from createControlledDispenses: ", err)
+		return err
+	}
+	return nil
 }
 
 /*
@@ -635,7 +726,21 @@ func BuildBillingData(c *gin.Context, patient map[string]interface{}) (map[strin
 }
 
 func GenerateBillingPDF(data map[string]interface{}, htmlPath string, pdfPath string) error {
-	tmpl, err := template.ParseFiles("./templates/billing.html")
+	return GenerateHTMLToPDF("./templates/billing.html", data, htmlPath, pdfPath)
+}
+
+/*
+* Render the html template with the data and convert it to pdf with wkhtmltopdf
+ */
+func GenerateHTMLToPDF(templatePath string, data map[string]interface{}, htmlPath string, pdfPath string) error {
+	return GenerateHTMLToPDFWithFuncs(templatePath, nil, data, htmlPath, pdfPath)
+}
+
+/*
+* Same as GenerateHTMLToPDF for the templates which use template functions
+ */
+func GenerateHTMLToPDFWithFuncs(templatePath string, funcMap template.FuncMap, data map[string]interface{}, htmlPath string, pdfPath string) error {
+	tmpl, err := template.New(filepath.Base(templatePath)).Funcs(funcMap).ParseFiles(templatePath)
 	if err != nil {
 		return err
 	}
@@ -774,6 +879,18 @@ func GenerateQRCode(data string) (string, error) {
 
 	return "data:image/png;base64," + base64QR, nil
 }
+
+/*
+* QR code as a png data url, generated locally so the encoded data(verification links, accession numbers) is not sent to a QR service
+ */
+func GenerateLocalQRCode(data string) (string, error) {
+	png, err := qrcode.Encode(data, qrcode.Medium, 200)
+	if err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(png), nil
+}
+
 func BuildUPIString(upiID, name string, amount int) string {
 	encodedName := url.QueryEscape(name)
 
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	redis "github.com/KanapuramVaishnavi/Core/config/redis"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+* Bills created before the payment tracking have no paymentStatus and are unpaid
+ */
+func billPaymentStatus(bill map[string]interface{}) string {
+	if status := getString(bill["paymentStatus"]); status != "" {
+		return status
+	}
+	return BILL_PAYMENT_UNPAID
+}
+
+func isBillSettled(bill map[string]interface{}) bool {
+	status := billPaymentStatus(bill)
+	return status == BILL_PAYMENT_PAID || status == BILL_PAYMENT_CREDIT_APPROVED
+}
+
+func saveBillPayment(c *gin.Context, billId string, set bson.M) (map[string]interface{}, error) {
+	set["updatedBy"] = c.GetString("code")
+	set["updatedAt"] = time.Now()
+	collection := db.OpenCollections(util.BillCollection)
+	if _, err := db.UpdateOne(c, collection, bson.M{"code": billId}, bson.M{"$set": set}); err != nil {
+		log.Println("Error from updateOne: ", err)
+		return nil, err
+	}
+	if err := redis.DeleteCache(c, util.BillKey+billId); err != nil {
+		log.Println("Failed deleting old bill cache: ", err)
+	}
+	bill := make(map[string]interface{})
+	if err := db.FindOne(c, collection, bson.M{"code": billId}, bill); err != nil {
+		log.Println("Error from findOne: ", err)
+		return nil, err
+	}
+	return bill, nil
+}
+
+/*
+* Record the full payment of the bill{paymentMode, reference}
+ */
+func SettleBill(c *gin.Context, billId string, data map[string]interface{}) (map[string]interface{}, error) {
+	bill, err := FetchBillByCode(c, billId)
+	if err != nil {
+		log.Println("Error from fetchBillByCode: ", err)
+		return nil, err
+	}
+	if billPaymentStatus(bill) == BILL_PAYMENT_PAID {
+		return nil, errors.New(BILL_ALREADY_SETTLED + billId)
+	}
+	mode, err := upperChoice(data, "paymentMode", PaymentModes, INVALID_PAYMENT_MODE)
+	if err != nil {
+		return nil, err
+	}
+	set := bson.M{
+		"paymentStatus": BILL_PAYMENT_PAID,
+		"paymentMode":   mode,
+		"settledBy":     c.GetString("code"),
+		"settledAt":     time.Now(),
+	}
+	if reference := strings.TrimSpace(getString(data["reference"])); reference != "" {
+		set["paymentReference"] = reference
+	}
+	return saveBillPayment(c, billId, set)
+}
+
+/*
+* The hospital admin lets the patient leave before the bill is paid, the bill stays to be collected later
+ */
+func ApproveBillCredit(c *gin.Context, billId string, data map[string]interface{}) (map[string]interface{}, error) {
+	if c.GetString("collection") != util.HospitalCollection && !c.GetBool("isSuperAdmin") {
+		return nil, errors.New(ONLY_HOSPITAL_CAN_APPROVE_CREDIT)
+	}
+	bill, err := FetchBillByCode(c, billId)
+	if err != nil {
+		log.Println("Error from fetchBillByCode: ", err)
+		return nil, err
+	}
+	if isBillSettled(bill) {
+		return nil, errors.New(BILL_ALREADY_SETTLED + billId)
+	}
+	reason := strings.TrimSpace(getString(data["reason"]))
+	if reason == "" {
+		return nil, errors.New(CREDIT_REASON_REQUIRED)
+	}
+	set := bson.M{
+		"paymentStatus":    BILL_PAYMENT_CREDIT_APPROVED,
+		"creditReason":     reason,
+		"creditApprovedBy": c.GetString("code"),
+		"creditApprovedAt": time.Now(),
+	}
+	return saveBillPayment(c, billId, set)
+}
+
+/*
+* Bills of the patient created since the admission, the latest one is the final bill
+* Returns an error when there is no bill or any of them is neither paid nor approved on credit
+ */
+func verifyAdmissionBillsSettled(c *gin.Context, patientId string, admittedOn time.Time) error {
+	collection := db.OpenCollections(util.BillCollection)
+	filter := bson.M{"patientId": patientId, "createdAt": bson.M{"$gte": admittedOn}}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	bills, err := db.FindAll(c, collection, filter, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return err
+	}
+	if len(bills) == 0 {
+		return errors.New(FINAL_BILL_NOT_GENERATED)
+	}
+	unsettled := []string{}
+	for _, b := range bills {
+		bill, ok := b.(map[string]interface{})
+		if ok && !isBillSettled(bill) {
+			unsettled = append(unsettled, getString(bill["code"]))
+		}
+	}
+	if len(unsettled) > 0 {
+		return errors.New(DISCHARGE_BLOCKED_BY_BILL + strings.Join(unsettled, ", "))
+	}
+	return nil
+}
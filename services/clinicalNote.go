@@ -0,0 +1,556 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+* Fields of the note covered by the signature of the author
+ */
+var signedNoteFields = []string{
+	"code", "medicalRecordId", "patientId", "templateId", "vitalsId", "createdBy", "revision",
+	"subjective", "objective", "assessment", "plan",
+}
+
+var signedAddendumFields = []string{"text", "reason", "addedBy", "addedAt"}
+
+/*
+* Canonical serialization of the signed fields of the note
+ */
+func CanonicalClinicalNote(note map[string]interface{}) ([]byte, error) {
+	payload := make(map[string]interface{})
+	for _, field := range signedNoteFields {
+		if value, exists := note[field]; exists && value != nil {
+			payload[field] = canonicalValue(value)
+		}
+	}
+	return json.Marshal(payload)
+}
+
+/*
+* An addendum is signed together with the code of the note it belongs to
+ */
+func CanonicalAddendum(noteId string, addendum map[string]interface{}) ([]byte, error) {
+	payload := map[string]interface{}{"noteId": noteId}
+	for _, field := range signedAddendumFields {
+		if value, exists := addendum[field]; exists && value != nil {
+			payload[field] = canonicalValue(value)
+		}
+	}
+	return json.Marshal(payload)
+}
+
+/*
+* Note is locked when the author locked it or NOTE_LOCK_HOURS passed since it was written
+ */
+func isNoteLocked(note map[string]interface{}) bool {
+	if getString(note["status"]) == NOTE_STATUS_LOCKED {
+		return true
+	}
+	lockAt, ok := toTime(note["lockAt"])
+	return ok && !time.Now().Before(lockAt)
+}
+
+func templateSectionFields(template map[string]interface{}, section string) []map[string]interface{} {
+	sections, _ := template["sections"].(map[string]interface{})
+	fields := []map[string]interface{}{}
+	for _, f := range toList(sections[section]) {
+		if field, ok := f.(map[string]interface{}); ok {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+/*
+* Value of a template field must match its type, CHOICE must be one of the options
+ */
+func validateNoteField(field map[string]interface{}, value interface{}) (interface{}, error) {
+	key := getString(field["key"])
+	switch getString(field["type"]) {
+	case NOTE_FIELD_TEXT:
+		text, ok := value.(string)
+		if !ok {
+			return nil, errors.New(INVALID_NOTE_FIELD + key)
+		}
+		return strings.TrimSpace(text), nil
+	case NOTE_FIELD_NUMBER:
+		number, ok := value.(float64)
+		if !ok {
+			return nil, errors.New(INVALID_NOTE_FIELD + key)
+		}
+		return number, nil
+	case NOTE_FIELD_BOOLEAN:
+		flag, ok := value.(bool)
+		if !ok {
+			return nil, errors.New(INVALID_NOTE_FIELD + key)
+		}
+		return flag, nil
+	case NOTE_FIELD_CHOICE:
+		choice, ok := value.(string)
+		if !ok {
+			return nil, errors.New(INVALID_NOTE_FIELD + key)
+		}
+		for _, option := range toList(field["options"]) {
+			if strings.EqualFold(getString(option), strings.TrimSpace(choice)) {
+				return getString(option), nil
+			}
+		}
+		return nil, errors.New(INVALID_NOTE_FIELD + key)
+	}
+	return nil, errors.New(INVALID_NOTE_FIELD + key)
+}
+
+/*
+* Validate the SOAP sections of the note
+* Without a template every section is free text
+* With a template a section with fields is an object of those fields(required, type and options are checked)
+* and a section without fields is free text
+ */
+func normalizeNoteSections(data map[string]interface{}, template map[string]interface{}) (map[string]interface{}, error) {
+	sections := make(map[string]interface{})
+	for _, section := range NoteSections {
+		raw, exists := data[section]
+		fields := templateSectionFields(template, section)
+		if len(fields) == 0 {
+			if !exists || raw == nil {
+				continue
+			}
+			text, ok := raw.(string)
+			if !ok {
+				return nil, errors.New(INVALID_NOTE_SECTION + section)
+			}
+			if text = strings.TrimSpace(text); text != "" {
+				sections[section] = text
+			}
+			continue
+		}
+		values := map[string]interface{}{}
+		if exists && raw != nil {
+			var ok bool
+			values, ok = raw.(map[string]interface{})
+			if !ok {
+				return nil, errors.New(INVALID_NOTE_SECTION + section)
+			}
+		}
+		known := map[string]bool{}
+		result := make(map[string]interface{})
+		for _, field := range fields {
+			key := getString(field["key"])
+			known[key] = true
+			value, given := values[key]
+			if !given || value == nil || value == "" {
+				if field["required"] == true {
+					return nil, errors.New(NOTE_FIELD_REQUIRED + section + "." + key)
+				}
+				continue
+			}
+			normalized, err := validateNoteField(field, value)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = normalized
+		}
+		for key := range values {
+			if !known[key] {
+				return nil, errors.New(UNKNOWN_NOTE_FIELD + section + "." + key)
+			}
+		}
+		if len(result) > 0 {
+			sections[section] = result
+		}
+	}
+	if len(sections) == 0 {
+		return nil, errors.New(NOTE_SECTION_REQUIRED)
+	}
+	return sections, nil
+}
+
+func fetchClinicalNote(c *gin.Context, noteId string) (map[string]interface{}, error) {
+	note := make(map[string]interface{})
+	collection := db.OpenCollections(ClinicalNoteCollection)
+	if err := db.FindOne(c, collection, bson.M{"code": noteId}, note); err != nil {
+		log.Println("Error from findOne(clinicalNote): ", err)
+		return nil, errors.New(CLINICAL_NOTE_NOT_FOUND + noteId)
+	}
+	return note, nil
+}
+
+func fetchTemplateOfNote(c *gin.Context, templateId string) (map[string]interface{}, error) {
+	if templateId == "" {
+		return nil, nil
+	}
+	template, err := FetchNoteTemplateByCode(c, templateId)
+	if err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+/*
+* Doctor of the medicalRecord writes the note, optionally with a template of the hospital
+* Latest vitals of the medicalRecord are referenced in the note
+* The note is signed with the key of the doctor and locked after NOTE_LOCK_HOURS
+ */
+func CreateClinicalNote(c *gin.Context, medicalRecordId string, data map[string]interface{}) (map[string]interface{}, error) {
+	if c.GetString("collection") != util.DoctorCollection {
+		return nil, errors.New(ONLY_DOCTOR_CAN_WRITE_NOTES)
+	}
+	doctorId := c.GetString("code")
+	medicalRecord := make(map[string]interface{})
+	mrColl := db.OpenCollections(util.MedicalRecordCollection)
+	if err := db.FindOne(c, mrColl, bson.M{"code": medicalRecordId}, medicalRecord); err != nil {
+		log.Println("Error from findOne(medicalRecord): ", err)
+		return nil, err
+	}
+	if err := VerifyDoctorCanAccess(medicalRecord, doctorId); err != nil {
+		log.Println("Error from verifyDoctorCanAccess: ", err)
+		return nil, err
+	}
+	templateId := strings.TrimSpace(getString(data["templateId"]))
+	template, err := fetchTemplateOfNote(c, templateId)
+	if err != nil {
+		return nil, err
+	}
+	if template != nil && template["isActive"] != true {
+		return nil, errors.New(NOTE_TEMPLATE_INACTIVE + templateId)
+	}
+	sections, err := normalizeNoteSections(data, template)
+	if err != nil {
+		return nil, err
+	}
+	doctor, err := FetchDoctorByCode(c, doctorId)
+	if err != nil {
+		log.Println("Error from fetchDoctorByCode: ", err)
+		return nil, err
+	}
+	code, err := GenerateCode(ClinicalNoteCollection)
+	if err != nil {
+		log.Println("Error from generateCode: ", err)
+		return nil, err
+	}
+	now := time.Now()
+	note := map[string]interface{}{
+		"code":            code,
+		"medicalRecordId": medicalRecordId,
+		"patientId":       medicalRecord["patientId"],
+		"hospitalId":      medicalRecord["hospitalId"],
+		"tenantId":        medicalRecord["tenantId"],
+		"revision":        1,
+		"status":          NOTE_STATUS_OPEN,
+		"lockAt":          now.Add(time.Duration(NOTE_LOCK_HOURS) * time.Hour),
+		"createdBy":       doctorId,
+		"createdAt":       now,
+		"updatedBy":       doctorId,
+		"updatedAt":       now,
+	}
+	if templateId != "" {
+		note["templateId"] = templateId
+	}
+	if vitalsId := getString(medicalRecord["latestVitalsId"]); vitalsId != "" {
+		note["vitalsId"] = vitalsId
+	}
+	for section, value := range sections {
+		note[section] = value
+	}
+	payload, err := CanonicalClinicalNote(note)
+	if err != nil {
+		log.Println("Error from canonicalClinicalNote: ", err)
+		return nil, err
+	}
+	signature, err := signPayload(c, doctor, payload)
+	if err != nil {
+		log.Println("Error from signPayload: ", err)
+		return nil, err
+	}
+	note["signature"] = signature
+
+	collection := db.OpenCollections(ClinicalNoteCollection)
+	if _, err := db.CreateOne(c, collection, note); err != nil {
+		log.Println("Error from createOne: ", err)
+		return nil, err
+	}
+	update := bson.M{"$addToSet": bson.M{"clinicalNotes": code}, "$set": bson.M{"updatedBy": doctorId, "updatedAt": now}}
+	if _, err := updateMedicalRecordWithHistory(c, medicalRecordId, update, HISTORY_ACTION_CLINICAL_NOTE); err != nil {
+		log.Println("Error from updateMedicalRecordWithHistory: ", err)
+		return nil, err
+	}
+	return note, nil
+}
+
+/*
+* Author edits the sections before the lock, the earlier content is kept in revisions
+* The new content is signed again with the next revision number
+* The edit is saved only while the note is unlocked and still at the revision it was read at
+ */
+func UpdateClinicalNote(c *gin.Context, noteId string, data map[string]interface{}) (map[string]interface{}, error) {
+	note, err := fetchClinicalNote(c, noteId)
+	if err != nil {
+		return nil, err
+	}
+	doctorId := c.GetString("code")
+	if getString(note["createdBy"]) != doctorId {
+		return nil, errors.New(ONLY_AUTHOR_CAN_EDIT_NOTE)
+	}
+	if isNoteLocked(note) {
+		return nil, errors.New(CLINICAL_NOTE_LOCKED)
+	}
+	template, err := fetchTemplateOfNote(c, getString(note["templateId"]))
+	if err != nil {
+		return nil, err
+	}
+	sections, err := normalizeNoteSections(data, template)
+	if err != nil {
+		return nil, err
+	}
+	doctor, err := FetchDoctorByCode(c, doctorId)
+	if err != nil {
+		log.Println("Error from fetchDoctorByCode: ", err)
+		return nil, err
+	}
+	revision := map[string]interface{}{
+		"revision":  toInt(note["revision"]),
+		"signature": note["signature"],
+		"editedAt":  time.Now(),
+	}
+	set := bson.M{}
+	unset := bson.M{}
+	for _, section := range NoteSections {
+		if value, exists := note[section]; exists {
+			revision[section] = value
+		}
+		if value, exists := sections[section]; exists {
+			note[section] = value
+			set[section] = value
+		} else {
+			delete(note, section)
+			unset[section] = ""
+		}
+	}
+	filter := bson.M{
+		"code":     noteId,
+		"status":   bson.M{"$ne": NOTE_STATUS_LOCKED},
+		"lockAt":   bson.M{"$gt": time.Now()},
+		"revision": note["revision"],
+	}
+	if note["revision"] == nil {
+		filter["revision"] = bson.M{"$exists": false}
+	}
+	note["revision"] = toInt(note["revision"]) + 1
+	payload, err := CanonicalClinicalNote(note)
+	if err != nil {
+		log.Println("Error from canonicalClinicalNote: ", err)
+		return nil, err
+	}
+	signature, err := signPayload(c, doctor, payload)
+	if err != nil {
+		log.Println("Error from signPayload: ", err)
+		return nil, err
+	}
+	note["signature"] = signature
+	note["updatedBy"] = doctorId
+	note["updatedAt"] = time.Now()
+	set["revision"] = note["revision"]
+	set["signature"] = signature
+	set["updatedBy"] = doctorId
+	set["updatedAt"] = note["updatedAt"]
+	update := bson.M{"$set": set, "$push": bson.M{"revisions": revision}}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	collection := db.OpenCollections(ClinicalNoteCollection)
+	result, err := db.UpdateOne(c, collection, filter, update)
+	if err != nil {
+		log.Println("Error from updateOne: ", err)
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, errors.New(CLINICAL_NOTE_CHANGED)
+	}
+	note["revisions"] = append(toList(note["revisions"]), revision)
+	return note, nil
+}
+
+/*
+* Author can lock the note before NOTE_LOCK_HOURS
+ */
+func LockClinicalNote(c *gin.Context, noteId string) (map[string]interface{}, error) {
+	note, err := fetchClinicalNote(c, noteId)
+	if err != nil {
+		return nil, err
+	}
+	if getString(note["createdBy"]) != c.GetString("code") {
+		return nil, errors.New(ONLY_AUTHOR_CAN_EDIT_NOTE)
+	}
+	if isNoteLocked(note) {
+		return nil, errors.New(CLINICAL_NOTE_LOCKED)
+	}
+	now := time.Now()
+	set := bson.M{"status": NOTE_STATUS_LOCKED, "lockedAt": now, "updatedBy": c.GetString("code"), "updatedAt": now}
+	collection := db.OpenCollections(ClinicalNoteCollection)
+	if _, err := db.UpdateOne(c, collection, bson.M{"code": noteId}, bson.M{"$set": set}); err != nil {
+		log.Println("Error from updateOne: ", err)
+		return nil, err
+	}
+	for key, value := range set {
+		note[key] = value
+	}
+	return note, nil
+}
+
+/*
+* Any doctor of the hospital can add a signed addendum{text, reason}
+* The content of the note is never changed by an addendum
+ */
+func AddClinicalNoteAddendum(c *gin.Context, noteId string, data map[string]interface{}) (map[string]interface{}, error) {
+	if c.GetString("collection") != util.DoctorCollection {
+		return nil, errors.New(ONLY_DOCTOR_CAN_WRITE_NOTES)
+	}
+	text := strings.TrimSpace(getString(data["text"]))
+	if text == "" {
+		return nil, errors.New(ADDENDUM_TEXT_REQUIRED)
+	}
+	note, err := fetchClinicalNote(c, noteId)
+	if err != nil {
+		return nil, err
+	}
+	hospitalId, err := fetchStaffHospital(c)
+	if err != nil {
+		return nil, err
+	}
+	if hospitalId != getString(note["hospitalId"]) {
+		return nil, errors.New(util.DOCTOR_DOESNOT_HAVE_ACCESS_TO_UPDATE)
+	}
+	doctor, err := FetchDoctorByCode(c, c.GetString("code"))
+	if err != nil {
+		log.Println("Error from fetchDoctorByCode: ", err)
+		return nil, err
+	}
+	addendum := map[string]interface{}{
+		"text":    text,
+		"addedBy": doctor["code"],
+		"addedAt": time.Now(),
+	}
+	if reason := strings.TrimSpace(getString(data["reason"])); reason != "" {
+		addendum["reason"] = reason
+	}
+	payload, err := CanonicalAddendum(noteId, addendum)
+	if err != nil {
+		log.Println("Error from canonicalAddendum: ", err)
+		return nil, err
+	}
+	signature, err := signPayload(c, doctor, payload)
+	if err != nil {
+		log.Println("Error from signPayload: ", err)
+		return nil, err
+	}
+	addendum["signature"] = signature
+	collection := db.OpenCollections(ClinicalNoteCollection)
+	update := bson.M{"$push": bson.M{"addenda": addendum}, "$set": bson.M{"updatedBy": doctor["code"], "updatedAt": time.Now()}}
+	if _, err := db.UpdateOne(c, collection, bson.M{"code": noteId}, update); err != nil {
+		log.Println("Error from updateOne: ", err)
+		return nil, err
+	}
+	note["addenda"] = append(toList(note["addenda"]), addendum)
+	return note, nil
+}
+
+/*
+* Access to the note is the access to its medicalRecord
+ */
+func FetchClinicalNoteByCode(c *gin.Context, noteId string) (map[string]interface{}, error) {
+	note, err := fetchClinicalNote(c, noteId)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := FetchMedicalRecordByCode(c, getString(note["medicalRecordId"])); err != nil {
+		log.Println("Error from fetchMedicalRecordByCode: ", err)
+		return nil, err
+	}
+	note["locked"] = isNoteLocked(note)
+	return note, nil
+}
+
+/*
+* Notes of the medicalRecord, oldest first
+ */
+func FetchClinicalNotes(c *gin.Context, medicalRecordId string) ([]interface{}, error) {
+	if _, err := FetchMedicalRecordByCode(c, medicalRecordId); err != nil {
+		log.Println("Error from fetchMedicalRecordByCode: ", err)
+		return nil, err
+	}
+	collection := db.OpenCollections(ClinicalNoteCollection)
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	notes, err := db.FindAll(c, collection, bson.M{"medicalRecordId": medicalRecordId}, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	for _, n := range notes {
+		if note, ok := n.(map[string]interface{}); ok {
+			note["locked"] = isNoteLocked(note)
+		}
+	}
+	return notes, nil
+}
+
+/*
+* Check the signature of the note and of every addendum
+* valid is false when any of them doesnot match, reason tells which one
+ */
+func VerifyClinicalNote(c *gin.Context, noteId string) (map[string]interface{}, error) {
+	note, err := FetchClinicalNoteByCode(c, noteId)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]interface{}{"noteId": noteId, "revision": note["revision"], "valid": true}
+	check := func(signature interface{}, payload []byte) string {
+		sig, ok := signature.(map[string]interface{})
+		if !ok {
+			return DOCUMENT_NOT_SIGNED
+		}
+		_, reason := checkSignature(c, sig, payload)
+		return reason
+	}
+	payload, err := CanonicalClinicalNote(note)
+	if err != nil {
+		log.Println("Error from canonicalClinicalNote: ", err)
+		return nil, err
+	}
+	if reason := check(note["signature"], payload); reason != "" {
+		result["valid"] = false
+		result["reason"] = reason
+	}
+	addenda := []interface{}{}
+	for i, a := range toList(note["addenda"]) {
+		addendum, ok := a.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		payload, err := CanonicalAddendum(noteId, addendum)
+		if err != nil {
+			log.Println("Error from canonicalAddendum: ", err)
+			return nil, err
+		}
+		entry := map[string]interface{}{"index": i, "addedBy": addendum["addedBy"], "valid": true}
+		if reason := check(addendum["signature"], payload); reason != "" {
+			entry["valid"] = false
+			entry["reason"] = reason
+			result["valid"] = false
+		}
+		addenda = append(addenda, entry)
+	}
+	result["addenda"] = addenda
+	return result, nil
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"sync"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	common "github.com/KanapuramVaishnavi/Core/coreServices"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+* Prefixes for the collections owned by this service
+* Collections of the Core module keep using the prefixes from common.GenerateEmpCode
+ */
+var codePrefixes = map[string]string{
+	PendingDispenseCollection:      "PD",
+	ControlledDispenseCollection:   "CD",
+	ControlledRegisterCollection:   "CR",
+	RefillCollection:               "RF",
+	SigningKeyCollection:           "SK",
+	SpecimenCollection:             "AC",
+	HL7MappingCollection:           "HM",
+	HL7ErrorCollection:             "HE",
+	HL7SenderCollection:            "HS",
+	VitalsCollection:               "VT",
+	DiagnosisCollection:            "DG",
+	ProblemCollection:              "PB",
+	ClinicalNoteCollection:         "CN",
+	NoteTemplateCollection:         "NT",
+	AllergyCollection:              "AL",
+	ImmunizationCollection:         "IM",
+	AttachmentCollection:           "AT",
+	MedicalRecordHistoryCollection: "MH",
+	DischargeCollection:            "DS",
+	WardCollection:                 "WD",
+	RoomCollection:                 "RM",
+	BedCollection:                  "BD",
+	BedAssignmentCollection:        "BA",
+	ConsentFormCollection:          "CF",
+}
+
+var codeNumberRegex = regexp.MustCompile(`(\d+)$`)
+
+var codeIndexes sync.Map
+
+/*
+* Generate the next code for the given collection(e.g. PD0001 -> PD0002)
+* If the collection is not known here, fallback to common.GenerateEmpCode
+* The number comes from an atomic counter per collection, so concurrent calls never get the same code
+* and the codes keep growing after PD9999(sorting the codes as strings puts PD10000 before PD9999)
+ */
+func GenerateCode(collName string) (string, error) {
+	prefix, ok := codePrefixes[collName]
+	if !ok {
+		return common.GenerateEmpCode(collName)
+	}
+	ctx := context.Background()
+	ensureCodeIndex(ctx, collName)
+	counters := db.OpenCollections(CodeCounterCollection)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	for attempt := 0; attempt < 2; attempt++ {
+		var counter bson.M
+		err := counters.FindOneAndUpdate(ctx, bson.M{"_id": collName}, bson.M{"$inc": bson.M{"seq": 1}}, opts).Decode(&counter)
+		if err == nil {
+			return formatCode(prefix, toInt(counter["seq"])), nil
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Println("Error while incrementing the code counter: ", err)
+			return "", err
+		}
+		if err := seedCodeCounter(ctx, collName); err != nil {
+			return "", err
+		}
+	}
+	return "", errors.New(CODE_COUNTER_NOT_SEEDED + collName)
+}
+
+func formatCode(prefix string, number int) string {
+	return fmt.Sprintf("%s%04d", prefix, number)
+}
+
+/*
+* Numeric part of a code(PD0012 -> 12), 0 when there is none
+ */
+func codeNumber(code string) int {
+	matches := codeNumberRegex.FindStringSubmatch(code)
+	if len(matches) < 2 {
+		return 0
+	}
+	number, _ := strconv.Atoi(matches[1])
+	return number
+}
+
+/*
+* Start the counter of the collection from the highest code already saved
+* When another call seeded it first the duplicate key error is ignored
+ */
+func seedCodeCounter(ctx context.Context, collName string) error {
+	collection := db.OpenCollections(collName)
+	cursor, err := collection.Find(ctx, bson.M{"code": bson.M{"$type": "string"}}, options.Find().SetProjection(bson.M{"code": 1}))
+	if err != nil {
+		log.Println("Error while reading the codes: ", err)
+		return err
+	}
+	defer cursor.Close(ctx)
+	highest := 0
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		highest = max(highest, codeNumber(getString(doc["code"])))
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	counters := db.OpenCollections(CodeCounterCollection)
+	if _, err := counters.InsertOne(ctx, bson.M{"_id": collName, "seq": highest}); err != nil && !mongo.IsDuplicateKeyError(err) {
+		log.Println("Error while seeding the code counter: ", err)
+		return err
+	}
+	return nil
+}
+
+/*
+* Unique index on code, created once per collection
+* It cannot be created while duplicate codes from before the counter exist, that is logged
+ */
+func ensureCodeIndex(ctx context.Context, collName string) {
+	once, _ := codeIndexes.LoadOrStore(collName, &sync.Once{})
+	once.(*sync.Once).Do(func() {
+		index := mongo.IndexModel{
+			Keys:    bson.D{{Key: "code", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("code_unique"),
+		}
+		if _, err := db.OpenCollections(collName).Indexes().CreateOne(ctx, index); err != nil {
+			log.Println("Error while creating the code index of "+collName+": ", err)
+		}
+	})
+}
@@ -0,0 +1,25 @@
+package services
+
+import "testing"
+
+func TestCodeNumber(t *testing.T) {
+	cases := map[string]int{
+		"PD0001":  1,
+		"PD9999":  9999,
+		"PD10000": 10000,
+		"AC0420":  420,
+		"PD":      0,
+		"":        0,
+	}
+	for code, want := range cases {
+		if got := codeNumber(code); got != want {
+			t.Errorf("codeNumber(%q) = %d, want %d", code, got, want)
+		}
+	}
+	if code := formatCode("PD", codeNumber("PD9999")+1); code != "PD10000" {
+		t.Errorf("code after PD9999 = %s", code)
+	}
+	if code := formatCode("VT", 7); code != "VT0007" {
+		t.Errorf("formatCode = %s", code)
+	}
+}
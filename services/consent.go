@@ -1,9 +1,12 @@
 package services
 
 import (
+	"crypto/subtle"
 	"errors"
 	"log"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	db "github.com/KanapuramVaishnavi/Core/config/db"
@@ -29,7 +32,13 @@ func PrepareConsentData(data map[string]interface{}, code string, consentCode st
 	data["updatedAt"] = time.Now()
 	return data
 }
-func VerifyConsentBelowAge(c *gin.Context, patientId string, data map[string]interface{}) error {
+
+/*
+* The guardian(guardianId) gives the consent of the minor with the OTP(password) of the consent verification
+* The OTP is not saved on the consent, the verified guardian signs the consent instead
+ */
+func VerifyConsentBelowAge(c *gin.Context, patient map[string]interface{}, data map[string]interface{}) (map[string]interface{}, error) {
+	patientId := getString(patient["code"])
 	collection := db.OpenCollections(util.ConsentVerificationCollection)
 	filter := bson.M{
 		"patientId": patientId,
@@ -38,28 +47,46 @@ func VerifyConsentBelowAge(c *gin.Context, patientId string, data map[string]int
 	err := db.FindOne(c, collection, filter, consentVerification)
 	if err != nil {
 		log.Println("Error from findOne: ", err)
-		return err
+		return nil, err
 	}
 	otpFromConsentVerification, ok := consentVerification["otp"].(string)
 	if !ok {
 		log.Println("Unable to fetch otp from the particular document")
-		return errors.New(util.UNABLE_TO_FETCH_OTP_FROM_DOCUMENT)
+		return nil, errors.New(util.UNABLE_TO_FETCH_OTP_FROM_DOCUMENT)
 	}
 	fields := []string{"password", "patientId"}
 	for _, field := range fields {
 		err := common.GetTrimmedString(data, field)
 		if err != nil {
 			log.Println("Error from getTrimmedString: ", err)
-			return err
+			return nil, err
 		}
 	}
-	if otpFromConsentVerification != data["password"].(string) {
+	guardianId := strings.TrimSpace(getString(data["guardianId"]))
+	if guardianId == "" {
+		return nil, errors.New(GUARDIAN_ID_REQUIRED)
+	}
+	guardians, _ := FetchGuardians(patient)
+	if !slices.Contains(guardians, guardianId) {
+		return nil, errors.New(NOT_GUARDIAN_OF_PATIENT + guardianId)
+	}
+	if issuedTo := getString(consentVerification["guardianId"]); issuedTo != "" && issuedTo != guardianId {
+		return nil, errors.New(GUARDIAN_OTP_MISMATCH + guardianId)
+	}
+	if subtle.ConstantTimeCompare([]byte(otpFromConsentVerification), []byte(data["password"].(string))) != 1 {
 		log.Println("Incorrect password")
-		return errors.New(util.INCORRECT_PASSWORD)
+		return nil, errors.New(util.INCORRECT_PASSWORD)
+	}
+	guardian := make(map[string]interface{})
+	if err := db.FindOne(c, db.OpenCollections(util.GuardianCollection), bson.M{"code": guardianId}, guardian); err != nil {
+		log.Println("Error from findOne(guardian): ", err)
+		return nil, err
 	}
 
+	delete(data, "password")
+	data["guardianId"] = guardianId
 	data["isConsentVerified"] = true
-	return nil
+	return guardian, nil
 }
 
 /*
@@ -67,7 +94,9 @@ func VerifyConsentBelowAge(c *gin.Context, patientId string, data map[string]int
 * Fetch medicalRecord based on the providedId
 * Fetch patient based on patientId present in medicalRecord
 * Check for the age and and whose age is <18
-* Check for the consentVerification and otp and validate with data(otp)
+* Check for the consentVerification and otp and validate with data(otp), the guardian signs the consent of the minor
+* The consent is taken on the current form of the consentType, formVersion(optional) is the version shown to the patient
+* Form version, text hash and expiry are recorded on the consent
 * Remaining fields should be mapped
 * Generate code and create consent and set in cache
 * UpdateMedicalRecord with the consentId
@@ -99,23 +128,59 @@ func CreateConsent(c *gin.Context, data map[string]interface{}, medicalRecordId
 
 	age, _ := strconv.Atoi(patient["age"].(string))
 	log.Println("age: ", age)
+	var guardian map[string]interface{}
 	if age > 18 {
 		data["isConsentVerified"] = true
 	} else {
-		err := VerifyConsentBelowAge(c, patientId, data)
+		guardian, err = VerifyConsentBelowAge(c, patient, data)
 		if err != nil {
 			log.Println("Error from verifyConsentBelowAge: ", err)
 			return "", err
 		}
 
 	}
+	hospitalId := nurse["createdBy"].(string)
+	consentType, err := normalizeConsentType(getString(data["consentType"]))
+	if err != nil {
+		return "", err
+	}
+	form, err := currentConsentForm(c, hospitalId, consentType)
+	if err != nil {
+		log.Println("Error from currentConsentForm: ", err)
+		return "", err
+	}
+	formVersion := toInt(form["version"])
+	if raw, exists := data["formVersion"]; exists && raw != nil && toInt(raw) != formVersion {
+		return "", errors.New(CONSENT_FORM_VERSION_MISMATCH + getString(form["code"]))
+	}
 	consentCode, err := common.GenerateEmpCode(util.ConsentCollection)
 	if err != nil {
 		log.Println("Error from generateEmpCode: ", err)
 		return "", err
 	}
 	log.Println("nurse: ", nurse)
-	PrepareConsentData(data, code, consentCode, patientId, tenantId, nurse["createdBy"].(string))
+	PrepareConsentData(data, code, consentCode, patientId, tenantId, hospitalId)
+	validFrom := data["createdAt"].(time.Time)
+	data["consentType"] = consentType
+	data["formId"] = form["code"]
+	data["formVersion"] = formVersion
+	data["formTextHash"] = form["textHash"]
+	data["status"] = CONSENT_STATUS_ACTIVE
+	data["validFrom"] = validFrom
+	data["expiresAt"] = validFrom.AddDate(0, 0, toInt(form["validityDays"]))
+	data["history"] = []interface{}{bson.M{
+		"action":     CONSENT_STATUS_ACTIVE,
+		"by":         code,
+		"collection": c.GetString("collection"),
+		"formId":     form["code"],
+		"at":         validFrom,
+	}}
+	if guardian != nil {
+		if err := signGuardianConsent(c, data, guardian); err != nil {
+			log.Println("Error from signGuardianConsent: ", err)
+			return "", err
+		}
+	}
 	inserted, err := db.CreateOne(c, collection, data)
 	if err != nil {
 		log.Println("Error from createOne: ", err)
@@ -228,7 +293,7 @@ func FetchConsentByCode(c *gin.Context, consentId string) (map[string]interface{
 	}
 
 	if cached, exists, err := CheckConsentCacheAccess(c, key, collFromContext, userData, tenantId, code, isSuperAdmin); exists && cached != nil {
-		return cached, err
+		return withConsentSignature(c, withConsentStatus(cached)), err
 	}
 
 	coll := db.OpenCollections(util.ConsentCollection)
@@ -249,7 +314,7 @@ func FetchConsentByCode(c *gin.Context, consentId string) (map[string]interface{
 		log.Println("Error from setCache: ", err)
 	}
 
-	return result, nil
+	return withConsentSignature(c, withConsentStatus(result)), nil
 }
 
 /*
@@ -290,12 +355,16 @@ func FetchAllConsents(c *gin.Context) ([]interface{}, error) {
 		log.Println("Error from FindAll", err)
 		return nil, err
 	}
+	for _, consent := range doc {
+		withConsentSignature(c, withConsentStatus(consent.(map[string]interface{})))
+	}
 	return doc, nil
 }
 
 /*
 * Search for the particular consent exists in db
 * Check who can delete consent and delete in database and delete in cache
+* A verified consent is part of the record of the patient, it can only be withdrawn
  */
 func DeleteConsent(c *gin.Context, consentId string) (string, error) {
 	nurseId, err := common.GetFromContext[string](c, "code")
@@ -315,11 +384,21 @@ func DeleteConsent(c *gin.Context, consentId string) (string, error) {
 		log.Println("Error from findOne function: ", err)
 		return "", err
 	}
+	if verified, _ := result["isConsentVerified"].(bool); verified {
+		return "", errors.New(CONSENT_VERIFIED_CANNOT_BE_DELETED + consentId)
+	}
+	filter["isConsentVerified"] = bson.M{"$ne": true}
 	deleted, err := db.DeleteOne(c, collection, filter)
 	if err != nil {
 		log.Println("Error from deleteOne: ", err)
 		return "", err
 	}
 	log.Println("DeletedCount: ", deleted.DeletedCount)
+	if deleted.DeletedCount == 0 {
+		return "", errors.New(CONSENT_VERIFIED_CANNOT_BE_DELETED + consentId)
+	}
+	if err := redis.DeleteCache(c, util.ConsentKey+consentId); err != nil {
+		log.Println("Failed deleting consent cache: ", err)
+	}
 	return "Deleted successfully", nil
 }
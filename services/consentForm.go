@@ -0,0 +1,383 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	redis "github.com/KanapuramVaishnavi/Core/config/redis"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+* consentType is matched ignoring the case, spaces and underscores(General, Surgery, DataSharing)
+ */
+func normalizeConsentType(raw string) (string, error) {
+	key := strings.ToUpper(strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.TrimSpace(raw)))
+	for _, consentType := range ConsentTypes {
+		if key == strings.ReplaceAll(consentType, "_", "") {
+			return consentType, nil
+		}
+	}
+	return "", errors.New(INVALID_CONSENT_TYPE)
+}
+
+func consentTextHash(text string) string {
+	hash := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(hash[:])
+}
+
+/*
+* Hospital whose consent forms the user works with
+ */
+func consentFormHospital(c *gin.Context) (string, error) {
+	switch c.GetString("collection") {
+	case util.HospitalCollection:
+		return c.GetString("code"), nil
+	case util.DoctorCollection, util.NurseCollection, util.ReceptionistCollection:
+		return fetchStaffHospital(c)
+	}
+	if c.GetBool("isSuperAdmin") {
+		hospitalId := strings.TrimSpace(c.Query("hospitalId"))
+		if hospitalId == "" {
+			return "", errors.New(HOSPITAL_ID_REQUIRED)
+		}
+		return hospitalId, nil
+	}
+	return "", errors.New(util.INVALID_USER_TO_ACCESS)
+}
+
+/*
+* Forms every hospital uses until it publishes its own, seeded when there are no global forms yet
+ */
+var defaultConsentForms = []map[string]interface{}{
+	{
+		"consentType": CONSENT_TYPE_GENERAL,
+		"title":       "General consent for treatment",
+		"text":        "I consent to the examination, investigations and treatment advised by the doctors and staff of the hospital. The nature of the treatment has been explained to me and I may withdraw this consent at any time.",
+	},
+	{
+		"consentType": CONSENT_TYPE_SURGERY,
+		"title":       "Consent for surgery",
+		"text":        "I consent to the surgery and the anaesthesia explained to me by the surgeon. The benefits, the risks, the alternatives and the outcome of refusing the surgery have been explained to me and my questions have been answered.",
+	},
+	{
+		"consentType": CONSENT_TYPE_DATA_SHARING,
+		"title":       "Consent for sharing of health records",
+		"text":        "I consent to my health records being shared with the doctors, laboratories and pharmacies involved in my care. My records are not shared for any other purpose and I may withdraw this consent at any time.",
+	},
+}
+
+/*
+* Current version of the consent form the hospital published for the consent type
+ */
+func hospitalConsentForm(c context.Context, hospitalId interface{}, consentType string) (map[string]interface{}, error) {
+	form := make(map[string]interface{})
+	filter := bson.M{"hospitalId": hospitalId, "consentType": consentType, "status": CONSENT_FORM_STATUS_CURRENT}
+	if err := db.FindOne(c, db.OpenCollections(ConsentFormCollection), filter, form); err != nil {
+		return nil, err
+	}
+	return form, nil
+}
+
+/*
+* Current version of the consent form of the hospital for the consent type
+* A hospital which hasnot published the form yet uses the global(default) form
+ */
+func currentConsentForm(c *gin.Context, hospitalId string, consentType string) (map[string]interface{}, error) {
+	form, err := hospitalConsentForm(c, hospitalId, consentType)
+	if err == nil {
+		return form, nil
+	}
+	form, err = hospitalConsentForm(c, bson.M{"$exists": false}, consentType)
+	if err != nil {
+		log.Println("Error from findOne(consentForm): ", err)
+		return nil, errors.New(CONSENT_FORM_NOT_FOUND + consentType)
+	}
+	return form, nil
+}
+
+/*
+* Hospital admin publishes a new version of the consent form{consentType, title, text, validityDays}
+* The form text is never changed, a revision is a new version and the previous one is superseded
+* validityDays(default 365) is how long the consents given on this version are valid
+ */
+func PublishConsentForm(c *gin.Context, data map[string]interface{}) (map[string]interface{}, error) {
+	if c.GetString("collection") != util.HospitalCollection {
+		return nil, errors.New(ONLY_HOSPITAL_CAN_PUBLISH_FORMS)
+	}
+	hospitalId := c.GetString("code")
+	consentType, err := normalizeConsentType(getString(data["consentType"]))
+	if err != nil {
+		return nil, err
+	}
+	title := strings.TrimSpace(getString(data["title"]))
+	text := strings.TrimSpace(getString(data["text"]))
+	if title == "" || text == "" {
+		return nil, errors.New(CONSENT_FORM_TEXT_REQUIRED)
+	}
+	validityDays := CONSENT_DEFAULT_VALIDITY
+	if raw, exists := data["validityDays"]; exists && raw != nil {
+		days, ok := raw.(float64)
+		if !ok || days != math.Trunc(days) || days < 1 || days > float64(CONSENT_MAX_VALIDITY) {
+			return nil, errors.New(INVALID_CONSENT_VALIDITY)
+		}
+		validityDays = int(days)
+	}
+
+	version := 1
+	previous, err := hospitalConsentForm(c, hospitalId, consentType)
+	if err == nil {
+		version = toInt(previous["version"]) + 1
+	}
+	code, err := GenerateCode(ConsentFormCollection)
+	if err != nil {
+		log.Println("Error from generateCode: ", err)
+		return nil, err
+	}
+	form := map[string]interface{}{
+		"code":         code,
+		"consentType":  consentType,
+		"version":      version,
+		"title":        title,
+		"text":         text,
+		"textHash":     consentTextHash(text),
+		"validityDays": validityDays,
+		"status":       CONSENT_FORM_STATUS_CURRENT,
+		"hospitalId":   hospitalId,
+		"tenantId":     c.GetString("tenantId"),
+		"createdBy":    hospitalId,
+		"createdAt":    time.Now(),
+	}
+	collection := db.OpenCollections(ConsentFormCollection)
+	if _, err := db.CreateOne(c, collection, form); err != nil {
+		log.Println("Error from createOne: ", err)
+		return nil, err
+	}
+	filter := bson.M{
+		"hospitalId":  hospitalId,
+		"consentType": consentType,
+		"status":      CONSENT_FORM_STATUS_CURRENT,
+		"code":        bson.M{"$ne": code},
+	}
+	update := bson.M{"$set": bson.M{
+		"status":       CONSENT_FORM_STATUS_SUPERSEDED,
+		"supersededBy": code,
+		"supersededAt": time.Now(),
+	}}
+	if _, err := db.UpdateMany(c, collection, filter, update, nil); err != nil {
+		log.Println("Error from updateMany: ", err)
+		return nil, err
+	}
+	return form, nil
+}
+
+func FetchConsentForm(c *gin.Context, formId string) (map[string]interface{}, error) {
+	form := make(map[string]interface{})
+	if err := db.FindOne(c, db.OpenCollections(ConsentFormCollection), bson.M{"code": formId}, form); err != nil {
+		log.Println("Error from findOne: ", err)
+		return nil, errors.New(CONSENT_FORM_NOT_FOUND + formId)
+	}
+	return form, nil
+}
+
+/*
+* Current form of the hospital of the user for the consent type, shown to the patient before the consent is taken
+ */
+func FetchCurrentConsentForm(c *gin.Context, consentType string) (map[string]interface{}, error) {
+	hospitalId, err := consentFormHospital(c)
+	if err != nil {
+		return nil, err
+	}
+	consentType, err = normalizeConsentType(consentType)
+	if err != nil {
+		return nil, err
+	}
+	return currentConsentForm(c, hospitalId, consentType)
+}
+
+/*
+* All the versions of the forms of the hospital and the global forms, latest first, consentType(optional) filters them
+ */
+func FetchConsentForms(c *gin.Context, consentType string) ([]interface{}, error) {
+	hospitalId, err := consentFormHospital(c)
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.M{"hospitalId": bson.M{"$in": bson.A{hospitalId, nil}}}
+	if strings.TrimSpace(consentType) != "" {
+		consentType, err = normalizeConsentType(consentType)
+		if err != nil {
+			return nil, err
+		}
+		filter["consentType"] = consentType
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "consentType", Value: 1}, {Key: "version", Value: -1}})
+	forms, err := db.FindAll(c, db.OpenCollections(ConsentFormCollection), filter, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	return forms, nil
+}
+
+/*
+* Global forms of every consent type are seeded once, a hospital publishing its own form takes over from them
+ */
+func SeedDefaultConsentForms() error {
+	c := context.Background()
+	collection := db.OpenCollections(ConsentFormCollection)
+	for _, defaults := range defaultConsentForms {
+		consentType := getString(defaults["consentType"])
+		if _, err := hospitalConsentForm(c, bson.M{"$exists": false}, consentType); err == nil {
+			continue
+		}
+		code, err := GenerateCode(ConsentFormCollection)
+		if err != nil {
+			log.Println("Error from generateCode: ", err)
+			return err
+		}
+		text := getString(defaults["text"])
+		form := map[string]interface{}{
+			"code":         code,
+			"consentType":  consentType,
+			"version":      1,
+			"title":        defaults["title"],
+			"text":         text,
+			"textHash":     consentTextHash(text),
+			"validityDays": CONSENT_DEFAULT_VALIDITY,
+			"status":       CONSENT_FORM_STATUS_CURRENT,
+			"createdBy":    "SYSTEM",
+			"createdAt":    time.Now(),
+		}
+		if _, err := db.CreateOne(c, collection, form); err != nil {
+			log.Println("Error from createOne: ", err)
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+* Consents given before the forms were versioned have no expiresAt, they are valid for the default validity from createdAt
+ */
+func consentExpiry(consent map[string]interface{}) (time.Time, bool) {
+	if expiresAt, ok := toTime(consent["expiresAt"]); ok {
+		return expiresAt, true
+	}
+	if createdAt, ok := toTime(consent["createdAt"]); ok {
+		return createdAt.AddDate(0, 0, CONSENT_DEFAULT_VALIDITY), true
+	}
+	return time.Time{}, false
+}
+
+/*
+* WITHDRAWN and ACTIVE are saved on the consent, PENDING(not verified) and EXPIRED are derived when it is read
+ */
+func consentStatus(consent map[string]interface{}) string {
+	if getString(consent["status"]) == CONSENT_STATUS_WITHDRAWN {
+		return CONSENT_STATUS_WITHDRAWN
+	}
+	if verified, _ := consent["isConsentVerified"].(bool); !verified {
+		return CONSENT_STATUS_PENDING
+	}
+	if expiresAt, ok := consentExpiry(consent); ok && !time.Now().Before(expiresAt) {
+		return CONSENT_STATUS_EXPIRED
+	}
+	return CONSENT_STATUS_ACTIVE
+}
+
+func withConsentStatus(consent map[string]interface{}) map[string]interface{} {
+	consent["status"] = consentStatus(consent)
+	if expiresAt, ok := consentExpiry(consent); ok {
+		consent["expiresAt"] = expiresAt
+	}
+	return consent
+}
+
+/*
+* Only an active consent allows the work it was given for, a consent whose guardian signature doesnot match is rejected
+ */
+func requireActiveConsent(consent map[string]interface{}) error {
+	consentId := getString(consent["code"])
+	if getString(consent["signatureStatus"]) == CONSENT_SIGNATURE_INVALID {
+		return errors.New(CONSENT_TAMPERED + consentId)
+	}
+	switch consentStatus(consent) {
+	case CONSENT_STATUS_PENDING:
+		return errors.New(util.CONSENT_NOT_APPROVED)
+	case CONSENT_STATUS_WITHDRAWN:
+		return errors.New(CONSENT_WITHDRAWN + consentId)
+	case CONSENT_STATUS_EXPIRED:
+		return errors.New(CONSENT_EXPIRED + consentId)
+	}
+	return nil
+}
+
+/*
+* Withdraw the consent{reason}, the consent is kept with the reason, the time and who withdrew it
+* Every change of the consent is added to its history
+ */
+func WithdrawConsent(c *gin.Context, consentId string, data map[string]interface{}) (map[string]interface{}, error) {
+	consent, err := FetchConsentByCode(c, consentId)
+	if err != nil {
+		log.Println("Error from fetchConsentByCode: ", err)
+		return nil, err
+	}
+	if getString(consent["status"]) == CONSENT_STATUS_WITHDRAWN {
+		return nil, errors.New(CONSENT_ALREADY_WITHDRAWN + consentId)
+	}
+	reason := strings.TrimSpace(getString(data["reason"]))
+	if reason == "" {
+		return nil, errors.New(WITHDRAWAL_REASON_REQUIRED)
+	}
+	code := c.GetString("code")
+	now := time.Now()
+	collection := db.OpenCollections(util.ConsentCollection)
+	filter := bson.M{"code": consentId, "status": bson.M{"$ne": CONSENT_STATUS_WITHDRAWN}}
+	update := bson.M{
+		"$set": bson.M{
+			"status":                CONSENT_STATUS_WITHDRAWN,
+			"withdrawalReason":      reason,
+			"withdrawnBy":           code,
+			"withdrawnByCollection": c.GetString("collection"),
+			"withdrawnAt":           now,
+			"updatedBy":             code,
+			"updatedAt":             now,
+		},
+		"$push": bson.M{"history": bson.M{
+			"action":     CONSENT_STATUS_WITHDRAWN,
+			"by":         code,
+			"collection": c.GetString("collection"),
+			"reason":     reason,
+			"at":         now,
+		}},
+	}
+	result, err := db.UpdateOne(c, collection, filter, update)
+	if err != nil {
+		log.Println("Error from updateOne: ", err)
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, errors.New(CONSENT_ALREADY_WITHDRAWN + consentId)
+	}
+	if err := redis.DeleteCache(c, util.ConsentKey+consentId); err != nil {
+		log.Println("Failed deleting old consent cache: ", err)
+	}
+	updated := make(map[string]interface{})
+	if err := db.FindOne(c, collection, bson.M{"code": consentId}, updated); err != nil {
+		log.Println("Error from findOne: ", err)
+		return nil, err
+	}
+	return withConsentSignature(c, withConsentStatus(updated)), nil
+}
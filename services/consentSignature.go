@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+/*
+* Fields of the consent covered by the guardian signature, the form is identified by its version and text hash
+* status, withdrawal and the audit fields change after the consent is given and are not signed
+ */
+var signedConsentFields = []string{
+	"code", "consentType", "consentPermission", "formId", "formVersion", "formTextHash", "patientId", "hospitalId", "tenantId",
+}
+
+var signedGuardianFields = []string{"guardianId", "name", "relation", "signedAt"}
+
+/*
+* Canonical serialization of the signed fields of the consent and the guardian who gave it
+* signedAt is kept as a string so the consent read from the cache gives the same bytes as the one read from mongo
+ */
+func CanonicalConsent(consent map[string]interface{}) ([]byte, error) {
+	payload := make(map[string]interface{})
+	for _, field := range signedConsentFields {
+		if value, exists := consent[field]; exists && value != nil {
+			payload[field] = canonicalValue(value)
+		}
+	}
+	if guardian, ok := consent["guardian"].(map[string]interface{}); ok {
+		signer := make(map[string]interface{})
+		for _, field := range signedGuardianFields {
+			if value, exists := guardian[field]; exists && value != nil {
+				signer[field] = canonicalValue(value)
+			}
+		}
+		payload["guardian"] = signer
+	}
+	return json.Marshal(payload)
+}
+
+/*
+* Sign the consent of a minor with the key of the guardian who verified it with the OTP
+* Called after every signed field is set and before the consent is saved, the signature is saved as consent.guardian.signature
+ */
+func signGuardianConsent(c *gin.Context, consent map[string]interface{}, guardian map[string]interface{}) error {
+	signer, payload, err := guardianConsentPayload(consent, guardian, time.Now())
+	if err != nil {
+		log.Println("Error from guardianConsentPayload: ", err)
+		return err
+	}
+	signature, err := signPayload(c, guardian, payload)
+	if err != nil {
+		log.Println("Error from signPayload: ", err)
+		return err
+	}
+	signer["signature"] = signature
+	return nil
+}
+
+/*
+* Set the guardian who gives the consent on it and return the payload to sign
+* signedAt is a string in milliseconds, the same bytes come back from mongo and from the cache
+ */
+func guardianConsentPayload(consent map[string]interface{}, guardian map[string]interface{}, signedAt time.Time) (map[string]interface{}, []byte, error) {
+	signer := map[string]interface{}{
+		"guardianId": guardian["code"],
+		"name":       guardian["name"],
+		"relation":   guardian["relation"],
+		"signedAt":   signedAt.UTC().Truncate(time.Millisecond).Format("2006-01-02T15:04:05.000Z"),
+	}
+	consent["guardian"] = signer
+	payload, err := CanonicalConsent(consent)
+	if err != nil {
+		log.Println("Error from canonicalConsent: ", err)
+		return nil, nil, err
+	}
+	return signer, payload, nil
+}
+
+/*
+* Check the guardian signature against the consent as it is now
+* Consents of adults have no guardian block, consents of minors taken before the signing have no signature
+* Returns the status and the reason when the signature cannot be trusted
+ */
+func consentSignatureStatus(c context.Context, consent map[string]interface{}) (string, string) {
+	guardian, ok := consent["guardian"].(map[string]interface{})
+	if !ok {
+		return CONSENT_SIGNATURE_NOT_REQUIRED, ""
+	}
+	signature, ok := guardian["signature"].(map[string]interface{})
+	if !ok {
+		return CONSENT_SIGNATURE_UNSIGNED, ""
+	}
+	signingKey, reason := fetchSignatureKey(c, signature)
+	if reason != "" {
+		return CONSENT_SIGNATURE_INVALID, reason
+	}
+	return guardianSignatureStatus(consent, guardian, signature, signingKey)
+}
+
+/*
+* The signature must verify with the signing key and the key must belong to the guardian on the consent,
+* a key of another user(a doctor or another guardian) is not accepted even when the signature verifies
+ */
+func guardianSignatureStatus(consent map[string]interface{}, guardian map[string]interface{}, signature map[string]interface{}, signingKey map[string]interface{}) (string, string) {
+	payload, err := CanonicalConsent(consent)
+	if err != nil {
+		log.Println("Error from canonicalConsent: ", err)
+		return CONSENT_SIGNATURE_INVALID, err.Error()
+	}
+	if reason := verifyWithSigningKey(signingKey, signature, payload); reason != "" {
+		return CONSENT_SIGNATURE_INVALID, reason
+	}
+	if getString(signingKey["doctorId"]) != getString(guardian["guardianId"]) {
+		return CONSENT_SIGNATURE_INVALID, SIGNATURE_INVALID
+	}
+	return CONSENT_SIGNATURE_VALID, ""
+}
+
+/*
+* Every read of the consent carries the result of the signature check
+ */
+func withConsentSignature(c context.Context, consent map[string]interface{}) map[string]interface{} {
+	status, reason := consentSignatureStatus(c, consent)
+	consent["signatureStatus"] = status
+	if reason != "" {
+		consent["signatureReason"] = reason
+	}
+	return consent
+}
+
+/*
+* Tamper check of the consent, always read from the database and not from the cache
+* The hash of the consent as it is now is returned along with the signed hash to compare
+ */
+func VerifyConsentSignature(c *gin.Context, consentId string) (map[string]interface{}, error) {
+	if _, err := FetchConsentByCode(c, consentId); err != nil {
+		log.Println("Error from fetchConsentByCode: ", err)
+		return nil, err
+	}
+	consent := make(map[string]interface{})
+	if err := db.FindOne(c, db.OpenCollections(util.ConsentCollection), bson.M{"code": consentId}, consent); err != nil {
+		log.Println("Error from findOne: ", err)
+		return nil, err
+	}
+	status, reason := consentSignatureStatus(c, consent)
+	result := map[string]interface{}{
+		"consentId":       consent["code"],
+		"patientId":       consent["patientId"],
+		"signatureStatus": status,
+		"isValid":         status == CONSENT_SIGNATURE_VALID,
+	}
+	if reason != "" {
+		result["reason"] = reason
+	}
+	guardian, _ := consent["guardian"].(map[string]interface{})
+	signature, ok := guardian["signature"].(map[string]interface{})
+	if !ok {
+		return result, nil
+	}
+	payload, err := CanonicalConsent(consent)
+	if err != nil {
+		log.Println("Error from canonicalConsent: ", err)
+		return nil, err
+	}
+	hash := sha256.Sum256(payload)
+	result["guardianId"] = guardian["guardianId"]
+	result["signedAt"] = guardian["signedAt"]
+	result["keyId"] = signature["keyId"]
+	result["algorithm"] = signature["algorithm"]
+	result["payloadHash"] = signature["payloadHash"]
+	result["currentHash"] = hex.EncodeToString(hash[:])
+	return result, nil
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func sampleMinorConsent() map[string]interface{} {
+	return map[string]interface{}{
+		"code":              "CN1",
+		"consentType":       "SURGERY",
+		"consentPermission": true,
+		"formId":            "CF1",
+		"formVersion":       int32(2),
+		"formTextHash":      "ab12",
+		"patientId":         "P1",
+		"hospitalId":        "H1",
+		"tenantId":          "T1",
+		"status":            "ACTIVE",
+		"guardian": map[string]interface{}{
+			"guardianId": "G1",
+			"name":       "Parent",
+			"relation":   "MOTHER",
+			"signedAt":   "2026-04-01T10:00:00.120Z",
+		},
+	}
+}
+
+func TestCanonicalConsent(t *testing.T) {
+	consent := sampleMinorConsent()
+	signed, err := CanonicalConsent(consent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	consent["status"] = "WITHDRAWN"
+	consent["withdrawnAt"] = "2026-05-01"
+	consent["guardian"].(map[string]interface{})["signature"] = map[string]interface{}{"value": "x"}
+	if unsigned, _ := CanonicalConsent(consent); string(unsigned) != string(signed) {
+		t.Error("status, withdrawal and the signature must not be signed")
+	}
+	consent["guardian"].(map[string]interface{})["relation"] = "FATHER"
+	if altered, _ := CanonicalConsent(consent); string(altered) == string(signed) {
+		t.Error("guardian relation must be signed")
+	}
+	consent["guardian"].(map[string]interface{})["relation"] = "MOTHER"
+	consent["formTextHash"] = "cd34"
+	if altered, _ := CanonicalConsent(consent); string(altered) == string(signed) {
+		t.Error("form text hash must be signed")
+	}
+}
+
+func TestGuardianConsentPayload(t *testing.T) {
+	consent := sampleMinorConsent()
+	delete(consent, "guardian")
+	guardian := map[string]interface{}{"code": "G1", "name": "Parent", "relation": "MOTHER", "phoneNo": "9999999999"}
+	signedAt := time.Date(2026, 4, 1, 15, 30, 0, 120_456_789, time.FixedZone("IST", 5*3600+1800))
+	signer, payload, err := guardianConsentPayload(consent, guardian, signedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"guardianId": "G1", "name": "Parent", "relation": "MOTHER", "signedAt": "2026-04-01T10:00:00.120Z"}
+	if len(signer) != len(want) {
+		t.Errorf("signer = %v, want %v", signer, want)
+	}
+	for field, value := range want {
+		if signer[field] != value {
+			t.Errorf("signer[%s] = %v, want %v", field, signer[field], value)
+		}
+	}
+	if consent["guardian"].(map[string]interface{})["guardianId"] != "G1" {
+		t.Errorf("guardian not set on the consent: %v", consent["guardian"])
+	}
+
+	signer["signature"] = map[string]interface{}{"keyId": "K1", "value": "x", "signedAt": time.Now()}
+	stored, _ := CanonicalConsent(bsonRoundTrip(t, consent))
+	if string(stored) != string(payload) {
+		t.Errorf("stored consent doesnot give the signed payload:\n%s\n%s", payload, stored)
+	}
+}
+
+func TestGuardianSignatureStatus(t *testing.T) {
+	privateKey, publicKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := encodePublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherPublicKey, _ := GenerateKeyPair()
+	otherEncoded, _ := encodePublicKey(otherPublicKey)
+
+	signedConsent := func() map[string]interface{} {
+		consent := sampleMinorConsent()
+		signer, payload, err := guardianConsentPayload(consent, map[string]interface{}{"code": "G1", "name": "Parent", "relation": "MOTHER"}, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := SignData(payload, privateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer["signature"] = map[string]interface{}{"keyId": "K1", "value": value}
+		return bsonRoundTrip(t, consent)
+	}
+	cases := []struct {
+		name       string
+		signingKey map[string]interface{}
+		change     func(consent map[string]interface{})
+		status     string
+		reason     string
+	}{
+		{"key of the guardian", map[string]interface{}{"doctorId": "G1", "publicKey": encoded}, nil, CONSENT_SIGNATURE_VALID, ""},
+		{"key of a doctor", map[string]interface{}{"doctorId": "D1", "publicKey": encoded}, nil, CONSENT_SIGNATURE_INVALID, SIGNATURE_INVALID},
+		{"key of another guardian", map[string]interface{}{"doctorId": "G2", "publicKey": encoded}, nil, CONSENT_SIGNATURE_INVALID, SIGNATURE_INVALID},
+		{"guardian changed to the key owner", map[string]interface{}{"doctorId": "G2", "publicKey": encoded}, func(consent map[string]interface{}) {
+			consent["guardian"].(map[string]interface{})["guardianId"] = "G2"
+		}, CONSENT_SIGNATURE_INVALID, SIGNATURE_INVALID},
+		{"permission changed", map[string]interface{}{"doctorId": "G1", "publicKey": encoded}, func(consent map[string]interface{}) {
+			consent["consentPermission"] = false
+		}, CONSENT_SIGNATURE_INVALID, SIGNATURE_INVALID},
+		{"other key pair", map[string]interface{}{"doctorId": "G1", "publicKey": otherEncoded}, nil, CONSENT_SIGNATURE_INVALID, SIGNATURE_INVALID},
+		{"unreadable key", map[string]interface{}{"doctorId": "G1", "publicKey": "not a pem"}, nil, CONSENT_SIGNATURE_INVALID, UNABLE_TO_READ_SIGNING_KEY},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			consent := signedConsent()
+			if tc.change != nil {
+				tc.change(consent)
+			}
+			guardian := consent["guardian"].(map[string]interface{})
+			status, reason := guardianSignatureStatus(consent, guardian, guardian["signature"].(map[string]interface{}), tc.signingKey)
+			if status != tc.status || reason != tc.reason {
+				t.Errorf("status = %s %q, want %s %q", status, reason, tc.status, tc.reason)
+			}
+		})
+	}
+}
+
+func TestConsentSignatureStatusWithoutSignature(t *testing.T) {
+	adult := sampleMinorConsent()
+	delete(adult, "guardian")
+	if status, reason := consentSignatureStatus(context.Background(), adult); status != CONSENT_SIGNATURE_NOT_REQUIRED || reason != "" {
+		t.Errorf("adult consent = %s %s", status, reason)
+	}
+	if status, reason := consentSignatureStatus(context.Background(), sampleMinorConsent()); status != CONSENT_SIGNATURE_UNSIGNED || reason != "" {
+		t.Errorf("legacy minor consent = %s %s", status, reason)
+	}
+}
@@ -0,0 +1,557 @@
+package services
+
+/*
+* Collections and cache keys which are not part of the Core module
+ */
+const (
+	PendingDispenseKey             string = "PENDING_DISPENSE#"
+	PendingDispenseCollection      string = "PENDING_DISPENSE"
+	ControlledDispenseKey          string = "CONTROLLED_DISPENSE#"
+	ControlledDispenseCollection   string = "CONTROLLED_DISPENSE"
+	ControlledRegisterCollection   string = "CONTROLLED_REGISTER"
+	RefillCollection               string = "REFILL"
+	SigningKeyCollection           string = "SIGNING_KEY"
+	SpecimenCollection             string = "SPECIMEN"
+	HL7MappingCollection           string = "HL7_CODE_MAPPING"
+	HL7ErrorCollection             string = "HL7_ERROR_QUEUE"
+	HL7SenderCollection            string = "HL7_SENDER"
+	VitalsCollection               string = "VITALS"
+	ICD10Collection                string = "ICD10_CODE"
+	DiagnosisCollection            string = "DIAGNOSIS"
+	ProblemCollection              string = "PROBLEM"
+	ClinicalNoteCollection         string = "CLINICAL_NOTE"
+	NoteTemplateCollection         string = "NOTE_TEMPLATE"
+	AllergyCollection              string = "ALLERGY"
+	ImmunizationCollection         string = "IMMUNIZATION"
+	AttachmentCollection           string = "ATTACHMENT"
+	MedicalRecordHistoryCollection string = "MEDICAL_RECORD_HISTORY"
+	DischargeCollection            string = "DISCHARGE"
+	WardCollection                 string = "WARD"
+	RoomCollection                 string = "ROOM"
+	BedCollection                  string = "BED"
+	BedAssignmentCollection        string = "BED_ASSIGNMENT"
+	ConsentFormCollection          string = "CONSENT_FORM"
+	CodeCounterCollection          string = "CODE_COUNTER"
+)
+
+/*
+* Status values used across the documents
+ */
+const (
+	PENDING_DISPENSE_STATUS_PENDING    string = "PENDING"
+	PENDING_DISPENSE_STATUS_READY      string = "READY"
+	PENDING_DISPENSE_STATUS_DISPENSED  string = "DISPENSED"
+	PENDING_DISPENSE_STATUS_DISPENSING string = "DISPENSING"
+	BILL_TYPE_REGULAR                  string = "REGULAR"
+	BILL_TYPE_SUPPLEMENTARY            string = "SUPPLEMENTARY"
+	BILL_TYPE_REFILL                   string = "REFILL"
+	BILL_TYPE_INPATIENT                string = "INPATIENT"
+	CONTROLLED_STATUS_AWAITING_WITNESS string = "AWAITING_WITNESS"
+	CONTROLLED_STATUS_WITNESSED        string = "WITNESSED"
+	REGISTER_ENTRY_DISPENSE            string = "DISPENSE"
+	REGISTER_ENTRY_RECEIPT             string = "RECEIPT"
+	PRESCRIPTION_STATUS_ACTIVE         string = "ACTIVE"
+	PRESCRIPTION_STATUS_SUPERSEDED     string = "SUPERSEDED"
+	SCHEDULE_FIXED_TIMES               string = "FIXED_TIMES"
+	SCHEDULE_INTERVAL                  string = "INTERVAL"
+	SCHEDULE_WEEKLY                    string = "WEEKLY"
+	SCHEDULE_TAPERING                  string = "TAPERING"
+	SCHEDULE_PRN                       string = "PRN"
+	SIGNING_KEY_STATUS_ACTIVE          string = "ACTIVE"
+	SIGNING_KEY_STATUS_ROTATED         string = "ROTATED"
+	SIGNATURE_ALGORITHM                string = "RSA-SHA256"
+	LAB_REPORT_SIGNATURE_VERSION       int    = 2
+	TEST_TYPE_SINGLE                   string = "SINGLE"
+	TEST_TYPE_PANEL                    string = "PANEL"
+	PANEL_PRICING_BUNDLE               string = "BUNDLE"
+	PANEL_PRICING_PER_ITEM             string = "PER_ITEM"
+	REFERENCE_SEX_ANY                  string = "ANY"
+	REFERENCE_SEX_MALE                 string = "M"
+	REFERENCE_SEX_FEMALE               string = "F"
+	TEST_REPORT_STATUS_ORDERED         string = "ORDERED"
+	TEST_REPORT_STATUS_COLLECTED       string = "COLLECTED"
+	TEST_REPORT_STATUS_RECEIVED        string = "RECEIVED"
+	TEST_REPORT_STATUS_IN_PROCESS      string = "IN_PROCESS"
+	TEST_REPORT_STATUS_RESULTED        string = "RESULTED"
+	TEST_REPORT_STATUS_VERIFIED        string = "VERIFIED"
+	RESULT_FLAG_NORMAL                 string = "N"
+	RESULT_FLAG_LOW                    string = "L"
+	RESULT_FLAG_HIGH                   string = "H"
+	RESULT_FLAG_CRITICAL_LOW           string = "LL"
+	RESULT_FLAG_CRITICAL_HIGH          string = "HH"
+	SPECIMEN_STATUS_COLLECTED          string = "COLLECTED"
+	SPECIMEN_STATUS_RECEIVED           string = "RECEIVED"
+	SPECIMEN_STATUS_IN_PROCESS         string = "IN_PROCESS"
+	SPECIMEN_STATUS_REJECTED           string = "REJECTED"
+	HL7_ERROR_STATUS_PENDING           string = "PENDING"
+	HL7_ERROR_STATUS_RESOLVED          string = "RESOLVED"
+	HL7_ERROR_STATUS_DISCARDED         string = "DISCARDED"
+	HL7_VIA_MLLP                       string = "MLLP"
+	HL7_VIA_FILE                       string = "FILE"
+	HL7_VIA_HTTP                       string = "HTTP"
+	HL7_USER_PREFIX                    string = "HL7:"
+	QUERY_DATE_FORMAT                  string = "2006-01-02"
+	NEWS2_RISK_LOW                     string = "LOW"
+	NEWS2_RISK_LOW_MEDIUM              string = "LOW_MEDIUM"
+	NEWS2_RISK_MEDIUM                  string = "MEDIUM"
+	NEWS2_RISK_HIGH                    string = "HIGH"
+	DIAGNOSIS_TYPE_PRIMARY             string = "PRIMARY"
+	DIAGNOSIS_TYPE_SECONDARY           string = "SECONDARY"
+	DIAGNOSIS_STATUS_PROVISIONAL       string = "PROVISIONAL"
+	DIAGNOSIS_STATUS_FINAL             string = "FINAL"
+	PROBLEM_STATUS_ACTIVE              string = "ACTIVE"
+	PROBLEM_STATUS_INACTIVE            string = "INACTIVE"
+	PROBLEM_STATUS_RESOLVED            string = "RESOLVED"
+	NOTE_STATUS_OPEN                   string = "OPEN"
+	NOTE_STATUS_LOCKED                 string = "LOCKED"
+	NOTE_FIELD_TEXT                    string = "TEXT"
+	NOTE_FIELD_NUMBER                  string = "NUMBER"
+	NOTE_FIELD_BOOLEAN                 string = "BOOLEAN"
+	NOTE_FIELD_CHOICE                  string = "CHOICE"
+	NOTE_DEPARTMENT_GENERAL            string = "GENERAL"
+	ALLERGY_CATEGORY_DRUG              string = "DRUG"
+	ALLERGY_STATUS_ACTIVE              string = "ACTIVE"
+	ALLERGY_STATUS_INACTIVE            string = "INACTIVE"
+	ALLERGY_STATUS_ENTERED_IN_ERROR    string = "ENTERED_IN_ERROR"
+	ALLERGY_VERIFICATION_UNVERIFIED    string = "UNVERIFIED"
+	ALLERGY_VERIFICATION_CONFIRMED     string = "CONFIRMED"
+	ALLERGY_VERIFICATION_REFUTED       string = "REFUTED"
+	ATTACHMENT_CATEGORY_OTHER          string = "OTHER"
+	HISTORY_ACTION_UPDATE              string = "UPDATE"
+	HISTORY_ACTION_VITALS              string = "VITALS"
+	HISTORY_ACTION_CLINICAL_NOTE       string = "CLINICAL_NOTE"
+	HISTORY_ACTION_DELETE              string = "DELETE"
+	TIMELINE_CLINICAL                  string = "CLINICAL"
+	TIMELINE_FINANCIAL                 string = "FINANCIAL"
+	TIMELINE_APPOINTMENT               string = "APPOINTMENT"
+	TIMELINE_PRESCRIPTION              string = "PRESCRIPTION"
+	TIMELINE_TEST_REPORT               string = "TEST_REPORT"
+	TIMELINE_VITALS                    string = "VITALS"
+	TIMELINE_DIAGNOSIS                 string = "DIAGNOSIS"
+	TIMELINE_CLINICAL_NOTE             string = "CLINICAL_NOTE"
+	TIMELINE_ALLERGY                   string = "ALLERGY"
+	TIMELINE_IMMUNIZATION              string = "IMMUNIZATION"
+	TIMELINE_ATTACHMENT                string = "ATTACHMENT"
+	TIMELINE_BILL                      string = "BILL"
+	BILL_PAYMENT_UNPAID                string = "UNPAID"
+	BILL_PAYMENT_PAID                  string = "PAID"
+	BILL_PAYMENT_CREDIT_APPROVED       string = "CREDIT_APPROVED"
+	DISCHARGE_TYPE_NORMAL              string = "NORMAL"
+	DISCHARGE_TYPE_LAMA                string = "LAMA"
+	DISCHARGE_TYPE_REFERRED            string = "REFERRED"
+	DISCHARGE_TYPE_DEATH               string = "DEATH"
+	BED_STATUS_AVAILABLE               string = "AVAILABLE"
+	BED_STATUS_OCCUPIED                string = "OCCUPIED"
+	BED_STATUS_MAINTENANCE             string = "MAINTENANCE"
+	BED_MOVE_ADMIT                     string = "ADMIT"
+	BED_MOVE_TRANSFER                  string = "TRANSFER"
+	BED_MOVE_DISCHARGE                 string = "DISCHARGE"
+	BED_CHARGE_JOB                     string = "BED_CHARGE_JOB"
+	CONSENT_TYPE_GENERAL               string = "GENERAL"
+	CONSENT_TYPE_SURGERY               string = "SURGERY"
+	CONSENT_TYPE_DATA_SHARING          string = "DATA_SHARING"
+	CONSENT_STATUS_PENDING             string = "PENDING"
+	CONSENT_STATUS_ACTIVE              string = "ACTIVE"
+	CONSENT_STATUS_WITHDRAWN           string = "WITHDRAWN"
+	CONSENT_STATUS_EXPIRED             string = "EXPIRED"
+	CONSENT_FORM_STATUS_CURRENT        string = "CURRENT"
+	CONSENT_FORM_STATUS_SUPERSEDED     string = "SUPERSEDED"
+	CONSENT_SIGNATURE_VALID            string = "VALID"
+	CONSENT_SIGNATURE_INVALID          string = "INVALID"
+	CONSENT_SIGNATURE_UNSIGNED         string = "UNSIGNED"
+	CONSENT_SIGNATURE_NOT_REQUIRED     string = "NOT_REQUIRED"
+)
+
+/*
+* FHIR identifier systems of our codes and the extensions used in the exchange
+ */
+const (
+	FHIR_SYSTEM_PATIENT        string = "urn:healthhub360:patient"
+	FHIR_SYSTEM_DOCTOR         string = "urn:healthhub360:doctor"
+	FHIR_SYSTEM_HOSPITAL       string = "urn:healthhub360:hospital"
+	FHIR_SYSTEM_APPOINTMENT    string = "urn:healthhub360:appointment"
+	FHIR_SYSTEM_MEDICAL_RECORD string = "urn:healthhub360:medicalRecord"
+	FHIR_SYSTEM_PRESCRIPTION   string = "urn:healthhub360:prescription"
+	FHIR_SYSTEM_TEST           string = "urn:healthhub360:test"
+	FHIR_SYSTEM_TEST_REPORT    string = "urn:healthhub360:testReport"
+	FHIR_SYSTEM_ANALYTE        string = "urn:healthhub360:analyte"
+	FHIR_SYSTEM_MEDICINE       string = "urn:healthhub360:medicine"
+	FHIR_SYSTEM_CONSENT        string = "urn:healthhub360:consent"
+	FHIR_SYSTEM_BILL           string = "urn:healthhub360:bill"
+	FHIR_SYSTEM_BED            string = "urn:healthhub360:bed"
+	FHIR_EXTENSION_GOVT_ID     string = "urn:healthhub360:fhir:govtId"
+	FHIR_EXTENSION_BIRTH_DATE  string = "urn:healthhub360:fhir:birthDate"
+	FHIR_EXTENSION_DEPARTMENT  string = "urn:healthhub360:fhir:department"
+	FHIR_CURRENCY              string = "INR"
+)
+
+/*
+* Limits for the controlled(scheduled) medicines, the repeat prescriptions, the lab delta check, the ICD-10 search, the clinical notes, the vaccine reminders, the attachments, the timeline
+* the validity(days) of the consents and the retries of the concurrent stock, bill and register updates
+ */
+const (
+	CONTROLLED_DEFAULT_MAX_DAYS int     = 7
+	MAX_REFILLS                 int     = 12
+	DELTA_CHECK_DEFAULT_PERCENT float64 = 50
+	ICD10_SEARCH_DEFAULT_LIMIT  int     = 20
+	ICD10_SEARCH_MAX_LIMIT      int     = 100
+	NOTE_LOCK_HOURS             int     = 24
+	VACCINE_REMINDER_DAYS       int     = 7
+	MAX_ATTACHMENT_SIZE         int64   = 20 << 20
+	MAX_IMPORT_FILE_SIZE        int64   = 5 << 20
+	MAX_XLSX_ENTRY_SIZE         int64   = 50 << 20
+	EXCEL_MAX_DATE_SERIAL       float64 = 2958465
+	THUMBNAIL_MAX_DIMENSION     int     = 256
+	TIMELINE_DEFAULT_PAGE_SIZE  int     = 20
+	TIMELINE_MAX_PAGE_SIZE      int     = 100
+	TIMELINE_MAX_PAGE           int     = 10000
+	CONSENT_DEFAULT_VALIDITY    int     = 365
+	CONSENT_MAX_VALIDITY        int     = 3650
+	STOCK_UPDATE_ATTEMPTS       int     = 5
+	DISPENSE_CLAIM_MINUTES      int     = 10
+	DISCHARGE_CLAIM_MINUTES     int     = 10
+	BILL_UPDATE_ATTEMPTS        int     = 5
+	REGISTER_APPEND_ATTEMPTS    int     = 5
+)
+
+/*
+* Units a dose can be prescribed in, tablets and capsules are dispensed loose
+* every other unit is dispensed in whole packs(tabletsPerStrip is the units per pack)
+ */
+var DoseUnits = []string{"TABLET", "CAPSULE", "ML", "DROP", "PUFF", "UNIT", "SACHET", "APPLICATION"}
+
+var LooseDispenseUnits = []string{"TABLET", "CAPSULE"}
+
+/*
+* Units a dose can be prescribed in for the drugType of the medicine
+* drugType is free text, types which are not listed(and medicines without a drugType) are not checked
+ */
+var DrugTypeDoseUnits = map[string][]string{
+	"TABLET":      {"TABLET"},
+	"CAPSULE":     {"CAPSULE"},
+	"SYRUP":       {"ML"},
+	"SUSPENSION":  {"ML"},
+	"SOLUTION":    {"ML"},
+	"LIQUID":      {"ML"},
+	"ML":          {"ML"},
+	"INJECTION":   {"ML", "UNIT"},
+	"INSULIN":     {"UNIT"},
+	"UNIT":        {"UNIT"},
+	"DROP":        {"DROP", "ML"},
+	"DROPS":       {"DROP", "ML"},
+	"INHALER":     {"PUFF"},
+	"PUFF":        {"PUFF"},
+	"SACHET":      {"SACHET"},
+	"POWDER":      {"SACHET"},
+	"CREAM":       {"APPLICATION"},
+	"OINTMENT":    {"APPLICATION"},
+	"GEL":         {"APPLICATION"},
+	"LOTION":      {"APPLICATION"},
+	"APPLICATION": {"APPLICATION"},
+}
+
+/*
+* Specimen types a lab test can be performed on
+ */
+var SpecimenTypes = []string{"BLOOD", "SERUM", "PLASMA", "URINE", "STOOL", "SPUTUM", "CSF", "SWAB", "TISSUE", "OTHER"}
+
+var SampleRejectionReasons = []string{"HEMOLYSED", "INSUFFICIENT", "CLOTTED", "MISLABELED", "CONTAMINATED", "OTHER"}
+
+/*
+* Sections of a SOAP clinical note and the types of the template fields
+ */
+var NoteSections = []string{"subjective", "objective", "assessment", "plan"}
+
+var NoteFieldTypes = []string{NOTE_FIELD_TEXT, NOTE_FIELD_NUMBER, NOTE_FIELD_BOOLEAN, NOTE_FIELD_CHOICE}
+
+/*
+* Allergy categories, severities and statuses
+ */
+var AllergyCategories = []string{ALLERGY_CATEGORY_DRUG, "FOOD", "ENVIRONMENT", "OTHER"}
+
+var AllergySeverities = []string{"MILD", "MODERATE", "SEVERE", "LIFE_THREATENING"}
+
+var AllergyStatuses = []string{ALLERGY_STATUS_ACTIVE, ALLERGY_STATUS_INACTIVE, ALLERGY_STATUS_ENTERED_IN_ERROR}
+
+/*
+* Ways a bill can be paid and the types of discharge(LAMA is left against medical advice)
+ */
+var PaymentModes = []string{"CASH", "CARD", "UPI", "NET_BANKING", "INSURANCE"}
+
+var DischargeTypes = []string{DISCHARGE_TYPE_NORMAL, DISCHARGE_TYPE_LAMA, DISCHARGE_TYPE_REFERRED, DISCHARGE_TYPE_DEATH}
+
+/*
+* Types of the wards, rooms and beds of a hospital
+ */
+var WardTypes = []string{"GENERAL", "SEMI_PRIVATE", "PRIVATE", "ICU", "NICU", "PICU", "HDU", "MATERNITY", "ISOLATION"}
+
+var RoomTypes = []string{"SHARED", "SEMI_PRIVATE", "PRIVATE", "DELUXE", "SUITE"}
+
+var BedTypes = []string{"STANDARD", "ICU", "VENTILATOR", "PEDIATRIC", "CRIB", "BARIATRIC"}
+
+/*
+* Types of the consent, every type has its own versioned consent form
+ */
+var ConsentTypes = []string{CONSENT_TYPE_GENERAL, CONSENT_TYPE_SURGERY, CONSENT_TYPE_DATA_SHARING}
+
+/*
+* Attachment categories and the content types(sniffed from the file, not the request header) which can be uploaded
+ */
+var AttachmentCategories = []string{"LAB_REPORT", "IMAGING", "DISCHARGE_SUMMARY", "PRESCRIPTION", "REFERRAL", ATTACHMENT_CATEGORY_OTHER}
+
+var AttachmentContentTypes = map[string]string{
+	"application/pdf":   ".pdf",
+	"image/jpeg":        ".jpg",
+	"image/png":         ".png",
+	"image/gif":         ".gif",
+	"image/webp":        ".webp",
+	"application/dicom": ".dcm",
+}
+
+/*
+* Error messages which are not part of the Core module
+ */
+var (
+	INVALID_NUMBER_OF_STRIPS            = "noOfStrips must be a valid positive number"
+	INVALID_TABLETS_PER_STRIP           = "tabletsPerStrip must be a valid positive number"
+	INVALID_PRICE_PER_STRIP             = "pricePerStrip must be a valid positive number"
+	UNSUPPORTED_IMPORT_FILE_TYPE        = "Unsupported file type, please upload a .csv or .xlsx file"
+	IMPORT_FILE_IS_EMPTY                = "Import file doesnot contain any rows"
+	IMPORT_FILE_TOO_LARGE               = "Import file is larger than the allowed size of 5 MB"
+	IMPORT_FILE_MISSING_HEADER          = "Import file header is missing the column: "
+	DUPLICATE_MEDICINE_IN_IMPORT_FILE   = "Medicine with same name is repeated in the import file"
+	UNABLE_TO_READ_XLSX_FILE            = "Unable to read the xlsx file"
+	CODE_COUNTER_NOT_SEEDED             = "Unable to generate the code for: "
+	UNABLE_TO_FETCH_GENERIC_NAME        = "Medicine doesnot have a genericName to find substitutes"
+	UNABLE_TO_FETCH_HOSPITAL_ID         = "Unable to fetch hospitalId from the document"
+	UNABLE_TO_FETCH_TENANT_ID_FROM_DOC  = "Unable to fetch tenantId from the document"
+	NO_PENDING_MEDICINES_FOR_PATIENT    = "No pending medicines found for this patient"
+	NO_STOCK_FOR_PENDING_MEDICINES      = "Pending medicines are still out of stock"
+	RESTOCK_STRIPS_REQUIRED             = "noOfStrips to restock must be a valid positive number"
+	INVALID_IS_CONTROLLED               = "isControlled must be true or false"
+	INVALID_MAX_DAYS                    = "maxDays must be a valid positive number"
+	DOCTOR_NOT_ELIGIBLE_FOR_CONTROLLED  = "Doctor is not eligible to prescribe controlled medicines"
+	CONTROLLED_MEDICINE_EXCEEDS_DAYS    = "noOfDays exceeds the maximum allowed for the controlled medicine: "
+	WITNESS_MUST_BE_ANOTHER_PHARMACIST  = "Witness must be a different pharmacist than the one who dispensed"
+	CONTROLLED_DISPENSE_NOT_AWAITING    = "Controlled dispense is not awaiting a witness"
+	BATCH_NUMBER_REQUIRED               = "batchNo is required for controlled medicines"
+	INSUFFICIENT_STOCK_FOR_CONTROLLED   = "Insufficient stock to dispense the controlled medicine"
+	INSUFFICIENT_STOCK                  = "Insufficient stock of the medicine: "
+	STOCK_UPDATE_CONFLICT               = "Stock of the medicine is being updated, try again: "
+	REGISTER_APPEND_CONFLICT            = "Controlled register is being updated, try again"
+	HOSPITAL_ID_REQUIRED_FOR_REGISTER   = "hospitalId is required to view the controlled register"
+	AMENDMENT_REASON_REQUIRED           = "reason is required to amend the prescription"
+	AMENDMENT_HAS_NO_CHANGES            = "diagnosis, diagnoses, medicines or refills must be provided to amend the prescription"
+	PRESCRIPTION_ALREADY_SUPERSEDED     = "Prescription is superseded, amend the latest version: "
+	NO_PREVIOUS_PRESCRIPTION_VERSION    = "Prescription doesnot have a previous version to compare"
+	PRESCRIPTION_VERSIONS_NOT_RELATED   = "Prescriptions are not versions of the same prescription"
+	MEDICINE_NOT_FOUND_IN_PRESCRIPTION  = "Medicine not found in the prescription"
+	SCHEDULE_MUST_BE_AN_OBJECT          = "schedule must be an object"
+	INVALID_SCHEDULE_TYPE               = "schedule type must be one of FIXED_TIMES, INTERVAL, WEEKLY, TAPERING, PRN"
+	INVALID_DOSE_UNIT                   = "schedule unit is not supported: "
+	DOSE_UNIT_NOT_FOR_DRUG_TYPE         = "schedule unit doesnot match the drug type of the medicine: "
+	INVALID_SCHEDULE_NUMBER             = "schedule field must be a valid positive number: "
+	TAPERING_STEPS_REQUIRED             = "steps are required for a tapering schedule"
+	INVALID_EVERY_HOURS                 = "everyHours must be between 1 and 24"
+	INVALID_REFILLS                     = "refills must be a valid number between 0 and 12"
+	REFILL_INTERVAL_REQUIRED            = "refillIntervalDays must be a valid positive number for a repeatable prescription"
+	PRESCRIPTION_NOT_REPEATABLE         = "Prescription is not repeatable"
+	NO_REFILLS_REMAINING                = "No refills remaining for this prescription"
+	REFILL_NOT_DUE_YET                  = "Next refill is allowed from: "
+	UNABLE_TO_FETCH_PATIENT_ID_FROM_DOC = "Unable to fetch patientId from the document"
+	SIGNING_KEY_SECRET_NOT_SET          = "SIGNING_KEY_SECRET is not configured to protect the signing keys"
+	UNABLE_TO_READ_SIGNING_KEY          = "Unable to read the signing key"
+	SIGNING_KEY_NOT_FOUND               = "Signing key of the prescription is not found"
+	PRESCRIPTION_NOT_SIGNED             = "Prescription is not signed"
+	SIGNATURE_INVALID                   = "Signature doesnot match, the document is altered"
+	SIGNING_KEY_NOT_OF_SIGNER           = "Signing key doesnot belong to the signer of the document"
+	INVALID_VERIFICATION_REQUEST        = "Invalid prescription or verification token"
+	INVALID_TEST_TYPE                   = "type must be SINGLE or PANEL"
+	INVALID_SPECIMEN_TYPE               = "specimenType is not supported: "
+	INVALID_TURNAROUND_HOURS            = "turnaroundHours must be a valid positive number"
+	INVALID_PANEL_PRICING_MODE          = "pricingMode must be BUNDLE or PER_ITEM"
+	PANEL_COMPONENTS_REQUIRED           = "components are required for a panel"
+	PANEL_CANNOT_CONTAIN_PANEL          = "Panel cannot contain another panel: "
+	PANEL_CANNOT_CONTAIN_ITSELF         = "Panel cannot contain itself: "
+	TEST_IS_PANEL_COMPONENT             = "Test is a component of a panel and cannot be a panel: "
+	PANEL_COMPONENT_CYCLE               = "Panel components form a cycle: "
+	ANALYTES_MUST_BE_ARRAY              = "analytes must be a non empty array of objects"
+	ANALYTE_FIELD_REQUIRED              = "analyte field is required: "
+	DUPLICATE_ANALYTE_CODE              = "analyte code is repeated: "
+	INVALID_REFERENCE_RANGE             = "referenceRanges must have sex(M, F, ANY), optional age limits and low and/or high values"
+	INVALID_TEST_PRICE                  = "price must be a valid number for the test: "
+	INVALID_ANALYTE_LIMIT               = "analyte limit must be a valid positive number: "
+	RESULTS_MUST_BE_ARRAY               = "results must be a non empty array of {analyteCode, value}"
+	ANALYTE_NOT_IN_REPORT               = "analyte is not part of the test report: "
+	TEST_REPORT_ALREADY_VERIFIED        = "Test report is already verified and released"
+	TEST_REPORT_NOT_RESULTED            = "Test report doesnot have results awaiting verification"
+	VERIFIER_MUST_BE_ANOTHER_USER       = "Results must be verified by a different user than the one who entered them"
+	REJECTION_REASON_REQUIRED           = "reason is required to reject the results"
+	SAMPLE_NOT_IN_PROCESS               = "Results can be entered only after the sample is in process"
+	SPECIMEN_NOT_FOUND                  = "Specimen not found for the accession number: "
+	SPECIMEN_ALREADY_REJECTED           = "Specimen is rejected, use the accession number of the recollected specimen"
+	INVALID_SAMPLE_STATUS               = "Action is not allowed for the sample status: "
+	INVALID_SAMPLE_REJECTION_REASON     = "reason must be one of HEMOLYSED, INSUFFICIENT, CLOTTED, MISLABELED, CONTAMINATED, OTHER"
+	HL7_MAPPING_FIELDS_REQUIRED         = "externalCode and testId are required for the code mapping"
+	HL7_MAPPING_ALREADY_EXISTS          = "Code mapping already exists for the external code: "
+	HL7_MAPPING_NOT_FOUND               = "Code mapping not found: "
+	ANALYTE_NOT_IN_TEST                 = "analyte is not part of the test: "
+	HL7_CODE_NOT_MAPPED                 = "No code mapping found for the HL7 code: "
+	HL7_ORDER_NOT_FOUND                 = "Test report not found for the HL7 order(placer/filler): "
+	HL7_NO_RESULTS_IN_MESSAGE           = "HL7 message doesnot contain any OBR with results"
+	HL7_UNIT_MISMATCH                   = "HL7 result unit doesnot match the analyte unit: "
+	HL7_UNSUPPORTED_MESSAGE_TYPE        = "HL7 message type is not supported: "
+	HL7_ERROR_NOT_FOUND                 = "HL7 error queue entry not found: "
+	HL7_ERROR_NOT_PENDING               = "HL7 error queue entry is already closed: "
+	HL7_DISCARD_REASON_REQUIRED         = "reason is required to discard the HL7 message"
+	HL7_MESSAGE_REQUIRED                = "HL7 message is required in the request body"
+	HL7_SENDER_APPLICATION_REQUIRED     = "application(MSH-3) is required for the HL7 sender"
+	HL7_SENDER_ALREADY_EXISTS           = "HL7 sender is already registered: "
+	HL7_SENDER_NOT_FOUND                = "HL7 sender not found: "
+	HL7_UNKNOWN_SENDER                  = "HL7 sender is not registered to any tenant: "
+	TEST_REPORT_NOT_VERIFIED            = "Test report is not verified yet: "
+	NO_VERIFIED_TEST_REPORTS            = "No verified test reports found for the order"
+	INVALID_LAB_REPORT_VERIFICATION     = "Invalid lab report or verification token"
+	INVALID_DATE_FILTER                 = "date must be in the format YYYY-MM-DD: "
+	INVALID_VITAL_READING               = "vital reading is out of the accepted range: "
+	BP_NEEDS_BOTH_READINGS              = "systolic and diastolic are required together"
+	DIASTOLIC_ABOVE_SYSTOLIC            = "diastolic must be lower than systolic"
+	INVALID_CONSCIOUSNESS_LEVEL         = "consciousness must be one of ALERT, CONFUSION, VOICE, PAIN, UNRESPONSIVE"
+	VITALS_REQUIRED                     = "At least one vital reading is required"
+	INVALID_ON_OXYGEN                   = "onOxygen must be true or false"
+	INVALID_SPO2_SCALE                  = "spo2Scale must be 1 or 2"
+	INVALID_TAKEN_AT                    = "takenAt must be a RFC3339 time which is not in the future"
+	ONLY_NURSE_CAN_RECORD_VITALS        = "Only a nurse can record the vitals"
+	INVALID_VITAL_PARAMETER             = "vital parameter is not supported: "
+	VITALS_MUST_BE_RECORDED             = "bp and weight are recorded as vitals, use /vitals/record"
+	DUPLICATE_ICD10_IN_IMPORT_FILE      = "ICD-10 code is repeated in the import file"
+	INVALID_ICD10_CODE                  = "ICD-10 code is not valid: "
+	ICD10_CODE_NOT_FOUND                = "ICD-10 code is not found in the code set: "
+	ICD10_SEARCH_QUERY_REQUIRED         = "q is required to search the ICD-10 codes"
+	DIAGNOSES_MUST_BE_ARRAY             = "diagnoses must be an array of {icdCode, type, status, chronic}"
+	INVALID_DIAGNOSIS_TYPE              = "diagnosis type must be PRIMARY or SECONDARY"
+	INVALID_DIAGNOSIS_STATUS            = "diagnosis status must be PROVISIONAL or FINAL"
+	INVALID_CHRONIC_FLAG                = "chronic must be true or false"
+	ONE_PRIMARY_DIAGNOSIS_REQUIRED      = "Exactly one diagnosis must be PRIMARY"
+	DUPLICATE_DIAGNOSIS_CODE            = "ICD-10 code is repeated in the diagnoses: "
+	INVALID_PROBLEM_STATUS              = "status must be one of ACTIVE, INACTIVE, RESOLVED"
+	PROBLEM_ALREADY_EXISTS              = "Problem is already on the list of the patient: "
+	PROBLEM_NOT_FOUND                   = "Problem not found: "
+	ONLY_DOCTOR_CAN_UPDATE_PROBLEMS     = "Only a doctor can update the problem list"
+	INVALID_ONSET_DATE                  = "onsetDate must be in the format YYYY-MM-DD and not in the future"
+	NOTE_SECTION_REQUIRED               = "At least one of subjective, objective, assessment, plan is required"
+	INVALID_NOTE_SECTION                = "note section must be text or an object of the template fields: "
+	NOTE_FIELD_REQUIRED                 = "note field is required: "
+	INVALID_NOTE_FIELD                  = "note field value doesnot match the template: "
+	UNKNOWN_NOTE_FIELD                  = "note field is not part of the template: "
+	TEMPLATE_SECTIONS_REQUIRED          = "sections must have fields for at least one of subjective, objective, assessment, plan"
+	INVALID_TEMPLATE_FIELD              = "template fields must have key, label and type(TEXT, NUMBER, BOOLEAN, or CHOICE with options)"
+	DUPLICATE_TEMPLATE_FIELD            = "template field key is repeated: "
+	NOTE_TEMPLATE_NOT_FOUND             = "Note template not found: "
+	NOTE_TEMPLATE_INACTIVE              = "Note template is inactive: "
+	CLINICAL_NOTE_NOT_FOUND             = "Clinical note not found: "
+	CLINICAL_NOTE_LOCKED                = "Clinical note is locked, add an addendum instead"
+	CLINICAL_NOTE_CHANGED               = "Clinical note was locked or edited meanwhile, fetch it and try again"
+	ONLY_AUTHOR_CAN_EDIT_NOTE           = "Only the doctor who wrote the note can edit or lock it"
+	ONLY_DOCTOR_CAN_WRITE_NOTES         = "Only a doctor can write clinical notes"
+	ADDENDUM_TEXT_REQUIRED              = "text is required for the addendum"
+	INVALID_IS_ACTIVE                   = "isActive must be true or false"
+	DOCUMENT_NOT_SIGNED                 = "Document is not signed"
+	NOTES_MUST_BE_WRITTEN               = "clinicalNotes are written as signed notes, use /clinicalNote/create"
+	ONLY_CLINICAL_STAFF_CAN_RECORD      = "Only a doctor or a nurse of the hospital of the patient can record this"
+	INVALID_ALLERGY_CATEGORY            = "category must be one of DRUG, FOOD, ENVIRONMENT, OTHER"
+	INVALID_ALLERGY_SEVERITY            = "severity must be one of MILD, MODERATE, SEVERE, LIFE_THREATENING"
+	INVALID_ALLERGY_STATUS              = "status must be one of ACTIVE, INACTIVE, ENTERED_IN_ERROR"
+	INVALID_ALLERGY_VERIFICATION        = "verificationStatus must be CONFIRMED or REFUTED"
+	ALLERGY_ALREADY_RECORDED            = "Allergy to the substance is already recorded: "
+	ALLERGY_NOT_FOUND                   = "Allergy not found: "
+	ONLY_DOCTOR_CAN_VERIFY_ALLERGY      = "Only a doctor can verify an allergy"
+	ALLERGY_CONFLICT                    = "Patient is allergic to the prescribed medicines, give allergyOverrideReason to prescribe anyway: "
+	INVALID_DOSE_NUMBER                 = "doseNumber must be a valid positive number"
+	INVALID_ADMINISTERED_DATE           = "administeredDate must be in the format YYYY-MM-DD and not in the future"
+	INVALID_NEXT_DUE_DATE               = "nextDueDate must be in the format YYYY-MM-DD and after the administeredDate"
+	IMMUNIZATION_ALREADY_RECORDED       = "Dose is already recorded for the vaccine: "
+	INVALID_DUE_DAYS                    = "days must be a valid non negative number"
+	ATTACHMENT_FILE_REQUIRED            = "file is required"
+	ATTACHMENT_TOO_LARGE                = "File is larger than the allowed size of 20 MB"
+	ATTACHMENT_IS_EMPTY                 = "File is empty"
+	UNSUPPORTED_ATTACHMENT_TYPE         = "Unsupported file type, please upload a PDF, JPEG, PNG, GIF, WEBP or DICOM file: "
+	INVALID_ATTACHMENT_CATEGORY         = "category must be one of LAB_REPORT, IMAGING, DISCHARGE_SUMMARY, PRESCRIPTION, REFERRAL, OTHER"
+	ATTACHMENT_INFECTED                 = "File is rejected by the virus scan: "
+	ATTACHMENT_NOT_FOUND                = "Attachment not found: "
+	THUMBNAIL_NOT_AVAILABLE             = "Thumbnail is available only for images"
+	MEDICAL_RECORD_OF_ANOTHER_PATIENT   = "Medical record doesnot belong to the patient"
+	ONLY_UPLOADER_CAN_DELETE_ATTACHMENT = "Only the user who uploaded the attachment or the hospital admin can delete it"
+	MEDICAL_RECORD_HISTORY_NOT_FOUND    = "No history found for the medical record: "
+	INVALID_HISTORY_TIMESTAMP           = "at must be a RFC3339 timestamp(2026-01-02T15:04:05Z) or a date YYYY-MM-DD"
+	MEDICAL_RECORD_DID_NOT_EXIST        = "Medical record did not exist at "
+	INVALID_TIMELINE_TYPE               = "Invalid timeline type, use APPOINTMENT, PRESCRIPTION, TEST_REPORT, VITALS, DIAGNOSIS, CLINICAL_NOTE, ALLERGY, IMMUNIZATION, ATTACHMENT or BILL: "
+	FHIR_RESOURCE_NOT_FOUND             = "FHIR resource not found: "
+	FHIR_PATIENT_PARAM_REQUIRED         = "patient search param is required"
+	FHIR_RESOURCE_NOT_SUPPORTED         = "Only Patient resources can be imported, skipped: "
+	FHIR_ROLE_CODE_REQUIRED             = "roleCode query param is required to create a patient"
+	FHIR_PATIENT_EMAIL_REQUIRED         = "Patient resource must have an email in telecom"
+	FHIR_RESOURCE_NOT_VISIBLE           = "FHIR resource is not visible to this role: "
+	FHIR_TRANSACTION_NOT_SUPPORTED      = "transaction bundles are not supported, send the patients as a batch bundle"
+	INVALID_PAYMENT_MODE                = "paymentMode must be one of CASH, CARD, UPI, NET_BANKING, INSURANCE"
+	BILL_ALREADY_SETTLED                = "Bill is already settled: "
+	ONLY_HOSPITAL_CAN_APPROVE_CREDIT    = "Only the hospital admin can approve a bill on credit"
+	CREDIT_REASON_REQUIRED              = "reason is required to approve a bill on credit"
+	PATIENT_NOT_ADMITTED                = "Patient is not admitted: "
+	DISCHARGE_IN_PROGRESS               = "Discharge of the patient is already in progress: "
+	ONLY_DOCTOR_CAN_DISCHARGE           = "Only a doctor of the hospital can discharge the patient"
+	INVALID_DISCHARGE_TYPE              = "dischargeType must be one of NORMAL, LAMA, REFERRED, DEATH"
+	INVALID_DISCHARGE_AT                = "dischargeAt must be a RFC3339 timestamp(2026-01-02T15:04:05Z), not before the admission and not in the future"
+	INVALID_FOLLOW_UP_DATE              = "followUpDate must be in the format YYYY-MM-DD and after the discharge"
+	REFERRED_TO_REQUIRED                = "referredTo is required for a referred discharge"
+	CAUSE_OF_DEATH_REQUIRED             = "causeOfDeath is required when the discharge type is DEATH"
+	PROCEDURES_MUST_BE_ARRAY            = "procedures must be a list of names or {name, performedOn, note}"
+	DISCHARGE_MEDICATIONS_MUST_BE_ARRAY = "medications must be an array"
+	CONDITION_AT_DISCHARGE_REQUIRED     = "conditionAtDischarge is required"
+	FINAL_BILL_NOT_GENERATED            = "Final bill is not generated for the admission, generate the bill before the discharge"
+	DISCHARGE_BLOCKED_BY_BILL           = "Bill must be paid or approved on credit before the discharge: "
+	DISCHARGE_NOT_FOUND                 = "Discharge summary not found: "
+	INVALID_DISCHARGE_VERIFICATION      = "Invalid discharge summary verification request"
+	ONLY_HOSPITAL_CAN_MANAGE_BEDS       = "Only the hospital admin can manage the wards, rooms and beds"
+	ONLY_STAFF_CAN_MOVE_PATIENTS        = "Only the staff of the hospital of the patient can admit or transfer the patient"
+	WARD_NAME_REQUIRED                  = "name is required for the ward"
+	ROOM_NO_REQUIRED                    = "roomNo is required for the room"
+	BED_NO_REQUIRED                     = "bedNo is required for the bed"
+	INVALID_WARD_TYPE                   = "wardType must be one of GENERAL, SEMI_PRIVATE, PRIVATE, ICU, NICU, PICU, HDU, MATERNITY, ISOLATION"
+	INVALID_ROOM_TYPE                   = "roomType must be one of SHARED, SEMI_PRIVATE, PRIVATE, DELUXE, SUITE"
+	INVALID_BED_TYPE                    = "bedType must be one of STANDARD, ICU, VENTILATOR, PEDIATRIC, CRIB, BARIATRIC"
+	INVALID_DAILY_TARIFF                = "dailyTariff must be a valid positive whole number"
+	WARD_ALREADY_EXISTS                 = "Ward already exists: "
+	ROOM_ALREADY_EXISTS                 = "Room already exists in the ward: "
+	BED_ALREADY_EXISTS                  = "Bed already exists in the room: "
+	WARD_NOT_FOUND                      = "Ward not found: "
+	ROOM_NOT_FOUND                      = "Room not found: "
+	BED_NOT_FOUND                       = "Bed not found: "
+	BED_NOT_AVAILABLE                   = "Bed is not available: "
+	BED_IS_OCCUPIED                     = "Bed is occupied, transfer or discharge the patient first: "
+	INVALID_BED_STATUS                  = "status must be AVAILABLE or MAINTENANCE"
+	PATIENT_ALREADY_IN_BED              = "Patient is already in a bed, transfer the patient instead: "
+	PATIENT_NOT_IN_BED                  = "Patient is not in a bed: "
+	SAME_BED_TRANSFER                   = "Patient is already in the bed: "
+	PATIENT_BED_CHANGED                 = "Bed of the patient was changed meanwhile, try again: "
+	BED_ASSIGNMENT_CLOSED               = "Bed assignment is already closed: "
+	BILL_UPDATE_CONFLICT                = "Bill is being updated, try again: "
+	INVALID_CENSUS_DATE                 = "date must be in the format YYYY-MM-DD and not in the future"
+	HOSPITAL_ID_REQUIRED                = "hospitalId is required"
+	INVALID_CONSENT_TYPE                = "consentType must be one of GENERAL, SURGERY, DATA_SHARING"
+	ONLY_HOSPITAL_CAN_PUBLISH_FORMS     = "Only the hospital admin can publish the consent forms"
+	CONSENT_FORM_TEXT_REQUIRED          = "title and text are required for the consent form"
+	INVALID_CONSENT_VALIDITY            = "validityDays must be a whole number between 1 and 3650"
+	CONSENT_FORM_NOT_FOUND              = "Consent form not found: "
+	CONSENT_FORM_VERSION_MISMATCH       = "Consent form was revised, the patient has to accept the current version: "
+	WITHDRAWAL_REASON_REQUIRED          = "reason is required to withdraw the consent"
+	CONSENT_ALREADY_WITHDRAWN           = "Consent is already withdrawn: "
+	CONSENT_VERIFIED_CANNOT_BE_DELETED  = "Verified consent cannot be deleted, withdraw it instead: "
+	CONSENT_WITHDRAWN                   = "Consent is withdrawn: "
+	CONSENT_EXPIRED                     = "Consent has expired: "
+	CONSENT_REQUIRED                    = "Medical record has no consent: "
+	GUARDIAN_ID_REQUIRED                = "guardianId is required for the consent of a minor"
+	NOT_GUARDIAN_OF_PATIENT             = "Guardian is not a guardian of the patient: "
+	GUARDIAN_OTP_MISMATCH               = "OTP was not issued to the guardian: "
+	CONSENT_TAMPERED                    = "Guardian signature of the consent doesnot match, the consent is altered: "
+)
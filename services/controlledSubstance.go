@@ -0,0 +1,524 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	redis "github.com/KanapuramVaishnavi/Core/config/redis"
+	common "github.com/KanapuramVaishnavi/Core/coreServices"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+* Fields which are chained into the hash of every register entry
+* Changing any of them(or the order of entries) breaks the chain
+ */
+var registerHashFields = []string{"serialNo", "hospitalId", "entryType", "medicineId", "batchNo", "quantity", "balanceBefore", "balanceAfter", "patientId", "prescriptionId", "prescribedBy", "dispensedBy", "witnessedBy", "receivedBy", "billId", "recordedAt", "previousHash"}
+
+/*
+* isControlled can come as bool from json or as string from the import file
+* maxDays is optional and must be a positive number
+ */
+func normalizeControlledFields(data map[string]interface{}) error {
+	if val, exists := data["isControlled"]; exists {
+		switch v := val.(type) {
+		case bool:
+		case string:
+			parsed, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return errors.New(INVALID_IS_CONTROLLED)
+			}
+			data["isControlled"] = parsed
+		default:
+			return errors.New(INVALID_IS_CONTROLLED)
+		}
+	}
+	if err := common.TrimIfExists(data, "schedule"); err != nil {
+		return err
+	}
+	if val, exists := data["maxDays"]; exists {
+		maxDays, err := strconv.Atoi(strings.TrimSpace(getString(val)))
+		if err != nil || maxDays <= 0 {
+			return errors.New(INVALID_MAX_DAYS)
+		}
+		data["maxDays"] = strconv.Itoa(maxDays)
+	}
+	return nil
+}
+
+func IsControlledMedicine(medicine map[string]interface{}) bool {
+	controlled, _ := medicine["isControlled"].(bool)
+	return controlled
+}
+
+/*
+* Every medicine of the prescription is fetched, the schedule unit must match its drugType
+* For every controlled medicine in the prescription
+* The doctor must be marked canPrescribeControlled by the hospital
+* noOfDays must not exceed maxDays of the medicine(default CONTROLLED_DEFAULT_MAX_DAYS)
+* Mark the prescription line as controlled
+ */
+func ValidateControlledMedicines(c *gin.Context, doctor map[string]interface{}, rawMedicines []interface{}) error {
+	collection := db.OpenCollections(util.MedicineCollection)
+	for _, m := range rawMedicines {
+		line, ok := m.(map[string]interface{})
+		if !ok {
+			return errors.New("invalid medicine format")
+		}
+		medicine := make(map[string]interface{})
+		filter := bson.M{
+			"code":       line["medicineId"],
+			"hospitalId": doctor["createdBy"],
+		}
+		err := db.FindOne(c, collection, filter, medicine)
+		if err != nil {
+			log.Println("Error from findOne while fetching medicine: ", err)
+			return err
+		}
+		if err := checkScheduleUnit(line, medicine); err != nil {
+			return err
+		}
+		if !IsControlledMedicine(medicine) {
+			continue
+		}
+		if eligible, _ := doctor["canPrescribeControlled"].(bool); !eligible {
+			log.Println("Doctor is not eligible for controlled medicine: ", doctor["code"])
+			return errors.New(DOCTOR_NOT_ELIGIBLE_FOR_CONTROLLED)
+		}
+		maxDays := CONTROLLED_DEFAULT_MAX_DAYS
+		if val, err := strconv.Atoi(getString(medicine["maxDays"])); err == nil && val > 0 {
+			maxDays = val
+		}
+		_, noOfDays, err := CalculatePrescribedQuantity(line)
+		if err != nil {
+			log.Println("Error from calculatePrescribedQuantity: ", err)
+			return err
+		}
+		if noOfDays > maxDays {
+			return errors.New(CONTROLLED_MEDICINE_EXCEEDS_DAYS + strconv.Itoa(maxDays))
+		}
+		line["isControlled"] = true
+	}
+	return nil
+}
+
+/*
+* For every controlled medicine in the bill which is waiting for the witness
+* Create a controlled dispense entry with the dispensing pharmacist as the first signature
+* Stock is reduced only when the second pharmacist witnesses it
+ */
+func CreateControlledDispenses(c *gin.Context, bill map[string]interface{}, billMedicines []map[string]interface{}) error {
+	prescribedBy := ""
+	prescription := make(map[string]interface{})
+	prescriptionColl := db.OpenCollections(util.PrescriptionCollection)
+	if err := db.FindOne(c, prescriptionColl, bson.M{"code": bill["prescripitonId"]}, prescription); err == nil {
+		prescribedBy = getString(prescription["createdBy"])
+	}
+	collection := db.OpenCollections(ControlledDispenseCollection)
+	for lineIndex, item := range billMedicines {
+		if awaiting, _ := item["awaitingWitness"].(bool); !awaiting {
+			continue
+		}
+		code, err := GenerateCode(ControlledDispenseCollection)
+		if err != nil {
+			log.Println("Error from generateCode: ", err)
+			return err
+		}
+		entry := map[string]interface{}{
+			"code":           code,
+			"billId":         bill["code"],
+			"patientId":      bill["patientId"],
+			"medicalId":      bill["medicalId"],
+			"prescriptionId": bill["prescripitonId"],
+			"prescribedBy":   prescribedBy,
+			"medicineId":     item["medicineId"],
+			"lineIndex":      lineIndex,
+			"quantity":       item["dispensedTablets"],
+			"pendingTablets": item["pendingTablets"],
+			"dispensedBy":    bill["createdBy"],
+			"status":         CONTROLLED_STATUS_AWAITING_WITNESS,
+			"tenantId":       bill["tenantId"],
+			"hospitalId":     bill["hospitalId"],
+			"createdBy":      bill["createdBy"],
+			"updatedBy":      bill["createdBy"],
+			"createdAt":      time.Now(),
+			"updatedAt":      time.Now(),
+		}
+		inserted, err := db.CreateOne(c, collection, entry)
+		if err != nil {
+			log.Println("Error from createOne: ", err)
+			return err
+		}
+		log.Println("Inserted controlled dispense: ", inserted.InsertedID)
+		if err := redis.SetCache(c, ControlledDispenseKey+code, entry); err != nil {
+			log.Println("Error from setCache: ", err)
+		}
+	}
+	return nil
+}
+
+/*
+* Fetch the pharmacist from the context and return the hospitalId
+ */
+func fetchPharmacistHospital(c *gin.Context) (string, error) {
+	pharmacist, err := FetchPharmacistByCode(c, c.GetString("code"))
+	if err != nil {
+		log.Println("Error from fetchPharmacistByCode: ", err)
+		return "", err
+	}
+	hospitalId, ok := pharmacist["createdBy"].(string)
+	if !ok {
+		return "", errors.New(UNABLE_TO_FETCH_HOSPITAL_ID)
+	}
+	return hospitalId, nil
+}
+
+/*
+* List the controlled dispenses of the pharmacist's hospital waiting for a witness
+ */
+func FetchAwaitingControlledDispenses(c *gin.Context) ([]interface{}, error) {
+	hospitalId, err := fetchPharmacistHospital(c)
+	if err != nil {
+		return nil, err
+	}
+	collection := db.OpenCollections(ControlledDispenseCollection)
+	filter := bson.M{
+		"hospitalId": hospitalId,
+		"status":     CONTROLLED_STATUS_AWAITING_WITNESS,
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	docs, err := db.FindAll(c, collection, filter, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	return docs, nil
+}
+
+/*
+* Second sign-off for a controlled dispense
+* Witness must be another pharmacist of the same hospital and give the batchNo
+* The dispense is claimed first(conditioned on AWAITING_WITNESS), so two witnesses cannot reduce the stock twice
+* Reduce the stock and write the register entry, the claim(and the stock) is given back when they fail
+* Mark the bill line as dispensed
+ */
+func WitnessControlledDispense(c *gin.Context, dispenseId string, data map[string]interface{}) (map[string]interface{}, error) {
+	if err := common.GetTrimmedString(data, "batchNo"); err != nil {
+		return nil, errors.New(BATCH_NUMBER_REQUIRED)
+	}
+	witnessId := c.GetString("code")
+	hospitalId, err := fetchPharmacistHospital(c)
+	if err != nil {
+		return nil, err
+	}
+	collection := db.OpenCollections(ControlledDispenseCollection)
+	filter := bson.M{"code": dispenseId, "hospitalId": hospitalId}
+	dispense := make(map[string]interface{})
+	err = db.FindOne(c, collection, filter, dispense)
+	if err != nil {
+		log.Println("Error from findOne while fetching controlled dispense: ", err)
+		return nil, err
+	}
+	if getString(dispense["status"]) != CONTROLLED_STATUS_AWAITING_WITNESS {
+		return nil, errors.New(CONTROLLED_DISPENSE_NOT_AWAITING)
+	}
+	if getString(dispense["dispensedBy"]) == witnessId {
+		return nil, errors.New(WITNESS_MUST_BE_ANOTHER_PHARMACIST)
+	}
+
+	claimFilter := bson.M{"code": dispenseId, "hospitalId": hospitalId, "status": CONTROLLED_STATUS_AWAITING_WITNESS}
+	claim := bson.M{"$set": bson.M{
+		"status":      CONTROLLED_STATUS_WITNESSED,
+		"batchNo":     data["batchNo"],
+		"witnessedBy": witnessId,
+		"witnessedAt": time.Now(),
+		"updatedBy":   witnessId,
+		"updatedAt":   time.Now(),
+	}}
+	claimed, err := db.UpdateOne(c, collection, claimFilter, claim)
+	if err != nil {
+		log.Println("Error from updateOne: ", err)
+		return nil, err
+	}
+	if claimed.MatchedCount == 0 {
+		return nil, errors.New(CONTROLLED_DISPENSE_NOT_AWAITING)
+	}
+	release := func() {
+		undo := bson.M{
+			"$set":   bson.M{"status": CONTROLLED_STATUS_AWAITING_WITNESS, "updatedAt": time.Now()},
+			"$unset": bson.M{"batchNo": "", "witnessedBy": "", "witnessedAt": ""},
+		}
+		if _, err := db.UpdateOne(c, collection, bson.M{"code": dispenseId, "witnessedBy": witnessId}, undo); err != nil {
+			log.Println("Error while releasing the controlled dispense: ", err)
+		}
+	}
+
+	medicineId := getString(dispense["medicineId"])
+	quantity, _ := strconv.Atoi(getString(dispense["quantity"]))
+	available, remaining, err := adjustMedicineStock(c, medicineId, -quantity)
+	if err != nil {
+		log.Println("Error from adjustMedicineStock: ", err)
+		release()
+		if strings.HasPrefix(err.Error(), INSUFFICIENT_STOCK) {
+			return nil, errors.New(INSUFFICIENT_STOCK_FOR_CONTROLLED)
+		}
+		return nil, err
+	}
+	entry, err := AppendRegisterEntry(c, map[string]interface{}{
+		"hospitalId":     hospitalId,
+		"tenantId":       dispense["tenantId"],
+		"entryType":      REGISTER_ENTRY_DISPENSE,
+		"medicineId":     medicineId,
+		"batchNo":        data["batchNo"],
+		"quantity":       strconv.Itoa(quantity),
+		"balanceBefore":  strconv.Itoa(available),
+		"balanceAfter":   strconv.Itoa(remaining),
+		"patientId":      dispense["patientId"],
+		"prescriptionId": dispense["prescriptionId"],
+		"prescribedBy":   dispense["prescribedBy"],
+		"dispensedBy":    dispense["dispensedBy"],
+		"witnessedBy":    witnessId,
+		"billId":         dispense["billId"],
+	})
+	if err != nil {
+		log.Println("Error from appendRegisterEntry: ", err)
+		if _, _, err := adjustMedicineStock(c, medicineId, quantity); err != nil {
+			log.Println("Error while giving back the stock of the controlled dispense: ", err)
+		}
+		release()
+		return nil, err
+	}
+	update := bson.M{"$set": bson.M{"registerId": entry["code"]}}
+	if _, err := db.UpdateOne(c, collection, bson.M{"code": dispenseId}, update); err != nil {
+		log.Println("Error from updateOne: ", err)
+		return nil, err
+	}
+	if err := redis.DeleteCache(c, ControlledDispenseKey+dispenseId); err != nil {
+		log.Println("Error from deleteCache: ", err)
+	}
+
+	billId := getString(dispense["billId"])
+	billColl := db.OpenCollections(util.BillCollection)
+	if err := markControlledBillLine(c, billColl, dispense, witnessId, data["batchNo"]); err != nil {
+		log.Println("Error from updateOne on bill: ", err)
+		return nil, err
+	}
+	if err := redis.DeleteCache(c, util.BillKey+billId); err != nil {
+		log.Println("Error from deleteCache: ", err)
+	}
+	return entry, nil
+}
+
+/*
+* The dispense keeps the index of its bill line, so a medicine billed on two lines updates its own line
+* Dispenses saved before the lineIndex update the first line of the medicine still awaiting the witness
+ */
+func markControlledBillLine(c context.Context, billColl *mongo.Collection, dispense map[string]interface{}, witnessId string, batchNo interface{}) error {
+	fields := map[string]interface{}{
+		"awaitingWitness": false,
+		"isDispensed":     getString(dispense["pendingTablets"]) == "0",
+		"witnessedBy":     witnessId,
+		"batchNo":         batchNo,
+	}
+	filter := bson.M{"code": dispense["billId"]}
+	prefix := "medicines.$."
+	if lineIndex, exists := dispense["lineIndex"]; exists && lineIndex != nil {
+		prefix = "medicines." + strconv.Itoa(toInt(lineIndex)) + "."
+	} else {
+		filter["medicines"] = bson.M{"$elemMatch": bson.M{"medicineId": dispense["medicineId"], "awaitingWitness": true}}
+	}
+	set := bson.M{}
+	for field, value := range fields {
+		set[prefix+field] = value
+	}
+	_, err := db.UpdateOne(c, billColl, filter, bson.M{"$set": set})
+	return err
+}
+
+/*
+* Restock of a controlled medicine is written to the register as a receipt
+ */
+func recordControlledReceipt(c *gin.Context, medicine map[string]interface{}, batchNo string, quantity int, balanceBefore int) error {
+	_, err := AppendRegisterEntry(c, map[string]interface{}{
+		"hospitalId":    medicine["hospitalId"],
+		"tenantId":      medicine["tenantId"],
+		"entryType":     REGISTER_ENTRY_RECEIPT,
+		"medicineId":    medicine["code"],
+		"batchNo":       batchNo,
+		"quantity":      strconv.Itoa(quantity),
+		"balanceBefore": strconv.Itoa(balanceBefore),
+		"balanceAfter":  strconv.Itoa(balanceBefore + quantity),
+		"dispensedBy":   "",
+		"witnessedBy":   "",
+		"receivedBy":    c.GetString("code"),
+	})
+	return err
+}
+
+var registerIndexOnce sync.Once
+
+/*
+* serialNo is unique in the chain of the hospital, two entries appended together cannot take the same serialNo
+ */
+func ensureRegisterIndex(c context.Context, collection *mongo.Collection) {
+	registerIndexOnce.Do(func() {
+		index := mongo.IndexModel{
+			Keys:    bson.D{{Key: "hospitalId", Value: 1}, {Key: "serialNo", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("hospitalId_serialNo_unique"),
+		}
+		if _, err := collection.Indexes().CreateOne(c, index); err != nil {
+			log.Println("Error while creating the register index: ", err)
+		}
+	})
+}
+
+/*
+* Fetch the last entry of the hospital to get the next serialNo and the previousHash
+* Hash the entry together with the previousHash, so any later change breaks the chain
+* Save to db, when another entry took the serialNo meanwhile(unique index) read the last entry again
+ */
+func AppendRegisterEntry(c *gin.Context, entry map[string]interface{}) (map[string]interface{}, error) {
+	collection := db.OpenCollections(ControlledRegisterCollection)
+	ensureRegisterIndex(context.Background(), collection)
+	code, err := GenerateCode(ControlledRegisterCollection)
+	if err != nil {
+		log.Println("Error from generateCode: ", err)
+		return nil, err
+	}
+	opts := options.FindOne().SetSort(bson.D{{Key: "serialNo", Value: -1}})
+	for attempt := 0; attempt < REGISTER_APPEND_ATTEMPTS; attempt++ {
+		last := bson.M{}
+		serialNo := 1
+		previousHash := ""
+		err := collection.FindOne(context.Background(), bson.M{"hospitalId": entry["hospitalId"]}, opts).Decode(&last)
+		if err == nil {
+			lastSerial, _ := strconv.Atoi(getString(last["serialNo"]))
+			serialNo = lastSerial + 1
+			previousHash = getString(last["hash"])
+		} else if !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Println("Error while fetching last register entry: ", err)
+			return nil, err
+		}
+		entry["code"] = code
+		entry["serialNo"] = serialNo
+		entry["previousHash"] = previousHash
+		entry["recordedAt"] = time.Now().UTC().Format(time.RFC3339Nano)
+		entry["hash"] = hashRegisterEntry(entry)
+		entry["createdBy"] = c.GetString("code")
+		entry["createdAt"] = time.Now()
+		delete(entry, "_id")
+		_, err = db.CreateOne(c, collection, entry)
+		if err == nil {
+			return entry, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			log.Println("Error from createOne: ", err)
+			return nil, err
+		}
+		log.Println("Register serialNo taken, retrying: ", serialNo)
+	}
+	return nil, errors.New(REGISTER_APPEND_CONFLICT)
+}
+
+func hashRegisterEntry(entry map[string]interface{}) string {
+	parts := make([]string, 0, len(registerHashFields))
+	for _, field := range registerHashFields {
+		parts = append(parts, field+"="+getString(entry[field]))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "|")))
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+* Walk through the chain in serial order
+* Every entry must follow the previous serialNo, carry the previous hash and match its own hash
+* Return the serialNo where the chain is broken, 0 if it is intact
+ */
+func VerifyRegisterChain(entries []interface{}) int {
+	previousHash := ""
+	expectedSerial := 1
+	for _, e := range entries {
+		entry, ok := e.(map[string]interface{})
+		if !ok {
+			return expectedSerial
+		}
+		serialNo, _ := strconv.Atoi(getString(entry["serialNo"]))
+		if serialNo != expectedSerial || getString(entry["previousHash"]) != previousHash || hashRegisterEntry(entry) != getString(entry["hash"]) {
+			return expectedSerial
+		}
+		previousHash = getString(entry["hash"])
+		expectedSerial++
+	}
+	return 0
+}
+
+/*
+* Resolve the hospital for the user
+* Hospital admin and pharmacist see their own hospital, tenant and superAdmin pass the hospitalId
+* Verify the whole chain of the hospital and return the entries(optionally of one medicine)
+ */
+func FetchControlledRegister(c *gin.Context, hospitalId string, medicineId string) (map[string]interface{}, error) {
+	code := c.GetString("code")
+	ctxCollection := c.GetString("collection")
+	isSuperAdmin := c.GetBool("isSuperAdmin")
+
+	switch {
+	case ctxCollection == util.HospitalCollection:
+		hospitalId = code
+	case ctxCollection == util.PharmacistCollection:
+		id, err := fetchPharmacistHospital(c)
+		if err != nil {
+			return nil, err
+		}
+		hospitalId = id
+	case isSuperAdmin || ctxCollection == util.TenantCollection:
+		if hospitalId == "" {
+			return nil, errors.New(HOSPITAL_ID_REQUIRED_FOR_REGISTER)
+		}
+	default:
+		log.Println("This user doesnot have access")
+		return nil, errors.New(util.INVALID_USER_TO_ACCESS)
+	}
+	collection := db.OpenCollections(ControlledRegisterCollection)
+	filter := bson.M{"hospitalId": hospitalId}
+	if ctxCollection == util.TenantCollection && !isSuperAdmin {
+		filter["tenantId"] = code
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "serialNo", Value: 1}})
+	docs, err := db.FindAll(c, collection, filter, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	brokenAt := VerifyRegisterChain(docs)
+	entries := docs
+	if medicineId != "" {
+		entries = []interface{}{}
+		for _, d := range docs {
+			if entry, ok := d.(map[string]interface{}); ok && getString(entry["medicineId"]) == medicineId {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return map[string]interface{}{
+		"hospitalId":     hospitalId,
+		"generatedAt":    time.Now(),
+		"totalEntries":   len(docs),
+		"isTampered":     brokenAt != 0,
+		"brokenAtSerial": brokenAt,
+		"entries":        entries,
+	}, nil
+}
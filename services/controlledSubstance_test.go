@@ -0,0 +1,61 @@
+package services
+
+import (
+	"strconv"
+	"testing"
+)
+
+func sampleRegisterChain(n int) []interface{} {
+	entries := make([]interface{}, 0, n)
+	previousHash := ""
+	for serialNo := 1; serialNo <= n; serialNo++ {
+		entry := map[string]interface{}{
+			"serialNo":      serialNo,
+			"hospitalId":    "H1",
+			"entryType":     REGISTER_ENTRY_DISPENSE,
+			"medicineId":    "M1",
+			"quantity":      "10",
+			"balanceBefore": strconv.Itoa(100 - (serialNo-1)*10),
+			"balanceAfter":  strconv.Itoa(100 - serialNo*10),
+			"previousHash":  previousHash,
+		}
+		entry["hash"] = hashRegisterEntry(entry)
+		previousHash = entry["hash"].(string)
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestVerifyRegisterChain(t *testing.T) {
+	cases := []struct {
+		name   string
+		change func(entries []interface{}) []interface{}
+		broken int
+	}{
+		{"intact", func(entries []interface{}) []interface{} { return entries }, 0},
+		{"empty", func(entries []interface{}) []interface{} { return nil }, 0},
+		{"quantity changed", func(entries []interface{}) []interface{} {
+			entries[1].(map[string]interface{})["quantity"] = "1"
+			return entries
+		}, 2},
+		{"entry removed", func(entries []interface{}) []interface{} {
+			return append(entries[:1], entries[2:]...)
+		}, 2},
+		{"duplicate serialNo", func(entries []interface{}) []interface{} {
+			return append(entries[:2], entries[1:]...)
+		}, 3},
+		{"rehashed without previousHash", func(entries []interface{}) []interface{} {
+			entry := entries[2].(map[string]interface{})
+			entry["previousHash"] = ""
+			entry["hash"] = hashRegisterEntry(entry)
+			return entries
+		}, 3},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := VerifyRegisterChain(tc.change(sampleRegisterChain(4))); got != tc.broken {
+				t.Errorf("broken at %d, want %d", got, tc.broken)
+			}
+		})
+	}
+}
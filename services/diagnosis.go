@@ -0,0 +1,717 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	common "github.com/KanapuramVaishnavi/Core/coreServices"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var icd10ImportColumns = []string{"code", "description", "chapter"}
+
+var icd10RequiredColumns = []string{"code", "description"}
+
+/*
+* Category(A00) with an optional subcategory(A00.1, S52.521A)
+ */
+var icd10CodeRegex = regexp.MustCompile(`^[A-Z][0-9][0-9A-Z](\.[0-9A-Z]{1,4})?$`)
+
+/*
+* Upper case the code and add the dot after the category when it is missing(E119 -> E11.9)
+ */
+func normalizeICD10Code(raw string) (string, error) {
+	code := strings.ToUpper(strings.TrimSpace(raw))
+	if len(code) > 3 && !strings.Contains(code, ".") {
+		code = code[:3] + "." + code[3:]
+	}
+	if !icd10CodeRegex.MatchString(code) {
+		return "", errors.New(INVALID_ICD10_CODE + raw)
+	}
+	return code, nil
+}
+
+/*
+* Map the header row to the ICD-10 columns
+* code and description are required
+ */
+func mapICD10Header(header []string) (map[int]string, error) {
+	columns := make(map[int]string)
+	present := make(map[string]bool)
+	for i, h := range header {
+		for _, col := range icd10ImportColumns {
+			if strings.EqualFold(strings.TrimSpace(h), col) {
+				columns[i] = col
+				present[col] = true
+			}
+		}
+	}
+	for _, col := range icd10RequiredColumns {
+		if !present[col] {
+			return nil, errors.New(IMPORT_FILE_MISSING_HEADER + col)
+		}
+	}
+	return columns, nil
+}
+
+/*
+* Validate the rows and upsert every code, the code itself is the key
+* Rows with errors are collected with their row number, remaining rows are saved
+ */
+func saveICD10Rows(c context.Context, rows [][]string) (map[string]interface{}, error) {
+	if len(rows) < 2 {
+		return nil, errors.New(IMPORT_FILE_IS_EMPTY)
+	}
+	columns, err := mapICD10Header(rows[0])
+	if err != nil {
+		log.Println("Error from mapICD10Header: ", err)
+		return nil, err
+	}
+	collection := db.OpenCollections(ICD10Collection)
+	opts := options.Update().SetUpsert(true)
+	seen := make(map[string]int)
+	failed := []interface{}{}
+	inserted := 0
+	updated := 0
+	for i, row := range rows[1:] {
+		rowNo := i + 2
+		if rowIsEmpty(row) {
+			continue
+		}
+		data := make(map[string]string)
+		for idx, col := range columns {
+			if idx < len(row) {
+				data[col] = strings.TrimSpace(row[idx])
+			}
+		}
+		code, err := normalizeICD10Code(data["code"])
+		if err != nil {
+			failed = append(failed, map[string]interface{}{"row": rowNo, "error": err.Error()})
+			continue
+		}
+		if data["description"] == "" {
+			failed = append(failed, map[string]interface{}{"row": rowNo, "error": IMPORT_FILE_MISSING_HEADER + "description"})
+			continue
+		}
+		if firstRow, ok := seen[code]; ok {
+			failed = append(failed, map[string]interface{}{"row": rowNo, "error": fmt.Sprintf("%s(row %d)", DUPLICATE_ICD10_IN_IMPORT_FILE, firstRow)})
+			continue
+		}
+		seen[code] = rowNo
+		set := bson.M{
+			"description": data["description"],
+			"updatedAt":   time.Now(),
+		}
+		if data["chapter"] != "" {
+			set["chapter"] = data["chapter"]
+		}
+		res, err := db.UpdateMany(c, collection, bson.M{"code": code}, bson.M{"$set": set}, opts)
+		if err != nil {
+			failed = append(failed, map[string]interface{}{"row": rowNo, "error": err.Error()})
+			continue
+		}
+		if res.UpsertedCount > 0 {
+			inserted++
+		} else {
+			updated++
+		}
+	}
+	return map[string]interface{}{
+		"totalRows": inserted + updated + len(failed),
+		"inserted":  inserted,
+		"updated":   updated,
+		"failed":    failed,
+	}, nil
+}
+
+/*
+* Load the ICD-10 code set from the uploaded csv/xlsx(code, description, chapter)
+* The code set is shared by all the tenants, only the super admin can load it
+ */
+func ImportICD10Codes(c *gin.Context, fileName string, content []byte) (map[string]interface{}, error) {
+	if !c.GetBool("isSuperAdmin") {
+		return nil, errors.New(util.INVALID_USER_TO_ACCESS)
+	}
+	rows, err := ReadImportSheet(fileName, content)
+	if err != nil {
+		log.Println("Error from readImportSheet: ", err)
+		return nil, err
+	}
+	result, err := saveICD10Rows(c, rows)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("ICD-10 import by %s: inserted %v updated %v failed %d", c.GetString("code"), result["inserted"], result["updated"], len(result["failed"].([]interface{})))
+	return result, nil
+}
+
+/*
+* Seed the ICD-10 code set from a local file at startup
+* Skipped when the collection already has codes
+ */
+func LoadICD10File(path string) error {
+	c := context.Background()
+	collection := db.OpenCollections(ICD10Collection)
+	existing := make(map[string]interface{})
+	if err := db.FindOne(c, collection, bson.M{}, existing); err == nil {
+		return nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		log.Println("Error while reading the ICD-10 file: ", err)
+		return err
+	}
+	rows, err := ReadImportSheet(path, content)
+	if err != nil {
+		log.Println("Error from readImportSheet: ", err)
+		return err
+	}
+	result, err := saveICD10Rows(c, rows)
+	if err != nil {
+		return err
+	}
+	log.Printf("ICD-10 codes loaded from %s: inserted %v failed %d", path, result["inserted"], len(result["failed"].([]interface{})))
+	return nil
+}
+
+/*
+* Search the code set by the code prefix(E11) or a word of the description(diabetes)
+ */
+func SearchICD10(c *gin.Context, query string, limit string) ([]interface{}, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, errors.New(ICD10_SEARCH_QUERY_REQUIRED)
+	}
+	size := ICD10_SEARCH_DEFAULT_LIMIT
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err == nil && n > 0 {
+			size = min(n, ICD10_SEARCH_MAX_LIMIT)
+		}
+	}
+	pattern := regexp.QuoteMeta(query)
+	filter := bson.M{"$or": []bson.M{
+		{"code": bson.M{"$regex": "^" + regexp.QuoteMeta(strings.ToUpper(query))}},
+		{"description": bson.M{"$regex": pattern, "$options": "i"}},
+	}}
+	opts := options.Find().SetSort(bson.D{{Key: "code", Value: 1}}).SetLimit(int64(size))
+	collection := db.OpenCollections(ICD10Collection)
+	codes, err := db.FindAll(c, collection, filter, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	return codes, nil
+}
+
+func fetchICD10Code(c *gin.Context, code string) (map[string]interface{}, error) {
+	icd := make(map[string]interface{})
+	collection := db.OpenCollections(ICD10Collection)
+	if err := db.FindOne(c, collection, bson.M{"code": code}, icd); err != nil {
+		log.Println("Error from findOne(icd10): ", err)
+		return nil, errors.New(ICD10_CODE_NOT_FOUND + code)
+	}
+	return icd, nil
+}
+
+/*
+* Validate the coded diagnoses {icdCode, type, status, chronic, note}
+* Every code must be in the code set, a code can be given only once
+* type defaults to PRIMARY for a single diagnosis, exactly one diagnosis must be PRIMARY
+* status defaults to PROVISIONAL
+ */
+func normalizeDiagnoses(c *gin.Context, raw interface{}) ([]interface{}, error) {
+	list, ok := raw.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, errors.New(DIAGNOSES_MUST_BE_ARRAY)
+	}
+	diagnoses := []interface{}{}
+	seen := map[string]bool{}
+	primaries := 0
+	for _, item := range list {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, errors.New(DIAGNOSES_MUST_BE_ARRAY)
+		}
+		code, err := normalizeICD10Code(getString(entry["icdCode"]))
+		if err != nil {
+			return nil, err
+		}
+		if seen[code] {
+			return nil, errors.New(DUPLICATE_DIAGNOSIS_CODE + code)
+		}
+		seen[code] = true
+		icd, err := fetchICD10Code(c, code)
+		if err != nil {
+			return nil, err
+		}
+		diagnosisType := strings.ToUpper(strings.TrimSpace(getString(entry["type"])))
+		if diagnosisType == "" && len(list) == 1 {
+			diagnosisType = DIAGNOSIS_TYPE_PRIMARY
+		}
+		if diagnosisType != DIAGNOSIS_TYPE_PRIMARY && diagnosisType != DIAGNOSIS_TYPE_SECONDARY {
+			return nil, errors.New(INVALID_DIAGNOSIS_TYPE)
+		}
+		if diagnosisType == DIAGNOSIS_TYPE_PRIMARY {
+			primaries++
+		}
+		status := strings.ToUpper(strings.TrimSpace(getString(entry["status"])))
+		if status == "" {
+			status = DIAGNOSIS_STATUS_PROVISIONAL
+		}
+		if status != DIAGNOSIS_STATUS_PROVISIONAL && status != DIAGNOSIS_STATUS_FINAL {
+			return nil, errors.New(INVALID_DIAGNOSIS_STATUS)
+		}
+		chronic := false
+		if value, exists := entry["chronic"]; exists {
+			flag, ok := value.(bool)
+			if !ok {
+				return nil, errors.New(INVALID_CHRONIC_FLAG)
+			}
+			chronic = flag
+		}
+		diagnosis := map[string]interface{}{
+			"icdCode":     code,
+			"description": icd["description"],
+			"type":        diagnosisType,
+			"status":      status,
+			"chronic":     chronic,
+		}
+		if note := strings.TrimSpace(getString(entry["note"])); note != "" {
+			diagnosis["note"] = note
+		}
+		diagnoses = append(diagnoses, diagnosis)
+	}
+	if primaries != 1 {
+		return nil, errors.New(ONE_PRIMARY_DIAGNOSIS_REQUIRED)
+	}
+	return diagnoses, nil
+}
+
+/*
+* diagnoses(coded) and/or the free-text diagnosis
+* When only the coded diagnoses are given, the text is taken from the primary diagnosis
+ */
+func prepareDiagnosisFields(c *gin.Context, data map[string]interface{}) error {
+	if raw, exists := data["diagnoses"]; exists {
+		diagnoses, err := normalizeDiagnoses(c, raw)
+		if err != nil {
+			log.Println("Error from normalizeDiagnoses: ", err)
+			return err
+		}
+		data["diagnoses"] = diagnoses
+		if strings.TrimSpace(getString(data["diagnosis"])) == "" {
+			for _, d := range diagnoses {
+				diagnosis := d.(map[string]interface{})
+				if diagnosis["type"] == DIAGNOSIS_TYPE_PRIMARY {
+					data["diagnosis"] = fmt.Sprintf("%s %s", diagnosis["icdCode"], getString(diagnosis["description"]))
+				}
+			}
+		}
+	}
+	return common.GetTrimmedString(data, "diagnosis")
+}
+
+/*
+* Keep one row per coded diagnosis of the latest version of the prescription
+* Rows of the earlier versions are replaced, so the reports count a visit only once
+* FINAL chronic diagnoses are added to(or reactivated in) the problem list of the patient
+ */
+func recordDiagnoses(c *gin.Context, prescription map[string]interface{}) error {
+	rootId := rootPrescriptionIdOf(prescription)
+	collection := db.OpenCollections(DiagnosisCollection)
+	if _, err := db.DeleteMany(c, collection, bson.M{"rootPrescriptionId": rootId}); err != nil {
+		log.Println("Error from deleteMany: ", err)
+		return err
+	}
+	diagnoses, err := normalizeMongoArray(prescription["diagnoses"])
+	if err != nil {
+		return nil
+	}
+	diagnosedAt := time.Now()
+	if issuedAt, ok := toTime(prescription["issuedAt"]); ok {
+		diagnosedAt = issuedAt
+	}
+	for _, d := range diagnoses {
+		diagnosis, ok := d.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		code, err := GenerateCode(DiagnosisCollection)
+		if err != nil {
+			log.Println("Error from generateCode: ", err)
+			return err
+		}
+		row := map[string]interface{}{
+			"code":               code,
+			"rootPrescriptionId": rootId,
+			"prescriptionId":     prescription["code"],
+			"medicalRecordId":    prescription["medicalRecordId"],
+			"patientId":          prescription["patientId"],
+			"doctorId":           prescription["createdBy"],
+			"hospitalId":         prescription["hospitalId"],
+			"tenantId":           prescription["tenantId"],
+			"diagnosedAt":        diagnosedAt,
+		}
+		for key, value := range diagnosis {
+			row[key] = value
+		}
+		if _, err := db.CreateOne(c, collection, row); err != nil {
+			log.Println("Error from createOne: ", err)
+			return err
+		}
+		if diagnosis["status"] == DIAGNOSIS_STATUS_FINAL && diagnosis["chronic"] == true {
+			if err := carryChronicProblem(c, prescription, diagnosis); err != nil {
+				log.Println("Error from carryChronicProblem: ", err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func carryChronicProblem(c *gin.Context, prescription map[string]interface{}, diagnosis map[string]interface{}) error {
+	patientId := getString(prescription["patientId"])
+	collection := db.OpenCollections(ProblemCollection)
+	existing := make(map[string]interface{})
+	err := db.FindOne(c, collection, bson.M{"patientId": patientId, "icdCode": diagnosis["icdCode"]}, existing)
+	if err == nil {
+		if existing["status"] == PROBLEM_STATUS_ACTIVE && existing["chronic"] == true {
+			return nil
+		}
+		update := bson.M{
+			"$set": bson.M{
+				"status":               PROBLEM_STATUS_ACTIVE,
+				"chronic":              true,
+				"sourcePrescriptionId": prescription["code"],
+				"updatedBy":            prescription["createdBy"],
+				"updatedAt":            time.Now(),
+			},
+			"$unset": bson.M{"resolvedAt": ""},
+		}
+		_, err = db.UpdateOne(c, collection, bson.M{"code": existing["code"]}, update)
+		return err
+	}
+	code, err := GenerateCode(ProblemCollection)
+	if err != nil {
+		log.Println("Error from generateCode: ", err)
+		return err
+	}
+	problem := map[string]interface{}{
+		"code":                 code,
+		"patientId":            patientId,
+		"icdCode":              diagnosis["icdCode"],
+		"description":          diagnosis["description"],
+		"chronic":              true,
+		"status":               PROBLEM_STATUS_ACTIVE,
+		"sourcePrescriptionId": prescription["code"],
+		"hospitalId":           prescription["hospitalId"],
+		"tenantId":             prescription["tenantId"],
+		"createdBy":            prescription["createdBy"],
+		"createdAt":            time.Now(),
+		"updatedBy":            prescription["createdBy"],
+		"updatedAt":            time.Now(),
+	}
+	_, err = db.CreateOne(c, collection, problem)
+	return err
+}
+
+/*
+* Only a doctor of the hospital of the patient can change the problem list
+ */
+func verifyProblemListAccess(c *gin.Context, patient map[string]interface{}) error {
+	if c.GetString("collection") != util.DoctorCollection {
+		return errors.New(ONLY_DOCTOR_CAN_UPDATE_PROBLEMS)
+	}
+	hospitalId, err := fetchStaffHospital(c)
+	if err != nil {
+		return err
+	}
+	if hospitalId != getString(patient["hospitalId"]) {
+		return errors.New(util.DOCTOR_DOESNOT_HAVE_ACCESS_TO_UPDATE)
+	}
+	return nil
+}
+
+func normalizeProblemStatus(data map[string]interface{}) (string, error) {
+	status := strings.ToUpper(strings.TrimSpace(getString(data["status"])))
+	if !slices.Contains([]string{PROBLEM_STATUS_ACTIVE, PROBLEM_STATUS_INACTIVE, PROBLEM_STATUS_RESOLVED}, status) {
+		return "", errors.New(INVALID_PROBLEM_STATUS)
+	}
+	return status, nil
+}
+
+func parseOnsetDate(raw interface{}) (time.Time, error) {
+	onset, err := time.Parse(QUERY_DATE_FORMAT, strings.TrimSpace(getString(raw)))
+	if err != nil || onset.After(time.Now()) {
+		return time.Time{}, errors.New(INVALID_ONSET_DATE)
+	}
+	return onset, nil
+}
+
+/*
+* Add a problem{icdCode, chronic, onsetDate, notes} to the list of the patient
+* A code can be on the list only once, reactivate the existing entry instead
+ */
+func CreateProblem(c *gin.Context, patientId string, data map[string]interface{}) (string, error) {
+	patient, err := FetchPatientByCode(c, patientId)
+	if err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return "", err
+	}
+	if err := verifyProblemListAccess(c, patient); err != nil {
+		return "", err
+	}
+	icdCode, err := normalizeICD10Code(getString(data["icdCode"]))
+	if err != nil {
+		return "", err
+	}
+	icd, err := fetchICD10Code(c, icdCode)
+	if err != nil {
+		return "", err
+	}
+	collection := db.OpenCollections(ProblemCollection)
+	existing := make(map[string]interface{})
+	if err := db.FindOne(c, collection, bson.M{"patientId": patientId, "icdCode": icdCode}, existing); err == nil {
+		return "", errors.New(PROBLEM_ALREADY_EXISTS + getString(existing["code"]))
+	}
+	chronic, _ := data["chronic"].(bool)
+	if value, exists := data["chronic"]; exists {
+		if _, ok := value.(bool); !ok {
+			return "", errors.New(INVALID_CHRONIC_FLAG)
+		}
+	}
+	code, err := GenerateCode(ProblemCollection)
+	if err != nil {
+		log.Println("Error from generateCode: ", err)
+		return "", err
+	}
+	doctorId := c.GetString("code")
+	problem := map[string]interface{}{
+		"code":        code,
+		"patientId":   patientId,
+		"icdCode":     icdCode,
+		"description": icd["description"],
+		"chronic":     chronic,
+		"status":      PROBLEM_STATUS_ACTIVE,
+		"hospitalId":  patient["hospitalId"],
+		"tenantId":    patient["tenantId"],
+		"createdBy":   doctorId,
+		"createdAt":   time.Now(),
+		"updatedBy":   doctorId,
+		"updatedAt":   time.Now(),
+	}
+	if _, exists := data["onsetDate"]; exists {
+		onset, err := parseOnsetDate(data["onsetDate"])
+		if err != nil {
+			return "", err
+		}
+		problem["onsetDate"] = onset
+	}
+	if notes := strings.TrimSpace(getString(data["notes"])); notes != "" {
+		problem["notes"] = notes
+	}
+	if _, err := db.CreateOne(c, collection, problem); err != nil {
+		log.Println("Error from createOne: ", err)
+		return "", err
+	}
+	return code, nil
+}
+
+/*
+* Update the status(ACTIVE, INACTIVE, RESOLVED), chronic, onsetDate and notes of a problem
+* resolvedAt is set when the problem is resolved and removed when it is active again
+ */
+func UpdateProblem(c *gin.Context, problemId string, data map[string]interface{}) (map[string]interface{}, error) {
+	collection := db.OpenCollections(ProblemCollection)
+	problem := make(map[string]interface{})
+	if err := db.FindOne(c, collection, bson.M{"code": problemId}, problem); err != nil {
+		log.Println("Error from findOne(problem): ", err)
+		return nil, errors.New(PROBLEM_NOT_FOUND + problemId)
+	}
+	patient, err := FetchPatientByCode(c, getString(problem["patientId"]))
+	if err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, err
+	}
+	if err := verifyProblemListAccess(c, patient); err != nil {
+		return nil, err
+	}
+	set := bson.M{"updatedBy": c.GetString("code"), "updatedAt": time.Now()}
+	unset := bson.M{}
+	if _, exists := data["status"]; exists {
+		status, err := normalizeProblemStatus(data)
+		if err != nil {
+			return nil, err
+		}
+		set["status"] = status
+		if status == PROBLEM_STATUS_RESOLVED {
+			set["resolvedAt"] = time.Now()
+		} else {
+			unset["resolvedAt"] = ""
+		}
+	}
+	if value, exists := data["chronic"]; exists {
+		chronic, ok := value.(bool)
+		if !ok {
+			return nil, errors.New(INVALID_CHRONIC_FLAG)
+		}
+		set["chronic"] = chronic
+	}
+	if _, exists := data["onsetDate"]; exists {
+		onset, err := parseOnsetDate(data["onsetDate"])
+		if err != nil {
+			return nil, err
+		}
+		set["onsetDate"] = onset
+	}
+	if notes, exists := data["notes"]; exists {
+		set["notes"] = strings.TrimSpace(getString(notes))
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	if _, err := db.UpdateOne(c, collection, bson.M{"code": problemId}, update); err != nil {
+		log.Println("Error from updateOne: ", err)
+		return nil, err
+	}
+	for key, value := range set {
+		problem[key] = value
+	}
+	for key := range unset {
+		delete(problem, key)
+	}
+	return problem, nil
+}
+
+/*
+* Problem list of the patient, chronic problems first and then the latest updated
+* Optional status filter, all the statuses are returned when it is empty
+ */
+func FetchProblems(c *gin.Context, patientId string, status string) ([]interface{}, error) {
+	if _, err := FetchPatientByCode(c, patientId); err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, err
+	}
+	filter := bson.M{"patientId": patientId}
+	if status != "" {
+		normalized, err := normalizeProblemStatus(map[string]interface{}{"status": status})
+		if err != nil {
+			return nil, err
+		}
+		filter["status"] = normalized
+	}
+	collection := db.OpenCollections(ProblemCollection)
+	opts := options.Find().SetSort(bson.D{{Key: "chronic", Value: -1}, {Key: "updatedAt", Value: -1}})
+	problems, err := db.FindAll(c, collection, filter, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	return problems, nil
+}
+
+/*
+* Count of the coded diagnoses per hospital, per ICD-10 code and per month(YYYY-MM)
+* Optional filters: date range from/to(YYYY-MM-DD), icdCode prefix, type and status
+ */
+func DiagnosisReport(c *gin.Context, query map[string]string) ([]map[string]interface{}, error) {
+	filter, err := labScopeFilter(c)
+	if err != nil {
+		return nil, err
+	}
+	diagnosedAt := bson.M{}
+	if from := query["from"]; from != "" {
+		start, err := time.Parse(QUERY_DATE_FORMAT, from)
+		if err != nil {
+			return nil, errors.New(INVALID_DATE_FILTER + from)
+		}
+		diagnosedAt["$gte"] = start
+	}
+	if to := query["to"]; to != "" {
+		end, err := time.Parse(QUERY_DATE_FORMAT, to)
+		if err != nil {
+			return nil, errors.New(INVALID_DATE_FILTER + to)
+		}
+		diagnosedAt["$lt"] = end.AddDate(0, 0, 1)
+	}
+	if len(diagnosedAt) > 0 {
+		filter["diagnosedAt"] = diagnosedAt
+	}
+	if icdCode := query["icdCode"]; icdCode != "" {
+		filter["icdCode"] = bson.M{"$regex": "^" + regexp.QuoteMeta(strings.ToUpper(strings.TrimSpace(icdCode)))}
+	}
+	if diagnosisType := query["type"]; diagnosisType != "" {
+		filter["type"] = strings.ToUpper(diagnosisType)
+	}
+	if status := query["status"]; status != "" {
+		filter["status"] = strings.ToUpper(status)
+	}
+	collection := db.OpenCollections(DiagnosisCollection)
+	rows, err := db.FindAll(c, collection, filter, nil)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	counts := make(map[string]map[string]interface{})
+	for _, r := range rows {
+		row, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		at, ok := toTime(row["diagnosedAt"])
+		if !ok {
+			continue
+		}
+		month := at.Format("2006-01")
+		key := strings.Join([]string{getString(row["hospitalId"]), getString(row["icdCode"]), month}, "#")
+		entry, exists := counts[key]
+		if !exists {
+			entry = map[string]interface{}{
+				"hospitalId":  row["hospitalId"],
+				"icdCode":     row["icdCode"],
+				"description": row["description"],
+				"month":       month,
+				"count":       0,
+				"patients":    map[string]bool{},
+			}
+			counts[key] = entry
+		}
+		entry["count"] = entry["count"].(int) + 1
+		entry["patients"].(map[string]bool)[getString(row["patientId"])] = true
+	}
+	report := make([]map[string]interface{}, 0, len(counts))
+	for _, entry := range counts {
+		entry["patients"] = len(entry["patients"].(map[string]bool))
+		report = append(report, entry)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		a, b := report[i], report[j]
+		if a["month"] != b["month"] {
+			return getString(a["month"]) < getString(b["month"])
+		}
+		if a["hospitalId"] != b["hospitalId"] {
+			return getString(a["hospitalId"]) < getString(b["hospitalId"])
+		}
+		if a["count"] != b["count"] {
+			return a["count"].(int) > b["count"].(int)
+		}
+		return getString(a["icdCode"]) < getString(b["icdCode"])
+	})
+	return report, nil
+}
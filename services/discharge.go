@@ -0,0 +1,554 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	redis "github.com/KanapuramVaishnavi/Core/config/redis"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var signedDischargeFields = []string{
+	"code", "patientId", "hospitalId", "tenantId", "admissionDate", "dischargeAt", "dischargeType",
+	"referredTo", "causeOfDeath", "finalDiagnoses", "procedures", "conditionAtDischarge",
+	"medications", "followUpAdvice", "followUpDate", "dischargedBy",
+}
+
+/*
+* Canonical serialization of the signed fields of the discharge summary
+ */
+func CanonicalDischarge(discharge map[string]interface{}) ([]byte, error) {
+	payload := make(map[string]interface{})
+	for _, field := range signedDischargeFields {
+		if value, exists := discharge[field]; exists && value != nil {
+			payload[field] = canonicalValue(value)
+		}
+	}
+	return json.Marshal(payload)
+}
+
+func DischargeVerificationURL(discharge map[string]interface{}) string {
+	signature, _ := discharge["signature"].(map[string]interface{})
+	base := publicBaseURL()
+	return fmt.Sprintf("%s/verify/discharge/%s?token=%s", base, url.PathEscape(getString(discharge["code"])), verificationToken(getString(signature["value"])))
+}
+
+/*
+* Procedures done during the admission, either the names or {name, performedOn(YYYY-MM-DD), note}
+ */
+func normalizeProcedures(raw interface{}) ([]interface{}, error) {
+	procedures := []interface{}{}
+	if raw == nil {
+		return procedures, nil
+	}
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, errors.New(PROCEDURES_MUST_BE_ARRAY)
+	}
+	for _, item := range list {
+		switch entry := item.(type) {
+		case string:
+			name := strings.TrimSpace(entry)
+			if name == "" {
+				return nil, errors.New(PROCEDURES_MUST_BE_ARRAY)
+			}
+			procedures = append(procedures, map[string]interface{}{"name": name})
+		case map[string]interface{}:
+			name := strings.TrimSpace(getString(entry["name"]))
+			if name == "" {
+				return nil, errors.New(PROCEDURES_MUST_BE_ARRAY)
+			}
+			procedure := map[string]interface{}{"name": name}
+			if performedOn := strings.TrimSpace(getString(entry["performedOn"])); performedOn != "" {
+				if _, err := time.Parse(QUERY_DATE_FORMAT, performedOn); err != nil {
+					return nil, errors.New(PROCEDURES_MUST_BE_ARRAY)
+				}
+				procedure["performedOn"] = performedOn
+			}
+			if note := strings.TrimSpace(getString(entry["note"])); note != "" {
+				procedure["note"] = note
+			}
+			procedures = append(procedures, procedure)
+		default:
+			return nil, errors.New(PROCEDURES_MUST_BE_ARRAY)
+		}
+	}
+	return procedures, nil
+}
+
+/*
+* dischargeAt(RFC3339) defaults to now, it cannot be before the admission or in the future
+ */
+func parseDischargeAt(raw string, admittedOn time.Time) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Now(), nil
+	}
+	dischargeAt, err := time.Parse(time.RFC3339, raw)
+	if err != nil || dischargeAt.After(time.Now()) || dischargeAt.Before(admittedOn) {
+		return time.Time{}, errors.New(INVALID_DISCHARGE_AT)
+	}
+	return dischargeAt, nil
+}
+
+/*
+* Doctor of the hospital discharges the admitted patient
+* dischargeType : NORMAL, LAMA(left against medical advice), REFERRED(needs referredTo) or DEATH(needs causeOfDeath)
+* finalDiagnoses are the coded diagnoses, all of them are saved as FINAL and recorded like the diagnoses of a prescription,
+* the chronic ones are carried to the problem list of the patient
+* medications are validated like the prescription lines, allergy conflicts need allergyOverrideReason
+* Bed charges up to the discharge are accrued, then the bills of the admission must be paid or approved on credit
+* The patient is claimed before anything is saved, so the same admission cannot be discharged twice
+* The summary is signed by the doctor, the bed is freed and the admissionDate of the patient is cleared
+ */
+func CreateDischarge(c *gin.Context, patientId string, data map[string]interface{}) (map[string]interface{}, error) {
+	if c.GetString("collection") != util.DoctorCollection {
+		return nil, errors.New(ONLY_DOCTOR_CAN_DISCHARGE)
+	}
+	patient, err := FetchPatientByCode(c, patientId)
+	if err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, err
+	}
+	hospitalId, err := fetchStaffHospital(c)
+	if err != nil {
+		log.Println("Error from fetchStaffHospital: ", err)
+		return nil, err
+	}
+	if hospitalId != getString(patient["hospitalId"]) {
+		return nil, errors.New(ONLY_DOCTOR_CAN_DISCHARGE)
+	}
+	if !isAdmitted(patient) {
+		return nil, errors.New(PATIENT_NOT_ADMITTED + patientId)
+	}
+	admissionDate := strings.TrimSpace(getString(patient["admissionDate"]))
+	admittedOn, err := time.Parse(QUERY_DATE_FORMAT, admissionDate)
+	if err != nil {
+		log.Println("Error from parse(admissionDate): ", err)
+		return nil, err
+	}
+
+	dischargeType, err := upperChoice(data, "dischargeType", DischargeTypes, INVALID_DISCHARGE_TYPE)
+	if err != nil {
+		return nil, err
+	}
+	dischargeAt, err := parseDischargeAt(getString(data["dischargeAt"]), admittedOn)
+	if err != nil {
+		return nil, err
+	}
+	finalDiagnoses, err := normalizeDiagnoses(c, data["finalDiagnoses"])
+	if err != nil {
+		log.Println("Error from normalizeDiagnoses: ", err)
+		return nil, err
+	}
+	for _, d := range finalDiagnoses {
+		d.(map[string]interface{})["status"] = DIAGNOSIS_STATUS_FINAL
+	}
+	procedures, err := normalizeProcedures(data["procedures"])
+	if err != nil {
+		return nil, err
+	}
+	conditionAtDischarge := strings.TrimSpace(getString(data["conditionAtDischarge"]))
+	if conditionAtDischarge == "" {
+		return nil, errors.New(CONDITION_AT_DISCHARGE_REQUIRED)
+	}
+
+	discharge := map[string]interface{}{
+		"patientId":            patientId,
+		"hospitalId":           hospitalId,
+		"tenantId":             patient["tenantId"],
+		"admissionDate":        admissionDate,
+		"dischargeAt":          dischargeAt,
+		"dischargeType":        dischargeType,
+		"finalDiagnoses":       finalDiagnoses,
+		"procedures":           procedures,
+		"conditionAtDischarge": conditionAtDischarge,
+		"medications":          []interface{}{},
+		"dischargedBy":         c.GetString("code"),
+	}
+	switch dischargeType {
+	case DISCHARGE_TYPE_REFERRED:
+		referredTo := strings.TrimSpace(getString(data["referredTo"]))
+		if referredTo == "" {
+			return nil, errors.New(REFERRED_TO_REQUIRED)
+		}
+		discharge["referredTo"] = referredTo
+	case DISCHARGE_TYPE_DEATH:
+		causeOfDeath := strings.TrimSpace(getString(data["causeOfDeath"]))
+		if causeOfDeath == "" {
+			return nil, errors.New(CAUSE_OF_DEATH_REQUIRED)
+		}
+		discharge["causeOfDeath"] = causeOfDeath
+	}
+
+	if dischargeType != DISCHARGE_TYPE_DEATH {
+		if raw, exists := data["medications"]; exists && raw != nil {
+			medications, ok := raw.([]interface{})
+			if !ok {
+				return nil, errors.New(DISCHARGE_MEDICATIONS_MUST_BE_ARRAY)
+			}
+			if err := ValidateMedicines(medications); err != nil {
+				log.Println("Error from validateMedicines: ", err)
+				return nil, err
+			}
+			allergyOverride, err := checkPrescriptionAllergies(c, patientId, medications, getString(data["allergyOverrideReason"]), nil)
+			if err != nil {
+				log.Println("Error from checkPrescriptionAllergies: ", err)
+				return nil, err
+			}
+			if allergyOverride != nil {
+				discharge["allergyOverride"] = allergyOverride
+			}
+			discharge["medications"] = medications
+		}
+		if advice := strings.TrimSpace(getString(data["followUpAdvice"])); advice != "" {
+			discharge["followUpAdvice"] = advice
+		}
+		if followUp := strings.TrimSpace(getString(data["followUpDate"])); followUp != "" {
+			followUpDate, err := time.Parse(QUERY_DATE_FORMAT, followUp)
+			if err != nil || !followUpDate.After(dischargeAt) {
+				return nil, errors.New(INVALID_FOLLOW_UP_DATE)
+			}
+			discharge["followUpDate"] = followUp
+		}
+	}
+
+	claimedAt, err := claimDischarge(c, patientId, admissionDate)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveDischarge(c, patient, discharge, admittedOn, claimedAt); err != nil {
+		releaseDischargeClaim(c, patientId, claimedAt)
+		return nil, err
+	}
+	if err := redis.DeleteCache(c, util.PatientKey+patientId); err != nil {
+		log.Println("Failed deleting old patient cache: ", err)
+	}
+	return discharge, nil
+}
+
+/*
+* Mark the admitted patient as being discharged, so a second discharge of the same admission is refused
+* A claim older than DISCHARGE_CLAIM_MINUTES(the request did not finish) can be taken again
+ */
+func claimDischarge(c *gin.Context, patientId string, admissionDate string) (time.Time, error) {
+	// mongo keeps milliseconds, the claim time is matched again when the discharge is completed
+	now := time.Now().Truncate(time.Millisecond)
+	filter := bson.M{
+		"code":          patientId,
+		"admissionDate": admissionDate,
+		"$or": bson.A{
+			bson.M{"dischargingAt": bson.M{"$exists": false}},
+			bson.M{"dischargingAt": bson.M{"$lt": now.Add(-time.Duration(DISCHARGE_CLAIM_MINUTES) * time.Minute)}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"dischargingAt": now, "dischargingBy": c.GetString("code")}}
+	result, err := db.UpdateOne(c, db.OpenCollections(util.PatientCollection), filter, update)
+	if err != nil {
+		log.Println("Error from updateOne(patient): ", err)
+		return time.Time{}, err
+	}
+	if result.MatchedCount == 0 {
+		return time.Time{}, errors.New(DISCHARGE_IN_PROGRESS + patientId)
+	}
+	return now, nil
+}
+
+/*
+* Remove the claim of claimDischarge when the discharge failed
+ */
+func releaseDischargeClaim(c *gin.Context, patientId string, claimedAt time.Time) {
+	update := bson.M{"$unset": bson.M{"dischargingAt": "", "dischargingBy": ""}}
+	_, err := db.UpdateOne(c, db.OpenCollections(util.PatientCollection), bson.M{"code": patientId, "dischargingAt": claimedAt}, update)
+	if err != nil {
+		log.Println("Error from updateOne(release discharge claim): ", err)
+	}
+}
+
+/*
+* Bed charges and bills are settled, the signed summary is saved, the bed is released and the patient is discharged
+* The summary and its diagnoses are removed again when a later step fails, so no summary is left without a discharge
+ */
+func saveDischarge(c *gin.Context, patient map[string]interface{}, discharge map[string]interface{}, admittedOn time.Time, claimedAt time.Time) error {
+	patientId := getString(patient["code"])
+	dischargeAt := discharge["dischargeAt"].(time.Time)
+	if err := accrueDischargeBedCharges(c, patient, dischargeAt); err != nil {
+		log.Println("Error from accrueDischargeBedCharges: ", err)
+		return err
+	}
+	if err := verifyAdmissionBillsSettled(c, patientId, admittedOn); err != nil {
+		log.Println("Error from verifyAdmissionBillsSettled: ", err)
+		return err
+	}
+
+	doctor, err := FetchDoctorByCode(c, c.GetString("code"))
+	if err != nil {
+		log.Println("Error from fetchDoctorByCode: ", err)
+		return err
+	}
+	code, err := GenerateCode(DischargeCollection)
+	if err != nil {
+		log.Println("Error from generateCode: ", err)
+		return err
+	}
+	discharge["code"] = code
+	payload, err := CanonicalDischarge(discharge)
+	if err != nil {
+		log.Println("Error from canonicalDischarge: ", err)
+		return err
+	}
+	signature, err := signPayload(c, doctor, payload)
+	if err != nil {
+		log.Println("Error from signPayload: ", err)
+		return err
+	}
+	discharge["signature"] = signature
+	discharge["createdAt"] = time.Now()
+
+	collection := db.OpenCollections(DischargeCollection)
+	if _, err := db.CreateOne(c, collection, discharge); err != nil {
+		log.Println("Error from createOne: ", err)
+		return err
+	}
+	err = completeDischarge(c, patient, discharge, claimedAt)
+	if err != nil {
+		if _, err := db.DeleteOne(c, collection, bson.M{"code": code}); err != nil {
+			log.Println("Error from deleteOne(discharge): ", err)
+		}
+		if _, err := db.DeleteMany(c, db.OpenCollections(DiagnosisCollection), bson.M{"rootPrescriptionId": code}); err != nil {
+			log.Println("Error from deleteMany(diagnosis): ", err)
+		}
+	}
+	return err
+}
+
+/*
+* Diagnoses of the discharge, the bed and the patient, the bed is occupied again when the patient cannot be updated
+ */
+func completeDischarge(c *gin.Context, patient map[string]interface{}, discharge map[string]interface{}, claimedAt time.Time) error {
+	patientId := getString(patient["code"])
+	dischargeAt := discharge["dischargeAt"].(time.Time)
+	diagnosed := map[string]interface{}{
+		"code":       discharge["code"],
+		"patientId":  patientId,
+		"createdBy":  discharge["dischargedBy"],
+		"hospitalId": discharge["hospitalId"],
+		"tenantId":   patient["tenantId"],
+		"issuedAt":   dischargeAt,
+		"diagnoses":  discharge["finalDiagnoses"],
+	}
+	if err := recordDiagnoses(c, diagnosed); err != nil {
+		log.Println("Error from recordDiagnoses: ", err)
+		return err
+	}
+	assignment, err := releaseDischargedBed(c, patient, dischargeAt)
+	if err != nil {
+		log.Println("Error from releaseDischargedBed: ", err)
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"lastDischargeId": discharge["code"],
+			"dischargedAt":    dischargeAt,
+			"updatedBy":       c.GetString("code"),
+			"updatedAt":       time.Now(),
+		},
+		"$unset": bson.M{"admissionDate": "", "currentBedId": "", "currentWardId": "", "dischargingAt": "", "dischargingBy": ""},
+	}
+	filter := bson.M{"code": patientId, "dischargingAt": claimedAt}
+	result, err := db.UpdateOne(c, db.OpenCollections(util.PatientCollection), filter, update)
+	if err == nil && result.MatchedCount == 0 {
+		err = errors.New(DISCHARGE_IN_PROGRESS + patientId)
+	}
+	if err != nil {
+		log.Println("Error from updateOne(patient): ", err)
+		if assignment != nil {
+			if err := reopenBedAssignment(c, assignment); err != nil {
+				log.Println("Error from reopenBedAssignment: ", err)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+/*
+* Discharge summary, only the users who can access the patient can read it
+ */
+func FetchDischarge(c *gin.Context, dischargeId string) (map[string]interface{}, error) {
+	discharge := make(map[string]interface{})
+	err := db.FindOne(c, db.OpenCollections(DischargeCollection), bson.M{"code": dischargeId}, discharge)
+	if err != nil {
+		log.Println("Error from findOne: ", err)
+		return nil, errors.New(DISCHARGE_NOT_FOUND + dischargeId)
+	}
+	if _, err := FetchPatientByCode(c, getString(discharge["patientId"])); err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, err
+	}
+	return discharge, nil
+}
+
+/*
+* All the discharges of the patient, latest first
+ */
+func FetchDischarges(c *gin.Context, patientId string) ([]interface{}, error) {
+	if _, err := FetchPatientByCode(c, patientId); err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, err
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "dischargeAt", Value: -1}})
+	discharges, err := db.FindAll(c, db.OpenCollections(DischargeCollection), bson.M{"patientId": patientId}, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	return discharges, nil
+}
+
+/*
+* Public verification of a printed discharge summary(from the QR code)
+* Only the details needed to match the printed copy are returned
+ */
+func VerifyDischarge(c *gin.Context, dischargeId string, token string) (map[string]interface{}, error) {
+	discharge := make(map[string]interface{})
+	err := db.FindOne(c, db.OpenCollections(DischargeCollection), bson.M{"code": dischargeId}, discharge)
+	if err != nil {
+		log.Println("Error from findOne: ", err)
+		return nil, errors.New(INVALID_DISCHARGE_VERIFICATION)
+	}
+	signature, ok := discharge["signature"].(map[string]interface{})
+	if !ok || token != verificationToken(getString(signature["value"])) {
+		return nil, errors.New(INVALID_DISCHARGE_VERIFICATION)
+	}
+
+	result := map[string]interface{}{
+		"dischargeId":   discharge["code"],
+		"admissionDate": discharge["admissionDate"],
+		"dischargeAt":   discharge["dischargeAt"],
+		"dischargeType": discharge["dischargeType"],
+		"keyId":         signature["keyId"],
+		"signedAt":      signature["signedAt"],
+		"payloadHash":   signature["payloadHash"],
+		"isValid":       false,
+	}
+	payload, err := CanonicalDischarge(discharge)
+	if err != nil {
+		log.Println("Error from canonicalDischarge: ", err)
+		return nil, err
+	}
+	signingKey, reason := checkSignature(c, signature, payload)
+	if reason != "" {
+		result["reason"] = reason
+		return result, nil
+	}
+	if getString(signingKey["doctorId"]) != getString(discharge["dischargedBy"]) {
+		result["reason"] = SIGNING_KEY_NOT_OF_SIGNER
+		return result, nil
+	}
+	result["isValid"] = true
+
+	doctor := make(map[string]interface{})
+	if err := db.FindOne(c, db.OpenCollections(util.DoctorCollection), bson.M{"code": signingKey["doctorId"]}, doctor); err == nil {
+		result["doctorName"] = doctor["name"]
+	}
+	hospital := make(map[string]interface{})
+	if err := db.FindOne(c, db.OpenCollections(util.HospitalCollection), bson.M{"code": discharge["hospitalId"]}, hospital); err == nil {
+		result["hospitalName"] = hospital["name"]
+	}
+	return result, nil
+}
+
+/*
+* Discharge summary PDF from the patient report(report.html) with the discharge section and the signature
+ */
+func GenerateDischargeSummaryPDF(c *gin.Context, dischargeId string) ([]string, error) {
+	discharge, err := FetchDischarge(c, dischargeId)
+	if err != nil {
+		return nil, err
+	}
+	signature, ok := discharge["signature"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New(INVALID_DISCHARGE_VERIFICATION)
+	}
+	patient, err := FetchPatientByCode(c, getString(discharge["patientId"]))
+	if err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, err
+	}
+	data, err := BuildReportData(c, patient)
+	if err != nil {
+		log.Println("Error from buildReportData: ", err)
+		return nil, err
+	}
+	doctor, err := FetchDoctorByCode(c, getString(discharge["dischargedBy"]))
+	if err != nil {
+		log.Println("Error from fetchDoctorByCode: ", err)
+		return nil, err
+	}
+
+	var medications []map[string]interface{}
+	for _, m := range toList(discharge["medications"]) {
+		line, ok := m.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		medicine, err := FetchMedicineByCode(c, getString(line["medicineId"]))
+		if err != nil {
+			log.Println("Error from fetchMedicineByCode: ", err)
+			return nil, err
+		}
+		medications = append(medications, map[string]interface{}{
+			"MedicineName": medicine["name"],
+			"Dosage":       describeDosage(line),
+			"Instructions": line["instructions"],
+		})
+	}
+	dischargeAt, _ := FormatedDateAndTime(discharge["dischargeAt"])
+	verificationURL := DischargeVerificationURL(discharge)
+	qr, err := GenerateLocalQRCode(verificationURL)
+	if err != nil {
+		log.Println("Error from generateLocalQRCode: ", err)
+		return nil, err
+	}
+
+	data["AdmissionDate"] = discharge["admissionDate"]
+	data["Discharge"] = map[string]interface{}{
+		"DischargeID":          discharge["code"],
+		"DischargeAt":          dischargeAt,
+		"DischargeType":        discharge["dischargeType"],
+		"ReferredTo":           discharge["referredTo"],
+		"CauseOfDeath":         discharge["causeOfDeath"],
+		"FinalDiagnoses":       toList(discharge["finalDiagnoses"]),
+		"Procedures":           toList(discharge["procedures"]),
+		"ConditionAtDischarge": discharge["conditionAtDischarge"],
+		"Medications":          medications,
+		"FollowUpAdvice":       discharge["followUpAdvice"],
+		"FollowUpDate":         discharge["followUpDate"],
+		"DoctorName":           doctor["name"],
+	}
+	data["KeyID"] = signature["keyId"]
+	data["PayloadHash"] = signature["payloadHash"]
+	data["VerificationQR"] = template.URL(qr)
+	data["VerificationURL"] = verificationURL
+
+	htmlPath := fmt.Sprintf("discharge_%s.html", dischargeId)
+	pdfPath := fmt.Sprintf("%s_discharge_summary.pdf", dischargeId)
+	if err := GenerateReportToPDF(data, htmlPath, pdfPath); err != nil {
+		log.Println("Error from generateReportToPDF: ", err)
+		return nil, err
+	}
+	return []string{pdfPath}, nil
+}
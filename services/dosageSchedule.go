@@ -0,0 +1,233 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+* schedule numbers come as float64 from json, but can also be sent as strings
+ */
+func scheduleNumber(schedule map[string]interface{}, field string) (float64, error) {
+	var value float64
+	switch v := schedule[field].(type) {
+	case float64:
+		value = v
+	case int:
+		value = float64(v)
+	case int32:
+		value = float64(v)
+	case int64:
+		value = float64(v)
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, errors.New(INVALID_SCHEDULE_NUMBER + field)
+		}
+		value = parsed
+	default:
+		return 0, errors.New(INVALID_SCHEDULE_NUMBER + field)
+	}
+	if value <= 0 {
+		return 0, errors.New(INVALID_SCHEDULE_NUMBER + field)
+	}
+	schedule[field] = value
+	return value, nil
+}
+
+func scheduleSteps(schedule map[string]interface{}) []interface{} {
+	switch v := schedule["steps"].(type) {
+	case []interface{}:
+		return v
+	case primitive.A:
+		return []interface{}(v)
+	default:
+		return nil
+	}
+}
+
+/*
+* Validate the schedule of a prescription line and normalize type and unit
+* FIXED_TIMES : dose, timesPerDay, noOfDays              (e.g. 1 tablet twice a day)
+* INTERVAL    : dose, everyHours, noOfDays               (e.g. every 8 hours)
+* WEEKLY      : dose, timesPerWeek(default 1), noOfWeeks (e.g. once weekly)
+* TAPERING    : steps[{dose, timesPerDay, noOfDays}]     (e.g. 3 tablets for 5 days, then 2...)
+* PRN         : dose, maxPerDay, noOfDays                (as needed, dispensed for the maximum)
+* unit defaults to TABLET
+ */
+func ValidateDosageSchedule(schedule map[string]interface{}) error {
+	scheduleType := strings.ToUpper(strings.TrimSpace(getString(schedule["type"])))
+	schedule["type"] = scheduleType
+	unit := strings.ToUpper(strings.TrimSpace(getString(schedule["unit"])))
+	if unit == "" {
+		unit = "TABLET"
+	}
+	if !slices.Contains(DoseUnits, unit) {
+		return errors.New(INVALID_DOSE_UNIT + unit)
+	}
+	schedule["unit"] = unit
+
+	var fields []string
+	switch scheduleType {
+	case SCHEDULE_FIXED_TIMES:
+		fields = []string{"dose", "timesPerDay", "noOfDays"}
+	case SCHEDULE_INTERVAL:
+		fields = []string{"dose", "everyHours", "noOfDays"}
+	case SCHEDULE_WEEKLY:
+		if _, exists := schedule["timesPerWeek"]; !exists {
+			schedule["timesPerWeek"] = float64(1)
+		}
+		fields = []string{"dose", "timesPerWeek", "noOfWeeks"}
+	case SCHEDULE_PRN:
+		fields = []string{"dose", "maxPerDay", "noOfDays"}
+	case SCHEDULE_TAPERING:
+		steps := scheduleSteps(schedule)
+		if len(steps) == 0 {
+			return errors.New(TAPERING_STEPS_REQUIRED)
+		}
+		for _, s := range steps {
+			step, ok := s.(map[string]interface{})
+			if !ok {
+				return errors.New(TAPERING_STEPS_REQUIRED)
+			}
+			for _, field := range []string{"dose", "timesPerDay", "noOfDays"} {
+				if _, err := scheduleNumber(step, field); err != nil {
+					return err
+				}
+			}
+		}
+		schedule["steps"] = steps
+		return nil
+	default:
+		return errors.New(INVALID_SCHEDULE_TYPE)
+	}
+	for _, field := range fields {
+		if _, err := scheduleNumber(schedule, field); err != nil {
+			return err
+		}
+	}
+	if scheduleType == SCHEDULE_INTERVAL {
+		if everyHours := schedule["everyHours"].(float64); everyHours < 1 || everyHours > 24 {
+			return errors.New(INVALID_EVERY_HOURS)
+		}
+	}
+	return nil
+}
+
+/*
+* The unit of a validated schedule must be one the medicine is given in(no ML for a tablet)
+* Lines without a schedule are in tablets and are not checked
+ */
+func checkScheduleUnit(line map[string]interface{}, medicine map[string]interface{}) error {
+	schedule, ok := line["schedule"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	drugType := strings.ToUpper(strings.TrimSpace(getString(medicine["drugType"])))
+	units, known := DrugTypeDoseUnits[drugType]
+	if !known {
+		return nil
+	}
+	unit := getString(schedule["unit"])
+	if !slices.Contains(units, unit) {
+		return errors.New(DOSE_UNIT_NOT_FOR_DRUG_TYPE + unit + "(" + drugType + ")")
+	}
+	return nil
+}
+
+/*
+* Total quantity(in the schedule unit) and the number of days covered by a validated schedule
+ */
+func CalculateScheduleQuantity(schedule map[string]interface{}) (float64, int, error) {
+	if err := ValidateDosageSchedule(schedule); err != nil {
+		return 0, 0, err
+	}
+	number := func(m map[string]interface{}, field string) float64 {
+		value, _ := scheduleNumber(m, field)
+		return value
+	}
+	switch schedule["type"] {
+	case SCHEDULE_FIXED_TIMES:
+		days := number(schedule, "noOfDays")
+		return number(schedule, "dose") * number(schedule, "timesPerDay") * days, int(math.Ceil(days)), nil
+	case SCHEDULE_INTERVAL:
+		days := number(schedule, "noOfDays")
+		doses := math.Ceil(days * 24 / number(schedule, "everyHours"))
+		return number(schedule, "dose") * doses, int(math.Ceil(days)), nil
+	case SCHEDULE_WEEKLY:
+		weeks := number(schedule, "noOfWeeks")
+		return number(schedule, "dose") * number(schedule, "timesPerWeek") * weeks, int(math.Ceil(weeks * 7)), nil
+	case SCHEDULE_PRN:
+		days := number(schedule, "noOfDays")
+		return number(schedule, "dose") * number(schedule, "maxPerDay") * days, int(math.Ceil(days)), nil
+	default:
+		total, days := 0.0, 0.0
+		for _, s := range scheduleSteps(schedule) {
+			step := s.(map[string]interface{})
+			total += number(step, "dose") * number(step, "timesPerDay") * number(step, "noOfDays")
+			days += number(step, "noOfDays")
+		}
+		return total, int(math.Ceil(days)), nil
+	}
+}
+
+/*
+* Quantity to dispense for a prescription line
+* Lines with a schedule use the dosage schedule model
+* Older lines use dosagePerFrequency x times a day(morning/afternoon/night) x noOfDays
+ */
+func CalculatePrescribedQuantity(medicine map[string]interface{}) (int, int, error) {
+	if raw, exists := medicine["schedule"]; exists && raw != nil {
+		schedule, ok := raw.(map[string]interface{})
+		if !ok {
+			return 0, 0, errors.New(SCHEDULE_MUST_BE_AN_OBJECT)
+		}
+		total, days, err := CalculateScheduleQuantity(schedule)
+		if err != nil {
+			return 0, 0, err
+		}
+		return int(math.Ceil(total)), days, nil
+	}
+	dosagePerFrequencyVal, ok := medicine["dosagePerFrequency"].(string)
+	if !ok {
+		return 0, 0, errors.New(util.UNABLE_TO_FETCH_DOSAGE_PER_FREQUENCY)
+	}
+	dosagePerFrequency, _ := strconv.Atoi(dosagePerFrequencyVal)
+	noOfDaysVal, ok := medicine["noOfDays"].(string)
+	if !ok {
+		return 0, 0, errors.New(util.UNABLE_TO_FETCH_NO_OF_DAYS)
+	}
+	noOfDays, _ := strconv.Atoi(noOfDaysVal)
+	freq, ok := medicine["frequency"].(map[string]interface{})
+	if !ok {
+		return 0, 0, errors.New(util.FREQUENCY_MUST_BE_AN_OBJECT)
+	}
+	timesPerDay := 0
+	for _, field := range frequencyFields {
+		if taken, _ := freq[field].(bool); taken {
+			timesPerDay++
+		}
+	}
+	return dosagePerFrequency * timesPerDay * noOfDays, noOfDays, nil
+}
+
+/*
+* Tablets and capsules are dispensed loose
+* Other forms(syrups in ml, inhalers, drops...) are dispensed in whole packs
+* For those, tabletsPerStrip is the units in one pack(e.g. 100 ml bottle)
+ */
+func RoundQuantityToPacks(medicine map[string]interface{}, quantity int, unitsPerPack int) int {
+	drugType := strings.ToUpper(strings.TrimSpace(getString(medicine["drugType"])))
+	if drugType == "" || slices.Contains(LooseDispenseUnits, drugType) || unitsPerPack <= 0 {
+		return quantity
+	}
+	packs := (quantity + unitsPerPack - 1) / unitsPerPack
+	return packs * unitsPerPack
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	util "github.com/KanapuramVaishnavi/Core/util"
+)
+
+func TestCheckScheduleUnit(t *testing.T) {
+	cases := []struct {
+		name     string
+		drugType interface{}
+		schedule map[string]interface{}
+		wantErr  bool
+	}{
+		{"tablet in tablets", "Tablet", map[string]interface{}{"unit": "TABLET"}, false},
+		{"syrup in ml", "syrup", map[string]interface{}{"unit": "ML"}, false},
+		{"injection in units", "INJECTION", map[string]interface{}{"unit": "UNIT"}, false},
+		{"tablet in ml", "TABLET", map[string]interface{}{"unit": "ML"}, true},
+		{"syrup in tablets", "SYRUP", map[string]interface{}{"unit": "TABLET"}, true},
+		{"inhaler in drops", "Inhaler", map[string]interface{}{"unit": "DROP"}, true},
+		{"unknown drug type", "Patch", map[string]interface{}{"unit": "UNIT"}, false},
+		{"no drug type", nil, map[string]interface{}{"unit": "ML"}, false},
+		{"line without schedule", "SYRUP", nil, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			line := map[string]interface{}{"medicineId": "M1"}
+			if tc.schedule != nil {
+				line["schedule"] = tc.schedule
+			}
+			err := checkScheduleUnit(line, map[string]interface{}{"drugType": tc.drugType})
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if err != nil && !strings.HasPrefix(err.Error(), DOSE_UNIT_NOT_FOR_DRUG_TYPE) {
+				t.Errorf("err = %v", err)
+			}
+		})
+	}
+}
+
+func TestCalculateScheduleQuantity(t *testing.T) {
+	cases := []struct {
+		name     string
+		schedule map[string]interface{}
+		quantity float64
+		days     int
+		err      string
+	}{
+		{"fixed times", map[string]interface{}{"type": "fixed_times", "dose": 1.0, "timesPerDay": 2.0, "noOfDays": 5.0}, 10, 5, ""},
+		{"fixed times from strings", map[string]interface{}{"type": "FIXED_TIMES", "dose": "0.5", "timesPerDay": "3", "noOfDays": "4"}, 6, 4, ""},
+		{"fixed times part day", map[string]interface{}{"type": "FIXED_TIMES", "dose": 1.0, "timesPerDay": 2.0, "noOfDays": 2.5}, 5, 3, ""},
+		{"interval", map[string]interface{}{"type": "INTERVAL", "dose": 5.0, "everyHours": 8.0, "noOfDays": 3.0, "unit": "ml"}, 45, 3, ""},
+		{"interval rounds doses up", map[string]interface{}{"type": "INTERVAL", "dose": 1.0, "everyHours": 7.0, "noOfDays": 1.0}, 4, 1, ""},
+		{"interval above a day", map[string]interface{}{"type": "INTERVAL", "dose": 1.0, "everyHours": 25.0, "noOfDays": 1.0}, 0, 0, INVALID_EVERY_HOURS},
+		{"weekly default once", map[string]interface{}{"type": "WEEKLY", "dose": 1.0, "noOfWeeks": 4.0}, 4, 28, ""},
+		{"weekly twice", map[string]interface{}{"type": "WEEKLY", "dose": 2.0, "timesPerWeek": 2.0, "noOfWeeks": 3.0}, 12, 21, ""},
+		{"tapering", map[string]interface{}{"type": "TAPERING", "steps": []interface{}{
+			map[string]interface{}{"dose": 3.0, "timesPerDay": 1.0, "noOfDays": 5.0},
+			map[string]interface{}{"dose": 2.0, "timesPerDay": 1.0, "noOfDays": 5.0},
+			map[string]interface{}{"dose": 1.0, "timesPerDay": 2.0, "noOfDays": 3.0},
+		}}, 31, 13, ""},
+		{"tapering without steps", map[string]interface{}{"type": "TAPERING"}, 0, 0, TAPERING_STEPS_REQUIRED},
+		{"tapering bad step", map[string]interface{}{"type": "TAPERING", "steps": []interface{}{map[string]interface{}{"dose": 1.0, "timesPerDay": 0.0, "noOfDays": 2.0}}}, 0, 0, INVALID_SCHEDULE_NUMBER + "timesPerDay"},
+		{"prn for the maximum", map[string]interface{}{"type": "PRN", "dose": 1.0, "maxPerDay": 4.0, "noOfDays": 3.0}, 12, 3, ""},
+		{"prn missing maximum", map[string]interface{}{"type": "PRN", "dose": 1.0, "noOfDays": 3.0}, 0, 0, INVALID_SCHEDULE_NUMBER + "maxPerDay"},
+		{"unknown type", map[string]interface{}{"type": "MONTHLY", "dose": 1.0}, 0, 0, INVALID_SCHEDULE_TYPE},
+		{"unknown unit", map[string]interface{}{"type": "PRN", "unit": "spoon", "dose": 1.0, "maxPerDay": 1.0, "noOfDays": 1.0}, 0, 0, INVALID_DOSE_UNIT + "SPOON"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			quantity, days, err := CalculateScheduleQuantity(tc.schedule)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("err = %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if quantity != tc.quantity || days != tc.days {
+				t.Errorf("quantity, days = %g, %d want %g, %d", quantity, days, tc.quantity, tc.days)
+			}
+		})
+	}
+}
+
+func TestCalculatePrescribedQuantity(t *testing.T) {
+	cases := []struct {
+		name     string
+		medicine map[string]interface{}
+		quantity int
+		days     int
+		err      string
+	}{
+		{"schedule rounded up", map[string]interface{}{"schedule": map[string]interface{}{"type": "FIXED_TIMES", "dose": 0.5, "timesPerDay": 3.0, "noOfDays": 3.0}}, 5, 3, ""},
+		{"schedule not an object", map[string]interface{}{"schedule": "twice a day"}, 0, 0, SCHEDULE_MUST_BE_AN_OBJECT},
+		{"invalid schedule", map[string]interface{}{"schedule": map[string]interface{}{"type": "DAILY"}}, 0, 0, INVALID_SCHEDULE_TYPE},
+		{"legacy morning and night", map[string]interface{}{
+			"dosagePerFrequency": "2", "noOfDays": "5",
+			"frequency": map[string]interface{}{"morning": true, "afternoon": false, "night": true},
+		}, 20, 5, ""},
+		{"legacy all day", map[string]interface{}{
+			"dosagePerFrequency": "1", "noOfDays": "7",
+			"frequency": map[string]interface{}{"morning": true, "afternoon": true, "night": true},
+		}, 21, 7, ""},
+		{"legacy nil schedule", map[string]interface{}{
+			"schedule": nil, "dosagePerFrequency": "1", "noOfDays": "2",
+			"frequency": map[string]interface{}{"night": true},
+		}, 2, 2, ""},
+		{"legacy without dosage", map[string]interface{}{"noOfDays": "2", "frequency": map[string]interface{}{}}, 0, 0, util.UNABLE_TO_FETCH_DOSAGE_PER_FREQUENCY},
+		{"legacy without days", map[string]interface{}{"dosagePerFrequency": "1", "frequency": map[string]interface{}{}}, 0, 0, util.UNABLE_TO_FETCH_NO_OF_DAYS},
+		{"legacy without frequency", map[string]interface{}{"dosagePerFrequency": "1", "noOfDays": "2"}, 0, 0, util.FREQUENCY_MUST_BE_AN_OBJECT},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			quantity, days, err := CalculatePrescribedQuantity(tc.medicine)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("err = %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if quantity != tc.quantity || days != tc.days {
+				t.Errorf("quantity, days = %d, %d want %d, %d", quantity, days, tc.quantity, tc.days)
+			}
+		})
+	}
+}
+
+func TestRoundQuantityToPacks(t *testing.T) {
+	cases := []struct {
+		drugType     interface{}
+		quantity     int
+		unitsPerPack int
+		want         int
+	}{
+		{"TABLET", 13, 10, 13},
+		{"capsule", 13, 10, 13},
+		{nil, 13, 10, 13},
+		{"SYRUP", 45, 100, 100},
+		{"Syrup", 150, 100, 200},
+		{"SYRUP", 200, 100, 200},
+		{"INHALER", 0, 200, 0},
+		{"DROPS", 12, 0, 12},
+	}
+	for _, tc := range cases {
+		got := RoundQuantityToPacks(map[string]interface{}{"drugType": tc.drugType}, tc.quantity, tc.unitsPerPack)
+		if got != tc.want {
+			t.Errorf("RoundQuantityToPacks(%v, %d, %d) = %d, want %d", tc.drugType, tc.quantity, tc.unitsPerPack, got, tc.want)
+		}
+	}
+}
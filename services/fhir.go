@@ -0,0 +1,1216 @@
+package services
+
+import (
+	"HealthHub360/fhir"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+* LOINC code and UCUM unit of every vital sign, the vitals entry is exported as one panel with a component per reading
+ */
+var fhirVitalCodes = map[string][3]string{
+	"systolic":        {"8480-6", "Systolic blood pressure", "mm[Hg]"},
+	"diastolic":       {"8462-4", "Diastolic blood pressure", "mm[Hg]"},
+	"pulse":           {"8867-4", "Heart rate", "/min"},
+	"temperature":     {"8310-5", "Body temperature", "Cel"},
+	"spo2":            {"59408-5", "Oxygen saturation in Arterial blood by Pulse oximetry", "%"},
+	"respiratoryRate": {"9279-1", "Respiratory rate", "/min"},
+	"height":          {"8302-2", "Body height", "cm"},
+	"weight":          {"29463-7", "Body weight", "kg"},
+	"bmi":             {"39156-5", "Body mass index (BMI) [Ratio]", "kg/m2"},
+	"painScore":       {"72514-3", "Pain severity - 0-10 verbal numeric rating [Score] - Reported", "{score}"},
+	"bloodGlucose":    {"2339-0", "Glucose [Mass/volume] in Blood", "mg/dL"},
+}
+
+/*
+* Lab report status to the FHIR DiagnosticReport/Observation status
+ */
+var fhirReportStatus = map[string]string{
+	TEST_REPORT_STATUS_ORDERED:    "registered",
+	TEST_REPORT_STATUS_COLLECTED:  "registered",
+	TEST_REPORT_STATUS_RECEIVED:   "registered",
+	TEST_REPORT_STATUS_IN_PROCESS: "partial",
+	TEST_REPORT_STATUS_RESULTED:   "preliminary",
+	TEST_REPORT_STATUS_VERIFIED:   "final",
+}
+
+/*
+* FHIR instant of a stored time, empty when the value is not a time
+ */
+func fhirTime(value interface{}) string {
+	if t, ok := toTime(value); ok {
+		return t.UTC().Format(fhir.DateTimeFormat)
+	}
+	return ""
+}
+
+func fhirMeta(doc map[string]interface{}) *fhir.Meta {
+	lastUpdated := fhirTime(doc["updatedAt"])
+	if lastUpdated == "" {
+		lastUpdated = fhirTime(doc["createdAt"])
+	}
+	if lastUpdated == "" {
+		return nil
+	}
+	return &fhir.Meta{LastUpdated: lastUpdated}
+}
+
+func fhirReference(resourceType string, id string) *fhir.Reference {
+	if id == "" {
+		return nil
+	}
+	return &fhir.Reference{Reference: resourceType + "/" + id}
+}
+
+func fhirIdentifiers(system string, value string) []fhir.Identifier {
+	return []fhir.Identifier{{Use: "official", System: system, Value: value}}
+}
+
+func fhirTelecom(doc map[string]interface{}) []fhir.ContactPoint {
+	telecom := []fhir.ContactPoint{}
+	if phone := getString(doc["phoneNo"]); phone != "" {
+		telecom = append(telecom, fhir.ContactPoint{System: "phone", Value: phone, Use: "mobile"})
+	}
+	if email := getString(doc["email"]); email != "" {
+		telecom = append(telecom, fhir.ContactPoint{System: "email", Value: email})
+	}
+	return telecom
+}
+
+/*
+* Gender is stored as given at the registration(MALE, Female, M...), FHIR has male, female, other and unknown
+ */
+func fhirGender(gender string) string {
+	gender = strings.ToUpper(strings.TrimSpace(gender))
+	switch {
+	case gender == "":
+		return ""
+	case strings.HasPrefix(gender, "M"):
+		return "male"
+	case strings.HasPrefix(gender, "F"):
+		return "female"
+	case strings.HasPrefix(gender, "O"):
+		return "other"
+	default:
+		return "unknown"
+	}
+}
+
+func fhirCoding(system, code, display string) fhir.CodeableConcept {
+	return fhir.CodeableConcept{Coding: []fhir.Coding{{System: system, Code: code, Display: display}}, Text: display}
+}
+
+/*
+* Guardians of the patient as contacts, govtId and dob as extensions
+ */
+func fhirGuardianContacts(c *gin.Context, patient map[string]interface{}) []fhir.PatientContact {
+	guardians, err := FetchGuardians(patient)
+	if err != nil || len(guardians) == 0 {
+		return nil
+	}
+	guardianColl := db.OpenCollections(util.GuardianCollection)
+	contacts := []fhir.PatientContact{}
+	for _, guardianId := range guardians {
+		guardian := make(map[string]interface{})
+		if err := db.FindOne(c, guardianColl, bson.M{"code": guardianId}, guardian); err != nil {
+			log.Println("Error from findOne(guardian): ", err)
+			continue
+		}
+		contact := fhir.PatientContact{
+			Name:    &fhir.HumanName{Text: getString(guardian["name"])},
+			Telecom: fhirTelecom(guardian),
+		}
+		if relation := getString(guardian["relation"]); relation != "" {
+			contact.Relationship = []fhir.CodeableConcept{{Text: relation}}
+		}
+		if govtId := getString(guardian["govtId"]); govtId != "" {
+			contact.Extension = append(contact.Extension, fhir.Extension{URL: FHIR_EXTENSION_GOVT_ID, ValueString: govtId})
+		}
+		if dob := getString(guardian["dob"]); dob != "" {
+			contact.Extension = append(contact.Extension, fhir.Extension{URL: FHIR_EXTENSION_BIRTH_DATE, ValueDate: dob})
+		}
+		contacts = append(contacts, contact)
+	}
+	return contacts
+}
+
+func PatientToFHIR(c *gin.Context, patient map[string]interface{}) fhir.Patient {
+	code := getString(patient["code"])
+	active := true
+	if isActive, ok := patient["isActive"].(bool); ok {
+		active = isActive
+	}
+	resource := fhir.Patient{
+		ResourceType:         fhir.ResourcePatient,
+		ID:                   code,
+		Meta:                 fhirMeta(patient),
+		Identifier:           fhirIdentifiers(FHIR_SYSTEM_PATIENT, code),
+		Active:               &active,
+		Name:                 []fhir.HumanName{{Use: "official", Text: getString(patient["name"])}},
+		Telecom:              fhirTelecom(patient),
+		Gender:               fhirGender(getString(patient["gender"])),
+		BirthDate:            getString(patient["dob"]),
+		ManagingOrganization: fhirReference("Organization", getString(patient["hospitalId"])),
+		Contact:              fhirGuardianContacts(c, patient),
+	}
+	if t, ok := toTime(patient["dob"]); ok {
+		resource.BirthDate = t.Format(fhir.DateFormat)
+	}
+	return resource
+}
+
+func PractitionerToFHIR(doctor map[string]interface{}) fhir.Practitioner {
+	code := getString(doctor["code"])
+	active := true
+	if isActive, ok := doctor["isActive"].(bool); ok {
+		active = isActive
+	}
+	resource := fhir.Practitioner{
+		ResourceType: fhir.ResourcePractitioner,
+		ID:           code,
+		Meta:         fhirMeta(doctor),
+		Identifier:   fhirIdentifiers(FHIR_SYSTEM_DOCTOR, code),
+		Active:       &active,
+		Name:         []fhir.HumanName{{Use: "official", Text: getString(doctor["name"])}},
+		Telecom:      fhirTelecom(doctor),
+		Gender:       fhirGender(getString(doctor["gender"])),
+	}
+	if department := getString(doctor["department"]); department != "" {
+		resource.Extension = []fhir.Extension{{URL: FHIR_EXTENSION_DEPARTMENT, ValueString: department}}
+	}
+	return resource
+}
+
+/*
+* An appointment with its medical record is one ambulatory encounter(id is the appointment code)
+* planned until the day of the appointment, finished once billed, in-progress in between
+ */
+func EncounterToFHIR(appointment map[string]interface{}, medicalRecord map[string]interface{}) fhir.Encounter {
+	code := getString(appointment["code"])
+	date := getString(appointment["date"])
+	start, err := time.Parse(QUERY_DATE_FORMAT+" 15:04", date+" "+getString(appointment["time"]))
+	if err != nil {
+		start, _ = time.Parse(QUERY_DATE_FORMAT, date)
+	}
+	status := "in-progress"
+	if getString(medicalRecord["billId"]) != "" {
+		status = "finished"
+	} else if date > time.Now().Format(QUERY_DATE_FORMAT) {
+		status = "planned"
+	}
+	resource := fhir.Encounter{
+		ResourceType:    fhir.ResourceEncounter,
+		ID:              code,
+		Meta:            fhirMeta(medicalRecord),
+		Identifier:      fhirIdentifiers(FHIR_SYSTEM_APPOINTMENT, code),
+		Status:          status,
+		Class:           fhir.Coding{System: fhir.SystemActCode, Code: "AMB", Display: "ambulatory"},
+		Subject:         fhirReference(fhir.ResourcePatient, getString(medicalRecord["patientId"])),
+		ServiceProvider: fhirReference("Organization", getString(appointment["hospitalId"])),
+	}
+	if !start.IsZero() {
+		resource.Period = &fhir.Period{Start: start.UTC().Format(fhir.DateTimeFormat)}
+	}
+	if medicalId := getString(appointment["medicalId"]); medicalId != "" {
+		resource.Identifier = append(resource.Identifier, fhir.Identifier{Use: "secondary", System: FHIR_SYSTEM_MEDICAL_RECORD, Value: medicalId})
+	}
+	if doctorId := getString(appointment["doctorId"]); doctorId != "" {
+		resource.Participant = append(resource.Participant, fhir.EncounterParticipant{
+			Type:       []fhir.CodeableConcept{fhirCoding(fhir.SystemParticipation, "ATND", "attender")},
+			Individual: fhirReference(fhir.ResourcePractitioner, doctorId),
+		})
+	}
+	if reason := getString(medicalRecord["reason"]); reason != "" {
+		resource.ReasonCode = []fhir.CodeableConcept{{Text: reason}}
+	}
+	return resource
+}
+
+/*
+* Encounter(appointment) of a medical record, nil when the record is not found
+ */
+func fhirEncounterReference(c *gin.Context, medicalRecordId string) *fhir.Reference {
+	if medicalRecordId == "" {
+		return nil
+	}
+	medicalRecord := make(map[string]interface{})
+	collection := db.OpenCollections(util.MedicalRecordCollection)
+	if err := db.FindOne(c, collection, bson.M{"code": medicalRecordId}, medicalRecord); err != nil {
+		log.Println("Error from findOne(medicalRecord): ", err)
+		return nil
+	}
+	return fhirReference(fhir.ResourceEncounter, getString(medicalRecord["appointmentId"]))
+}
+
+func VitalsToFHIR(c *gin.Context, vitals map[string]interface{}) fhir.Observation {
+	resource := fhir.Observation{
+		ResourceType:      fhir.ResourceObservation,
+		ID:                getString(vitals["code"]),
+		Meta:              fhirMeta(vitals),
+		Status:            "final",
+		Category:          []fhir.CodeableConcept{fhirCoding(fhir.SystemObsCategory, "vital-signs", "Vital Signs")},
+		Code:              fhirCoding(fhir.SystemLOINC, "85353-1", "Vital signs, weight, height, head circumference, oxygen saturation and BMI panel"),
+		Subject:           fhirReference(fhir.ResourcePatient, getString(vitals["patientId"])),
+		Encounter:         fhirEncounterReference(c, getString(vitals["medicalRecordId"])),
+		EffectiveDateTime: fhirTime(vitals["takenAt"]),
+		Issued:            fhirTime(vitals["createdAt"]),
+	}
+	if recordedBy := getString(vitals["recordedBy"]); recordedBy != "" {
+		resource.Performer = []fhir.Reference{{Reference: "Practitioner/" + recordedBy}}
+	}
+	for _, field := range vitalFields {
+		value, ok := resultNumber(vitals[field])
+		if !ok {
+			continue
+		}
+		loinc := fhirVitalCodes[field]
+		resource.Component = append(resource.Component, fhir.ObservationComponent{
+			Code:          fhirCoding(fhir.SystemLOINC, loinc[0], loinc[1]),
+			ValueQuantity: &fhir.Quantity{Value: fhir.Decimal(value), Unit: loinc[2], System: fhir.SystemUCUM, Code: loinc[2]},
+		})
+	}
+	return resource
+}
+
+/*
+* One observation per analyte with a value, id is <testReportId>-<analyteCode>
+* Numbers are exported as quantities, anything else(e.g. POSITIVE) as a string
+ */
+func LabResultToFHIR(report map[string]interface{}, row map[string]interface{}) fhir.Observation {
+	reportId := getString(report["code"])
+	analyteCode := getString(row["analyteCode"])
+	status := fhirReportStatus[getString(report["status"])]
+	if status == "" {
+		status = "registered"
+	}
+	resource := fhir.Observation{
+		ResourceType:      fhir.ResourceObservation,
+		ID:                reportId + "-" + analyteCode,
+		Meta:              fhirMeta(report),
+		Status:            status,
+		Category:          []fhir.CodeableConcept{fhirCoding(fhir.SystemObsCategory, "laboratory", "Laboratory")},
+		Code:              fhirCoding(FHIR_SYSTEM_ANALYTE, analyteCode, getString(row["analyteName"])),
+		Subject:           fhirReference(fhir.ResourcePatient, getString(report["patientId"])),
+		EffectiveDateTime: fhirTime(report["resultedAt"]),
+		Issued:            fhirTime(report["verifiedAt"]),
+	}
+	unit := getString(row["unit"])
+	if value, ok := resultNumber(row["value"]); ok {
+		resource.ValueQuantity = &fhir.Quantity{Value: fhir.Decimal(value), Unit: unit, System: fhir.SystemUCUM, Code: unit}
+	} else {
+		resource.ValueString = fmt.Sprint(row["value"])
+	}
+	if flag := getString(row["flag"]); flag != "" {
+		resource.Interpretation = []fhir.CodeableConcept{fhirCoding(fhir.SystemInterpret, flag, "")}
+	}
+	if refRange, ok := row["referenceRange"].(map[string]interface{}); ok {
+		reference := fhir.ObservationReferenceRange{}
+		if low, ok := resultNumber(refRange["low"]); ok {
+			reference.Low = &fhir.Quantity{Value: fhir.Decimal(low), Unit: unit, System: fhir.SystemUCUM, Code: unit}
+		}
+		if high, ok := resultNumber(refRange["high"]); ok {
+			reference.High = &fhir.Quantity{Value: fhir.Decimal(high), Unit: unit, System: fhir.SystemUCUM, Code: unit}
+		}
+		reference.Text = getString(refRange["text"])
+		if reference.Low != nil || reference.High != nil || reference.Text != "" {
+			resource.ReferenceRange = []fhir.ObservationReferenceRange{reference}
+		}
+	}
+	return resource
+}
+
+/*
+* Results of the report which have a value, the results are not there until they are released to the patient
+ */
+func labResultRows(report map[string]interface{}) []map[string]interface{} {
+	results, _ := normalizeMongoArray(report["results"])
+	rows := []map[string]interface{}{}
+	for _, r := range results {
+		row, ok := r.(map[string]interface{})
+		if !ok || row["value"] == nil || getString(row["analyteCode"]) == "" {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func DiagnosticReportToFHIR(report map[string]interface{}) fhir.DiagnosticReport {
+	code := getString(report["code"])
+	status := fhirReportStatus[getString(report["status"])]
+	if status == "" {
+		status = "registered"
+	}
+	resource := fhir.DiagnosticReport{
+		ResourceType:      fhir.ResourceDiagnosticReport,
+		ID:                code,
+		Meta:              fhirMeta(report),
+		Identifier:        fhirIdentifiers(FHIR_SYSTEM_TEST_REPORT, code),
+		Status:            status,
+		Category:          []fhir.CodeableConcept{fhirCoding(fhir.SystemDiagService, "LAB", "Laboratory")},
+		Code:              fhirCoding(FHIR_SYSTEM_TEST, getString(report["testId"]), getString(report["testName"])),
+		Subject:           fhirReference(fhir.ResourcePatient, getString(report["patientId"])),
+		EffectiveDateTime: fhirTime(report["resultedAt"]),
+		Issued:            fhirTime(report["verifiedAt"]),
+	}
+	if doctorId := getString(report["doctorId"]); doctorId != "" {
+		resource.Performer = []fhir.Reference{{Reference: "Practitioner/" + doctorId}}
+	}
+	for _, row := range labResultRows(report) {
+		resource.Result = append(resource.Result, fhir.Reference{
+			Reference: "Observation/" + code + "-" + getString(row["analyteCode"]),
+			Display:   getString(row["analyteName"]),
+		})
+	}
+	return resource
+}
+
+/*
+* Timing of a prescription line
+* Lines with a schedule follow the dosage schedule model, a tapering schedule gives one dosage per step
+* Older lines are dosagePerFrequency at morning/afternoon/night for noOfDays
+ */
+func fhirDosages(medicine map[string]interface{}) []fhir.Dosage {
+	instructions := getString(medicine["instructions"])
+	days := func(n float64) *fhir.Quantity {
+		return &fhir.Quantity{Value: fhir.Decimal(n), Unit: "days", System: fhir.SystemUCUM, Code: "d"}
+	}
+	dose := func(n float64, unit string) []fhir.DoseAndRate {
+		return []fhir.DoseAndRate{{DoseQuantity: &fhir.Quantity{Value: fhir.Decimal(n), Unit: strings.ToLower(unit)}}}
+	}
+	schedule, ok := medicine["schedule"].(map[string]interface{})
+	if !ok {
+		frequency, _ := medicine["frequency"].(map[string]interface{})
+		repeat := &fhir.TimingRepeat{Period: 1, PeriodUnit: "d"}
+		for _, slot := range [][2]string{{"morning", "MORN"}, {"afternoon", "AFT"}, {"night", "NIGHT"}} {
+			if taken, _ := frequency[slot[0]].(bool); taken {
+				repeat.When = append(repeat.When, slot[1])
+			}
+		}
+		repeat.Frequency = len(repeat.When)
+		if n, ok := resultNumber(medicine["noOfDays"]); ok {
+			repeat.BoundsDuration = days(n)
+		}
+		dosage := fhir.Dosage{Text: instructions, Timing: &fhir.Timing{Repeat: repeat}}
+		if n, ok := resultNumber(medicine["dosagePerFrequency"]); ok {
+			dosage.DoseAndRate = dose(n, "TABLET")
+		}
+		return []fhir.Dosage{dosage}
+	}
+	number := func(m map[string]interface{}, field string) float64 {
+		value, _ := scheduleNumber(m, field)
+		return value
+	}
+	unit := getString(schedule["unit"])
+	dosage := fhir.Dosage{Text: instructions, DoseAndRate: dose(number(schedule, "dose"), unit)}
+	switch getString(schedule["type"]) {
+	case SCHEDULE_FIXED_TIMES:
+		dosage.Timing = &fhir.Timing{Repeat: &fhir.TimingRepeat{Frequency: int(number(schedule, "timesPerDay")), Period: 1, PeriodUnit: "d", BoundsDuration: days(number(schedule, "noOfDays"))}}
+	case SCHEDULE_INTERVAL:
+		dosage.Timing = &fhir.Timing{Repeat: &fhir.TimingRepeat{Frequency: 1, Period: number(schedule, "everyHours"), PeriodUnit: "h", BoundsDuration: days(number(schedule, "noOfDays"))}}
+	case SCHEDULE_WEEKLY:
+		dosage.Timing = &fhir.Timing{Repeat: &fhir.TimingRepeat{Frequency: int(number(schedule, "timesPerWeek")), Period: 1, PeriodUnit: "wk", BoundsDuration: days(number(schedule, "noOfWeeks") * 7)}}
+	case SCHEDULE_PRN:
+		dosage.AsNeededBoolean = true
+		dosage.Timing = &fhir.Timing{Repeat: &fhir.TimingRepeat{FrequencyMax: int(number(schedule, "maxPerDay")), Period: 1, PeriodUnit: "d", BoundsDuration: days(number(schedule, "noOfDays"))}}
+	case SCHEDULE_TAPERING:
+		dosages := []fhir.Dosage{}
+		for i, s := range scheduleSteps(schedule) {
+			step, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			dosages = append(dosages, fhir.Dosage{
+				Sequence:    i + 1,
+				Text:        instructions,
+				DoseAndRate: dose(number(step, "dose"), unit),
+				Timing:      &fhir.Timing{Repeat: &fhir.TimingRepeat{Frequency: int(number(step, "timesPerDay")), Period: 1, PeriodUnit: "d", BoundsDuration: days(number(step, "noOfDays"))}},
+			})
+		}
+		return dosages
+	}
+	return []fhir.Dosage{dosage}
+}
+
+/*
+* Medicine name for the medication, the medicineId when the medicine is not found
+ */
+func fhirMedication(c *gin.Context, medicineId string) fhir.CodeableConcept {
+	medicine := make(map[string]interface{})
+	name := medicineId
+	if err := db.FindOne(c, db.OpenCollections(util.MedicineCollection), bson.M{"code": medicineId}, medicine); err == nil {
+		if medicineName := getString(medicine["medicineName"]); medicineName != "" {
+			name = medicineName
+		}
+	}
+	return fhirCoding(FHIR_SYSTEM_MEDICINE, medicineId, name)
+}
+
+/*
+* A prescription is a group of medication requests, one per medicine line(id is <prescriptionId>-<line number>)
+* Superseded versions are exported as stopped
+ */
+func PrescriptionToFHIR(c *gin.Context, prescription map[string]interface{}) []fhir.MedicationRequest {
+	code := getString(prescription["code"])
+	status := "active"
+	if getString(prescription["status"]) == PRESCRIPTION_STATUS_SUPERSEDED {
+		status = "stopped"
+	}
+	authoredOn := fhirTime(prescription["issuedAt"])
+	if authoredOn == "" {
+		authoredOn = fhirTime(prescription["createdAt"])
+	}
+	var reasons []fhir.CodeableConcept
+	diagnoses, _ := normalizeMongoArray(prescription["diagnoses"])
+	for _, d := range diagnoses {
+		if diagnosis, ok := d.(map[string]interface{}); ok && getString(diagnosis["icdCode"]) != "" {
+			reasons = append(reasons, fhirCoding(fhir.SystemICD10, getString(diagnosis["icdCode"]), getString(diagnosis["description"])))
+		}
+	}
+	if len(reasons) == 0 && getString(prescription["diagnosis"]) != "" {
+		reasons = []fhir.CodeableConcept{{Text: getString(prescription["diagnosis"])}}
+	}
+	encounter := fhirEncounterReference(c, getString(prescription["medicalRecordId"]))
+	medicines, _ := normalizeMongoArray(prescription["medicines"])
+	requests := []fhir.MedicationRequest{}
+	for i, m := range medicines {
+		medicine, ok := m.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		requests = append(requests, fhir.MedicationRequest{
+			ResourceType:              fhir.ResourceMedicationRequest,
+			ID:                        code + "-" + strconv.Itoa(i+1),
+			Meta:                      fhirMeta(prescription),
+			Status:                    status,
+			Intent:                    "order",
+			MedicationCodeableConcept: fhirMedication(c, getString(medicine["medicineId"])),
+			Subject:                   fhir.Reference{Reference: "Patient/" + getString(prescription["patientId"])},
+			Encounter:                 encounter,
+			AuthoredOn:                authoredOn,
+			Requester:                 fhirReference(fhir.ResourcePractitioner, getString(prescription["createdBy"])),
+			ReasonCode:                reasons,
+			GroupIdentifier:           &fhir.Identifier{System: FHIR_SYSTEM_PRESCRIPTION, Value: code},
+			DosageInstruction:         fhirDosages(medicine),
+		})
+	}
+	return requests
+}
+
+/*
+* A verified consent is active, it is proposed until the guardian verifies it
+ */
+func ConsentToFHIR(consent map[string]interface{}) fhir.Consent {
+	code := getString(consent["code"])
+	status := "active"
+	switch consentStatus(consent) {
+	case CONSENT_STATUS_PENDING:
+		status = "proposed"
+	case CONSENT_STATUS_WITHDRAWN, CONSENT_STATUS_EXPIRED:
+		status = "inactive"
+	}
+	provision := "permit"
+	switch strings.ToLower(strings.TrimSpace(getString(consent["consentPermission"]))) {
+	case "deny", "denied", "no", "false", "rejected":
+		provision = "deny"
+	}
+	consentType := getString(consent["consentType"])
+	if consentType == "" {
+		consentType = "Patient Consent"
+	}
+	validFrom := consent["validFrom"]
+	if validFrom == nil {
+		validFrom = consent["createdAt"]
+	}
+	period := &fhir.Period{Start: fhirTime(validFrom)}
+	if expiresAt, ok := consentExpiry(consent); ok {
+		period.End = fhirTime(expiresAt)
+	}
+	return fhir.Consent{
+		ResourceType: fhir.ResourceConsent,
+		ID:           code,
+		Meta:         fhirMeta(consent),
+		Identifier:   fhirIdentifiers(FHIR_SYSTEM_CONSENT, code),
+		Status:       status,
+		Scope:        fhirCoding(fhir.SystemConsentScope, "treatment", "Treatment"),
+		Category:     []fhir.CodeableConcept{{Coding: []fhir.Coding{{System: fhir.SystemConsentCat, Code: "59284-0", Display: "Patient Consent"}}, Text: consentType}},
+		Patient:      fhirReference(fhir.ResourcePatient, getString(consent["patientId"])),
+		DateTime:     fhirTime(consent["createdAt"]),
+		Performer:    []fhir.Reference{{Reference: "Patient/" + getString(consent["patientId"])}},
+		Provision:    &fhir.ConsentProvision{Type: provision, Period: period},
+	}
+}
+
+func fhirMoney(value interface{}) *fhir.Money {
+	amount, _ := resultNumber(value)
+	return &fhir.Money{Value: amount, Currency: FHIR_CURRENCY}
+}
+
+/*
+* Tests, medicines and bed charges of the bill are the line items, the amounts are stored as strings
+ */
+func BillToFHIR(c *gin.Context, bill map[string]interface{}) fhir.Invoice {
+	code := getString(bill["code"])
+	resource := fhir.Invoice{
+		ResourceType: fhir.ResourceInvoice,
+		ID:           code,
+		Meta:         fhirMeta(bill),
+		Identifier:   fhirIdentifiers(FHIR_SYSTEM_BILL, code),
+		Status:       "issued",
+		Type:         &fhir.CodeableConcept{Text: getString(bill["billType"])},
+		Subject:      fhirReference(fhir.ResourcePatient, getString(bill["patientId"])),
+		Date:         fhirTime(bill["createdAt"]),
+		Issuer:       fhirReference("Organization", getString(bill["hospitalId"])),
+		TotalNet:     fhirMoney(bill["amount"]),
+		TotalGross:   fhirMoney(bill["amount"]),
+	}
+	tests, _ := normalizeMongoArray(bill["tests"])
+	for _, t := range tests {
+		test, ok := t.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		resource.LineItem = append(resource.LineItem, fhir.InvoiceLineItem{
+			Sequence:                  len(resource.LineItem) + 1,
+			ChargeItemCodeableConcept: fhirCoding(FHIR_SYSTEM_TEST, getString(test["testId"]), getString(test["testName"])),
+			PriceComponent:            []fhir.InvoicePriceComponent{{Type: "base", Amount: fhirMoney(test["price"])}},
+		})
+	}
+	medicines, _ := normalizeMongoArray(bill["medicines"])
+	for _, m := range medicines {
+		medicine, ok := m.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		resource.LineItem = append(resource.LineItem, fhir.InvoiceLineItem{
+			Sequence:                  len(resource.LineItem) + 1,
+			ChargeItemCodeableConcept: fhirMedication(c, getString(medicine["medicineId"])),
+			PriceComponent:            []fhir.InvoicePriceComponent{{Type: "base", Amount: fhirMoney(medicine["pricePerMedicine"])}},
+		})
+	}
+	bedCharges, _ := normalizeMongoArray(bill["bedCharges"])
+	for _, b := range bedCharges {
+		charge, ok := b.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		resource.LineItem = append(resource.LineItem, fhir.InvoiceLineItem{
+			Sequence:                  len(resource.LineItem) + 1,
+			ChargeItemCodeableConcept: fhirCoding(FHIR_SYSTEM_BED, getString(charge["bedId"]), "Bed charge "+getString(charge["date"])),
+			PriceComponent:            []fhir.InvoicePriceComponent{{Type: "base", Amount: fhirMoney(charge["tariff"])}},
+		})
+	}
+	return resource
+}
+
+/*
+* A resource is read only when the role can see its events on the timeline(timelineVisibility)
+ */
+func requireFHIRVisible(c *gin.Context, timelineType string, resource string) error {
+	visible, err := visibleTimelineTypes(c, "")
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(visible, timelineType) {
+		return errors.New(FHIR_RESOURCE_NOT_VISIBLE + resource)
+	}
+	return nil
+}
+
+func FetchFHIRPatient(c *gin.Context, patientId string) (fhir.Patient, error) {
+	patient, err := FetchPatientByCode(c, patientId)
+	if err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return fhir.Patient{}, err
+	}
+	return PatientToFHIR(c, patient), nil
+}
+
+func FetchFHIRPractitioner(c *gin.Context, doctorId string) (fhir.Practitioner, error) {
+	doctor, err := FetchDoctorByCode(c, doctorId)
+	if err != nil {
+		log.Println("Error from fetchDoctorByCode: ", err)
+		return fhir.Practitioner{}, err
+	}
+	return PractitionerToFHIR(doctor), nil
+}
+
+func FetchFHIREncounter(c *gin.Context, appointmentId string) (fhir.Encounter, error) {
+	if err := requireFHIRVisible(c, TIMELINE_APPOINTMENT, "Encounter/"+appointmentId); err != nil {
+		return fhir.Encounter{}, err
+	}
+	appointment, err := FetchAppointmentByCode(c, appointmentId)
+	if err != nil {
+		log.Println("Error from fetchAppointmentByCode: ", err)
+		return fhir.Encounter{}, err
+	}
+	medicalRecord := make(map[string]interface{})
+	collection := db.OpenCollections(util.MedicalRecordCollection)
+	if err := db.FindOne(c, collection, bson.M{"code": appointment["medicalId"]}, medicalRecord); err != nil {
+		log.Println("Error from findOne(medicalRecord): ", err)
+	}
+	return EncounterToFHIR(appointment, medicalRecord), nil
+}
+
+/*
+* id is the vitals code, or <testReportId>-<analyteCode> for a lab result
+ */
+func FetchFHIRObservation(c *gin.Context, observationId string) (fhir.Observation, error) {
+	reportId, analyteCode, isLab := strings.Cut(observationId, "-")
+	if !isLab {
+		if err := requireFHIRVisible(c, TIMELINE_VITALS, "Observation/"+observationId); err != nil {
+			return fhir.Observation{}, err
+		}
+		vitals := make(map[string]interface{})
+		collection := db.OpenCollections(VitalsCollection)
+		if err := db.FindOne(c, collection, bson.M{"code": observationId}, vitals); err != nil {
+			log.Println("Error from findOne(vitals): ", err)
+			return fhir.Observation{}, errors.New(FHIR_RESOURCE_NOT_FOUND + "Observation/" + observationId)
+		}
+		if _, err := FetchPatientByCode(c, getString(vitals["patientId"])); err != nil {
+			log.Println("Error from fetchPatientByCode: ", err)
+			return fhir.Observation{}, err
+		}
+		return VitalsToFHIR(c, vitals), nil
+	}
+	if err := requireFHIRVisible(c, TIMELINE_TEST_REPORT, "Observation/"+observationId); err != nil {
+		return fhir.Observation{}, err
+	}
+	report, err := FetchTestReportByCode(c, reportId)
+	if err != nil {
+		log.Println("Error from fetchTestReportByCode: ", err)
+		return fhir.Observation{}, err
+	}
+	for _, row := range labResultRows(report) {
+		if getString(row["analyteCode"]) == analyteCode {
+			return LabResultToFHIR(report, row), nil
+		}
+	}
+	return fhir.Observation{}, errors.New(FHIR_RESOURCE_NOT_FOUND + "Observation/" + observationId)
+}
+
+/*
+* id is <prescriptionId>-<line number>
+ */
+func FetchFHIRMedicationRequest(c *gin.Context, medicationRequestId string) (fhir.MedicationRequest, error) {
+	if err := requireFHIRVisible(c, TIMELINE_PRESCRIPTION, "MedicationRequest/"+medicationRequestId); err != nil {
+		return fhir.MedicationRequest{}, err
+	}
+	prescriptionId, _, _ := strings.Cut(medicationRequestId, "-")
+	prescription, err := FetchPrescriptionByCode(c, prescriptionId)
+	if err != nil {
+		log.Println("Error from fetchPrescriptionByCode: ", err)
+		return fhir.MedicationRequest{}, err
+	}
+	for _, request := range PrescriptionToFHIR(c, prescription) {
+		if request.ID == medicationRequestId {
+			return request, nil
+		}
+	}
+	return fhir.MedicationRequest{}, errors.New(FHIR_RESOURCE_NOT_FOUND + "MedicationRequest/" + medicationRequestId)
+}
+
+func FetchFHIRDiagnosticReport(c *gin.Context, testReportId string) (fhir.DiagnosticReport, error) {
+	if err := requireFHIRVisible(c, TIMELINE_TEST_REPORT, "DiagnosticReport/"+testReportId); err != nil {
+		return fhir.DiagnosticReport{}, err
+	}
+	report, err := FetchTestReportByCode(c, testReportId)
+	if err != nil {
+		log.Println("Error from fetchTestReportByCode: ", err)
+		return fhir.DiagnosticReport{}, err
+	}
+	return DiagnosticReportToFHIR(report), nil
+}
+
+func FetchFHIRConsent(c *gin.Context, consentId string) (fhir.Consent, error) {
+	if err := requireFHIRVisible(c, TIMELINE_APPOINTMENT, "Consent/"+consentId); err != nil {
+		return fhir.Consent{}, err
+	}
+	consent, err := FetchConsentByCode(c, consentId)
+	if err != nil {
+		log.Println("Error from fetchConsentByCode: ", err)
+		return fhir.Consent{}, err
+	}
+	return ConsentToFHIR(consent), nil
+}
+
+func FetchFHIRInvoice(c *gin.Context, billId string) (fhir.Invoice, error) {
+	if err := requireFHIRVisible(c, TIMELINE_BILL, "Invoice/"+billId); err != nil {
+		return fhir.Invoice{}, err
+	}
+	bill, err := FetchBillByCode(c, billId)
+	if err != nil {
+		log.Println("Error from fetchBillByCode: ", err)
+		return fhir.Invoice{}, err
+	}
+	return BillToFHIR(c, bill), nil
+}
+
+/*
+* Documents of the patient in the collection, oldest first
+ */
+func fhirPatientDocuments(c *gin.Context, coll string, patientId string) ([]map[string]interface{}, error) {
+	return fhirDocuments(c, coll, bson.M{"patientId": patientId})
+}
+
+func fhirDocuments(c *gin.Context, coll string, filter bson.M) ([]map[string]interface{}, error) {
+	collection := db.OpenCollections(coll)
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	docs, err := db.FindAll(c, collection, filter, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	result := []map[string]interface{}{}
+	for _, d := range docs {
+		if doc, ok := d.(map[string]interface{}); ok {
+			result = append(result, doc)
+		}
+	}
+	return result, nil
+}
+
+/*
+* Resources of one type for the patient, the access to the patient is checked by the caller
+ */
+type fhirPatientSearch func(c *gin.Context, patient map[string]interface{}) (*fhir.Bundle, error)
+
+func fhirEncounters(c *gin.Context, patient map[string]interface{}) (*fhir.Bundle, error) {
+	bundle := fhir.NewBundle(fhir.BundleSearchSet)
+	codes, _ := normalizeMongoArray(patient["appointments"])
+	if len(codes) == 0 {
+		return bundle, nil
+	}
+	appointments, err := db.FindAll(c, db.OpenCollections(util.AppointmentCollection), bson.M{"code": bson.M{"$in": codes}}, nil)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	medicalRecords, err := fhirPatientDocuments(c, util.MedicalRecordCollection, getString(patient["code"]))
+	if err != nil {
+		return nil, err
+	}
+	byCode := map[string]map[string]interface{}{}
+	for _, medicalRecord := range medicalRecords {
+		byCode[getString(medicalRecord["code"])] = medicalRecord
+	}
+	for _, a := range appointments {
+		appointment, ok := a.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		medicalRecord := byCode[getString(appointment["medicalId"])]
+		if medicalRecord == nil {
+			medicalRecord = map[string]interface{}{"patientId": patient["code"]}
+		}
+		if err := bundle.Add(fhir.ResourceEncounter, getString(appointment["code"]), EncounterToFHIR(appointment, medicalRecord)); err != nil {
+			return nil, err
+		}
+	}
+	return bundle, nil
+}
+
+/*
+* Vitals panels and the released lab results
+ */
+func fhirObservations(c *gin.Context, patient map[string]interface{}) (*fhir.Bundle, error) {
+	bundle := fhir.NewBundle(fhir.BundleSearchSet)
+	patientId := getString(patient["code"])
+	vitals, err := fhirPatientDocuments(c, VitalsCollection, patientId)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range vitals {
+		if err := bundle.Add(fhir.ResourceObservation, getString(entry["code"]), VitalsToFHIR(c, entry)); err != nil {
+			return nil, err
+		}
+	}
+	reports, err := fhirPatientDocuments(c, util.TestReportCollection, patientId)
+	if err != nil {
+		return nil, err
+	}
+	for _, report := range reports {
+		report = hideUnreleasedResults(c, report)
+		for _, row := range labResultRows(report) {
+			observation := LabResultToFHIR(report, row)
+			if err := bundle.Add(fhir.ResourceObservation, observation.ID, observation); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return bundle, nil
+}
+
+func fhirMedicationRequests(c *gin.Context, patient map[string]interface{}) (*fhir.Bundle, error) {
+	bundle := fhir.NewBundle(fhir.BundleSearchSet)
+	filter, err := patientPrescriptionFilter(c, getString(patient["code"]))
+	if err != nil {
+		return nil, err
+	}
+	prescriptions, err := fhirDocuments(c, util.PrescriptionCollection, filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, prescription := range prescriptions {
+		for _, request := range PrescriptionToFHIR(c, prescription) {
+			if err := bundle.Add(fhir.ResourceMedicationRequest, request.ID, request); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return bundle, nil
+}
+
+func fhirDiagnosticReports(c *gin.Context, patient map[string]interface{}) (*fhir.Bundle, error) {
+	bundle := fhir.NewBundle(fhir.BundleSearchSet)
+	reports, err := fhirPatientDocuments(c, util.TestReportCollection, getString(patient["code"]))
+	if err != nil {
+		return nil, err
+	}
+	for _, report := range reports {
+		if err := bundle.Add(fhir.ResourceDiagnosticReport, getString(report["code"]), DiagnosticReportToFHIR(hideUnreleasedResults(c, report))); err != nil {
+			return nil, err
+		}
+	}
+	return bundle, nil
+}
+
+func fhirConsents(c *gin.Context, patient map[string]interface{}) (*fhir.Bundle, error) {
+	bundle := fhir.NewBundle(fhir.BundleSearchSet)
+	consents, err := fhirPatientDocuments(c, util.ConsentCollection, getString(patient["code"]))
+	if err != nil {
+		return nil, err
+	}
+	for _, consent := range consents {
+		if err := bundle.Add(fhir.ResourceConsent, getString(consent["code"]), ConsentToFHIR(consent)); err != nil {
+			return nil, err
+		}
+	}
+	return bundle, nil
+}
+
+func fhirInvoices(c *gin.Context, patient map[string]interface{}) (*fhir.Bundle, error) {
+	bundle := fhir.NewBundle(fhir.BundleSearchSet)
+	bills, err := fhirPatientDocuments(c, util.BillCollection, getString(patient["code"]))
+	if err != nil {
+		return nil, err
+	}
+	for _, bill := range bills {
+		if err := bundle.Add(fhir.ResourceInvoice, getString(bill["code"]), BillToFHIR(c, bill)); err != nil {
+			return nil, err
+		}
+	}
+	return bundle, nil
+}
+
+/*
+* Searches by patient, in the order of the export bundle
+* timelineType limits the export to what the role can see on the timeline(timelineVisibility)
+ */
+var fhirPatientSearches = []struct {
+	resourceType string
+	timelineType string
+	search       fhirPatientSearch
+}{
+	{fhir.ResourceEncounter, TIMELINE_APPOINTMENT, fhirEncounters},
+	{fhir.ResourceObservation, TIMELINE_VITALS, fhirObservations},
+	{fhir.ResourceMedicationRequest, TIMELINE_PRESCRIPTION, fhirMedicationRequests},
+	{fhir.ResourceDiagnosticReport, TIMELINE_TEST_REPORT, fhirDiagnosticReports},
+	{fhir.ResourceConsent, TIMELINE_APPOINTMENT, fhirConsents},
+	{fhir.ResourceInvoice, TIMELINE_BILL, fhirInvoices},
+}
+
+/*
+* Search resources of the type for the patient(GET /fhir/<type>?patient=<patientId>)
+* MedicationRequest can also be searched by the prescription
+* Only the types the role can see on the timeline are searched, like in the export
+ */
+func SearchFHIRResources(c *gin.Context, resourceType string, query map[string]string) (*fhir.Bundle, error) {
+	if prescriptionId := strings.TrimSpace(query["prescription"]); prescriptionId != "" && resourceType == fhir.ResourceMedicationRequest {
+		if err := requireFHIRVisible(c, TIMELINE_PRESCRIPTION, resourceType); err != nil {
+			return nil, err
+		}
+		prescription, err := FetchPrescriptionByCode(c, prescriptionId)
+		if err != nil {
+			log.Println("Error from fetchPrescriptionByCode: ", err)
+			return nil, err
+		}
+		bundle := fhir.NewBundle(fhir.BundleSearchSet)
+		for _, request := range PrescriptionToFHIR(c, prescription) {
+			if err := bundle.Add(fhir.ResourceMedicationRequest, request.ID, request); err != nil {
+				return nil, err
+			}
+		}
+		bundle.SetTotal()
+		return bundle, nil
+	}
+	patientId := strings.TrimSpace(strings.TrimPrefix(query["patient"], "Patient/"))
+	if patientId == "" {
+		return nil, errors.New(FHIR_PATIENT_PARAM_REQUIRED)
+	}
+	patient, err := FetchPatientByCode(c, patientId)
+	if err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, err
+	}
+	for _, search := range fhirPatientSearches {
+		if search.resourceType != resourceType {
+			continue
+		}
+		if err := requireFHIRVisible(c, search.timelineType, resourceType); err != nil {
+			return nil, err
+		}
+		bundle, err := search.search(c, patient)
+		if err != nil {
+			return nil, err
+		}
+		bundle.SetTotal()
+		return bundle, nil
+	}
+	return nil, errors.New(FHIR_RESOURCE_NOT_FOUND + resourceType)
+}
+
+/*
+* Everything of the patient as a collection bundle(Patient/<id>/$everything)
+* The patient first, then the practitioners who treated the patient and the resources the role can see
+ */
+func ExportFHIRPatientBundle(c *gin.Context, patientId string) (*fhir.Bundle, error) {
+	patient, err := FetchPatientByCode(c, patientId)
+	if err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, err
+	}
+	visible, err := visibleTimelineTypes(c, "")
+	if err != nil {
+		return nil, err
+	}
+	bundle := fhir.NewBundle(fhir.BundleCollection)
+	bundle.ID = patientId
+	if err := bundle.Add(fhir.ResourcePatient, patientId, PatientToFHIR(c, patient)); err != nil {
+		return nil, err
+	}
+	resources := []fhir.BundleEntry{}
+	doctors := []string{}
+	for _, search := range fhirPatientSearches {
+		if !slices.Contains(visible, search.timelineType) {
+			continue
+		}
+		searched, err := search.search(c, patient)
+		if err != nil {
+			log.Println("Error from search "+search.resourceType+": ", err)
+			return nil, err
+		}
+		resources = append(resources, searched.Entry...)
+		if search.resourceType != fhir.ResourceEncounter {
+			continue
+		}
+		for _, entry := range searched.Entry {
+			encounter := fhir.Encounter{}
+			if err := json.Unmarshal(entry.Resource, &encounter); err != nil {
+				continue
+			}
+			for _, participant := range encounter.Participant {
+				if participant.Individual == nil {
+					continue
+				}
+				doctorId := strings.TrimPrefix(participant.Individual.Reference, "Practitioner/")
+				if !slices.Contains(doctors, doctorId) {
+					doctors = append(doctors, doctorId)
+				}
+			}
+		}
+	}
+	doctorColl := db.OpenCollections(util.DoctorCollection)
+	for _, doctorId := range doctors {
+		doctor := make(map[string]interface{})
+		if err := db.FindOne(c, doctorColl, bson.M{"code": doctorId}, doctor); err != nil {
+			log.Println("Error from findOne(doctor): ", err)
+			continue
+		}
+		if err := bundle.Add(fhir.ResourcePractitioner, doctorId, PractitionerToFHIR(doctor)); err != nil {
+			return nil, err
+		}
+	}
+	bundle.Entry = append(bundle.Entry, resources...)
+	bundle.SetTotal()
+	return bundle, nil
+}
+
+/*
+* Our fields of a FHIR patient, only the elements which are given
+ */
+func fhirPatientData(resource fhir.Patient) map[string]interface{} {
+	data := map[string]interface{}{}
+	if len(resource.Name) > 0 {
+		if name := resource.Name[0].Display(); name != "" {
+			data["name"] = name
+		}
+	}
+	if email := fhir.TelecomValue(resource.Telecom, "email"); email != "" {
+		data["email"] = email
+	}
+	if phone := fhir.TelecomValue(resource.Telecom, "phone"); phone != "" {
+		data["phoneNo"] = phone
+	}
+	if resource.BirthDate != "" {
+		data["dob"] = resource.BirthDate
+	}
+	if resource.Gender != "" {
+		data["gender"] = strings.ToUpper(resource.Gender)
+	}
+	return data
+}
+
+/*
+* Guardians of a minor from the contacts, in the format CreatePatient expects
+ */
+func fhirGuardians(resource fhir.Patient, roleCode string) []interface{} {
+	guardians := []interface{}{}
+	for _, contact := range resource.Contact {
+		guardian := map[string]interface{}{
+			"email":    fhir.TelecomValue(contact.Telecom, "email"),
+			"phoneNo":  fhir.TelecomValue(contact.Telecom, "phone"),
+			"dob":      fhir.ExtensionValue(contact.Extension, FHIR_EXTENSION_BIRTH_DATE),
+			"govtId":   fhir.ExtensionValue(contact.Extension, FHIR_EXTENSION_GOVT_ID),
+			"roleCode": roleCode,
+		}
+		if contact.Name != nil {
+			guardian["name"] = contact.Name.Display()
+		}
+		if len(contact.Relationship) > 0 {
+			relation := contact.Relationship[0].Text
+			if relation == "" && len(contact.Relationship[0].Coding) > 0 {
+				relation = contact.Relationship[0].Coding[0].Code
+			}
+			guardian["relation"] = relation
+		}
+		guardians = append(guardians, guardian)
+	}
+	return guardians
+}
+
+/*
+* Existing patient for the resource, matched by our identifier and then by the email
+* nil when there is no such patient, an error when the user cannot access it
+ */
+func findFHIRPatient(c *gin.Context, resource fhir.Patient, email string) (map[string]interface{}, error) {
+	collection := db.OpenCollections(util.PatientCollection)
+	filters := []bson.M{}
+	if code := fhir.IdentifierValue(resource.Identifier, FHIR_SYSTEM_PATIENT); code != "" {
+		filters = append(filters, bson.M{"code": code})
+	}
+	if email != "" {
+		filters = append(filters, bson.M{"email": email})
+	}
+	for _, filter := range filters {
+		existing := make(map[string]interface{})
+		if err := db.FindOne(c, collection, filter, existing); err != nil {
+			continue
+		}
+		return FetchPatientByCode(c, getString(existing["code"]))
+	}
+	return nil, nil
+}
+
+/*
+* Update the matched patient or create a new one(with the guardians of a minor from the contacts)
+* email and phoneNo are updated only when they changed, they must be unique among the patients
+ */
+func importFHIRPatient(c *gin.Context, raw json.RawMessage, query map[string]string) (*fhir.BundleResponse, error) {
+	resource := fhir.Patient{}
+	if err := json.Unmarshal(raw, &resource); err != nil {
+		return nil, err
+	}
+	data := fhirPatientData(resource)
+	existing, err := findFHIRPatient(c, resource, getString(data["email"]))
+	if err != nil {
+		log.Println("Error from findFHIRPatient: ", err)
+		return nil, err
+	}
+	if existing != nil {
+		patientId := getString(existing["code"])
+		for _, field := range []string{"email", "phoneNo"} {
+			if getString(existing[field]) == getString(data[field]) {
+				delete(data, field)
+			}
+		}
+		if _, err := UpdatePatientByCode(c, patientId, data); err != nil {
+			log.Println("Error from updatePatientByCode: ", err)
+			return nil, err
+		}
+		return &fhir.BundleResponse{Status: "200 OK", Location: "Patient/" + patientId}, nil
+	}
+	email := getString(data["email"])
+	if email == "" {
+		return nil, errors.New(FHIR_PATIENT_EMAIL_REQUIRED)
+	}
+	if strings.TrimSpace(query["roleCode"]) == "" {
+		return nil, errors.New(FHIR_ROLE_CODE_REQUIRED)
+	}
+	data["roleCode"] = strings.TrimSpace(query["roleCode"])
+	if len(resource.Contact) > 0 {
+		data["guardians"] = fhirGuardians(resource, strings.TrimSpace(query["guardianRoleCode"]))
+	}
+	if _, err := CreatePatient(c, data); err != nil {
+		log.Println("Error from createPatient: ", err)
+		return nil, err
+	}
+	created := make(map[string]interface{})
+	if err := db.FindOne(c, db.OpenCollections(util.PatientCollection), bson.M{"email": email}, created); err != nil {
+		log.Println("Error from findOne(patient): ", err)
+		return nil, err
+	}
+	return &fhir.BundleResponse{Status: "201 Created", Location: "Patient/" + getString(created["code"])}, nil
+}
+
+/*
+* Import a batch bundle of patients, each entry is processed on its own and answered in a batch-response
+* A transaction bundle is rejected, the entries cannot be applied all-or-nothing
+* Query: roleCode of the patient role and guardianRoleCode, needed when a patient is created
+ */
+func ImportFHIRBundle(c *gin.Context, raw []byte, query map[string]string) (*fhir.Bundle, error) {
+	bundle, err := fhir.ParseBundle(raw)
+	if err != nil {
+		log.Println("Error from parseBundle: ", err)
+		return nil, err
+	}
+	if bundle.Type == fhir.BundleTransaction {
+		return nil, errors.New(FHIR_TRANSACTION_NOT_SUPPORTED)
+	}
+	response := fhir.NewBundle(fhir.BundleBatchResponse)
+	for _, entry := range bundle.Entry {
+		resourceType := fhir.ResourceType(entry.Resource)
+		result := fhir.BundleEntry{}
+		if resourceType != fhir.ResourcePatient {
+			result.Response = &fhir.BundleResponse{
+				Status:  "422 Unprocessable Entity",
+				Outcome: fhir.NewOperationOutcome("error", "not-supported", FHIR_RESOURCE_NOT_SUPPORTED+resourceType),
+			}
+		} else if imported, err := importFHIRPatient(c, entry.Resource, query); err != nil {
+			log.Println("Error from importFHIRPatient: ", err)
+			result.Response = &fhir.BundleResponse{
+				Status:  "400 Bad Request",
+				Outcome: fhir.NewOperationOutcome("error", "processing", err.Error()),
+			}
+		} else {
+			result.FullURL = imported.Location
+			result.Response = imported
+		}
+		response.Entry = append(response.Entry, result)
+	}
+	return response, nil
+}
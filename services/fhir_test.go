@@ -0,0 +1,50 @@
+package services
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+func fhirTestContext(collection string, isSuperAdmin bool) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set("collection", collection)
+	c.Set("isSuperAdmin", isSuperAdmin)
+	return c
+}
+
+func TestRequireFHIRVisible(t *testing.T) {
+	cases := []struct {
+		collection   string
+		isSuperAdmin bool
+		timelineType string
+		visible      bool
+	}{
+		{util.PharmacistCollection, false, TIMELINE_PRESCRIPTION, true},
+		{util.PharmacistCollection, false, TIMELINE_TEST_REPORT, false},
+		{util.ReceptionistCollection, false, TIMELINE_VITALS, false},
+		{util.ReceptionistCollection, false, TIMELINE_BILL, true},
+		{util.DoctorCollection, false, TIMELINE_BILL, false},
+		{util.DoctorCollection, false, TIMELINE_TEST_REPORT, true},
+		{util.PharmacistCollection, true, TIMELINE_TEST_REPORT, true},
+		{util.HospitalCollection, false, TIMELINE_BILL, true},
+	}
+	for _, tc := range cases {
+		err := requireFHIRVisible(fhirTestContext(tc.collection, tc.isSuperAdmin), tc.timelineType, "Resource/1")
+		if (err == nil) != tc.visible {
+			t.Errorf("%s(superAdmin %v) %s: err = %v, want visible %v", tc.collection, tc.isSuperAdmin, tc.timelineType, err, tc.visible)
+		}
+	}
+}
+
+func TestImportFHIRBundleRejectsTransaction(t *testing.T) {
+	raw := []byte(`{"resourceType":"Bundle","type":"transaction","entry":[{"resource":{"resourceType":"Patient"}}]}`)
+	_, err := ImportFHIRBundle(fhirTestContext(util.HospitalCollection, false), raw, nil)
+	if err == nil || err.Error() != FHIR_TRANSACTION_NOT_SUPPORTED {
+		t.Errorf("err = %v, want %q", err, FHIR_TRANSACTION_NOT_SUPPORTED)
+	}
+}
@@ -1,7 +1,6 @@
 package services
 
 import (
-	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -10,8 +9,6 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
-	"os"
-	"os/exec"
 	"strings"
 	"time"
 
@@ -52,6 +49,21 @@ func getString(v interface{}) string {
 	}
 }
 
+// toTime reads the dates stored as time, mongo DateTime or RFC3339 string
+func toTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case primitive.DateTime:
+		return v.Time(), true
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		return t, err == nil
+	default:
+		return time.Time{}, false
+	}
+}
+
 func FormatedDateAndTime(input interface{}) (string, error) {
 	var t time.Time
 
@@ -273,46 +285,12 @@ func flattenMedicine(c *gin.Context, med map[string]interface{}) map[string]inte
 }
 
 func GenerateReportToPDF(reportData map[string]interface{}, htmlPath string, pdfPath string) error {
-
-	// Register template functions
 	funcMap := template.FuncMap{
 		"add": func(a, b int) int {
 			return a + b
 		},
 	}
-
-	// Parse template with function map
-	tmpl, err := template.New("report.html").Funcs(funcMap).ParseFiles("./templates/report.html")
-	if err != nil {
-		return errors.New("template parse error: " + err.Error())
-	}
-
-	// Execute template into buffer
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, reportData); err != nil {
-		return errors.New("template execute error: " + err.Error())
-	}
-
-	// Write HTML file
-	if err := os.WriteFile(htmlPath, buf.Bytes(), 0644); err != nil {
-		return errors.New("failed to write HTML: " + err.Error())
-	}
-	cmd := exec.Command(
-		"wkhtmltopdf",
-		"--enable-local-file-access",
-		"--load-error-handling", "ignore",
-		htmlPath,
-		pdfPath,
-	)
-
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		return errors.New("wkhtmltopdf error: " + stderr.String())
-	}
-
-	return nil
+	return GenerateHTMLToPDFWithFuncs("./templates/report.html", funcMap, reportData, htmlPath, pdfPath)
 }
 func GenerateReport(c *gin.Context, code string) ([]string, error) {
 	patient, err := FetchPatientByCode(c, code)
@@ -0,0 +1,797 @@
+package services
+
+import (
+	"HealthHub360/hl7"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	common "github.com/KanapuramVaishnavi/Core/coreServices"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+* Name of this system in the MSH of the outgoing messages and the ACKs
+ */
+func hl7Application() (string, string) {
+	application := os.Getenv("HL7_APPLICATION")
+	if application == "" {
+		application = "HEALTHHUB360"
+	}
+	return application, os.Getenv("HL7_FACILITY")
+}
+
+/*
+* Code mapping from the code sent by an analyzer/LIS to our test catalog
+* source       : sending application(MSH-3) the mapping applies to, empty for every source
+* externalCode : OBR-4/OBX-3 identifier used by the source
+* testId       : test of our catalog
+* analyteCode  : analyte of the test for an OBX code, empty when the code identifies the whole test(OBR)
+ */
+func CreateHL7Mapping(c *gin.Context, data map[string]interface{}) (map[string]interface{}, error) {
+	tenantId, err := common.GetTenantIdFromContext(c)
+	if err != nil {
+		log.Println("Error from getTenantIdFromContext: ", err)
+		return nil, err
+	}
+	externalCode := strings.TrimSpace(getString(data["externalCode"]))
+	testId := strings.TrimSpace(getString(data["testId"]))
+	if externalCode == "" || testId == "" {
+		return nil, errors.New(HL7_MAPPING_FIELDS_REQUIRED)
+	}
+	source := strings.ToUpper(strings.TrimSpace(getString(data["source"])))
+	analyteCode := strings.ToUpper(strings.TrimSpace(getString(data["analyteCode"])))
+
+	test, err := FetchTestByCode(c, testId)
+	if err != nil {
+		log.Println("Error from fetchTestByCode: ", err)
+		return nil, err
+	}
+	if analyteCode != "" {
+		analytes, err := ExpandTestAnalytes(c, test)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, analyte := range analytes {
+			if strings.EqualFold(getString(analyte["code"]), analyteCode) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.New(ANALYTE_NOT_IN_TEST + analyteCode)
+		}
+	}
+
+	collection := db.OpenCollections(HL7MappingCollection)
+	filter := bson.M{"tenantId": tenantId, "source": source, "externalCode": externalCode, "analyteCode": analyteCode}
+	existing := make(map[string]interface{})
+	if err := db.FindOne(c, collection, filter, existing); err == nil {
+		return nil, errors.New(HL7_MAPPING_ALREADY_EXISTS + externalCode)
+	}
+	code, err := GenerateCode(HL7MappingCollection)
+	if err != nil {
+		log.Println("Error from generateCode: ", err)
+		return nil, err
+	}
+	mapping := map[string]interface{}{
+		"code":         code,
+		"source":       source,
+		"externalCode": externalCode,
+		"testId":       testId,
+		"analyteCode":  analyteCode,
+		"tenantId":     tenantId,
+		"createdBy":    c.GetString("code"),
+		"createdAt":    time.Now(),
+	}
+	inserted, err := db.CreateOne(c, collection, mapping)
+	if err != nil {
+		log.Println("Error from createOne: ", err)
+		return nil, err
+	}
+	log.Println("Inserted hl7 mapping: ", inserted.InsertedID)
+	return mapping, nil
+}
+
+func FetchHL7Mappings(c *gin.Context) ([]interface{}, error) {
+	filter := bson.M{}
+	if !c.GetBool("isSuperAdmin") {
+		tenantId, err := common.GetTenantIdFromContext(c)
+		if err != nil {
+			log.Println("Error from getTenantIdFromContext: ", err)
+			return nil, err
+		}
+		filter["tenantId"] = tenantId
+	}
+	collection := db.OpenCollections(HL7MappingCollection)
+	opts := options.Find().SetSort(bson.D{{Key: "source", Value: 1}, {Key: "externalCode", Value: 1}})
+	docs, err := db.FindAll(c, collection, filter, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	return docs, nil
+}
+
+func DeleteHL7Mapping(c *gin.Context, code string) error {
+	filter := bson.M{"code": code}
+	if !c.GetBool("isSuperAdmin") {
+		tenantId, err := common.GetTenantIdFromContext(c)
+		if err != nil {
+			log.Println("Error from getTenantIdFromContext: ", err)
+			return err
+		}
+		filter["tenantId"] = tenantId
+	}
+	collection := db.OpenCollections(HL7MappingCollection)
+	result, err := collection.DeleteOne(c, filter)
+	if err != nil {
+		log.Println("Error from deleteOne: ", err)
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return errors.New(HL7_MAPPING_NOT_FOUND + code)
+	}
+	return nil
+}
+
+/*
+* Sending system(MSH-3 application, MSH-4 facility) registered by the tenant
+* Results are only matched to the test reports of the tenant(and the hospital, when given) of the sender
+* facility is optional, a sender registered without it accepts every facility of the application
+* An application/facility belongs to a single tenant
+ */
+func CreateHL7Sender(c *gin.Context, data map[string]interface{}) (map[string]interface{}, error) {
+	tenantId, err := common.GetTenantIdFromContext(c)
+	if err != nil {
+		log.Println("Error from getTenantIdFromContext: ", err)
+		return nil, err
+	}
+	application := strings.ToUpper(strings.TrimSpace(getString(data["application"])))
+	if application == "" {
+		return nil, errors.New(HL7_SENDER_APPLICATION_REQUIRED)
+	}
+	facility := strings.ToUpper(strings.TrimSpace(getString(data["facility"])))
+	hospitalId := strings.TrimSpace(getString(data["hospitalId"]))
+	if c.GetString("collection") == util.HospitalCollection {
+		hospitalId = c.GetString("code")
+	}
+
+	collection := db.OpenCollections(HL7SenderCollection)
+	existing := make(map[string]interface{})
+	if err := db.FindOne(c, collection, bson.M{"application": application, "facility": facility}, existing); err == nil {
+		return nil, errors.New(HL7_SENDER_ALREADY_EXISTS + application + "^" + facility)
+	}
+	code, err := GenerateCode(HL7SenderCollection)
+	if err != nil {
+		log.Println("Error from generateCode: ", err)
+		return nil, err
+	}
+	sender := map[string]interface{}{
+		"code":        code,
+		"application": application,
+		"facility":    facility,
+		"hospitalId":  hospitalId,
+		"tenantId":    tenantId,
+		"createdBy":   c.GetString("code"),
+		"createdAt":   time.Now(),
+	}
+	if _, err := db.CreateOne(c, collection, sender); err != nil {
+		log.Println("Error from createOne: ", err)
+		return nil, err
+	}
+	return sender, nil
+}
+
+func FetchHL7Senders(c *gin.Context) ([]interface{}, error) {
+	filter := bson.M{}
+	if !c.GetBool("isSuperAdmin") {
+		tenantId, err := common.GetTenantIdFromContext(c)
+		if err != nil {
+			log.Println("Error from getTenantIdFromContext: ", err)
+			return nil, err
+		}
+		filter["tenantId"] = tenantId
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "application", Value: 1}, {Key: "facility", Value: 1}})
+	docs, err := db.FindAll(c, db.OpenCollections(HL7SenderCollection), filter, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	return docs, nil
+}
+
+func DeleteHL7Sender(c *gin.Context, code string) error {
+	filter := bson.M{"code": code}
+	if !c.GetBool("isSuperAdmin") {
+		tenantId, err := common.GetTenantIdFromContext(c)
+		if err != nil {
+			log.Println("Error from getTenantIdFromContext: ", err)
+			return err
+		}
+		filter["tenantId"] = tenantId
+	}
+	result, err := db.OpenCollections(HL7SenderCollection).DeleteOne(c, filter)
+	if err != nil {
+		log.Println("Error from deleteOne: ", err)
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return errors.New(HL7_SENDER_NOT_FOUND + code)
+	}
+	return nil
+}
+
+/*
+* Sender of the message, the registration for the exact facility is preferred over the one for every facility
+ */
+func resolveHL7Sender(ctx context.Context, msg *hl7.Message) (map[string]interface{}, error) {
+	application := strings.ToUpper(msg.SendingApplication())
+	facility := strings.ToUpper(msg.SendingFacility())
+	filter := bson.M{"application": application, "facility": bson.M{"$in": []string{facility, ""}}}
+	docs, err := db.FindAll(ctx, db.OpenCollections(HL7SenderCollection), filter, nil)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	var match map[string]interface{}
+	for _, d := range docs {
+		sender, ok := d.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if match == nil || getString(sender["facility"]) != "" {
+			match = sender
+		}
+	}
+	if match == nil {
+		return nil, errors.New(HL7_UNKNOWN_SENDER + application + "^" + facility)
+	}
+	return match, nil
+}
+
+/*
+* Test reports the sender can result
+ */
+func hl7SenderScope(sender map[string]interface{}) bson.M {
+	scope := bson.M{"tenantId": sender["tenantId"]}
+	if hospitalId := getString(sender["hospitalId"]); hospitalId != "" {
+		scope["hospitalId"] = hospitalId
+	}
+	return scope
+}
+
+/*
+* Mapping for the code sent by the source, a mapping for the source is preferred over a generic one
+ */
+func findHL7Mapping(ctx context.Context, tenantId string, source string, filter bson.M) map[string]interface{} {
+	filter["tenantId"] = tenantId
+	filter["source"] = bson.M{"$in": []string{strings.ToUpper(source), ""}}
+	collection := db.OpenCollections(HL7MappingCollection)
+	docs, err := db.FindAll(ctx, collection, filter, nil)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil
+	}
+	var match map[string]interface{}
+	for _, d := range docs {
+		mapping, ok := d.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if match == nil || getString(mapping["source"]) != "" {
+			match = mapping
+		}
+	}
+	return match
+}
+
+/*
+* Analyte of the report for an OBX-3 code
+* The mapping is used first, a code equal to our analyte code is accepted without a mapping
+ */
+func resolveAnalyteCode(ctx context.Context, report map[string]interface{}, source string, externalCode string) (string, error) {
+	rows := map[string]bool{}
+	for _, r := range toList(report["results"]) {
+		if row, ok := r.(map[string]interface{}); ok {
+			rows[strings.ToUpper(getString(row["analyteCode"]))] = true
+		}
+	}
+	mapping := findHL7Mapping(ctx, getString(report["tenantId"]), source, bson.M{
+		"externalCode": externalCode,
+		"analyteCode":  bson.M{"$ne": ""},
+	})
+	if mapping != nil && rows[getString(mapping["analyteCode"])] {
+		return getString(mapping["analyteCode"]), nil
+	}
+	if rows[strings.ToUpper(externalCode)] {
+		return strings.ToUpper(externalCode), nil
+	}
+	return "", errors.New(HL7_CODE_NOT_MAPPED + externalCode)
+}
+
+/*
+* Test report of an OBR: OBR-2(placer order number) is our test report code
+* OBR-3(filler order number) is the accession number of the specimen
+* Only the test reports of the tenant/hospital of the sender are matched
+ */
+func findReportForOrder(ctx context.Context, sender map[string]interface{}, obr hl7.Segment) (map[string]interface{}, error) {
+	collection := db.OpenCollections(util.TestReportCollection)
+	if placer := obr.Value(2); placer != "" {
+		filter := hl7SenderScope(sender)
+		filter["code"] = placer
+		report := make(map[string]interface{})
+		if err := db.FindOne(ctx, collection, filter, report); err == nil {
+			return report, nil
+		}
+	}
+	if filler := obr.Value(3); filler != "" {
+		specimen, err := fetchSpecimenByAccession(ctx, filler)
+		if err == nil {
+			filter := hl7SenderScope(sender)
+			filter["code"] = specimen["testReportId"]
+			report := make(map[string]interface{})
+			if err := db.FindOne(ctx, collection, filter, report); err == nil {
+				if getString(report["accessionNo"]) != filler {
+					return nil, errors.New(SPECIMEN_ALREADY_REJECTED)
+				}
+				return report, nil
+			}
+		}
+	}
+	return nil, errors.New(HL7_ORDER_NOT_FOUND + obr.Value(2) + "/" + obr.Value(3))
+}
+
+/*
+* A report of a retried message which already has every value of the message was imported by the earlier attempt
+ */
+func resultsAlreadyApplied(report map[string]interface{}, entries []interface{}) bool {
+	if getString(report["status"]) != TEST_REPORT_STATUS_RESULTED {
+		return false
+	}
+	rows := map[string]interface{}{}
+	for _, r := range toList(report["results"]) {
+		if row, ok := r.(map[string]interface{}); ok {
+			rows[strings.ToUpper(getString(row["analyteCode"]))] = row["value"]
+		}
+	}
+	for _, e := range entries {
+		entry := e.(map[string]interface{})
+		stored, exists := rows[getString(entry["analyteCode"])]
+		if !exists || stored == nil {
+			return false
+		}
+		storedNumber, storedNumeric := resultNumber(stored)
+		number, numeric := resultNumber(entry["value"])
+		if storedNumeric && numeric {
+			if storedNumber != number {
+				return false
+			}
+		} else if strings.TrimSpace(getString(stored)) != strings.TrimSpace(getString(entry["value"])) {
+			return false
+		}
+	}
+	return true
+}
+
+type hl7Result struct {
+	report  map[string]interface{}
+	entries []interface{}
+}
+
+/*
+* Match every OBR/OBX of an ORU^R01 before saving anything, including the status of every report,
+* so that a message is either imported completely or queued completely
+* Orders imported by an earlier attempt of the same message are skipped, so a retry doesnot enter them again
+ */
+func matchORUResults(ctx context.Context, sender map[string]interface{}, msg *hl7.Message) ([]hl7Result, map[string]interface{}, error) {
+	orders := msg.Orders()
+	if len(orders) == 0 {
+		return nil, nil, errors.New(HL7_NO_RESULTS_IN_MESSAGE)
+	}
+	source := msg.SendingApplication()
+	var matched []hl7Result
+	for _, order := range orders {
+		report, err := findReportForOrder(ctx, sender, order.OBR)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch getString(report["status"]) {
+		case TEST_REPORT_STATUS_COLLECTED, TEST_REPORT_STATUS_RECEIVED, TEST_REPORT_STATUS_IN_PROCESS, TEST_REPORT_STATUS_RESULTED:
+		case TEST_REPORT_STATUS_VERIFIED:
+			return nil, report, errors.New(TEST_REPORT_ALREADY_VERIFIED)
+		default:
+			return nil, report, errors.New(SAMPLE_NOT_IN_PROCESS)
+		}
+		units := map[string]string{}
+		for _, r := range toList(report["results"]) {
+			if row, ok := r.(map[string]interface{}); ok {
+				units[strings.ToUpper(getString(row["analyteCode"]))] = getString(row["unit"])
+			}
+		}
+		var entries []interface{}
+		for _, obx := range order.OBX {
+			// X: result cannot be obtained, D: deleted
+			if status := obx.Value(11); status == "X" || status == "D" {
+				continue
+			}
+			analyteCode, err := resolveAnalyteCode(ctx, report, source, obx.Component(3, 1))
+			if err != nil {
+				return nil, report, err
+			}
+			unit := obx.Component(6, 1)
+			if unit != "" && units[analyteCode] != "" && !strings.EqualFold(unit, units[analyteCode]) {
+				return nil, report, fmt.Errorf("%s%s(%s, expected %s)", HL7_UNIT_MISMATCH, analyteCode, unit, units[analyteCode])
+			}
+			entry := map[string]interface{}{
+				"analyteCode": analyteCode,
+				"value":       obx.Value(5),
+				"comment":     "HL7 " + source,
+			}
+			entries = append(entries, entry)
+		}
+		if len(entries) == 0 {
+			return nil, report, errors.New(HL7_NO_RESULTS_IN_MESSAGE)
+		}
+		if resultsAlreadyApplied(report, entries) {
+			log.Println("HL7 results already imported for the test report: ", report["code"])
+			continue
+		}
+		matched = append(matched, hl7Result{report: report, entries: entries})
+	}
+	return matched, nil, nil
+}
+
+/*
+* Save the matched results, a sample which is collected/received is moved to processing first
+* A message which fails before its report is known is queued for the tenant/hospital of the sender
+ */
+func importORU(ctx context.Context, msg *hl7.Message) (map[string]interface{}, error) {
+	sender, err := resolveHL7Sender(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	matched, failed, err := matchORUResults(ctx, sender, msg)
+	if err != nil {
+		if failed == nil {
+			failed = hl7SenderScope(sender)
+		}
+		return failed, err
+	}
+	userId := HL7_USER_PREFIX + msg.SendingApplication()
+	for _, result := range matched {
+		report := result.report
+		status := getString(report["status"])
+		if status == TEST_REPORT_STATUS_COLLECTED || status == TEST_REPORT_STATUS_RECEIVED {
+			set := bson.M{"status": TEST_REPORT_STATUS_IN_PROCESS, "updatedBy": userId, "updatedAt": time.Now()}
+			report, err = saveTestReport(ctx, getString(report["code"]), bson.M{"status": status}, set, userId, "Result received over HL7")
+			if err != nil {
+				return result.report, err
+			}
+			if accessionNo := getString(report["accessionNo"]); accessionNo != "" {
+				// the specimen follows the report, so it is in the same status the report was
+				if err := updateSpecimen(ctx, accessionNo, status, bson.M{"status": SPECIMEN_STATUS_IN_PROCESS}); err != nil {
+					log.Println("Error from updateSpecimen: ", err)
+				}
+			}
+		}
+		if _, err := applyTestResults(ctx, report, result.entries, userId); err != nil {
+			log.Println("Error from applyTestResults: ", err)
+			return report, err
+		}
+	}
+	return nil, nil
+}
+
+/*
+* Import one HL7 message received over MLLP or from the drop folder and return the ACK
+* AA: imported, AE: the message is kept in the error queue, AR: the message cannot be parsed
+ */
+func ProcessHL7Message(ctx context.Context, raw string, via string) string {
+	application, facility := hl7Application()
+	msg, err := hl7.Parse(raw)
+	if err != nil {
+		log.Println("Error from hl7 parse: ", err)
+		queueHL7Error(ctx, raw, nil, nil, via, err)
+		return hl7.BuildACK(nil, "AR", err.Error(), application, facility)
+	}
+	report, err := handleHL7Message(ctx, msg)
+	if err != nil {
+		log.Println("Error from handleHL7Message: ", err)
+		queueHL7Error(ctx, raw, msg, report, via, err)
+		return hl7.BuildACK(msg, "AE", err.Error(), application, facility)
+	}
+	return hl7.BuildACK(msg, "AA", "", application, facility)
+}
+
+func handleHL7Message(ctx context.Context, msg *hl7.Message) (map[string]interface{}, error) {
+	switch msg.Type() {
+	case "ORU^R01":
+		return importORU(ctx, msg)
+	default:
+		return nil, errors.New(HL7_UNSUPPORTED_MESSAGE_TYPE + msg.Type())
+	}
+}
+
+/*
+* Messages which cannot be imported are kept with the error for the lab staff to retry or discard
+* tenantId/hospitalId are known when the test report of the message is found
+ */
+func queueHL7Error(ctx context.Context, raw string, msg *hl7.Message, report map[string]interface{}, via string, cause error) {
+	code, err := GenerateCode(HL7ErrorCollection)
+	if err != nil {
+		log.Println("Error from generateCode: ", err)
+		return
+	}
+	entry := map[string]interface{}{
+		"code":        code,
+		"rawMessage":  raw,
+		"error":       cause.Error(),
+		"status":      HL7_ERROR_STATUS_PENDING,
+		"receivedVia": via,
+		"receivedAt":  time.Now(),
+		"attempts":    1,
+	}
+	if msg != nil {
+		entry["messageType"] = msg.Type()
+		entry["controlId"] = msg.ControlID()
+		entry["source"] = msg.SendingApplication()
+	}
+	if report != nil {
+		entry["testReportId"] = report["code"]
+		entry["tenantId"] = report["tenantId"]
+		entry["hospitalId"] = report["hospitalId"]
+	}
+	collection := db.OpenCollections(HL7ErrorCollection)
+	inserted, err := db.CreateOne(ctx, collection, entry)
+	if err != nil {
+		log.Println("Error from createOne: ", err)
+		return
+	}
+	log.Println("Queued hl7 message: ", inserted.InsertedID)
+}
+
+/*
+* Error queue of the lab, messages without a test report are visible to the super admin only
+ */
+func FetchHL7Errors(c *gin.Context, status string) ([]interface{}, error) {
+	filter, err := labScopeFilter(c)
+	if err != nil {
+		return nil, err
+	}
+	if status != "" {
+		filter["status"] = strings.ToUpper(status)
+	}
+	collection := db.OpenCollections(HL7ErrorCollection)
+	opts := options.Find().SetSort(bson.D{{Key: "receivedAt", Value: -1}})
+	docs, err := db.FindAll(c, collection, filter, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	return docs, nil
+}
+
+func fetchPendingHL7Error(c *gin.Context, code string) (map[string]interface{}, error) {
+	filter, err := labScopeFilter(c)
+	if err != nil {
+		return nil, err
+	}
+	filter["code"] = code
+	entry := make(map[string]interface{})
+	collection := db.OpenCollections(HL7ErrorCollection)
+	if err := db.FindOne(c, collection, filter, entry); err != nil {
+		log.Println("Error from findOne: ", err)
+		return nil, errors.New(HL7_ERROR_NOT_FOUND + code)
+	}
+	if getString(entry["status"]) != HL7_ERROR_STATUS_PENDING {
+		return nil, errors.New(HL7_ERROR_NOT_PENDING + getString(entry["status"]))
+	}
+	return entry, nil
+}
+
+func updateHL7Error(c *gin.Context, code string, update bson.M) (map[string]interface{}, error) {
+	collection := db.OpenCollections(HL7ErrorCollection)
+	filter := bson.M{"code": code}
+	if _, err := db.UpdateOne(c, collection, filter, update); err != nil {
+		log.Println("Error from updateOne: ", err)
+		return nil, err
+	}
+	result := make(map[string]interface{})
+	if err := db.FindOne(c, collection, filter, result); err != nil {
+		log.Println("Error from findOne: ", err)
+		return nil, err
+	}
+	return result, nil
+}
+
+/*
+* Import the queued message again(e.g. after adding the missing code mapping)
+ */
+func RetryHL7Error(c *gin.Context, code string) (map[string]interface{}, error) {
+	entry, err := fetchPendingHL7Error(c, code)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := hl7.Parse(getString(entry["rawMessage"]))
+	if err == nil {
+		_, err = handleHL7Message(c, msg)
+	}
+	if err != nil {
+		log.Println("Error from handleHL7Message: ", err)
+		update := bson.M{
+			"$set": bson.M{"error": err.Error(), "lastAttemptAt": time.Now()},
+			"$inc": bson.M{"attempts": 1},
+		}
+		if _, updateErr := updateHL7Error(c, code, update); updateErr != nil {
+			return nil, updateErr
+		}
+		return nil, err
+	}
+	return updateHL7Error(c, code, bson.M{
+		"$set": bson.M{"status": HL7_ERROR_STATUS_RESOLVED, "resolvedBy": c.GetString("code"), "resolvedAt": time.Now()},
+		"$inc": bson.M{"attempts": 1},
+	})
+}
+
+func DiscardHL7Error(c *gin.Context, code string, data map[string]interface{}) (map[string]interface{}, error) {
+	reason := strings.TrimSpace(getString(data["reason"]))
+	if reason == "" {
+		return nil, errors.New(HL7_DISCARD_REASON_REQUIRED)
+	}
+	if _, err := fetchPendingHL7Error(c, code); err != nil {
+		return nil, err
+	}
+	return updateHL7Error(c, code, bson.M{"$set": bson.M{
+		"status":        HL7_ERROR_STATUS_DISCARDED,
+		"discardReason": reason,
+		"resolvedBy":    c.GetString("code"),
+		"resolvedAt":    time.Now(),
+	}})
+}
+
+/*
+* ORM^O01 new order message for the lab system of a test report
+* OBR-4 uses the mapped external code of the test, our testId when there is no mapping
+* The message is also written to HL7_OUTBOUND_DIR when it is configured
+ */
+func ExportLabOrderORM(c *gin.Context, testReportId string) (map[string]interface{}, error) {
+	report, err := FetchTestReportsofPatientById(c, testReportId)
+	if err != nil {
+		log.Println("Error from fetchTestReportsofPatientById: ", err)
+		return nil, err
+	}
+	patient, err := FetchPatientByCode(c, getString(report["patientId"]))
+	if err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, err
+	}
+	testCode := getString(report["testId"])
+	receivingApp := os.Getenv("HL7_RECEIVING_APPLICATION")
+	mapping := findHL7Mapping(c, getString(report["tenantId"]), receivingApp, bson.M{"testId": testCode, "analyteCode": ""})
+	if mapping != nil {
+		testCode = getString(mapping["externalCode"])
+	}
+
+	gender := strings.ToUpper(getString(patient["gender"]))
+	if gender != "" {
+		gender = gender[:1]
+	}
+	dob := ""
+	if t, ok := toTime(patient["dob"]); ok {
+		dob = t.Format("20060102")
+	} else if t, err := time.Parse(QUERY_DATE_FORMAT, getString(patient["dob"])); err == nil {
+		dob = t.Format("20060102")
+	}
+	collectedAt := ""
+	if t, ok := toTime(report["collectedAt"]); ok {
+		collectedAt = t.Format(hl7.TimeFormat)
+	}
+	placer := hl7.Components(testReportId)
+	filler := hl7.Components(getString(report["accessionNo"]))
+	application, facility := hl7Application()
+	controlId := "ORM" + time.Now().Format(hl7.TimeFormat) + testReportId
+
+	b := &hl7.Builder{}
+	b.Add("MSH", hl7.Header(application, facility, receivingApp, os.Getenv("HL7_RECEIVING_FACILITY"), "ORM^O01", controlId)...)
+	b.Add("PID", "1", "", hl7.Components(getString(patient["code"])), "", hl7.Components(getString(patient["name"])), "", dob, gender)
+	b.Add("ORC", "NW", placer, filler, "", "", "", "", "", time.Now().Format(hl7.TimeFormat), "", "", hl7.Components(getString(report["doctorId"])))
+	b.Add("OBR", "1", placer, filler, hl7.Components(testCode, getString(report["testName"])), "", "", collectedAt,
+		"", "", "", "", "", "", "", hl7.Components(getString(report["specimenType"])), hl7.Components(getString(report["doctorId"])))
+	message := b.String()
+
+	response := map[string]interface{}{
+		"testReportId": testReportId,
+		"controlId":    controlId,
+		"message":      message,
+	}
+	if dir := os.Getenv("HL7_OUTBOUND_DIR"); dir != "" {
+		path := filepath.Join(dir, safeFileName(controlId)+".hl7")
+		if err := os.WriteFile(path, []byte(message), 0644); err != nil {
+			log.Println("Error from writeFile: ", err)
+			return nil, err
+		}
+		response["file"] = path
+	}
+	return response, nil
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+func safeFileName(name string) string {
+	return unsafeFileChars.ReplaceAllString(name, "_")
+}
+
+/*
+* Messages in a dropped file start with MSH, a file can have more than one message
+ */
+func splitHL7Batch(content string) []string {
+	content = strings.ReplaceAll(content, "\r\n", "\r")
+	content = strings.ReplaceAll(content, "\n", "\r")
+	var messages []string
+	var current []string
+	for _, line := range strings.Split(content, "\r") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "MSH") && len(current) > 0 {
+			messages = append(messages, strings.Join(current, "\r"))
+			current = nil
+		}
+		current = append(current, line)
+	}
+	if len(current) > 0 {
+		messages = append(messages, strings.Join(current, "\r"))
+	}
+	return messages
+}
+
+/*
+* Import the .hl7/.txt files of the drop folder
+* Imported files are moved to processed/, files which cannot be read to error/
+* Messages of a file which fail are kept in the error queue
+ */
+func ImportHL7DropFolder(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Println("Error from readDir: ", err)
+		return
+	}
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".hl7" && ext != ".txt") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		target := "processed"
+		content, err := os.ReadFile(path)
+		if err != nil {
+			log.Println("Error from readFile: ", err)
+			target = "error"
+		} else {
+			for _, message := range splitHL7Batch(string(content)) {
+				ProcessHL7Message(context.Background(), message, HL7_VIA_FILE)
+			}
+		}
+		if err := os.MkdirAll(filepath.Join(dir, target), 0755); err != nil {
+			log.Println("Error from mkdirAll: ", err)
+			continue
+		}
+		if err := os.Rename(path, filepath.Join(dir, target, entry.Name())); err != nil {
+			log.Println("Error from rename: ", err)
+		}
+	}
+}
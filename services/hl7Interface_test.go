@@ -0,0 +1,36 @@
+package services
+
+import "testing"
+
+func TestResultsAlreadyApplied(t *testing.T) {
+	report := map[string]interface{}{
+		"status": TEST_REPORT_STATUS_RESULTED,
+		"results": []interface{}{
+			map[string]interface{}{"analyteCode": "HGB", "value": 13.2},
+			map[string]interface{}{"analyteCode": "CULT", "value": "No growth"},
+			map[string]interface{}{"analyteCode": "WBC"},
+		},
+	}
+	entry := func(code string, value string) interface{} {
+		return map[string]interface{}{"analyteCode": code, "value": value}
+	}
+	cases := []struct {
+		name    string
+		status  string
+		entries []interface{}
+		applied bool
+	}{
+		{"same values", TEST_REPORT_STATUS_RESULTED, []interface{}{entry("HGB", "13.20"), entry("CULT", " No growth")}, true},
+		{"changed value", TEST_REPORT_STATUS_RESULTED, []interface{}{entry("HGB", "13.5")}, false},
+		{"analyte without value", TEST_REPORT_STATUS_RESULTED, []interface{}{entry("WBC", "6.1")}, false},
+		{"not resulted yet", TEST_REPORT_STATUS_IN_PROCESS, []interface{}{entry("HGB", "13.2")}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			report["status"] = tc.status
+			if got := resultsAlreadyApplied(report, tc.entries); got != tc.applied {
+				t.Errorf("applied = %v, want %v", got, tc.applied)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	common "github.com/KanapuramVaishnavi/Core/coreServices"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func parseDoseNumber(raw interface{}) (int, error) {
+	var dose int
+	switch v := raw.(type) {
+	case float64:
+		if v != float64(int(v)) {
+			return 0, errors.New(INVALID_DOSE_NUMBER)
+		}
+		dose = int(v)
+	case string:
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return 0, errors.New(INVALID_DOSE_NUMBER)
+		}
+		dose = n
+	default:
+		return 0, errors.New(INVALID_DOSE_NUMBER)
+	}
+	if dose <= 0 {
+		return 0, errors.New(INVALID_DOSE_NUMBER)
+	}
+	return dose, nil
+}
+
+/*
+* administeredDate defaults to today and cannot be in the future
+* nextDueDate is optional and must be after the administeredDate
+ */
+func parseImmunizationDates(data map[string]interface{}) (time.Time, *time.Time, error) {
+	today, _ := time.Parse(QUERY_DATE_FORMAT, time.Now().Format(QUERY_DATE_FORMAT))
+	administered := today
+	if raw := strings.TrimSpace(getString(data["administeredDate"])); raw != "" {
+		parsed, err := time.Parse(QUERY_DATE_FORMAT, raw)
+		if err != nil || parsed.After(today) {
+			return time.Time{}, nil, errors.New(INVALID_ADMINISTERED_DATE)
+		}
+		administered = parsed
+	}
+	raw := strings.TrimSpace(getString(data["nextDueDate"]))
+	if raw == "" {
+		return administered, nil, nil
+	}
+	nextDue, err := time.Parse(QUERY_DATE_FORMAT, raw)
+	if err != nil || !nextDue.After(administered) {
+		return time.Time{}, nil, errors.New(INVALID_NEXT_DUE_DATE)
+	}
+	return administered, &nextDue, nil
+}
+
+/*
+* Record a dose{vaccine, doseNumber, lotNumber, administeredDate, nextDueDate, site, notes}
+* A dose number of a vaccine can be recorded only once
+* Earlier doses of the vaccine are completed by this dose, so their nextDueDate is not reminded anymore
+ */
+func CreateImmunization(c *gin.Context, patientId string, data map[string]interface{}) (string, error) {
+	patient, err := FetchPatientByCode(c, patientId)
+	if err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return "", err
+	}
+	if err := verifyClinicalStaff(c, patient); err != nil {
+		return "", err
+	}
+	for _, field := range []string{"vaccine", "lotNumber"} {
+		if err := common.GetTrimmedString(data, field); err != nil {
+			log.Println("Error from getTrimmedString: ", err)
+			return "", err
+		}
+	}
+	vaccine := strings.ToUpper(getString(data["vaccine"]))
+	doseNumber, err := parseDoseNumber(data["doseNumber"])
+	if err != nil {
+		return "", err
+	}
+	administered, nextDue, err := parseImmunizationDates(data)
+	if err != nil {
+		return "", err
+	}
+	collection := db.OpenCollections(ImmunizationCollection)
+	existing := make(map[string]interface{})
+	if err := db.FindOne(c, collection, bson.M{"patientId": patientId, "vaccine": vaccine, "doseNumber": doseNumber}, existing); err == nil {
+		return "", errors.New(IMMUNIZATION_ALREADY_RECORDED + fmt.Sprintf("%s dose %d(%s)", vaccine, doseNumber, getString(existing["code"])))
+	}
+	code, err := GenerateCode(ImmunizationCollection)
+	if err != nil {
+		log.Println("Error from generateCode: ", err)
+		return "", err
+	}
+	immunization := map[string]interface{}{
+		"code":             code,
+		"patientId":        patientId,
+		"vaccine":          vaccine,
+		"doseNumber":       doseNumber,
+		"lotNumber":        data["lotNumber"],
+		"administeredDate": administered,
+		"hospitalId":       patient["hospitalId"],
+		"tenantId":         patient["tenantId"],
+		"administeredBy":   c.GetString("code"),
+		"createdAt":        time.Now(),
+	}
+	if nextDue != nil {
+		immunization["nextDueDate"] = *nextDue
+	}
+	for _, field := range []string{"site", "notes"} {
+		if value := strings.TrimSpace(getString(data[field])); value != "" {
+			immunization[field] = value
+		}
+	}
+	if _, err := db.CreateOne(c, collection, immunization); err != nil {
+		log.Println("Error from createOne: ", err)
+		return "", err
+	}
+	earlier := bson.M{
+		"patientId":       patientId,
+		"vaccine":         vaccine,
+		"doseNumber":      bson.M{"$lt": doseNumber},
+		"completedByDose": bson.M{"$exists": false},
+	}
+	if _, err := db.UpdateMany(c, collection, earlier, bson.M{"$set": bson.M{"completedByDose": code}}, nil); err != nil {
+		log.Println("Error from updateMany: ", err)
+	}
+	return code, nil
+}
+
+/*
+* Immunization history of the patient grouped by vaccine in dose order
+ */
+func FetchImmunizations(c *gin.Context, patientId string) ([]interface{}, error) {
+	if _, err := FetchPatientByCode(c, patientId); err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, err
+	}
+	collection := db.OpenCollections(ImmunizationCollection)
+	opts := options.Find().SetSort(bson.D{{Key: "vaccine", Value: 1}, {Key: "doseNumber", Value: 1}})
+	immunizations, err := db.FindAll(c, collection, bson.M{"patientId": patientId}, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	return immunizations, nil
+}
+
+func dueImmunizationFilter(days int) bson.M {
+	return bson.M{
+		"nextDueDate":     bson.M{"$lte": time.Now().AddDate(0, 0, days)},
+		"completedByDose": bson.M{"$exists": false},
+	}
+}
+
+/*
+* Doses due(or overdue) in the next days(default VACCINE_REMINDER_DAYS) for the hospital
+ */
+func FetchDueImmunizations(c *gin.Context, days string) ([]interface{}, error) {
+	filter, err := labScopeFilter(c)
+	if err != nil {
+		return nil, err
+	}
+	within := VACCINE_REMINDER_DAYS
+	if days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return nil, errors.New(INVALID_DUE_DAYS)
+		}
+		within = n
+	}
+	for key, value := range dueImmunizationFilter(within) {
+		filter[key] = value
+	}
+	collection := db.OpenCollections(ImmunizationCollection)
+	opts := options.Find().SetSort(bson.D{{Key: "nextDueDate", Value: 1}})
+	due, err := db.FindAll(c, collection, filter, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	return due, nil
+}
+
+/*
+* Emails of the patient and the guardians of the patient
+ */
+func patientContactEmails(c context.Context, patient map[string]interface{}) []string {
+	emails := []string{}
+	if email := getString(patient["email"]); email != "" {
+		emails = append(emails, email)
+	}
+	guardians, err := FetchGuardians(patient)
+	if err != nil {
+		return emails
+	}
+	guardianColl := db.OpenCollections(util.GuardianCollection)
+	for _, guardianId := range guardians {
+		guardian := make(map[string]interface{})
+		if err := db.FindOne(c, guardianColl, bson.M{"code": guardianId}, guardian); err != nil {
+			log.Println("Error from findOne(guardian): ", err)
+			continue
+		}
+		if email := getString(guardian["email"]); email != "" {
+			emails = append(emails, email)
+		}
+	}
+	return emails
+}
+
+/*
+* Daily job: remind the patient and the guardians about the doses due in VACCINE_REMINDER_DAYS
+* A dose is reminded only once, reminderSentAt is set after the mail is sent
+ */
+func SendImmunizationReminders(c context.Context) (int, error) {
+	filter := dueImmunizationFilter(VACCINE_REMINDER_DAYS)
+	filter["reminderSentAt"] = bson.M{"$exists": false}
+	collection := db.OpenCollections(ImmunizationCollection)
+	due, err := db.FindAll(c, collection, filter, nil)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return 0, err
+	}
+	patientColl := db.OpenCollections(util.PatientCollection)
+	sent := 0
+	for _, d := range due {
+		immunization, ok := d.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		patient := make(map[string]interface{})
+		if err := db.FindOne(c, patientColl, bson.M{"code": immunization["patientId"]}, patient); err != nil {
+			log.Println("Error from findOne(patient): ", err)
+			continue
+		}
+		emails := patientContactEmails(c, patient)
+		if len(emails) == 0 {
+			log.Println("Patient and guardians donot have email for the vaccine reminder: ", getString(patient["code"]))
+			continue
+		}
+		dueOn, _ := FormatedDateAndTime(immunization["nextDueDate"])
+		subject := "Vaccination due reminder"
+		body := fmt.Sprintf("Hello,\n\nThe next dose of %s for %s is due on %s. Please visit the hospital to get it.\n\nThank you!",
+			getString(immunization["vaccine"]), getString(patient["name"]), dueOn)
+		for _, email := range emails {
+			if err := common.SendOTPToMail(email, subject, body); err != nil {
+				log.Println("Vaccine reminder mail failed: ", err)
+			}
+		}
+		if _, err := db.UpdateOne(c, collection, bson.M{"code": immunization["code"]}, bson.M{"$set": bson.M{"reminderSentAt": time.Now()}}); err != nil {
+			log.Println("Error from updateOne: ", err)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
@@ -0,0 +1,395 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+* Hospital of the logged-in staff(nurse, doctor, pharmacist...) is the createdBy of the user
+ */
+func fetchStaffHospital(c *gin.Context) (string, error) {
+	user := make(map[string]interface{})
+	collection := db.OpenCollections(c.GetString("collection"))
+	err := db.FindOne(c, collection, bson.M{"code": c.GetString("code")}, user)
+	if err != nil {
+		log.Println("Error from findOne: ", err)
+		return "", err
+	}
+	hospitalId, ok := user["createdBy"].(string)
+	if !ok || hospitalId == "" {
+		return "", errors.New(UNABLE_TO_FETCH_HOSPITAL_ID)
+	}
+	return hospitalId, nil
+}
+
+func fetchSpecimenByAccession(c context.Context, accessionNo string) (map[string]interface{}, error) {
+	specimen := make(map[string]interface{})
+	collection := db.OpenCollections(SpecimenCollection)
+	err := db.FindOne(c, collection, bson.M{"code": accessionNo}, specimen)
+	if err != nil {
+		log.Println("Error from findOne: ", err)
+		return nil, errors.New(SPECIMEN_NOT_FOUND + accessionNo)
+	}
+	return specimen, nil
+}
+
+/*
+* Move the specimen on only from the expected status, a concurrent step on the same specimen doesnot match
+ */
+func updateSpecimen(c context.Context, accessionNo string, expected string, set bson.M) error {
+	collection := db.OpenCollections(SpecimenCollection)
+	result, err := db.UpdateOne(c, collection, bson.M{"code": accessionNo, "status": expected}, bson.M{"$set": set})
+	if err != nil {
+		log.Println("Error from updateOne: ", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		current, err := fetchSpecimenByAccession(c, accessionNo)
+		if err != nil {
+			return err
+		}
+		return errors.New(INVALID_SAMPLE_STATUS + getString(current["status"]))
+	}
+	return nil
+}
+
+/*
+* Put back the fields of the specimen changed by updateSpecimen when the test report could not follow
+ */
+func restoreSpecimen(c context.Context, accessionNo string, previous map[string]interface{}, set bson.M) {
+	restore := bson.M{}
+	unset := bson.M{}
+	for key := range set {
+		if value, ok := previous[key]; ok {
+			restore[key] = value
+		} else {
+			unset[key] = ""
+		}
+	}
+	update := bson.M{"$set": restore}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	collection := db.OpenCollections(SpecimenCollection)
+	_, err := db.UpdateOne(c, collection, bson.M{"code": accessionNo, "status": set["status"]}, update)
+	if err != nil {
+		log.Println("Error from updateOne(restore specimen): ", err)
+	}
+}
+
+/*
+* Fetch the specimen and its test report with the access check
+* The test report must be in the expected status for the step
+ */
+func specimenForStep(c *gin.Context, accessionNo string, expected string) (map[string]interface{}, map[string]interface{}, error) {
+	specimen, err := fetchSpecimenByAccession(c, accessionNo)
+	if err != nil {
+		return nil, nil, err
+	}
+	report, err := FetchTestReportsofPatientById(c, getString(specimen["testReportId"]))
+	if err != nil {
+		log.Println("Error from fetchTestReportsofPatientById: ", err)
+		return nil, nil, err
+	}
+	if getString(specimen["status"]) == SPECIMEN_STATUS_REJECTED || getString(report["accessionNo"]) != accessionNo {
+		return nil, nil, errors.New(SPECIMEN_ALREADY_REJECTED)
+	}
+	if getString(report["status"]) != expected {
+		return nil, nil, errors.New(INVALID_SAMPLE_STATUS + getString(report["status"]))
+	}
+	return specimen, report, nil
+}
+
+/*
+* Collect the specimen of an ordered test
+* A new accession number is generated for every collection(also for a recollection)
+ */
+func CollectSample(c *gin.Context, testReportId string) (map[string]interface{}, error) {
+	report, err := FetchTestReportsofPatientById(c, testReportId)
+	if err != nil {
+		log.Println("Error from fetchTestReportsofPatientById: ", err)
+		return nil, err
+	}
+	if getString(report["status"]) != TEST_REPORT_STATUS_ORDERED {
+		return nil, errors.New(INVALID_SAMPLE_STATUS + getString(report["status"]))
+	}
+	accessionNo, err := GenerateCode(SpecimenCollection)
+	if err != nil {
+		log.Println("Error from generateCode: ", err)
+		return nil, err
+	}
+	userId := c.GetString("code")
+	specimen := map[string]interface{}{
+		"code":         accessionNo,
+		"testReportId": testReportId,
+		"testId":       report["testId"],
+		"testName":     report["testName"],
+		"specimenType": report["specimenType"],
+		"patientId":    report["patientId"],
+		"hospitalId":   report["hospitalId"],
+		"tenantId":     report["tenantId"],
+		"status":       SPECIMEN_STATUS_COLLECTED,
+		"collectedBy":  userId,
+		"collectedAt":  time.Now(),
+	}
+	if previous := getString(report["accessionNo"]); previous != "" {
+		specimen["recollectionOf"] = previous
+	}
+	collection := db.OpenCollections(SpecimenCollection)
+	inserted, err := db.CreateOne(c, collection, specimen)
+	if err != nil {
+		log.Println("Error from createOne: ", err)
+		return nil, err
+	}
+	log.Println("Inserted specimen: ", inserted.InsertedID)
+	set := bson.M{
+		"status":               TEST_REPORT_STATUS_COLLECTED,
+		"accessionNo":          accessionNo,
+		"recollectionRequired": false,
+		"collectedBy":          userId,
+		"collectedAt":          time.Now(),
+		"updatedBy":            userId,
+		"updatedAt":            time.Now(),
+	}
+	updated, err := saveTestReport(c, testReportId, bson.M{"status": TEST_REPORT_STATUS_ORDERED}, set, userId, "")
+	if err != nil {
+		if _, err := db.DeleteOne(c, collection, bson.M{"code": accessionNo}); err != nil {
+			log.Println("Error from deleteOne(specimen): ", err)
+		}
+		return nil, err
+	}
+	return updated, nil
+}
+
+/*
+* Lab receives the collected specimen, the result is due turnaroundHours after receiving
+ */
+func ReceiveSample(c *gin.Context, accessionNo string) (map[string]interface{}, error) {
+	specimen, report, err := specimenForStep(c, accessionNo, TEST_REPORT_STATUS_COLLECTED)
+	if err != nil {
+		return nil, err
+	}
+	userId := c.GetString("code")
+	specimenSet := bson.M{"status": SPECIMEN_STATUS_RECEIVED, "receivedBy": userId, "receivedAt": time.Now()}
+	if err := updateSpecimen(c, accessionNo, SPECIMEN_STATUS_COLLECTED, specimenSet); err != nil {
+		return nil, err
+	}
+	set := bson.M{
+		"status":     TEST_REPORT_STATUS_RECEIVED,
+		"receivedBy": userId,
+		"receivedAt": time.Now(),
+		"updatedBy":  userId,
+		"updatedAt":  time.Now(),
+	}
+	if hours := toInt(report["turnaroundHours"]); hours > 0 {
+		set["dueAt"] = time.Now().Add(time.Duration(hours) * time.Hour)
+	}
+	expected := bson.M{"status": TEST_REPORT_STATUS_COLLECTED, "accessionNo": accessionNo}
+	updated, err := saveTestReport(c, getString(report["code"]), expected, set, userId, "")
+	if err != nil {
+		restoreSpecimen(c, accessionNo, specimen, specimenSet)
+		return nil, err
+	}
+	return updated, nil
+}
+
+/*
+* Lab starts processing the received specimen, results can be entered after this
+ */
+func StartSampleProcessing(c *gin.Context, accessionNo string) (map[string]interface{}, error) {
+	specimen, report, err := specimenForStep(c, accessionNo, TEST_REPORT_STATUS_RECEIVED)
+	if err != nil {
+		return nil, err
+	}
+	userId := c.GetString("code")
+	specimenSet := bson.M{"status": SPECIMEN_STATUS_IN_PROCESS, "processedBy": userId, "processingAt": time.Now()}
+	if err := updateSpecimen(c, accessionNo, SPECIMEN_STATUS_RECEIVED, specimenSet); err != nil {
+		return nil, err
+	}
+	set := bson.M{
+		"status":       TEST_REPORT_STATUS_IN_PROCESS,
+		"processedBy":  userId,
+		"processingAt": time.Now(),
+		"updatedBy":    userId,
+		"updatedAt":    time.Now(),
+	}
+	expected := bson.M{"status": TEST_REPORT_STATUS_RECEIVED, "accessionNo": accessionNo}
+	updated, err := saveTestReport(c, getString(report["code"]), expected, set, userId, "")
+	if err != nil {
+		restoreSpecimen(c, accessionNo, specimen, specimenSet)
+		return nil, err
+	}
+	return updated, nil
+}
+
+/*
+* Reject the specimen(e.g. HEMOLYSED, INSUFFICIENT) before the results are entered
+* The test report goes back to ORDERED with recollectionRequired so it shows up to collect again
+ */
+func RejectSample(c *gin.Context, accessionNo string, data map[string]interface{}) (map[string]interface{}, error) {
+	reason := strings.ToUpper(strings.TrimSpace(getString(data["reason"])))
+	if !slices.Contains(SampleRejectionReasons, reason) {
+		return nil, errors.New(INVALID_SAMPLE_REJECTION_REASON)
+	}
+	specimen, err := fetchSpecimenByAccession(c, accessionNo)
+	if err != nil {
+		return nil, err
+	}
+	report, err := FetchTestReportsofPatientById(c, getString(specimen["testReportId"]))
+	if err != nil {
+		log.Println("Error from fetchTestReportsofPatientById: ", err)
+		return nil, err
+	}
+	status := getString(report["status"])
+	if getString(specimen["status"]) == SPECIMEN_STATUS_REJECTED || getString(report["accessionNo"]) != accessionNo {
+		return nil, errors.New(SPECIMEN_ALREADY_REJECTED)
+	}
+	if status != TEST_REPORT_STATUS_COLLECTED && status != TEST_REPORT_STATUS_RECEIVED && status != TEST_REPORT_STATUS_IN_PROCESS {
+		return nil, errors.New(INVALID_SAMPLE_STATUS + status)
+	}
+	userId := c.GetString("code")
+	note := getString(data["note"])
+	rejection := map[string]interface{}{
+		"reason":     reason,
+		"note":       note,
+		"rejectedBy": userId,
+		"rejectedAt": time.Now(),
+	}
+	specimenSet := bson.M{"status": SPECIMEN_STATUS_REJECTED, "rejection": rejection}
+	if err := updateSpecimen(c, accessionNo, getString(specimen["status"]), specimenSet); err != nil {
+		return nil, err
+	}
+	set := bson.M{
+		"status":               TEST_REPORT_STATUS_ORDERED,
+		"recollectionRequired": true,
+		"sampleRejection":      rejection,
+		"updatedBy":            userId,
+		"updatedAt":            time.Now(),
+	}
+	expected := bson.M{"status": status, "accessionNo": accessionNo}
+	updated, err := saveTestReport(c, getString(report["code"]), expected, set, userId, reason+" "+note)
+	if err != nil {
+		restoreSpecimen(c, accessionNo, specimen, specimenSet)
+		return nil, err
+	}
+	return updated, nil
+}
+
+/*
+* Filter on tenantId/hospitalId for the logged-in user, patients and guardians are not allowed
+ */
+func labScopeFilter(c *gin.Context) (bson.M, error) {
+	code := c.GetString("code")
+	ctxCollection := c.GetString("collection")
+	filter := bson.M{}
+	if c.GetBool("isSuperAdmin") {
+		return filter, nil
+	}
+	switch ctxCollection {
+	case util.TenantCollection:
+		filter["tenantId"] = code
+	case util.HospitalCollection:
+		filter["hospitalId"] = code
+	case util.PatientCollection, util.GuardianCollection:
+		return nil, errors.New(util.INVALID_USER_TO_ACCESS)
+	default:
+		hospitalId, err := fetchStaffHospital(c)
+		if err != nil {
+			return nil, err
+		}
+		filter["hospitalId"] = hospitalId
+	}
+	return filter, nil
+}
+
+/*
+* Lab worklist: test reports of the hospital waiting for collection, receiving, processing or entry
+* Optional filters status and specimenType, sorted by the due time and then the order time
+ */
+func FetchLabWorklist(c *gin.Context, status string, specimenType string) ([]interface{}, error) {
+	filter, err := labScopeFilter(c)
+	if err != nil {
+		return nil, err
+	}
+	pending := []string{TEST_REPORT_STATUS_ORDERED, TEST_REPORT_STATUS_COLLECTED, TEST_REPORT_STATUS_RECEIVED, TEST_REPORT_STATUS_IN_PROCESS}
+	if status != "" {
+		status = strings.ToUpper(status)
+		if !slices.Contains(pending, status) {
+			return nil, errors.New(INVALID_SAMPLE_STATUS + status)
+		}
+		filter["status"] = status
+	} else {
+		filter["status"] = bson.M{"$in": pending}
+	}
+	if specimenType != "" {
+		filter["specimenType"] = strings.ToUpper(specimenType)
+	}
+	collection := db.OpenCollections(util.TestReportCollection)
+	opts := options.Find().SetSort(bson.D{{Key: "dueAt", Value: 1}, {Key: "createdAt", Value: 1}})
+	docs, err := db.FindAll(c, collection, filter, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	return docs, nil
+}
+
+/*
+* Printable label for the collected specimen with the accession number as a QR code
+ */
+func GenerateSpecimenLabel(c *gin.Context, accessionNo string) ([]string, error) {
+	specimen, err := fetchSpecimenByAccession(c, accessionNo)
+	if err != nil {
+		return nil, err
+	}
+	report, err := FetchTestReportsofPatientById(c, getString(specimen["testReportId"]))
+	if err != nil {
+		log.Println("Error from fetchTestReportsofPatientById: ", err)
+		return nil, err
+	}
+	patient, err := FetchPatientByCode(c, getString(report["patientId"]))
+	if err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, err
+	}
+	barcode, err := GenerateLocalQRCode(accessionNo)
+	if err != nil {
+		log.Println("Error from generateLocalQRCode: ", err)
+		return nil, err
+	}
+	collectedAt, _ := FormatedDateAndTime(specimen["collectedAt"])
+	data := map[string]interface{}{
+		"AccessionNo":  accessionNo,
+		"Barcode":      template.URL(barcode),
+		"PatientName":  patient["name"],
+		"PatientID":    patient["code"],
+		"Age":          patient["age"],
+		"Gender":       patient["gender"],
+		"TestName":     specimen["testName"],
+		"SpecimenType": specimen["specimenType"],
+		"CollectedAt":  collectedAt,
+		"CollectedBy":  specimen["collectedBy"],
+	}
+	htmlPath := fmt.Sprintf("label_%s.html", accessionNo)
+	pdfPath := fmt.Sprintf("%s_label.pdf", accessionNo)
+	err = GenerateHTMLToPDF("./templates/specimenLabel.html", data, htmlPath, pdfPath)
+	if err != nil {
+		log.Println("Error from generateHTMLToPDF: ", err)
+		return nil, err
+	}
+	return []string{pdfPath}, nil
+}
@@ -0,0 +1,398 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/url"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var signedLabReportFields = []string{
+	"code", "testId", "testName", "patientId", "doctorId", "hospitalId", "tenantId", "accessionNo",
+	"resultedBy", "verifiedBy", "verifiedAt",
+}
+
+var signedResultFields = []string{"analyteCode", "analyteName", "unit", "referenceRange", "value", "flag", "comment"}
+
+/*
+* Signatures before version 2 did not cover the comment of the result rows
+ */
+var legacyResultFields = []string{"analyteCode", "analyteName", "unit", "referenceRange", "value", "flag"}
+
+/*
+* Canonical serialization of the released report, only the printed values of the results are signed
+* The fields follow the version of the signature on the report, a report being signed uses the current version
+ */
+func CanonicalLabReport(report map[string]interface{}) ([]byte, error) {
+	resultFields := signedResultFields
+	if signature, ok := report["signature"].(map[string]interface{}); ok && toInt(signature["version"]) < LAB_REPORT_SIGNATURE_VERSION {
+		resultFields = legacyResultFields
+	}
+	payload := make(map[string]interface{})
+	for _, field := range signedLabReportFields {
+		if value, exists := report[field]; exists && value != nil {
+			payload[field] = canonicalValue(value)
+		}
+	}
+	var results []interface{}
+	for _, r := range toList(report["results"]) {
+		row, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		item := make(map[string]interface{})
+		for _, field := range resultFields {
+			if value, exists := row[field]; exists && value != nil {
+				item[field] = canonicalValue(value)
+			}
+		}
+		results = append(results, item)
+	}
+	payload["results"] = results
+	return json.Marshal(payload)
+}
+
+/*
+* User who verified the report, older reports without verifiedByCollection are looked up in the doctors
+ */
+func fetchVerifier(c context.Context, report map[string]interface{}) (map[string]interface{}, error) {
+	collName := getString(report["verifiedByCollection"])
+	if collName == "" {
+		collName = util.DoctorCollection
+	}
+	verifier := make(map[string]interface{})
+	err := db.FindOne(c, db.OpenCollections(collName), bson.M{"code": report["verifiedBy"]}, verifier)
+	if err != nil {
+		log.Println("Error from findOne(verifier): ", err)
+		return nil, err
+	}
+	return verifier, nil
+}
+
+/*
+* Sign the verified report with the signing key of the verifier
+* The signature is saved on the report so every download carries the same signature
+* The report is read again from mongo, the cached copy has the dates as json strings which donot
+* give the same canonical bytes as the dates read back at the verification
+* When another download signed the report meanwhile, its signature is kept
+ */
+func signLabReport(c *gin.Context, cached map[string]interface{}) (map[string]interface{}, error) {
+	if _, ok := cached["signature"].(map[string]interface{}); ok {
+		return cached, nil
+	}
+	report := make(map[string]interface{})
+	if err := db.FindOne(c, db.OpenCollections(util.TestReportCollection), bson.M{"code": cached["code"]}, report); err != nil {
+		log.Println("Error from findOne: ", err)
+		return nil, err
+	}
+	if _, ok := report["signature"].(map[string]interface{}); ok {
+		return report, nil
+	}
+	verifier, err := fetchVerifier(c, report)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := CanonicalLabReport(report)
+	if err != nil {
+		log.Println("Error from canonicalLabReport: ", err)
+		return nil, err
+	}
+	signature, err := signPayload(c, verifier, payload)
+	if err != nil {
+		log.Println("Error from signPayload: ", err)
+		return nil, err
+	}
+	signature["version"] = LAB_REPORT_SIGNATURE_VERSION
+	set := bson.M{"signature": signature}
+	expected := bson.M{"status": TEST_REPORT_STATUS_VERIFIED, "signature": bson.M{"$exists": false}}
+	signed, err := saveTestReport(c, getString(report["code"]), expected, set, c.GetString("code"), "")
+	if err != nil {
+		current := make(map[string]interface{})
+		if db.FindOne(c, db.OpenCollections(util.TestReportCollection), bson.M{"code": report["code"]}, current) == nil {
+			if _, ok := current["signature"].(map[string]interface{}); ok {
+				return current, nil
+			}
+		}
+		return nil, err
+	}
+	return signed, nil
+}
+
+func LabReportVerificationURL(report map[string]interface{}) string {
+	signature, _ := report["signature"].(map[string]interface{})
+	base := publicBaseURL()
+	return fmt.Sprintf("%s/verify/labReport/%s?token=%s", base, url.PathEscape(getString(report["code"])), verificationToken(getString(signature["value"])))
+}
+
+/*
+* Public verification of a printed lab report(from the QR code)
+* The results are returned to compare with the printed copy, the patient details are not
+ */
+func VerifyLabReport(c *gin.Context, testReportId string, token string) (map[string]interface{}, error) {
+	report := make(map[string]interface{})
+	collection := db.OpenCollections(util.TestReportCollection)
+	err := db.FindOne(c, collection, bson.M{"code": testReportId}, report)
+	if err != nil {
+		log.Println("Error from findOne: ", err)
+		return nil, errors.New(INVALID_LAB_REPORT_VERIFICATION)
+	}
+	signature, ok := report["signature"].(map[string]interface{})
+	if !ok || token != verificationToken(getString(signature["value"])) {
+		return nil, errors.New(INVALID_LAB_REPORT_VERIFICATION)
+	}
+	result := map[string]interface{}{
+		"testReportId": report["code"],
+		"testName":     report["testName"],
+		"accessionNo":  report["accessionNo"],
+		"verifiedAt":   report["verifiedAt"],
+		"keyId":        signature["keyId"],
+		"signedAt":     signature["signedAt"],
+		"payloadHash":  signature["payloadHash"],
+		"isValid":      false,
+	}
+	payload, err := CanonicalLabReport(report)
+	if err != nil {
+		log.Println("Error from canonicalLabReport: ", err)
+		return nil, err
+	}
+	signingKey, reason := checkSignature(c, signature, payload)
+	if reason != "" {
+		result["reason"] = reason
+		return result, nil
+	}
+	if getString(signingKey["doctorId"]) != getString(report["verifiedBy"]) {
+		result["reason"] = SIGNING_KEY_NOT_OF_SIGNER
+		return result, nil
+	}
+	result["isValid"] = true
+	if verifier, err := fetchVerifier(c, report); err == nil {
+		result["verifiedBy"] = verifier["name"]
+	}
+	hospital := make(map[string]interface{})
+	if err := db.FindOne(c, db.OpenCollections(util.HospitalCollection), bson.M{"code": report["hospitalId"]}, hospital); err == nil {
+		result["hospitalName"] = hospital["name"]
+	}
+	var results []map[string]interface{}
+	for _, r := range toList(report["results"]) {
+		if row, ok := r.(map[string]interface{}); ok {
+			results = append(results, map[string]interface{}{
+				"analyteName": row["analyteName"],
+				"value":       row["value"],
+				"unit":        row["unit"],
+				"flag":        row["flag"],
+			})
+		}
+	}
+	result["results"] = results
+	return result, nil
+}
+
+/*
+* Printed reference range e.g. 12 - 16, < 200, > 40
+ */
+func describeReferenceRange(raw interface{}) string {
+	refRange, ok := raw.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	low, hasLow := resultNumber(refRange["low"])
+	high, hasHigh := resultNumber(refRange["high"])
+	switch {
+	case hasLow && hasHigh:
+		return fmt.Sprintf("%g - %g", low, high)
+	case hasHigh:
+		return fmt.Sprintf("< %g", high)
+	case hasLow:
+		return fmt.Sprintf("> %g", low)
+	default:
+		return ""
+	}
+}
+
+func describeResultValue(value interface{}) string {
+	if number, ok := value.(float64); ok {
+		return fmt.Sprintf("%g", number)
+	}
+	return getString(value)
+}
+
+/*
+* Page data of one verified report(a section of the printed lab report)
+ */
+func labReportSection(c *gin.Context, report map[string]interface{}, sign bool) (map[string]interface{}, error) {
+	if getString(report["status"]) != TEST_REPORT_STATUS_VERIFIED {
+		return nil, errors.New(TEST_REPORT_NOT_VERIFIED + getString(report["code"]))
+	}
+	var err error
+	if sign {
+		report, err = signLabReport(c, report)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var rows []map[string]interface{}
+	for _, r := range toList(report["results"]) {
+		row, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		flag := getString(row["flag"])
+		rows = append(rows, map[string]interface{}{
+			"AnalyteName":    row["analyteName"],
+			"Value":          describeResultValue(row["value"]),
+			"Unit":           row["unit"],
+			"ReferenceRange": describeReferenceRange(row["referenceRange"]),
+			"Flag":           flag,
+			"IsAbnormal":     flag != "" && flag != RESULT_FLAG_NORMAL,
+			"IsCritical":     row["isCritical"] == true,
+			"Comment":        row["comment"],
+		})
+	}
+	verifierName := getString(report["verifiedBy"])
+	if verifier, err := fetchVerifier(c, report); err == nil {
+		verifierName = getString(verifier["name"])
+	}
+	collectedAt, _ := FormatedDateAndTime(report["collectedAt"])
+	receivedAt, _ := FormatedDateAndTime(report["receivedAt"])
+	verifiedAt, _ := FormatedDateAndTime(report["verifiedAt"])
+	section := map[string]interface{}{
+		"TestReportID": report["code"],
+		"TestName":     report["testName"],
+		"AccessionNo":  report["accessionNo"],
+		"SpecimenType": report["specimenType"],
+		"CollectedAt":  collectedAt,
+		"ReceivedAt":   receivedAt,
+		"Results":      rows,
+		"VerifiedBy":   verifierName,
+		"VerifiedAt":   verifiedAt,
+	}
+	if signature, ok := report["signature"].(map[string]interface{}); ok && sign {
+		verificationURL := LabReportVerificationURL(report)
+		qr, err := GenerateLocalQRCode(verificationURL)
+		if err != nil {
+			log.Println("Error from generateLocalQRCode: ", err)
+			return nil, err
+		}
+		section["Signed"] = true
+		section["KeyID"] = signature["keyId"]
+		section["PayloadHash"] = signature["payloadHash"]
+		section["VerificationQR"] = template.URL(qr)
+		section["VerificationURL"] = verificationURL
+	}
+	return section, nil
+}
+
+/*
+* Header of the printed lab report, the reports of an order belong to the same patient
+ */
+func labReportPage(c *gin.Context, report map[string]interface{}, sections []map[string]interface{}) (map[string]interface{}, error) {
+	patient, err := FetchPatientByCode(c, getString(report["patientId"]))
+	if err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, err
+	}
+	hospital := make(map[string]interface{})
+	if err := db.FindOne(c, db.OpenCollections(util.HospitalCollection), bson.M{"code": report["hospitalId"]}, hospital); err != nil {
+		log.Println("Error from findOne(hospital): ", err)
+	}
+	doctor := make(map[string]interface{})
+	if err := db.FindOne(c, db.OpenCollections(util.DoctorCollection), bson.M{"code": report["doctorId"]}, doctor); err != nil {
+		log.Println("Error from findOne(doctor): ", err)
+	}
+	printedAt, _ := FormatedDateAndTime(time.Now())
+	return map[string]interface{}{
+		"HospitalName":    hospital["name"],
+		"HospitalAddress": hospital["address"],
+		"HospitalContact": hospital["phoneNo"],
+		"PatientName":     patient["name"],
+		"PatientID":       patient["code"],
+		"Age":             patient["age"],
+		"Gender":          patient["gender"],
+		"DoctorName":      doctor["name"],
+		"PrintedAt":       printedAt,
+		"Reports":         sections,
+	}, nil
+}
+
+/*
+* Printable lab report of a verified test report
+* sign adds the digital signature of the verifier with a QR code to verify the printed copy
+ */
+func GenerateLabReportPDF(c *gin.Context, testReportId string, sign bool) ([]string, error) {
+	report, err := FetchTestReportByCode(c, testReportId)
+	if err != nil {
+		log.Println("Error from fetchTestReportByCode: ", err)
+		return nil, err
+	}
+	section, err := labReportSection(c, report, sign)
+	if err != nil {
+		return nil, err
+	}
+	data, err := labReportPage(c, report, []map[string]interface{}{section})
+	if err != nil {
+		return nil, err
+	}
+	htmlPath := fmt.Sprintf("labReport_%s.html", testReportId)
+	pdfPath := fmt.Sprintf("%s_labReport.pdf", testReportId)
+	if err := GenerateHTMLToPDF("./templates/labReport.html", data, htmlPath, pdfPath); err != nil {
+		log.Println("Error from generateHTMLToPDF: ", err)
+		return nil, err
+	}
+	return []string{pdfPath}, nil
+}
+
+/*
+* Printable lab report of all the verified test reports ordered in a medical record
+* Reports which are not verified yet are left out
+ */
+func GenerateLabOrderPDF(c *gin.Context, medicalRecordId string, sign bool) ([]string, error) {
+	medicalRecord, err := FetchMedicalRecordByCode(c, medicalRecordId)
+	if err != nil {
+		log.Println("Error from fetchMedicalRecordByCode: ", err)
+		return nil, err
+	}
+	var first map[string]interface{}
+	var sections []map[string]interface{}
+	for _, id := range toList(medicalRecord["testReports"]) {
+		report, err := FetchTestReportByCode(c, getString(id))
+		if err != nil {
+			log.Println("Error from fetchTestReportByCode: ", err)
+			return nil, err
+		}
+		if getString(report["status"]) != TEST_REPORT_STATUS_VERIFIED {
+			continue
+		}
+		section, err := labReportSection(c, report, sign)
+		if err != nil {
+			return nil, err
+		}
+		if first == nil {
+			first = report
+		}
+		sections = append(sections, section)
+	}
+	if len(sections) == 0 {
+		return nil, errors.New(NO_VERIFIED_TEST_REPORTS)
+	}
+	data, err := labReportPage(c, first, sections)
+	if err != nil {
+		return nil, err
+	}
+	htmlPath := fmt.Sprintf("labOrder_%s.html", medicalRecordId)
+	pdfPath := fmt.Sprintf("%s_labReport.pdf", medicalRecordId)
+	if err := GenerateHTMLToPDF("./templates/labReport.html", data, htmlPath, pdfPath); err != nil {
+		log.Println("Error from generateHTMLToPDF: ", err)
+		return nil, err
+	}
+	return []string{pdfPath}, nil
+}
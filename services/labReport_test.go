@@ -0,0 +1,52 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func sampleLabReport(verifiedAt time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"code":       "TR1",
+		"testId":     "T1",
+		"patientId":  "P1",
+		"verifiedBy": "D1",
+		"verifiedAt": verifiedAt,
+		"status":     TEST_REPORT_STATUS_VERIFIED,
+		"results": []interface{}{
+			map[string]interface{}{"analyteCode": "HGB", "value": 13.2, "unit": "g/dL", "flag": "N", "comment": "repeated"},
+		},
+	}
+}
+
+func bsonRoundTrip(t *testing.T, doc map[string]interface{}) map[string]interface{} {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(map[string]interface{})
+	if err := bson.Unmarshal(raw, &result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestCanonicalLabReportSignsComment(t *testing.T) {
+	report := sampleLabReport(time.Now())
+	signed, _ := CanonicalLabReport(report)
+	report["results"].([]interface{})[0].(map[string]interface{})["comment"] = "changed"
+	altered, _ := CanonicalLabReport(report)
+	if string(signed) == string(altered) {
+		t.Error("comment is not covered by the signature")
+	}
+
+	report["signature"] = map[string]interface{}{"value": "x"}
+	legacy, _ := CanonicalLabReport(report)
+	report["results"].([]interface{})[0].(map[string]interface{})["comment"] = "changed again"
+	legacyAltered, _ := CanonicalLabReport(report)
+	if string(legacy) != string(legacyAltered) {
+		t.Error("signature without version must keep the fields it was signed with")
+	}
+}
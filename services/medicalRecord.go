@@ -79,7 +79,11 @@ func FetchMedicalRecordByCode(c *gin.Context, medicalRecordId string) (map[strin
 * Delete from cache, set in Cache
  */
 func UpdateMedicalRecordByNurse(c *gin.Context, medicalRecordId string, data map[string]interface{}) error {
-
+	for _, field := range []string{"bp", "weight"} {
+		if _, exists := data[field]; exists {
+			return errors.New(VITALS_MUST_BE_RECORDED)
+		}
+	}
 	code := c.GetString("code")
 	data["updatedBy"] = code
 	data["updatedAt"] = time.Now()
@@ -107,33 +111,16 @@ func UpdateMedicalRecordByNurse(c *gin.Context, medicalRecordId string, data map
 		log.Println("This nurse doesnot have access to updatethe record")
 		return errors.New(util.NURSE_DOESNOT_HAVE_ACCESS_TO_UPDATE)
 	}
-	collection := db.OpenCollections(util.MedicalRecordCollection)
-	filter := bson.M{
-		"code": medicalRecordId,
-	}
 	update := bson.M{
 		"$set": data,
 	}
-	updated, err := db.UpdateOne(c, collection, filter, update)
+	updatedRecord, err := updateMedicalRecordWithHistory(c, medicalRecordId, update, HISTORY_ACTION_UPDATE)
 	if err != nil {
 		log.Println("Error while updating medicalRecord by nurse:", err)
 		return err
 	}
-	log.Println("UpdatedCount(byNurse): ", updated.ModifiedCount)
-	updatedRecord := make(map[string]interface{})
-	err = db.FindOne(c, collection, filter, &updatedRecord)
-	if err != nil {
-		log.Println("Error from findOne after updating medicalRecord byNurse", err)
-		return err
-	}
 	key := util.MedicalRecordKey + medicalRecordId
-	result := make(map[string]interface{})
-	err = db.FindOne(c, collection, filter, result)
-	if err := redis.DeleteCache(c, key); err != nil {
-		log.Println(FAILED_TO_DELETE_OLD_MEDICAL_RECORD, err)
-	}
-
-	if err := redis.SetCache(c, key, result); err != nil {
+	if err := redis.SetCache(c, key, updatedRecord); err != nil {
 		log.Println(FAILED_CACHCING_UPDATED_MEDICAL_RECORD, err)
 	}
 	return nil
@@ -216,10 +203,14 @@ func VerifyDoctorCanAccess(medicalRecord map[string]interface{}, code string) er
 * Get the code from claims which is updatedBy field
 * Update based on the search filters and update fields
 * Update by doctor, whose id should match with the existing medicalRecord doctorId field
+* clinicalNotes are written through /clinicalNote, they cannot be set here
 * Fetch updated document
 * Delete from cache, set in Cache
  */
 func UpdateMedicalRecordByDoctor(c *gin.Context, medicalRecordId string, data map[string]interface{}) error {
+	if _, exists := data["clinicalNotes"]; exists {
+		return errors.New(NOTES_MUST_BE_WRITTEN)
+	}
 	code := c.GetString("code")
 	data["updatedBy"] = code
 	data["updatedAt"] = time.Now()
@@ -266,30 +257,15 @@ func UpdateMedicalRecordByDoctor(c *gin.Context, medicalRecordId string, data ma
 			return err
 		}
 	}
-	collection := db.OpenCollections(util.MedicalRecordCollection)
-	filter := bson.M{
-		"code": medicalRecordId,
-	}
 	update := bson.M{
 		"$set": data,
 	}
-	updated, err := db.UpdateOne(c, collection, filter, update)
+	updatedRecord, err := updateMedicalRecordWithHistory(c, medicalRecordId, update, HISTORY_ACTION_UPDATE)
 	if err != nil {
 		log.Println("Error while updating medicalRecord by doctor:", err)
 		return err
 	}
-	log.Println("UpdatedCount(medicalRecord): ", updated.ModifiedCount)
-	updatedRecord := make(map[string]interface{})
-	err = db.FindOne(c, collection, filter, updatedRecord)
-	if err != nil {
-		log.Println("Error from findOne after updating medicalRecord byDoctor", err)
-		return err
-	}
 	key := util.MedicalRecordKey + medicalRecordId
-	if err := redis.DeleteCache(c, key); err != nil {
-		log.Println(FAILED_TO_DELETE_OLD_MEDICAL_RECORD, err)
-	}
-
 	if err := redis.SetCache(c, key, updatedRecord); err != nil {
 		log.Println(FAILED_CACHCING_UPDATED_MEDICAL_RECORD, err)
 	}
@@ -332,30 +308,15 @@ func UpdateMedicalRecordByPharmacist(c *gin.Context, medicalRecordId string, dat
 		log.Println("This pharmacist doesnot have access to update the record")
 		return errors.New(util.PHARMACIST_DOES_NOT_HAVE_ACCESS_TO_UPDATE_MEDICAL_RECORD)
 	}
-	collection := db.OpenCollections(util.MedicalRecordCollection)
-	filter := bson.M{
-		"code": medicalRecordId,
-	}
 	update := bson.M{
 		"$set": data,
 	}
-	updated, err := db.UpdateOne(c, collection, filter, update)
+	updatedRecord, err := updateMedicalRecordWithHistory(c, medicalRecordId, update, HISTORY_ACTION_UPDATE)
 	if err != nil {
 		log.Println("Error while updating medicalRecord by doctor:", err)
 		return err
 	}
-	log.Println("UpdatedCount(byPharmacist): ", updated.ModifiedCount)
-	updatedRecord := make(map[string]interface{})
-	err = db.FindOne(c, collection, filter, updatedRecord)
-	if err != nil {
-		log.Println("Error from findOne after updating medicalRecord by pharmacist", err)
-		return err
-	}
 	key := util.MedicalRecordKey + medicalRecordId
-	if err := redis.DeleteCache(c, key); err != nil {
-		log.Println(FAILED_TO_DELETE_OLD_MEDICAL_RECORD, err)
-	}
-
 	if err := redis.SetCache(c, key, updatedRecord); err != nil {
 		log.Println(FAILED_CACHCING_UPDATED_MEDICAL_RECORD, err)
 	}
@@ -489,18 +450,21 @@ func DeleteMedicalRecordByCode(c *gin.Context, medicalRecordId string) (string,
 		log.Println("This user doesnot have access")
 		return "", errors.New(util.RECEPTIONIST_DOESNOT_HAVE_ACCESS)
 	}
-	deleted, err := db.DeleteOne(c, collection, filter)
-	if err != nil {
-		log.Println("Error from the deleteOne function: ", err)
+	deleted := make(map[string]interface{})
+	if err := collection.FindOneAndDelete(c, filter).Decode(&deleted); err != nil {
+		log.Println("Error from the findOneAndDelete function: ", err)
 		return "", err
 	}
-	log.Println("Deleted: ", deleted.DeletedCount)
 	key := util.MedicalRecordKey + medicalRecordId
 	err = redis.DeleteCache(c, key)
 	if err != nil {
 		log.Println("Error from deleteCache:", err)
 		return "", err
 	}
+	if err := recordMedicalRecordHistory(c, deleted, map[string]interface{}{}, HISTORY_ACTION_DELETE); err != nil {
+		log.Println("Error from recordMedicalRecordHistory: ", err)
+		return "", err
+	}
 	msg := fmt.Sprintf("User %s deleted successfuly ", medicalRecordId)
 	return msg, nil
 }
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	redis "github.com/KanapuramVaishnavi/Core/config/redis"
+	common "github.com/KanapuramVaishnavi/Core/coreServices"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+* Fields which are not tracked per change, who and when are part of every history entry
+ */
+var untrackedMedicalRecordFields = []string{"_id", "updatedBy", "updatedAt"}
+
+/*
+* Changed fields between two states of a medical record, sorted by the field name
+* A field missing in before is added(no oldValue), a field missing in after is removed(no newValue)
+ */
+func diffMedicalRecord(before, after map[string]interface{}) []interface{} {
+	fields := []string{}
+	for field := range before {
+		fields = append(fields, field)
+	}
+	for field := range after {
+		if _, ok := before[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	changes := []interface{}{}
+	for _, field := range fields {
+		if slices.Contains(untrackedMedicalRecordFields, field) {
+			continue
+		}
+		oldValue, existed := before[field]
+		newValue, exists := after[field]
+		if existed && exists && reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		change := map[string]interface{}{"field": field}
+		if existed {
+			change["oldValue"] = oldValue
+		}
+		if exists {
+			change["newValue"] = newValue
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+/*
+* Append one history entry{changedBy, role, changedAt, changes} for an update of the medical record
+* The history is append only, there is no update or delete of the entries
+* Nothing is written when no tracked field changed
+ */
+func recordMedicalRecordHistory(c *gin.Context, before, after map[string]interface{}, action string) error {
+	changes := diffMedicalRecord(before, after)
+	if len(changes) == 0 {
+		return nil
+	}
+	record := after
+	if len(after) == 0 {
+		record = before
+	}
+	code, err := GenerateCode(MedicalRecordHistoryCollection)
+	if err != nil {
+		log.Println("Error from generateCode: ", err)
+		return err
+	}
+	entry := map[string]interface{}{
+		"code":            code,
+		"medicalRecordId": record["code"],
+		"patientId":       record["patientId"],
+		"hospitalId":      record["hospitalId"],
+		"tenantId":        record["tenantId"],
+		"action":          action,
+		"changedBy":       c.GetString("code"),
+		"role":            c.GetString("collection"),
+		"changedAt":       time.Now(),
+		"changes":         changes,
+	}
+	collection := db.OpenCollections(MedicalRecordHistoryCollection)
+	if _, err := db.CreateOne(c, collection, entry); err != nil {
+		log.Println("Error from createOne: ", err)
+		return err
+	}
+	return nil
+}
+
+/*
+* Same CanAccess rules as the medical record
+* A deleted record is checked against the hospital and tenant kept in its latest history entry
+ */
+func verifyMedicalRecordHistoryAccess(c *gin.Context, medicalRecordId string) error {
+	_, err := FetchMedicalRecordByCode(c, medicalRecordId)
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+	collection := db.OpenCollections(MedicalRecordHistoryCollection)
+	opts := options.Find().SetSort(bson.D{{Key: "changedAt", Value: -1}}).SetLimit(1)
+	entries, err := db.FindAll(c, collection, bson.M{"medicalRecordId": medicalRecordId}, opts)
+	if err != nil || len(entries) == 0 {
+		return errors.New(MEDICAL_RECORD_HISTORY_NOT_FOUND + medicalRecordId)
+	}
+	latest, ok := entries[0].(map[string]interface{})
+	if !ok {
+		return errors.New(MEDICAL_RECORD_HISTORY_NOT_FOUND + medicalRecordId)
+	}
+	userData := make(map[string]interface{})
+	userColl := db.OpenCollections(c.GetString("collection"))
+	if err := db.FindOne(c, userColl, bson.M{"code": c.GetString("code")}, userData); err != nil {
+		log.Println("Error from findOne: ", err)
+		return err
+	}
+	return common.CanAccess(userData, latest, c.GetString("tenantId"), c.GetString("code"), c.GetString("collection"), c.GetBool("isSuperAdmin"))
+}
+
+/*
+* History of the medical record, newest first
+* Optional filters field(entries which changed the field) and the date range from/to(YYYY-MM-DD)
+ */
+func FetchMedicalRecordHistory(c *gin.Context, medicalRecordId string, query map[string]string) ([]interface{}, error) {
+	if err := verifyMedicalRecordHistoryAccess(c, medicalRecordId); err != nil {
+		log.Println("Error from verifyMedicalRecordHistoryAccess: ", err)
+		return nil, err
+	}
+	filter := bson.M{"medicalRecordId": medicalRecordId}
+	if field := strings.TrimSpace(query["field"]); field != "" {
+		filter["changes.field"] = field
+	}
+	changedAt := bson.M{}
+	if from := strings.TrimSpace(query["from"]); from != "" {
+		start, err := time.Parse(QUERY_DATE_FORMAT, from)
+		if err != nil {
+			return nil, errors.New(INVALID_DATE_FILTER + from)
+		}
+		changedAt["$gte"] = start
+	}
+	if to := strings.TrimSpace(query["to"]); to != "" {
+		end, err := time.Parse(QUERY_DATE_FORMAT, to)
+		if err != nil {
+			return nil, errors.New(INVALID_DATE_FILTER + to)
+		}
+		changedAt["$lt"] = end.AddDate(0, 0, 1)
+	}
+	if len(changedAt) > 0 {
+		filter["changedAt"] = changedAt
+	}
+	collection := db.OpenCollections(MedicalRecordHistoryCollection)
+	opts := options.Find().SetSort(bson.D{{Key: "changedAt", Value: -1}, {Key: "_id", Value: -1}})
+	history, err := db.FindAll(c, collection, filter, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	return history, nil
+}
+
+/*
+* at is RFC3339(2026-01-02T15:04:05Z) or a date YYYY-MM-DD which means the end of that day(UTC)
+ */
+func parseHistoryTimestamp(at string) (time.Time, error) {
+	at = strings.TrimSpace(at)
+	if t, err := time.Parse(time.RFC3339, at); err == nil {
+		return t, nil
+	}
+	if day, err := time.Parse(QUERY_DATE_FORMAT, at); err == nil {
+		return day.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+	}
+	return time.Time{}, errors.New(INVALID_HISTORY_TIMESTAMP)
+}
+
+/*
+* The medical record as it was at the timestamp
+* Starts from the current record and replays the history back to the timestamp
+ */
+func FetchMedicalRecordAt(c *gin.Context, medicalRecordId string, at string) (map[string]interface{}, error) {
+	asOf, err := parseHistoryTimestamp(at)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyMedicalRecordHistoryAccess(c, medicalRecordId); err != nil {
+		log.Println("Error from verifyMedicalRecordHistoryAccess: ", err)
+		return nil, err
+	}
+	// read from the db and not the cache, so the values have the same types as in the history
+	record := make(map[string]interface{})
+	recordColl := db.OpenCollections(util.MedicalRecordCollection)
+	if err := db.FindOne(c, recordColl, bson.M{"code": medicalRecordId}, record); err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Println("Error from findOne: ", err)
+		return nil, err
+	}
+	collection := db.OpenCollections(MedicalRecordHistoryCollection)
+	// _id breaks the ties between the changes made in the same millisecond
+	opts := options.Find().SetSort(bson.D{{Key: "changedAt", Value: -1}, {Key: "_id", Value: -1}})
+	history, err := db.FindAll(c, collection, bson.M{"medicalRecordId": medicalRecordId}, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	record, err = replayMedicalRecordHistory(record, history, asOf)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"asOf":          asOf,
+		"medicalRecord": record,
+	}, nil
+}
+
+/*
+* Undo the changes of the history(newest first) made after asOf on the current record(empty when deleted)
+* updatedBy/updatedAt are taken from the latest change before asOf(or createdBy/createdAt)
+ */
+func replayMedicalRecordHistory(record map[string]interface{}, history []interface{}, asOf time.Time) (map[string]interface{}, error) {
+	var lastChange map[string]interface{}
+	for _, h := range history {
+		entry, ok := h.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if changedAt, _ := toTime(entry["changedAt"]); !changedAt.After(asOf) {
+			lastChange = entry
+			break
+		}
+		changes, _ := normalizeMongoArray(entry["changes"])
+		for _, ch := range changes {
+			change, ok := ch.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			field := getString(change["field"])
+			if oldValue, existed := change["oldValue"]; existed {
+				record[field] = oldValue
+			} else {
+				delete(record, field)
+			}
+		}
+	}
+	createdAt, _ := toTime(record["createdAt"])
+	if len(record) == 0 || createdAt.After(asOf) {
+		return nil, errors.New(MEDICAL_RECORD_DID_NOT_EXIST + asOf.Format(time.RFC3339))
+	}
+	if lastChange != nil {
+		record["updatedBy"] = lastChange["changedBy"]
+		record["updatedAt"] = lastChange["changedAt"]
+	} else {
+		record["updatedBy"] = record["createdBy"]
+		record["updatedAt"] = record["createdAt"]
+	}
+	return record, nil
+}
+
+/*
+* Apply the update on the medical record and append the change to the history
+* The state before is returned by the update itself, so a concurrent update is not part of this change
+* The cached record is removed, a failure to write the history is returned
+ */
+func updateMedicalRecordWithHistory(c *gin.Context, medicalRecordId string, update bson.M, action string) (map[string]interface{}, error) {
+	collection := db.OpenCollections(util.MedicalRecordCollection)
+	filter := bson.M{"code": medicalRecordId}
+	before := make(map[string]interface{})
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+	if err := collection.FindOneAndUpdate(c, filter, update, opts).Decode(&before); err != nil {
+		log.Println("Error from findOneAndUpdate(medicalRecord): ", err)
+		return nil, err
+	}
+	if err := redis.DeleteCache(c, util.MedicalRecordKey+medicalRecordId); err != nil {
+		log.Println(FAILED_TO_DELETE_OLD_MEDICAL_RECORD, err)
+	}
+	after := make(map[string]interface{})
+	if err := db.FindOne(c, collection, filter, after); err != nil {
+		log.Println("Error from findOne after updating medicalRecord: ", err)
+		return nil, err
+	}
+	if err := recordMedicalRecordHistory(c, before, after, action); err != nil {
+		log.Println("Error from recordMedicalRecordHistory: ", err)
+		return nil, err
+	}
+	return after, nil
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func historyEntry(t *testing.T, before, after map[string]interface{}, changedBy string, changedAt time.Time) interface{} {
+	return bsonRoundTrip(t, map[string]interface{}{
+		"changedBy": changedBy,
+		"changedAt": changedAt,
+		"changes":   diffMedicalRecord(before, after),
+	})
+}
+
+func copyRecord(record map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{})
+	for key, value := range record {
+		copied[key] = value
+	}
+	return copied
+}
+
+func TestReplayMedicalRecordHistory(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 9, 0, 0, 0, time.UTC) }
+	created := map[string]interface{}{"code": "MR1", "createdBy": "D1", "createdAt": day(1), "bp": "120/80", "reason": "fever"}
+	firstUpdate := map[string]interface{}{"code": "MR1", "createdBy": "D1", "createdAt": day(1), "bp": "130/85", "reason": "fever", "diagnosis": "flu"}
+	secondUpdate := map[string]interface{}{"code": "MR1", "createdBy": "D1", "createdAt": day(1), "bp": "130/85", "diagnosis": "viral flu"}
+	// newest first, like the history read from the db
+	history := []interface{}{
+		historyEntry(t, secondUpdate, map[string]interface{}{}, "A1", day(7)),
+		historyEntry(t, firstUpdate, secondUpdate, "D1", day(5)),
+		historyEntry(t, created, firstUpdate, "N1", day(3)),
+	}
+	cases := []struct {
+		name      string
+		current   map[string]interface{}
+		asOf      time.Time
+		want      map[string]interface{}
+		updatedBy string
+		wantErr   string
+	}{
+		{"before the record was created", secondUpdate, day(1).Add(-time.Hour), nil, "", MEDICAL_RECORD_DID_NOT_EXIST},
+		{"as created", secondUpdate, day(2), created, "D1", ""},
+		{"after the first update", secondUpdate, day(4), firstUpdate, "N1", ""},
+		{"exactly at the second update", secondUpdate, day(5), secondUpdate, "D1", ""},
+		{"current record", secondUpdate, day(6), secondUpdate, "D1", ""},
+		{"deleted record before the delete", map[string]interface{}{}, day(6), secondUpdate, "D1", ""},
+		{"deleted record after the delete", map[string]interface{}{}, day(8), nil, "", MEDICAL_RECORD_DID_NOT_EXIST},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			record, err := replayMedicalRecordHistory(copyRecord(tc.current), history, tc.asOf)
+			if tc.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tc.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if record["updatedBy"] != tc.updatedBy {
+				t.Errorf("updatedBy = %v, want %s", record["updatedBy"], tc.updatedBy)
+			}
+			delete(record, "updatedBy")
+			delete(record, "updatedAt")
+			for field, value := range tc.want {
+				// values restored from the history come back with the mongo types
+				if want, ok := toTime(value); ok {
+					if got, _ := toTime(record[field]); !got.Equal(want) {
+						t.Errorf("%s = %v, want %v", field, record[field], value)
+					}
+					continue
+				}
+				if !reflect.DeepEqual(record[field], value) {
+					t.Errorf("%s = %v, want %v", field, record[field], value)
+				}
+			}
+			if len(record) != len(tc.want) {
+				t.Errorf("record = %v, want %v", record, tc.want)
+			}
+		})
+	}
+}
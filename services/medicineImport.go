@@ -0,0 +1,394 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+var medicineImportColumns = []string{"name", "genericName", "brandName", "strength", "drugType", "dosage", "expiryDate", "noOfStrips", "tabletsPerStrip", "pricePerStrip", "isControlled", "schedule", "maxDays"}
+
+var medicineRequiredColumns = []string{"name", "dosage", "expiryDate", "noOfStrips", "tabletsPerStrip", "pricePerStrip"}
+
+/*
+* Read the uploaded file based on the extension
+* First row is the header, remaining rows are the records(medicines, ICD-10 codes)
+ */
+func ReadImportSheet(fileName string, content []byte) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		reader := csv.NewReader(bytes.NewReader(content))
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		return reader.ReadAll()
+	case ".xlsx":
+		return readXLSXRows(content)
+	default:
+		return nil, errors.New(UNSUPPORTED_IMPORT_FILE_TYPE)
+	}
+}
+
+type xlsxSharedStrings struct {
+	Items []struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"si"`
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Items []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref       string `xml:"r,attr"`
+			Type      string `xml:"t,attr"`
+			Value     string `xml:"v"`
+			InlineStr string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+/*
+* xlsx is a zip of xml files
+* Read the shared strings and then the first worksheet of the workbook
+* Place every cell in its column using the cell reference(A1,B1...)
+ */
+func readXLSXRows(content []byte) ([][]string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		log.Println("Error while opening xlsx: ", err)
+		return nil, errors.New(UNABLE_TO_READ_XLSX_FILE)
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+	var sharedStrings []string
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		var sst xlsxSharedStrings
+		if err := decodeZipXML(f, &sst); err != nil {
+			return nil, err
+		}
+		for _, item := range sst.Items {
+			text := item.Text
+			for _, r := range item.Runs {
+				text += r.Text
+			}
+			sharedStrings = append(sharedStrings, text)
+		}
+	}
+	sheetFile, err := xlsxFirstSheet(files)
+	if err != nil {
+		return nil, err
+	}
+	var sheet xlsxSheet
+	if err := decodeZipXML(sheetFile, &sheet); err != nil {
+		return nil, err
+	}
+	var rows [][]string
+	for _, r := range sheet.Rows {
+		var row []string
+		for i, cell := range r.Cells {
+			col := xlsxColumnIndex(cell.Ref)
+			if col < 0 {
+				col = i
+			}
+			for len(row) <= col {
+				row = append(row, "")
+			}
+			switch cell.Type {
+			case "s":
+				idx, err := strconv.Atoi(cell.Value)
+				if err != nil || idx >= len(sharedStrings) {
+					return nil, errors.New(UNABLE_TO_READ_XLSX_FILE)
+				}
+				row[col] = sharedStrings[idx]
+			case "inlineStr":
+				row[col] = cell.InlineStr
+			default:
+				row[col] = cell.Value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+/*
+* The first sheet listed in the workbook, its file comes from the relationships of the workbook
+* The sheet files are not always named sheet1.xml(sheets renamed, reordered or deleted)
+ */
+func xlsxFirstSheet(files map[string]*zip.File) (*zip.File, error) {
+	workbookFile, ok := files["xl/workbook.xml"]
+	if !ok {
+		log.Println("workbook not found in xlsx")
+		return nil, errors.New(UNABLE_TO_READ_XLSX_FILE)
+	}
+	var workbook xlsxWorkbook
+	if err := decodeZipXML(workbookFile, &workbook); err != nil {
+		return nil, err
+	}
+	relsFile, ok := files["xl/_rels/workbook.xml.rels"]
+	if !ok || len(workbook.Sheets) == 0 {
+		log.Println("sheets not found in xlsx")
+		return nil, errors.New(UNABLE_TO_READ_XLSX_FILE)
+	}
+	var rels xlsxRelationships
+	if err := decodeZipXML(relsFile, &rels); err != nil {
+		return nil, err
+	}
+	for _, rel := range rels.Items {
+		if rel.ID != workbook.Sheets[0].RID {
+			continue
+		}
+		// targets are relative to xl/, or absolute from the root of the package
+		name := path.Join("xl", rel.Target)
+		if strings.HasPrefix(rel.Target, "/") {
+			name = strings.TrimPrefix(rel.Target, "/")
+		}
+		if sheetFile, ok := files[name]; ok {
+			return sheetFile, nil
+		}
+	}
+	log.Println("first sheet not found in xlsx: ", workbook.Sheets[0].Name)
+	return nil, errors.New(UNABLE_TO_READ_XLSX_FILE)
+}
+
+/*
+* Entries are read up to MAX_XLSX_ENTRY_SIZE, a small upload can expand to a huge xml(zip bomb)
+ */
+func decodeZipXML(f *zip.File, dest interface{}) error {
+	if f.UncompressedSize64 > uint64(MAX_XLSX_ENTRY_SIZE) {
+		log.Println("File in xlsx is too large: ", f.Name)
+		return errors.New(UNABLE_TO_READ_XLSX_FILE)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		log.Println("Error while opening file in xlsx: ", err)
+		return errors.New(UNABLE_TO_READ_XLSX_FILE)
+	}
+	defer rc.Close()
+	raw, err := io.ReadAll(io.LimitReader(rc, MAX_XLSX_ENTRY_SIZE+1))
+	if err != nil || int64(len(raw)) > MAX_XLSX_ENTRY_SIZE {
+		return errors.New(UNABLE_TO_READ_XLSX_FILE)
+	}
+	if err := xml.Unmarshal(raw, dest); err != nil {
+		log.Println("Error while decoding xml in xlsx: ", err)
+		return errors.New(UNABLE_TO_READ_XLSX_FILE)
+	}
+	return nil
+}
+
+/*
+* Dates typed in excel are saved as the number of days since 1899-12-30
+* Returns the date as YYYY-MM-DD when the value is such a serial number
+ */
+func excelSerialDate(value string) (string, bool) {
+	serial, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || serial < 1 || serial > EXCEL_MAX_DATE_SERIAL {
+		return "", false
+	}
+	return time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC).AddDate(0, 0, int(serial)).Format(QUERY_DATE_FORMAT), true
+}
+
+/*
+* Convert the cell reference to the zero based column index(A1 -> 0, AB3 -> 27)
+ */
+func xlsxColumnIndex(ref string) int {
+	idx := 0
+	found := false
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		idx = idx*26 + int(ch-'A'+1)
+		found = true
+	}
+	if !found {
+		return -1
+	}
+	return idx - 1
+}
+
+/*
+* Map the header row to the known columns
+* Every required column must be present in the header
+ */
+func mapMedicineHeader(header []string) (map[int]string, error) {
+	known := make(map[string]string)
+	for _, col := range medicineImportColumns {
+		known[strings.ToLower(col)] = col
+	}
+	columns := make(map[int]string)
+	present := make(map[string]bool)
+	for i, h := range header {
+		if col, ok := known[strings.ToLower(strings.TrimSpace(h))]; ok {
+			columns[i] = col
+			present[col] = true
+		}
+	}
+	for _, col := range medicineRequiredColumns {
+		if !present[col] {
+			return nil, errors.New(IMPORT_FILE_MISSING_HEADER + col)
+		}
+	}
+	return columns, nil
+}
+
+func rowIsEmpty(row []string) bool {
+	for _, v := range row {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+* Read the file and validate the header
+* Validate every row with the same rules as create medicine, expiryDate of xlsx can be an excel date number
+* Rows with errors are collected with their row number, remaining rows are created
+* If dryRun is true only the validation report is returned and nothing is saved
+ */
+func ImportMedicines(c *gin.Context, fileName string, content []byte, dryRun bool) (map[string]interface{}, error) {
+	rows, err := ReadImportSheet(fileName, content)
+	if err != nil {
+		log.Println("Error from readImportSheet: ", err)
+		return nil, err
+	}
+	if len(rows) < 2 {
+		return nil, errors.New(IMPORT_FILE_IS_EMPTY)
+	}
+	columns, err := mapMedicineHeader(rows[0])
+	if err != nil {
+		log.Println("Error from mapMedicineHeader: ", err)
+		return nil, err
+	}
+	pharmacistId := c.GetString("code")
+	pharmacist, err := fetchPharmacistForMedicine(c, pharmacistId)
+	if err != nil {
+		log.Println("Error from fetchPharmacistForMedicine: ", err)
+		return nil, err
+	}
+	tenantId := pharmacist["tenantId"].(string)
+	isXLSX := strings.EqualFold(filepath.Ext(fileName), ".xlsx")
+
+	seen := make(map[string]int)
+	failed := []interface{}{}
+	created := []interface{}{}
+	valid := 0
+	for i, row := range rows[1:] {
+		rowNo := i + 2
+		if rowIsEmpty(row) {
+			continue
+		}
+		data := make(map[string]interface{})
+		for idx, col := range columns {
+			if idx < len(row) && strings.TrimSpace(row[idx]) != "" {
+				data[col] = row[idx]
+			}
+		}
+		if expiryDate, ok := data["expiryDate"].(string); ok && isXLSX {
+			if date, ok := excelSerialDate(expiryDate); ok {
+				data["expiryDate"] = date
+			}
+		}
+		if err := ValidateMedicineInput(data); err != nil {
+			failed = append(failed, map[string]interface{}{"row": rowNo, "error": err.Error()})
+			continue
+		}
+		name := medicineNameKey(data["name"].(string))
+		if firstRow, ok := seen[name]; ok {
+			failed = append(failed, map[string]interface{}{"row": rowNo, "error": fmt.Sprintf("%s(row %d)", DUPLICATE_MEDICINE_IN_IMPORT_FILE, firstRow)})
+			continue
+		}
+		seen[name] = rowNo
+		if err := CheckMedicineNameExists(c, tenantId, data["name"].(string)); err != nil {
+			failed = append(failed, map[string]interface{}{"row": rowNo, "error": err.Error()})
+			continue
+		}
+		valid++
+		if dryRun {
+			continue
+		}
+		code, err := saveMedicine(c, data, pharmacist)
+		if err != nil {
+			failed = append(failed, map[string]interface{}{"row": rowNo, "error": err.Error()})
+			continue
+		}
+		created = append(created, map[string]interface{}{"row": rowNo, "code": code, "name": data["name"]})
+	}
+	log.Printf("Medicine import by %s: valid %d failed %d", pharmacistId, valid, len(failed))
+	return map[string]interface{}{
+		"dryRun":    dryRun,
+		"totalRows": valid + len(failed),
+		"valid":     valid,
+		"created":   created,
+		"failed":    failed,
+	}, nil
+}
+
+/*
+* Fetch the medicines visible to the user
+* Write them as csv with the same columns used by import, prefixed with the code
+ */
+func ExportMedicines(c *gin.Context) ([]byte, error) {
+	medicines, err := FetchAllMedicines(c)
+	if err != nil {
+		log.Println("Error from fetchAllMedicines: ", err)
+		return nil, err
+	}
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	header := append([]string{"code"}, medicineImportColumns...)
+	header = append(header, "totalNoOfTablets")
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+	for _, m := range medicines {
+		medicine, ok := m.(map[string]interface{})
+		if !ok {
+			return nil, errors.New(util.UNABLE_TO_FETCH_MEDICINE_FROM_MEDICINE)
+		}
+		record := make([]string, 0, len(header))
+		for _, col := range header {
+			record = append(record, getString(medicine[col]))
+		}
+		if err := writer.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
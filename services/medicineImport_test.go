@@ -0,0 +1,97 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+func buildXLSX(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+const xlsxRelsNamespace = `xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"`
+
+func TestReadXLSXRowsUsesFirstSheetOfWorkbook(t *testing.T) {
+	content := buildXLSX(t, map[string]string{
+		"xl/workbook.xml": `<workbook ` + xlsxRelsNamespace + `><sheets>` +
+			`<sheet name="Medicines" sheetId="2" r:id="rId5"/><sheet name="Old" sheetId="1" r:id="rId1"/>` +
+			`</sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships>` +
+			`<Relationship Id="rId1" Target="worksheets/sheet1.xml"/><Relationship Id="rId5" Target="/xl/worksheets/sheet2.xml"/>` +
+			`</Relationships>`,
+		"xl/sharedStrings.xml":     `<sst><si><t>name</t></si><si><r><t>Para</t></r><r><t>cetamol</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData><row><c r="A1" t="inlineStr"><is><t>old</t></is></c></row></sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet><sheetData>` +
+			`<row><c r="A1" t="s"><v>0</v></c><c r="C1" t="inlineStr"><is><t>expiryDate</t></is></c></row>` +
+			`<row><c r="A2" t="s"><v>1</v></c><c r="C2"><v>45658</v></c></row>` +
+			`</sheetData></worksheet>`,
+	})
+	rows, err := readXLSXRows(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0][0] != "name" || rows[0][2] != "expiryDate" || rows[1][0] != "Paracetamol" || rows[1][2] != "45658" {
+		t.Errorf("rows = %q", rows)
+	}
+
+	missing := buildXLSX(t, map[string]string{
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData/></worksheet>`,
+	})
+	if _, err := readXLSXRows(missing); err == nil || err.Error() != UNABLE_TO_READ_XLSX_FILE {
+		t.Errorf("err without workbook = %v", err)
+	}
+}
+
+func TestExcelSerialDate(t *testing.T) {
+	cases := []struct {
+		value string
+		date  string
+		ok    bool
+	}{
+		{"45658", "2025-01-01", true},
+		{"45658.75", "2025-01-01", true},
+		{" 46387 ", "2026-12-31", true},
+		{"2025-01-01", "", false},
+		{"0", "", false},
+		{"-5", "", false},
+		{"99999999", "", false},
+	}
+	for _, tc := range cases {
+		date, ok := excelSerialDate(tc.value)
+		if ok != tc.ok || date != tc.date {
+			t.Errorf("excelSerialDate(%q) = %q, %v want %q, %v", tc.value, date, ok, tc.date, tc.ok)
+		}
+	}
+}
+
+func TestMedicineNameKey(t *testing.T) {
+	cases := []struct {
+		a, b string
+		same bool
+	}{
+		{"Paracetamol", "paracetamol", true},
+		{" PARACETAMOL ", "Paracetamol", true},
+		{"Paracetamol", "Paracetamol 500", false},
+		{"Amoxicillin", "Amoxycillin", false},
+	}
+	for _, tc := range cases {
+		if same := medicineNameKey(tc.a) == medicineNameKey(tc.b); same != tc.same {
+			t.Errorf("medicineNameKey(%q) == medicineNameKey(%q) = %v want %v", tc.a, tc.b, same, tc.same)
+		}
+	}
+}
@@ -1,9 +1,14 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"log"
+	"regexp"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	db "github.com/KanapuramVaishnavi/Core/config/db"
 	redis "github.com/KanapuramVaishnavi/Core/config/redis"
@@ -12,84 +17,169 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 /*
-* Validate the input fields
+* Check the mandatory fields and trim them
+* Trim the optional catalog fields(genericName,brandName,strength,drugType) if provided
+* Normalize the controlled medicine fields(isControlled,schedule,maxDays)
 * Normalize the expiryDate
-* Get pharmacistId from the context
-* Bind the data with some more fields
-* Check whether the medicines withe same name already exists in db
-* Create in db
-* Set in cache
+* Validate the numeric fields and calculate totalNoOfTablets
  */
-func CreateMedicines(c *gin.Context, data map[string]interface{}) (string, error) {
+func ValidateMedicineInput(data map[string]interface{}) error {
 	fields := []string{"name", "dosage", "expiryDate", "noOfStrips", "tabletsPerStrip", "pricePerStrip"}
 	for _, value := range fields {
 		err := common.GetTrimmedString(data, value)
 		if err != nil {
 			log.Println("Error from getTrimmedString")
-			return "", err
+			return err
+		}
+	}
+	optionalFields := []string{"genericName", "brandName", "strength", "drugType"}
+	for _, field := range optionalFields {
+		err := common.TrimIfExists(data, field)
+		if err != nil {
+			log.Println("Error from trimIfExists: ", err)
+			return err
 		}
 	}
+	if err := normalizeControlledFields(data); err != nil {
+		log.Println("Error from normalizeControlledFields: ", err)
+		return err
+	}
 	dateStr, err := common.NormalizeDate(data["expiryDate"].(string))
 	if err != nil {
 		log.Println("Error from normalizeDate: ", err)
-		return "", err
+		return err
 	}
 	data["expiryDate"] = dateStr
-	pharmacistId := c.GetString("code")
-	noOfStripsVal, ok := data["noOfStrips"].(string)
-	if !ok {
-		log.Println("Unable to get noOfStrips")
-		return "", errors.New(util.UNABLE_TO_FETCH_NO_OF_STRIPS)
-	}
-	noOfStrips, _ := strconv.Atoi(noOfStripsVal)
-	tabletsPerStripVal, ok := data["tabletsPerStrip"].(string)
-	if !ok {
-		log.Println("Unable to get tabletsPerStrips")
-		return "", errors.New(util.UNABLE_TO_FETCH_TABLETS_PER_STRIP)
-	}
-	tabletsPerStrip, _ := strconv.Atoi(tabletsPerStripVal)
-	data["createdBy"] = pharmacistId
-	totalNoOfTabletsVal := noOfStrips * tabletsPerStrip
-	totalNoOfTablets := strconv.Itoa(totalNoOfTabletsVal)
-	data["totalNoOfTablets"] = totalNoOfTablets
-	coll := util.MedicineCollection
-	collection := db.OpenCollections(coll)
+	noOfStrips, err := strconv.Atoi(data["noOfStrips"].(string))
+	if err != nil || noOfStrips < 0 {
+		log.Println("Invalid noOfStrips: ", data["noOfStrips"])
+		return errors.New(INVALID_NUMBER_OF_STRIPS)
+	}
+	tabletsPerStrip, err := strconv.Atoi(data["tabletsPerStrip"].(string))
+	if err != nil || tabletsPerStrip <= 0 {
+		log.Println("Invalid tabletsPerStrip: ", data["tabletsPerStrip"])
+		return errors.New(INVALID_TABLETS_PER_STRIP)
+	}
+	pricePerStrip, err := strconv.Atoi(data["pricePerStrip"].(string))
+	if err != nil || pricePerStrip < 0 {
+		log.Println("Invalid pricePerStrip: ", data["pricePerStrip"])
+		return errors.New(INVALID_PRICE_PER_STRIP)
+	}
+	data["totalNoOfTablets"] = strconv.Itoa(noOfStrips * tabletsPerStrip)
+	return nil
+}
+
+var medicineNameIndexOnce sync.Once
+
+/*
+* Names are compared by the nameKey, the trimmed lowercase name
+* The same rule is used for the names repeated inside an import file
+ */
+func medicineNameKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+/*
+* nameKey is unique inside a tenant, two medicines saved together cannot take the same name
+* Medicines saved before the nameKey do not have it and are left out of the index
+ */
+func ensureMedicineNameIndex(c context.Context, collection *mongo.Collection) {
+	medicineNameIndexOnce.Do(func() {
+		index := mongo.IndexModel{
+			Keys: bson.D{{Key: "tenantId", Value: 1}, {Key: "nameKey", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("tenantId_nameKey_unique").
+				SetPartialFilterExpression(bson.M{"nameKey": bson.M{"$exists": true}}),
+		}
+		if _, err := collection.Indexes().CreateOne(c, index); err != nil {
+			log.Println("Error while creating the medicine name index: ", err)
+		}
+	})
+}
 
+/*
+* Medicine names are unique inside a tenant only, ignoring the case
+* Different tenants can have the medicine with the same name
+* Medicines without the nameKey are matched on the name ignoring the case
+ */
+func CheckMedicineNameExists(c *gin.Context, tenantId string, name string) error {
+	collection := db.OpenCollections(util.MedicineCollection)
+	key := medicineNameKey(name)
 	filter := bson.M{
-		"name": data["name"],
+		"tenantId": tenantId,
+		"$or": bson.A{
+			bson.M{"nameKey": key},
+			bson.M{
+				"nameKey": bson.M{"$exists": false},
+				"name":    primitive.Regex{Pattern: "^\\s*" + regexp.QuoteMeta(key) + "\\s*$", Options: "i"},
+			},
+		},
 	}
 	medicine := make(map[string]interface{})
-	err = db.FindOne(c, collection, filter, medicine)
-	if !errors.Is(err, mongo.ErrNoDocuments) {
-		log.Println("Medicine with same name already exists: ", err)
-		return "", errors.New(util.MEDICINE_ALREADY_EXISTS_WITH_THIS_NAME)
+	err := db.FindOne(c, collection, filter, medicine)
+	if err == nil {
+		log.Println("Medicine with same name already exists in tenant: ", tenantId)
+		return errors.New(util.MEDICINE_ALREADY_EXISTS_WITH_THIS_NAME)
 	}
-	code, err := common.GenerateEmpCode(util.MedicineCollection)
-	if err != nil {
-		log.Println("Error from generateEmpCode: ", err)
-		return "", err
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Println("Error from findOne while checking medicine name: ", err)
+		return err
 	}
-	data["code"] = code
-	pharmaColl := util.PharmacistCollection
-	pharmaCollection := db.OpenCollections(pharmaColl)
+	return nil
+}
+
+/*
+* Fetch the pharmacist who is creating the medicines
+ */
+func fetchPharmacistForMedicine(c *gin.Context, pharmacistId string) (map[string]interface{}, error) {
+	pharmaCollection := db.OpenCollections(util.PharmacistCollection)
 	pharmacist := make(map[string]interface{})
 	pFilter := bson.M{
 		"code": pharmacistId,
 	}
-	err = db.FindOne(c, pharmaCollection, pFilter, pharmacist)
+	err := db.FindOne(c, pharmaCollection, pFilter, pharmacist)
 	if err != nil {
 		log.Println("Error from findOne function: ", err)
+		return nil, err
+	}
+	return pharmacist, nil
+}
+
+/*
+* Generate the medicine code
+* Bind tenantId,hospitalId from the pharmacist and the audit fields
+* Create in db
+* Set in cache
+ */
+func saveMedicine(c *gin.Context, data map[string]interface{}, pharmacist map[string]interface{}) (string, error) {
+	code, err := common.GenerateEmpCode(util.MedicineCollection)
+	if err != nil {
+		log.Println("Error from generateEmpCode: ", err)
 		return "", err
 	}
+	pharmacistId := pharmacist["code"].(string)
+	data["code"] = code
 	data["tenantId"] = pharmacist["tenantId"].(string)
 	data["hospitalId"] = pharmacist["createdBy"].(string)
+	data["createdBy"] = pharmacistId
+	data["updatedBy"] = pharmacistId
+	data["createdAt"] = time.Now()
+	data["updatedAt"] = time.Now()
+	data["nameKey"] = medicineNameKey(data["name"].(string))
 	log.Println("MEDICINE CODE:", code)
 
+	collection := db.OpenCollections(util.MedicineCollection)
+	ensureMedicineNameIndex(context.Background(), collection)
 	inserted, err := db.CreateOne(c, collection, data)
+	if mongo.IsDuplicateKeyError(err) {
+		log.Println("Medicine with same name was saved meanwhile in tenant: ", data["tenantId"])
+		return "", errors.New(util.MEDICINE_ALREADY_EXISTS_WITH_THIS_NAME)
+	}
 	if err != nil {
 		log.Println("Error from createOne: ", err)
 		return "", err
@@ -101,6 +191,39 @@ func CreateMedicines(c *gin.Context, data map[string]interface{}) (string, error
 		log.Println("Error from setCache: ", err)
 		return "", err
 	}
+	return code, nil
+}
+
+/*
+* Validate the input fields
+* Get pharmacistId from the context
+* Check whether the medicine with same name already exists in the tenant
+* Bind the data with some more fields
+* Create in db
+* Set in cache
+ */
+func CreateMedicines(c *gin.Context, data map[string]interface{}) (string, error) {
+	err := ValidateMedicineInput(data)
+	if err != nil {
+		log.Println("Error from validateMedicineInput: ", err)
+		return "", err
+	}
+	pharmacistId := c.GetString("code")
+	pharmacist, err := fetchPharmacistForMedicine(c, pharmacistId)
+	if err != nil {
+		log.Println("Error from fetchPharmacistForMedicine: ", err)
+		return "", err
+	}
+	err = CheckMedicineNameExists(c, pharmacist["tenantId"].(string), data["name"].(string))
+	if err != nil {
+		log.Println("Error from checkMedicineNameExists: ", err)
+		return "", err
+	}
+	_, err = saveMedicine(c, data, pharmacist)
+	if err != nil {
+		log.Println("Error from saveMedicine: ", err)
+		return "", err
+	}
 	return "Successfully created", nil
 }
 
@@ -216,6 +339,7 @@ func FetchAllMedicines(c *gin.Context) ([]interface{}, error) {
 * Get the code from claims which is createdBy field
 * Update based on the search filters and update fields
 * Update this medicine by pharmacist, who has access only match hospitalId's of pharmacist and medicines
+* A new name must not be used by another medicine of the tenant
 * Fetch updated document
 * Delete from cache, set in Cache
  */
@@ -225,7 +349,7 @@ func UpdateMedicines(c *gin.Context, medicineId string, data map[string]interfac
 		log.Println("Error from getFromContext: ", err)
 		return "", err
 	}
-	fields := []string{"name", "dosage", "expiryDate"}
+	fields := []string{"name", "dosage", "expiryDate", "genericName", "brandName", "strength", "drugType"}
 	for _, field := range fields {
 		err := common.TrimIfExists(data, field)
 		if err != nil {
@@ -266,10 +390,25 @@ func UpdateMedicines(c *gin.Context, medicineId string, data map[string]interfac
 		log.Println("This pharmacist doesnot have access")
 		return "", errors.New(util.PHARMACIST_DOESNOT_HAVE_ACCESS)
 	}
+	if name, ok := data["name"].(string); ok {
+		if medicineNameKey(name) != medicineNameKey(getString(result["name"])) {
+			err = CheckMedicineNameExists(c, getString(pharmacist["tenantId"]), name)
+			if err != nil {
+				log.Println("Error from checkMedicineNameExists: ", err)
+				return "", err
+			}
+		}
+		data["nameKey"] = medicineNameKey(name)
+	}
 	update := bson.M{
 		"$set": data,
 	}
+	ensureMedicineNameIndex(context.Background(), collection)
 	updated, err := db.UpdateOne(c, collection, filter, update)
+	if mongo.IsDuplicateKeyError(err) {
+		log.Println("Medicine with same name was saved meanwhile in tenant: ", pharmacist["tenantId"])
+		return "", errors.New(util.MEDICINE_ALREADY_EXISTS_WITH_THIS_NAME)
+	}
 	if err != nil {
 		log.Println("Error from updateOne:", err)
 		return "", err
@@ -325,3 +464,189 @@ func DeleteMedicine(c *gin.Context, medicineId string) (string, error) {
 	log.Println("DeletedCount: ", deleted.DeletedCount)
 	return "Deleted successfully", nil
 }
+
+/*
+* Validate noOfStrips to be added(and the new expiryDate if given)
+* Controlled medicines need the batchNo, the receipt is written to the controlled register
+* The expiryDate is updated through UpdateMedicines, which checks the pharmacist access
+* The strips are added with adjustMedicineStock, so a dispense running together is not lost
+* Notify the patients waiting on this medicine
+ */
+func RestockMedicine(c *gin.Context, medicineId string, data map[string]interface{}) (string, error) {
+	strips, err := strconv.Atoi(strings.TrimSpace(getString(data["noOfStrips"])))
+	if err != nil || strips <= 0 {
+		return "", errors.New(RESTOCK_STRIPS_REQUIRED)
+	}
+	medicine, err := FetchMedicineByCode(c, medicineId)
+	if err != nil {
+		log.Println("Error from fetchMedicineByCode: ", err)
+		return "", err
+	}
+	tabletsPerStrip, _ := strconv.Atoi(getString(medicine["tabletsPerStrip"]))
+	if tabletsPerStrip <= 0 {
+		return "", errors.New(INVALID_TABLETS_PER_STRIP)
+	}
+	batchNo := strings.TrimSpace(getString(data["batchNo"]))
+	controlled := IsControlledMedicine(medicine)
+	if controlled && batchNo == "" {
+		return "", errors.New(BATCH_NUMBER_REQUIRED)
+	}
+	update := map[string]interface{}{
+		"updatedBy": c.GetString("code"),
+		"updatedAt": time.Now(),
+	}
+	if expiryDate, ok := data["expiryDate"].(string); ok && strings.TrimSpace(expiryDate) != "" {
+		normalized, err := common.NormalizeDate(strings.TrimSpace(expiryDate))
+		if err != nil {
+			log.Println("Error from normalizeDate: ", err)
+			return "", err
+		}
+		update["expiryDate"] = normalized
+	}
+	_, err = UpdateMedicines(c, medicineId, update)
+	if err != nil {
+		log.Println("Error from updateMedicines: ", err)
+		return "", err
+	}
+	quantity := strips * tabletsPerStrip
+	balanceBefore, _, err := adjustMedicineStock(c, medicineId, quantity)
+	if err != nil {
+		log.Println("Error from adjustMedicineStock: ", err)
+		return "", err
+	}
+	if controlled {
+		if err := recordControlledReceipt(c, medicine, batchNo, quantity, balanceBefore); err != nil {
+			log.Println("Error from recordControlledReceipt: ", err)
+			if _, _, err := adjustMedicineStock(c, medicineId, -quantity); err != nil {
+				log.Println("Error while taking back the restocked tablets: ", err)
+			}
+			return "", err
+		}
+	}
+	medicine, err = FetchMedicineByCode(c, medicineId)
+	if err != nil {
+		log.Println("Error from fetchMedicineByCode: ", err)
+		return "", err
+	}
+	if err := NotifyPendingDispenses(c, medicine); err != nil {
+		log.Println("Error from notifyPendingDispenses: ", err)
+	}
+	return "Restocked successfully", nil
+}
+
+/*
+* Fetch the medicines of the same hospital which share the genericName(and strength if given)
+* Skip the medicine itself and the ones which doesnot have the required tablets in stock
+ */
+func FindGenericSubstitutes(c *gin.Context, medicine map[string]interface{}, requiredTablets int) ([]interface{}, error) {
+	genericName, ok := medicine["genericName"].(string)
+	if !ok || genericName == "" {
+		log.Println("genericName not found in medicine")
+		return nil, errors.New(UNABLE_TO_FETCH_GENERIC_NAME)
+	}
+	hospitalId, ok := medicine["hospitalId"].(string)
+	if !ok {
+		log.Println("hospitalId not found in medicine")
+		return nil, errors.New(UNABLE_TO_FETCH_HOSPITAL_ID)
+	}
+	filter := bson.M{
+		"hospitalId":  hospitalId,
+		"genericName": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(genericName) + "$", Options: "i"},
+		"code":        bson.M{"$ne": medicine["code"]},
+	}
+	if strength, ok := medicine["strength"].(string); ok && strength != "" {
+		filter["strength"] = strength
+	}
+	collection := db.OpenCollections(util.MedicineCollection)
+	docs, err := db.FindAll(c, collection, filter, nil)
+	if err != nil {
+		log.Println("Error from findAll while fetching substitutes: ", err)
+		return nil, err
+	}
+	substitutes := []interface{}{}
+	for _, d := range docs {
+		doc, ok := d.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		available, _ := strconv.Atoi(getString(doc["totalNoOfTablets"]))
+		if available <= 0 || available < requiredTablets {
+			continue
+		}
+		substitutes = append(substitutes, map[string]interface{}{
+			"medicineId":       doc["code"],
+			"name":             doc["name"],
+			"brandName":        doc["brandName"],
+			"genericName":      doc["genericName"],
+			"strength":         doc["strength"],
+			"totalNoOfTablets": doc["totalNoOfTablets"],
+			"pricePerStrip":    doc["pricePerStrip"],
+			"tabletsPerStrip":  doc["tabletsPerStrip"],
+		})
+	}
+	return substitutes, nil
+}
+
+/*
+* Fetch the medicine with access checks
+* Return the in stock medicines with the same generic name
+ */
+func FetchMedicineSubstitutes(c *gin.Context, medicineId string) ([]interface{}, error) {
+	medicine, err := FetchMedicineByCode(c, medicineId)
+	if err != nil {
+		log.Println("Error from fetchMedicineByCode: ", err)
+		return nil, err
+	}
+	substitutes, err := FindGenericSubstitutes(c, medicine, 1)
+	if err != nil {
+		log.Println("Error from findGenericSubstitutes: ", err)
+		return nil, err
+	}
+	return substitutes, nil
+}
+
+/*
+* Add delta tablets(negative to take them out) to the stock of the medicine
+* totalNoOfTablets is saved as a string so $inc cannot be used, the update is conditioned on the
+* value read(compare and set) and read again when another dispense or restock changed it meanwhile
+* Returns the stock before and after the change
+ */
+func adjustMedicineStock(c context.Context, medicineId string, delta int) (int, int, error) {
+	collection := db.OpenCollections(util.MedicineCollection)
+	for attempt := 0; attempt < STOCK_UPDATE_ATTEMPTS; attempt++ {
+		medicine := make(map[string]interface{})
+		if err := db.FindOne(c, collection, bson.M{"code": medicineId}, medicine); err != nil {
+			log.Println("Error from findOne(medicine): ", err)
+			return 0, 0, err
+		}
+		stored := getString(medicine["totalNoOfTablets"])
+		before, _ := strconv.Atoi(stored)
+		tabletsPerStrip, _ := strconv.Atoi(getString(medicine["tabletsPerStrip"]))
+		if tabletsPerStrip <= 0 {
+			return 0, 0, errors.New(INVALID_TABLETS_PER_STRIP)
+		}
+		after := before + delta
+		if after < 0 {
+			return 0, 0, errors.New(INSUFFICIENT_STOCK + medicineId)
+		}
+		filter := bson.M{"code": medicineId, "totalNoOfTablets": medicine["totalNoOfTablets"]}
+		update := bson.M{"$set": bson.M{
+			"totalNoOfTablets": strconv.Itoa(after),
+			"noOfStrips":       strconv.Itoa(after / tabletsPerStrip),
+			"updatedAt":        time.Now(),
+		}}
+		result, err := db.UpdateOne(c, collection, filter, update)
+		if err != nil {
+			log.Println("Error from updateOne(medicine): ", err)
+			return 0, 0, err
+		}
+		if result.MatchedCount == 1 {
+			if err := redis.DeleteCache(c, util.MedicinesKey+medicineId); err != nil {
+				log.Println("Failed deleting old medicine cache: ", err)
+			}
+			return before, after, nil
+		}
+		log.Println("Stock changed while updating, retrying: ", medicineId, stored)
+	}
+	return 0, 0, errors.New(STOCK_UPDATE_CONFLICT + medicineId)
+}
@@ -0,0 +1,383 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	common "github.com/KanapuramVaishnavi/Core/coreServices"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func noteField(key string, label string, fieldType string, required bool, options ...string) map[string]interface{} {
+	field := map[string]interface{}{"key": key, "label": label, "type": fieldType, "required": required}
+	if len(options) > 0 {
+		list := []interface{}{}
+		for _, option := range options {
+			list = append(list, option)
+		}
+		field["options"] = list
+	}
+	return field
+}
+
+/*
+* Templates available to every hospital, seeded when there are no global templates yet
+ */
+var defaultNoteTemplates = []map[string]interface{}{
+	{
+		"name":       "General consultation",
+		"department": NOTE_DEPARTMENT_GENERAL,
+		"sections": map[string]interface{}{
+			"subjective": []interface{}{
+				noteField("chiefComplaint", "Chief complaint", NOTE_FIELD_TEXT, true),
+				noteField("historyOfPresentIllness", "History of present illness", NOTE_FIELD_TEXT, false),
+			},
+			"objective": []interface{}{
+				noteField("examination", "General examination", NOTE_FIELD_TEXT, false),
+			},
+			"assessment": []interface{}{
+				noteField("impression", "Impression", NOTE_FIELD_TEXT, true),
+			},
+			"plan": []interface{}{
+				noteField("plan", "Plan", NOTE_FIELD_TEXT, true),
+				noteField("followUpDays", "Follow up in days", NOTE_FIELD_NUMBER, false),
+			},
+		},
+	},
+	{
+		"name":       "Cardiology consultation",
+		"department": "CARDIOLOGY",
+		"sections": map[string]interface{}{
+			"subjective": []interface{}{
+				noteField("chiefComplaint", "Chief complaint", NOTE_FIELD_TEXT, true),
+				noteField("chestPain", "Chest pain", NOTE_FIELD_BOOLEAN, true),
+				noteField("dyspneaNYHA", "Dyspnea(NYHA class)", NOTE_FIELD_CHOICE, false, "I", "II", "III", "IV"),
+				noteField("palpitations", "Palpitations", NOTE_FIELD_BOOLEAN, false),
+			},
+			"objective": []interface{}{
+				noteField("heartSounds", "Heart sounds", NOTE_FIELD_TEXT, false),
+				noteField("murmur", "Murmur", NOTE_FIELD_BOOLEAN, false),
+				noteField("pedalEdema", "Pedal edema", NOTE_FIELD_BOOLEAN, false),
+				noteField("ecg", "ECG findings", NOTE_FIELD_TEXT, false),
+				noteField("ejectionFraction", "Ejection fraction(%)", NOTE_FIELD_NUMBER, false),
+			},
+			"assessment": []interface{}{
+				noteField("impression", "Impression", NOTE_FIELD_TEXT, true),
+			},
+			"plan": []interface{}{
+				noteField("plan", "Plan", NOTE_FIELD_TEXT, true),
+				noteField("investigations", "Investigations", NOTE_FIELD_TEXT, false),
+			},
+		},
+	},
+	{
+		"name":       "Pediatric consultation",
+		"department": "PEDIATRICS",
+		"sections": map[string]interface{}{
+			"subjective": []interface{}{
+				noteField("chiefComplaint", "Chief complaint", NOTE_FIELD_TEXT, true),
+				noteField("informant", "Informant", NOTE_FIELD_CHOICE, false, "MOTHER", "FATHER", "GUARDIAN", "SELF", "OTHER"),
+				noteField("feeding", "Feeding history", NOTE_FIELD_TEXT, false),
+				noteField("immunizationUpToDate", "Immunization up to date", NOTE_FIELD_BOOLEAN, false),
+			},
+			"objective": []interface{}{
+				noteField("headCircumference", "Head circumference(cm)", NOTE_FIELD_NUMBER, false),
+				noteField("developmentalMilestones", "Developmental milestones", NOTE_FIELD_CHOICE, false, "APPROPRIATE", "DELAYED"),
+				noteField("examination", "Examination", NOTE_FIELD_TEXT, false),
+			},
+			"assessment": []interface{}{
+				noteField("impression", "Impression", NOTE_FIELD_TEXT, true),
+			},
+			"plan": []interface{}{
+				noteField("plan", "Plan", NOTE_FIELD_TEXT, true),
+				noteField("adviceToParents", "Advice to parents", NOTE_FIELD_TEXT, false),
+			},
+		},
+	},
+}
+
+/*
+* Validate the fields of every section {key, label, type, options, required}
+* At least one SOAP section must have fields
+ */
+func normalizeTemplateSections(raw interface{}) (map[string]interface{}, error) {
+	sections, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, errors.New(TEMPLATE_SECTIONS_REQUIRED)
+	}
+	result := make(map[string]interface{})
+	for name, value := range sections {
+		if !slices.Contains(NoteSections, name) {
+			return nil, errors.New(INVALID_NOTE_SECTION + name)
+		}
+		fields, ok := value.([]interface{})
+		if !ok {
+			return nil, errors.New(INVALID_TEMPLATE_FIELD)
+		}
+		seen := map[string]bool{}
+		normalized := []interface{}{}
+		for _, f := range fields {
+			field, ok := f.(map[string]interface{})
+			if !ok {
+				return nil, errors.New(INVALID_TEMPLATE_FIELD)
+			}
+			key := strings.TrimSpace(getString(field["key"]))
+			label := strings.TrimSpace(getString(field["label"]))
+			fieldType := strings.ToUpper(strings.TrimSpace(getString(field["type"])))
+			if key == "" || label == "" || !slices.Contains(NoteFieldTypes, fieldType) {
+				return nil, errors.New(INVALID_TEMPLATE_FIELD)
+			}
+			if seen[key] {
+				return nil, errors.New(DUPLICATE_TEMPLATE_FIELD + key)
+			}
+			seen[key] = true
+			required, _ := field["required"].(bool)
+			entry := map[string]interface{}{"key": key, "label": label, "type": fieldType, "required": required}
+			if fieldType == NOTE_FIELD_CHOICE {
+				options := []interface{}{}
+				for _, o := range toList(field["options"]) {
+					if option := strings.TrimSpace(getString(o)); option != "" {
+						options = append(options, option)
+					}
+				}
+				if len(options) == 0 {
+					return nil, errors.New(INVALID_TEMPLATE_FIELD)
+				}
+				entry["options"] = options
+			}
+			normalized = append(normalized, entry)
+		}
+		if len(normalized) > 0 {
+			result[name] = normalized
+		}
+	}
+	if len(result) == 0 {
+		return nil, errors.New(TEMPLATE_SECTIONS_REQUIRED)
+	}
+	return result, nil
+}
+
+/*
+* Templates visible to the user: global ones, the ones of the tenant and the ones of the hospital
+ */
+func noteTemplateScope(c *gin.Context) (bson.M, error) {
+	if c.GetBool("isSuperAdmin") {
+		return bson.M{}, nil
+	}
+	global := bson.M{"hospitalId": bson.M{"$exists": false}, "tenantId": bson.M{"$exists": false}}
+	tenantWide := bson.M{"hospitalId": bson.M{"$exists": false}, "tenantId": c.GetString("tenantId")}
+	switch c.GetString("collection") {
+	case util.TenantCollection:
+		return bson.M{"$or": []bson.M{global, {"tenantId": c.GetString("code")}}}, nil
+	case util.HospitalCollection:
+		return bson.M{"$or": []bson.M{global, tenantWide, {"hospitalId": c.GetString("code")}}}, nil
+	case util.PatientCollection, util.GuardianCollection:
+		return nil, errors.New(util.INVALID_USER_TO_ACCESS)
+	}
+	hospitalId, err := fetchStaffHospital(c)
+	if err != nil {
+		return nil, err
+	}
+	return bson.M{"$or": []bson.M{global, tenantWide, {"hospitalId": hospitalId}}}, nil
+}
+
+/*
+* Super admin creates the global templates, tenant the templates of all its hospitals
+* and the hospital the templates of its own departments
+ */
+func CreateNoteTemplate(c *gin.Context, data map[string]interface{}) (string, error) {
+	if err := common.GetTrimmedString(data, "name"); err != nil {
+		log.Println("Error from getTrimmedString: ", err)
+		return "", err
+	}
+	if err := common.GetTrimmedString(data, "department"); err != nil {
+		log.Println("Error from getTrimmedString: ", err)
+		return "", err
+	}
+	sections, err := normalizeTemplateSections(data["sections"])
+	if err != nil {
+		return "", err
+	}
+	code, err := GenerateCode(NoteTemplateCollection)
+	if err != nil {
+		log.Println("Error from generateCode: ", err)
+		return "", err
+	}
+	userId := c.GetString("code")
+	template := map[string]interface{}{
+		"code":       code,
+		"name":       data["name"],
+		"department": strings.ToUpper(getString(data["department"])),
+		"sections":   sections,
+		"isActive":   true,
+		"createdBy":  userId,
+		"createdAt":  time.Now(),
+		"updatedBy":  userId,
+		"updatedAt":  time.Now(),
+	}
+	if !c.GetBool("isSuperAdmin") {
+		switch c.GetString("collection") {
+		case util.TenantCollection:
+			template["tenantId"] = userId
+		case util.HospitalCollection:
+			template["hospitalId"] = userId
+			template["tenantId"] = c.GetString("tenantId")
+		default:
+			return "", errors.New(util.INVALID_USER_TO_ACCESS)
+		}
+	}
+	collection := db.OpenCollections(NoteTemplateCollection)
+	if _, err := db.CreateOne(c, collection, template); err != nil {
+		log.Println("Error from createOne: ", err)
+		return "", err
+	}
+	return code, nil
+}
+
+func FetchNoteTemplateByCode(c *gin.Context, templateId string) (map[string]interface{}, error) {
+	filter, err := noteTemplateScope(c)
+	if err != nil {
+		return nil, err
+	}
+	filter = bson.M{"$and": []bson.M{filter, {"code": templateId}}}
+	template := make(map[string]interface{})
+	collection := db.OpenCollections(NoteTemplateCollection)
+	if err := db.FindOne(c, collection, filter, template); err != nil {
+		log.Println("Error from findOne(noteTemplate): ", err)
+		return nil, errors.New(NOTE_TEMPLATE_NOT_FOUND + templateId)
+	}
+	return template, nil
+}
+
+/*
+* Active templates visible to the user, optional department filter
+* Doctors get the templates of their department and the general ones when no department is given
+ */
+func FetchNoteTemplates(c *gin.Context, department string) ([]interface{}, error) {
+	filter, err := noteTemplateScope(c)
+	if err != nil {
+		return nil, err
+	}
+	conditions := []bson.M{filter, {"isActive": true}}
+	if department != "" {
+		conditions = append(conditions, bson.M{"department": strings.ToUpper(strings.TrimSpace(department))})
+	} else if c.GetString("collection") == util.DoctorCollection {
+		doctor, err := FetchDoctorByCode(c, c.GetString("code"))
+		if err != nil {
+			log.Println("Error from fetchDoctorByCode: ", err)
+			return nil, err
+		}
+		departments := []string{NOTE_DEPARTMENT_GENERAL}
+		if own := strings.ToUpper(strings.TrimSpace(getString(doctor["department"]))); own != "" {
+			departments = append(departments, own)
+		}
+		conditions = append(conditions, bson.M{"department": bson.M{"$in": departments}})
+	}
+	collection := db.OpenCollections(NoteTemplateCollection)
+	opts := options.Find().SetSort(bson.D{{Key: "department", Value: 1}, {Key: "name", Value: 1}})
+	templates, err := db.FindAll(c, collection, bson.M{"$and": conditions}, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	return templates, nil
+}
+
+/*
+* Update name, department, sections or isActive of a template, only by the one who created it
+* Notes written earlier keep their content, they donot depend on the template after they are saved
+ */
+func UpdateNoteTemplate(c *gin.Context, templateId string, data map[string]interface{}) (map[string]interface{}, error) {
+	template, err := FetchNoteTemplateByCode(c, templateId)
+	if err != nil {
+		return nil, err
+	}
+	if !c.GetBool("isSuperAdmin") && getString(template["createdBy"]) != c.GetString("code") {
+		return nil, errors.New(util.INVALID_USER_TO_ACCESS)
+	}
+	set := bson.M{"updatedBy": c.GetString("code"), "updatedAt": time.Now()}
+	for _, field := range []string{"name", "department"} {
+		if _, exists := data[field]; exists {
+			if err := common.GetTrimmedString(data, field); err != nil {
+				log.Println("Error from getTrimmedString: ", err)
+				return nil, err
+			}
+			set[field] = data[field]
+		}
+	}
+	if department, ok := set["department"].(string); ok {
+		set["department"] = strings.ToUpper(department)
+	}
+	if raw, exists := data["sections"]; exists {
+		sections, err := normalizeTemplateSections(raw)
+		if err != nil {
+			return nil, err
+		}
+		set["sections"] = sections
+	}
+	if value, exists := data["isActive"]; exists {
+		isActive, ok := value.(bool)
+		if !ok {
+			return nil, errors.New(INVALID_IS_ACTIVE)
+		}
+		set["isActive"] = isActive
+	}
+	collection := db.OpenCollections(NoteTemplateCollection)
+	if _, err := db.UpdateOne(c, collection, bson.M{"code": templateId}, bson.M{"$set": set}); err != nil {
+		log.Println("Error from updateOne: ", err)
+		return nil, err
+	}
+	for key, value := range set {
+		template[key] = value
+	}
+	return template, nil
+}
+
+/*
+* Seed the global templates(general, cardiology, pediatrics) once
+ */
+func SeedDefaultNoteTemplates() error {
+	c := context.Background()
+	collection := db.OpenCollections(NoteTemplateCollection)
+	existing := make(map[string]interface{})
+	global := bson.M{"hospitalId": bson.M{"$exists": false}, "tenantId": bson.M{"$exists": false}}
+	if err := db.FindOne(c, collection, global, existing); err == nil {
+		return nil
+	}
+	for _, defaults := range defaultNoteTemplates {
+		sections, err := normalizeTemplateSections(defaults["sections"])
+		if err != nil {
+			return err
+		}
+		code, err := GenerateCode(NoteTemplateCollection)
+		if err != nil {
+			log.Println("Error from generateCode: ", err)
+			return err
+		}
+		template := map[string]interface{}{
+			"code":       code,
+			"name":       defaults["name"],
+			"department": defaults["department"],
+			"sections":   sections,
+			"isActive":   true,
+			"createdBy":  "SYSTEM",
+			"createdAt":  time.Now(),
+			"updatedBy":  "SYSTEM",
+			"updatedAt":  time.Now(),
+		}
+		if _, err := db.CreateOne(c, collection, template); err != nil {
+			log.Println("Error from createOne: ", err)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,433 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	redis "github.com/KanapuramVaishnavi/Core/config/redis"
+	common "github.com/KanapuramVaishnavi/Core/coreServices"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+* Check whether any medicine in the bill still has pendingTablets
+ */
+func HasPendingMedicines(billMedicines []map[string]interface{}) bool {
+	for _, item := range billMedicines {
+		pending, _ := strconv.Atoi(getString(item["pendingTablets"]))
+		if pending > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+* For every medicine which was not dispensed completely
+* Create a pending dispense entry for the patient linked with the bill
+* Save to db and cache
+ */
+func CreatePendingDispenses(c *gin.Context, bill map[string]interface{}, billMedicines []map[string]interface{}) error {
+	collection := db.OpenCollections(PendingDispenseCollection)
+	for _, item := range billMedicines {
+		pending, _ := strconv.Atoi(getString(item["pendingTablets"]))
+		// lines of a supplementary bill are already tracked by their pending dispense entry
+		if pending <= 0 || item["pendingDispenseId"] != nil {
+			continue
+		}
+		code, err := GenerateCode(PendingDispenseCollection)
+		if err != nil {
+			log.Println("Error from generateCode: ", err)
+			return err
+		}
+		entry := map[string]interface{}{
+			"code":            code,
+			"billId":          bill["code"],
+			"patientId":       bill["patientId"],
+			"medicalId":       bill["medicalId"],
+			"prescriptionId":  bill["prescripitonId"],
+			"medicineId":      item["medicineId"],
+			"requiredTablets": item["requiredTablets"],
+			"pendingTablets":  strconv.Itoa(pending),
+			"status":          PENDING_DISPENSE_STATUS_PENDING,
+			"dispenses":       []interface{}{},
+			"tenantId":        bill["tenantId"],
+			"hospitalId":      bill["hospitalId"],
+			"createdBy":       bill["createdBy"],
+			"updatedBy":       bill["createdBy"],
+			"createdAt":       time.Now(),
+			"updatedAt":       time.Now(),
+		}
+		inserted, err := db.CreateOne(c, collection, entry)
+		if err != nil {
+			log.Println("Error from createOne: ", err)
+			return err
+		}
+		log.Println("Inserted pending dispense: ", inserted.InsertedID)
+		err = redis.SetCache(c, PendingDispenseKey+code, entry)
+		if err != nil {
+			log.Println("Error from setCache: ", err)
+		}
+	}
+	return nil
+}
+
+/*
+* Make a filter
+* According to the user,the filter condition changes
+* patientId and status from the query narrow down the list
+* Return the oldest entries first
+ */
+func FetchAllPendingDispenses(c *gin.Context, patientId string, status string) ([]interface{}, error) {
+	code := c.GetString("code")
+	ctxCollection := c.GetString("collection")
+	isSuperAdmin := c.GetBool("isSuperAdmin")
+
+	filter := bson.M{}
+	if isSuperAdmin {
+		filter = bson.M{}
+	} else if ctxCollection == util.TenantCollection {
+		filter["tenantId"] = code
+	} else if ctxCollection == util.HospitalCollection {
+		filter["hospitalId"] = code
+	} else if ctxCollection == util.PharmacistCollection {
+		pharmacist, err := FetchPharmacistByCode(c, code)
+		if err != nil {
+			log.Println("Error from fetchPharmacistByCode: ", err)
+			return nil, err
+		}
+		filter["hospitalId"] = pharmacist["createdBy"].(string)
+	} else if ctxCollection == util.PatientCollection {
+		filter["patientId"] = code
+	} else {
+		log.Println("This user doesnot have access")
+		return nil, errors.New(util.INVALID_USER_TO_ACCESS)
+	}
+	if patientId != "" {
+		if ctxCollection == util.PatientCollection && patientId != code {
+			return nil, errors.New(util.PATIENT_DOESNOT_HAVE_ACCESS)
+		}
+		filter["patientId"] = patientId
+	}
+	if status != "" {
+		filter["status"] = status
+	}
+	collection := db.OpenCollections(PendingDispenseCollection)
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	docs, err := db.FindAll(c, collection, filter, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	return docs, nil
+}
+
+/*
+* Called after a medicine is restocked
+* Walk through the pending entries of the medicine from the oldest
+* Mark them READY while the new stock covers them and mail the patient to come back
+ */
+func NotifyPendingDispenses(c *gin.Context, medicine map[string]interface{}) error {
+	available, _ := strconv.Atoi(getString(medicine["totalNoOfTablets"]))
+	if available <= 0 {
+		return nil
+	}
+	collection := db.OpenCollections(PendingDispenseCollection)
+	filter := bson.M{
+		"medicineId": medicine["code"],
+		"hospitalId": medicine["hospitalId"],
+		"status":     PENDING_DISPENSE_STATUS_PENDING,
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	docs, err := db.FindAll(c, collection, filter, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return err
+	}
+	code := c.GetString("code")
+	for _, d := range docs {
+		entry, ok := d.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		pending, _ := strconv.Atoi(getString(entry["pendingTablets"]))
+		if pending > available {
+			break
+		}
+		available -= pending
+		entryCode := entry["code"].(string)
+		update := bson.M{"$set": bson.M{
+			"status":     PENDING_DISPENSE_STATUS_READY,
+			"notifiedAt": time.Now(),
+			"updatedBy":  code,
+			"updatedAt":  time.Now(),
+		}}
+		result, err := db.UpdateOne(c, collection, bson.M{"code": entryCode, "status": PENDING_DISPENSE_STATUS_PENDING}, update)
+		if err != nil {
+			log.Println("Error from updateOne: ", err)
+			return err
+		}
+		if result.MatchedCount == 0 {
+			available += pending
+			continue
+		}
+		if err := redis.DeleteCache(c, PendingDispenseKey+entryCode); err != nil {
+			log.Println("Error from deleteCache: ", err)
+		}
+		notifyPatientForPendingDispense(c, getString(entry["patientId"]), getString(medicine["name"]))
+	}
+	return nil
+}
+
+func notifyPatientForPendingDispense(c *gin.Context, patientId string, medicineName string) {
+	patient, err := FetchPatientByCode(c, patientId)
+	if err != nil {
+		log.Println("Unable to fetch patient for pending dispense notification: ", err)
+		return
+	}
+	email, ok := patient["email"].(string)
+	if !ok || email == "" {
+		log.Println("Patient doesnot have email to notify: ", patientId)
+		return
+	}
+	subject := "Your pending medicine is available"
+	body := fmt.Sprintf("Hello %s,\n\nThe pending medicine %s from your prescription is now available at the pharmacy. Please collect it at your convenience.\n\nThank you!", getString(patient["name"]), medicineName)
+	if err := common.SendOTPToMail(email, subject, body); err != nil {
+		log.Println("Pending dispense mail failed: ", err)
+	}
+}
+
+/*
+* Take the entry for this dispense, conditioned on the status it was read with
+* Entries left DISPENSING by a dispense which did not finish are taken again after DISPENSE_CLAIM_MINUTES
+* Returns the status to go back to when the dispense fails, false when another dispense took the entry
+ */
+func claimPendingDispense(c *gin.Context, entry map[string]interface{}) (string, bool, error) {
+	filter := bson.M{"code": entry["code"], "status": entry["status"]}
+	claimedFrom := getString(entry["status"])
+	if claimedFrom == PENDING_DISPENSE_STATUS_DISPENSING {
+		filter["claimedAt"] = entry["claimedAt"]
+		claimedFrom = getString(entry["claimedFrom"])
+	}
+	update := bson.M{"$set": bson.M{
+		"status":      PENDING_DISPENSE_STATUS_DISPENSING,
+		"claimedFrom": claimedFrom,
+		"claimedBy":   c.GetString("code"),
+		"claimedAt":   time.Now(),
+	}}
+	result, err := db.UpdateOne(c, db.OpenCollections(PendingDispenseCollection), filter, update)
+	if err != nil {
+		log.Println("Error from updateOne(claim): ", err)
+		return "", false, err
+	}
+	return claimedFrom, result.MatchedCount == 1, nil
+}
+
+/*
+* Fetch the patient and check the pharmacist belongs to the same hospital
+* Dispense the open pending entries(PENDING/READY) with the current stock, each entry is claimed(DISPENSING) first
+* so two dispenses cannot both bill it, the stock is taken with adjustMedicineStock
+* Create a supplementary bill for the dispensed quantity, the stock is given back and the entries released when the bill is not saved
+* Once the bill is saved, update every claimed entry with the remaining pendingTablets and the supplementary billId
+ */
+func DispensePendingMedicines(c *gin.Context, patientId string) (map[string]interface{}, error) {
+	patient, err := FetchPatientByCode(c, patientId)
+	if err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, err
+	}
+	err = CheckForAccess(c, patient)
+	if err != nil {
+		log.Println("Error from checkForAccess: ", err)
+		return nil, err
+	}
+	pharmacistId := c.GetString("code")
+	collection := db.OpenCollections(PendingDispenseCollection)
+	filter := bson.M{
+		"patientId":  patientId,
+		"hospitalId": patient["hospitalId"],
+		"$or": bson.A{
+			bson.M{"status": bson.M{"$in": []string{PENDING_DISPENSE_STATUS_PENDING, PENDING_DISPENSE_STATUS_READY}}},
+			bson.M{
+				"status":    PENDING_DISPENSE_STATUS_DISPENSING,
+				"claimedAt": bson.M{"$lt": time.Now().Add(-time.Duration(DISPENSE_CLAIM_MINUTES) * time.Minute)},
+			},
+		},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	docs, err := db.FindAll(c, collection, filter, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, errors.New(NO_PENDING_MEDICINES_FOR_PATIENT)
+	}
+	billCode, err := common.GenerateEmpCode(util.BillCollection)
+	if err != nil {
+		log.Println("Error from generateEmpCode: ", err)
+		return nil, err
+	}
+
+	var billMedicines []map[string]interface{}
+	parentBills := []string{}
+	seenBills := map[string]bool{}
+	total := 0
+	var tenantId, medicalId, prescriptionId interface{}
+	taken := map[string]int{}
+	claimed := map[string]string{}
+	giveBackStock := func() {
+		for medicineId, tablets := range taken {
+			if _, _, err := adjustMedicineStock(c, medicineId, tablets); err != nil {
+				log.Println("Error while giving back the stock of the pending dispense: ", medicineId, err)
+			}
+		}
+		for entryCode, status := range claimed {
+			release := bson.M{"$set": bson.M{"status": status}, "$unset": bson.M{"claimedFrom": "", "claimedBy": "", "claimedAt": ""}}
+			if _, err := db.UpdateOne(c, collection, bson.M{"code": entryCode, "status": PENDING_DISPENSE_STATUS_DISPENSING}, release); err != nil {
+				log.Println("Error while releasing the pending dispense: ", entryCode, err)
+			}
+		}
+	}
+	for _, d := range docs {
+		entry, ok := d.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		medicineId := getString(entry["medicineId"])
+		pending, _ := strconv.Atoi(getString(entry["pendingTablets"]))
+		pricePerStrip, tabletsPerStrip, available, err := FetchFieldsFromMedicine(c, medicineId)
+		if err != nil {
+			log.Println("Error from fetchFieldsFromMedicine: ", err)
+			giveBackStock()
+			return nil, err
+		}
+		if available <= 0 {
+			continue
+		}
+		claimedFrom, ok, err := claimPendingDispense(c, entry)
+		if err != nil {
+			giveBackStock()
+			return nil, err
+		}
+		if !ok {
+			log.Println("Pending dispense taken by another dispense: ", entry["code"])
+			continue
+		}
+		claimed[getString(entry["code"])] = claimedFrom
+		item, price := calculateMedicineLine(medicineId, pending, pricePerStrip, tabletsPerStrip, available)
+		medicine, err := FetchMedicineByCode(c, medicineId)
+		if err != nil {
+			log.Println("Error from fetchMedicineByCode: ", err)
+			giveBackStock()
+			return nil, err
+		}
+		// controlled medicines are billed now, but the stock is reduced only after the witness sign-off
+		if IsControlledMedicine(medicine) {
+			item["isControlled"] = true
+			item["awaitingWitness"] = true
+			item["isDispensed"] = false
+		} else {
+			dispensed, _ := strconv.Atoi(getString(item["dispensedTablets"]))
+			if _, _, err := adjustMedicineStock(c, medicineId, -dispensed); err != nil {
+				log.Println("Error from adjustMedicineStock: ", err)
+				giveBackStock()
+				return nil, err
+			}
+			taken[medicineId] += dispensed
+		}
+		item["pendingDispenseId"] = entry["code"]
+		billMedicines = append(billMedicines, item)
+		total += price
+
+		parentBill := getString(entry["billId"])
+		if !seenBills[parentBill] {
+			seenBills[parentBill] = true
+			parentBills = append(parentBills, parentBill)
+		}
+		tenantId, medicalId, prescriptionId = entry["tenantId"], entry["medicalId"], entry["prescriptionId"]
+	}
+	if len(billMedicines) == 0 {
+		giveBackStock()
+		return nil, errors.New(NO_STOCK_FOR_PENDING_MEDICINES)
+	}
+
+	bill := bson.M{
+		"code":                billCode,
+		"billType":            BILL_TYPE_SUPPLEMENTARY,
+		"parentBillIds":       parentBills,
+		"medicines":           billMedicines,
+		"tests":               []interface{}{},
+		"amountForTests":      "0",
+		"amountForMedicine":   strconv.Itoa(total),
+		"amount":              strconv.Itoa(total),
+		"hasPendingMedicines": HasPendingMedicines(billMedicines),
+		"tenantId":            tenantId,
+		"hospitalId":          patient["hospitalId"],
+		"prescripitonId":      prescriptionId,
+		"medicalId":           medicalId,
+		"patientId":           patientId,
+		"createdBy":           pharmacistId,
+		"updatedBy":           pharmacistId,
+		"createdAt":           time.Now(),
+		"updatedAt":           time.Now(),
+	}
+	saveErr := SaveBill(c, bill, billMedicines)
+	if saveErr != nil {
+		log.Println("Error from saveBill: ", saveErr)
+		if !billSaved(c, billCode) {
+			giveBackStock()
+			return nil, saveErr
+		}
+		// the bill is saved and the stock taken, the entries are updated so a retry doesnot dispense them again
+	}
+
+	for _, item := range billMedicines {
+		remaining := getString(item["pendingTablets"])
+		status := PENDING_DISPENSE_STATUS_PENDING
+		if remaining == "0" {
+			status = PENDING_DISPENSE_STATUS_DISPENSED
+		}
+		entryCode := getString(item["pendingDispenseId"])
+		update := bson.M{
+			"$set": bson.M{
+				"pendingTablets": remaining,
+				"status":         status,
+				"updatedBy":      pharmacistId,
+				"updatedAt":      time.Now(),
+			},
+			"$push": bson.M{
+				"dispenses": bson.M{
+					"billId":           billCode,
+					"dispensedTablets": item["dispensedTablets"],
+					"dispensedBy":      pharmacistId,
+					"dispensedAt":      time.Now(),
+				},
+			},
+		}
+		update["$unset"] = bson.M{"claimedFrom": "", "claimedBy": "", "claimedAt": ""}
+		result, err := db.UpdateOne(c, collection, bson.M{"code": entryCode, "status": PENDING_DISPENSE_STATUS_DISPENSING}, update)
+		if err != nil {
+			log.Println("Error from updateOne: ", err)
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			log.Println("Pending dispense is no longer claimed by this dispense: ", entryCode)
+		}
+		if err := redis.DeleteCache(c, PendingDispenseKey+entryCode); err != nil {
+			log.Println("Error from deleteCache: ", err)
+		}
+	}
+	if saveErr != nil {
+		return nil, saveErr
+	}
+	return bill, nil
+}
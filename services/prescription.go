@@ -48,14 +48,33 @@ func ValidateMedicines(rawMedicines []interface{}) error {
 	}
 	return nil
 }
+
+/*
+* medicineId and instructions are always required
+* If a schedule is given, it is validated by the dosage schedule model
+* Otherwise dosagePerFrequency, noOfDays and frequency(morning/afternoon/night) are required
+ */
 func ValidateMedicineFields(medicine map[string]interface{}) error {
-	fields := []string{"medicineId", "instructions", "dosagePerFrequency", "noOfDays"}
+	fields := []string{"medicineId", "instructions"}
 	for _, field := range fields {
 		err := common.GetTrimmedString(medicine, field)
 		if err != nil {
 			return err
 		}
 	}
+	if raw, exists := medicine["schedule"]; exists && raw != nil {
+		schedule, ok := raw.(map[string]interface{})
+		if !ok {
+			return errors.New(SCHEDULE_MUST_BE_AN_OBJECT)
+		}
+		return ValidateDosageSchedule(schedule)
+	}
+	for _, field := range []string{"dosagePerFrequency", "noOfDays"} {
+		err := common.GetTrimmedString(medicine, field)
+		if err != nil {
+			return err
+		}
+	}
 	frequency, ok := medicine["frequency"].(map[string]interface{})
 	if !ok {
 		log.Println("Frequency must be an object")
@@ -76,7 +95,12 @@ func ValidateMedicineFields(medicine map[string]interface{}) error {
 /*
 * Validate user inputs first
 * Verify whether the doctor can create prescription for that medicalRecord
+* diagnoses are the coded(ICD-10) diagnoses, diagnosis text is taken from the primary one when not given
 * Check the fields and Generate a code and then createdBy
+* Controlled medicines need an eligible doctor and noOfDays within maxDays
+* Medicines matching a drug allergy of the patient need allergyOverrideReason
+* This is the first version of the prescription, amendments create new versions
+* refills and refillIntervalDays make it a repeat prescription
 * Fetch tenantId from context
 * Include tenantId and generate otp and hash the otp
 * Combine all the remaining data and prepare it
@@ -102,9 +126,9 @@ func CreatePrescription(c *gin.Context, data map[string]interface{}, medicalReco
 		log.Println("Medicines field must be list of interface")
 		return "", errors.New(util.MEDICINES_MUST_BE_ARRAY)
 	}
-	err = common.GetTrimmedString(data, "diagnosis")
+	err = prepareDiagnosisFields(c, data)
 	if err != nil {
-		log.Println("Error from getTrimmedString: ", err)
+		log.Println("Error from prepareDiagnosisFields: ", err)
 		return "", err
 	}
 	err = ValidateMedicines(rawMedicines)
@@ -112,6 +136,11 @@ func CreatePrescription(c *gin.Context, data map[string]interface{}, medicalReco
 		log.Println("Error from validateMedicines: ", err)
 		return "", err
 	}
+	err = normalizeRepeatFields(data)
+	if err != nil {
+		log.Println("Error from normalizeRepeatFields: ", err)
+		return "", err
+	}
 
 	tenantId, err := common.GetFromContext[string](c, "tenantId")
 	if err != nil {
@@ -129,19 +158,47 @@ func CreatePrescription(c *gin.Context, data map[string]interface{}, medicalReco
 		log.Println("Error from fetchDoctorByCode: ", err)
 		return "", err
 	}
+	err = ValidateControlledMedicines(c, doctor, rawMedicines)
+	if err != nil {
+		log.Println("Error from validateControlledMedicines: ", err)
+		return "", err
+	}
+	allergyOverride, err := checkPrescriptionAllergies(c, getString(medicalRecord["patientId"]), rawMedicines, getString(data["allergyOverrideReason"]), nil)
+	if err != nil {
+		log.Println("Error from checkPrescriptionAllergies: ", err)
+		return "", err
+	}
+	delete(data, "allergyOverrideReason")
+	if allergyOverride != nil {
+		data["allergyOverride"] = allergyOverride
+	}
 	data["code"] = prescriptionCode
+	data["medicalRecordId"] = medicalRecordId
+	data["patientId"] = medicalRecord["patientId"]
+	data["issuedAt"] = time.Now()
+	data["version"] = 1
+	data["rootPrescriptionId"] = prescriptionCode
+	data["status"] = PRESCRIPTION_STATUS_ACTIVE
 	data["hospitalId"] = doctor["createdBy"].(string)
 	data["tenantId"] = tenantId
 	data["createdBy"] = doctorId
 	data["updatedBy"] = doctorId
 	data["createdAt"] = time.Now()
 	data["updatedAt"] = time.Now()
+	err = SignPrescription(c, doctor, data)
+	if err != nil {
+		log.Println("Error from signPrescription: ", err)
+		return "", err
+	}
 
 	collection := db.OpenCollections(coll)
 	_, err = db.CreateOne(c, collection, data)
 	if err != nil {
 		return "", err
 	}
+	if err := recordDiagnoses(c, data); err != nil {
+		log.Println("Error from recordDiagnoses: ", err)
+	}
 
 	medRecDoc := make(map[string]interface{})
 	medRecDoc["prescriptionId"] = prescriptionCode
@@ -275,18 +332,27 @@ func ValidateUpdatePrescriptionData(data map[string]interface{}, doctorId string
 		}
 		data["frequency"] = f
 	}
+	if raw, exists := data["schedule"]; exists && raw != nil {
+		schedule, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, errors.New(SCHEDULE_MUST_BE_AN_OBJECT)
+		}
+		if err := ValidateDosageSchedule(schedule); err != nil {
+			log.Println("Error from validateDosageSchedule: ", err)
+			return nil, err
+		}
+	}
 	data["updatedBy"] = doctorId
 	data["updatedAt"] = time.Now()
 	return data, nil
 }
 
 /*
-* If fields provided,trim them and append to the input data
-* Get the code from claims which is createdBy field
-* Update based on the search filters and update fields
-* Update this prescription
-* Fetch updated document
-* Delete from cache, set in Cache
+* Prescriptions are immutable once issued, the change is saved as a new version
+* reason is required and the fields provided are trimmed and validated
+* Fetch the latest version, check the doctor issued it
+* Copy the medicines and apply the change on the given medicine(frequency is merged)
+* Create the new version
  */
 func UpdatePrescription(c *gin.Context, prescriptionId string, medicineId string, data map[string]interface{}) (string, error) {
 	doctorId, err := common.GetFromContext[string](c, "code")
@@ -294,65 +360,81 @@ func UpdatePrescription(c *gin.Context, prescriptionId string, medicineId string
 		log.Println("Error from getFromContext: ", err)
 		return "", err
 	}
+	reason, err := fetchAmendmentReason(data)
+	if err != nil {
+		return "", err
+	}
 	err = common.TrimIfExists(data, "diagnosis")
 	if err != nil {
 		log.Println("Error from trimIfExists: ", err)
 		return "", err
 	}
+	changes := make(map[string]interface{})
+	if diagnosis, exists := data["diagnosis"]; exists {
+		changes["diagnosis"] = diagnosis
+		delete(data, "diagnosis")
+	}
+	if overrideReason, exists := data["allergyOverrideReason"]; exists {
+		changes["allergyOverrideReason"] = overrideReason
+		delete(data, "allergyOverrideReason")
+	}
 	data, err = ValidateUpdatePrescriptionData(data, doctorId)
 	if err != nil {
 		log.Println("Error from validateUpdatePrescriptionData: ", err)
 		return "", err
 	}
-	coll := util.PrescriptionCollection
-	collection := db.OpenCollections(coll)
-	filter := bson.M{
-		"code":                 prescriptionId,
-		"medicines.medicineId": medicineId,
-	}
-	result := make(map[string]interface{})
-	err = db.FindOne(c, collection, filter, result)
+	previous, err := fetchPrescriptionForAmendment(c, prescriptionId, doctorId)
 	if err != nil {
-		log.Println("Error from findOne(while fetching prescription): ", err)
+		log.Println("Error from fetchPrescriptionForAmendment: ", err)
 		return "", err
 	}
-	docFromPrescriptionVal, ok := result["createdBy"].(string)
-	if !ok {
-		log.Println("createdBy(doctor) field doesnot exists in prescription")
-		return "", errors.New(util.UNABLE_TO_FETCH_CREATED_BY_FROM_PRESCRIPTION)
-	}
-	if doctorId != docFromPrescriptionVal {
-		log.Println("This doctor doesnot have access")
-		return "", errors.New(util.DOCTOR_DOESNOT_HAVE_ACCESS_TO_UPDATE)
-	}
-	updateFields := bson.M{}
-	for key, value := range data {
-		updateFields["medicines.$."+key] = value
-	}
-	update := bson.M{
-		"$set": updateFields,
-	}
-	updated, err := db.UpdateOne(c, collection, filter, update)
+	medicines, err := ExtractMedicines(previous)
 	if err != nil {
-		log.Println("Error from updateOne: ", err)
+		log.Println("Error from extractMedicines: ", err)
 		return "", err
 	}
-	log.Println("Updated prescription count: ", updated.ModifiedCount)
-	err = db.FindOne(c, collection, filter, result)
-	if err != nil {
-		log.Println("Error from findOne: ", err)
-		return "", err
+	found := false
+	updatedMedicines := make([]interface{}, 0, len(medicines))
+	for _, m := range medicines {
+		medicine, ok := m.(map[string]interface{})
+		if !ok {
+			return "", errors.New("invalid medicine format")
+		}
+		line := make(map[string]interface{})
+		for key, value := range medicine {
+			line[key] = value
+		}
+		if getString(line["medicineId"]) == medicineId {
+			found = true
+			for key, value := range data {
+				if key == "frequency" {
+					frequency := make(map[string]interface{})
+					if old, ok := line["frequency"].(map[string]interface{}); ok {
+						for k, v := range old {
+							frequency[k] = v
+						}
+					}
+					for k, v := range value.(map[string]interface{}) {
+						frequency[k] = v
+					}
+					line["frequency"] = frequency
+					continue
+				}
+				line[key] = value
+			}
+		}
+		updatedMedicines = append(updatedMedicines, line)
 	}
-	key := util.PrescriptionKey + prescriptionId
-	err = redis.DeleteCache(c, key)
-	if err != nil {
-		log.Println("Error from deleteCache: ", err)
+	if !found {
+		return "", errors.New(MEDICINE_NOT_FOUND_IN_PRESCRIPTION)
 	}
-	err = redis.SetCache(c, key, result)
+	changes["medicines"] = updatedMedicines
+	code, err := createPrescriptionVersion(c, previous, changes, reason, doctorId)
 	if err != nil {
-		log.Println("Error from setCache: ", err)
+		log.Println("Error from createPrescriptionVersion: ", err)
+		return "", err
 	}
-	return "updated successfully", nil
+	return fmt.Sprintf("Prescription amended as %s", code), nil
 }
 
 /*
@@ -0,0 +1,622 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+* Fields of the prescription covered by the signature
+* status, supersededBy and the audit fields can change after issue and are not signed
+ */
+var signedPrescriptionFields = []string{
+	"code", "version", "rootPrescriptionId", "previousVersionId", "medicalRecordId", "patientId",
+	"hospitalId", "tenantId", "createdBy", "diagnosis", "diagnoses", "medicines", "refills", "refillIntervalDays", "issuedAt",
+}
+
+/*
+* The private keys are encrypted(AES-GCM) with a key derived from SIGNING_KEY_SECRET
+ */
+func signingKeyCipher() (cipher.AEAD, error) {
+	secret := os.Getenv("SIGNING_KEY_SECRET")
+	if secret == "" {
+		return nil, errors.New(SIGNING_KEY_SECRET_NOT_SET)
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encryptPrivateKey(privateKey *rsa.PrivateKey) (string, error) {
+	gcm, err := signingKeyCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, x509.MarshalPKCS1PrivateKey(privateKey), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptPrivateKey(encrypted string) (*rsa.PrivateKey, error) {
+	gcm, err := signingKeyCipher()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return nil, errors.New(UNABLE_TO_READ_SIGNING_KEY)
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New(UNABLE_TO_READ_SIGNING_KEY)
+	}
+	return x509.ParsePKCS1PrivateKey(plain)
+}
+
+func encodePublicKey(publicKey *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+func decodePublicKey(encoded string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(encoded))
+	if block == nil {
+		return nil, errors.New(UNABLE_TO_READ_SIGNING_KEY)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New(UNABLE_TO_READ_SIGNING_KEY)
+	}
+	return publicKey, nil
+}
+
+/*
+* Generate a new key pair for the doctor and save it as the active key
+ */
+func createSigningKey(c *gin.Context, doctor map[string]interface{}) (map[string]interface{}, error) {
+	privateKey, publicKey, err := GenerateKeyPair()
+	if err != nil {
+		log.Println("Error from generateKeyPair: ", err)
+		return nil, err
+	}
+	encrypted, err := encryptPrivateKey(privateKey)
+	if err != nil {
+		log.Println("Error from encryptPrivateKey: ", err)
+		return nil, err
+	}
+	publicPem, err := encodePublicKey(publicKey)
+	if err != nil {
+		log.Println("Error from encodePublicKey: ", err)
+		return nil, err
+	}
+	code, err := GenerateCode(SigningKeyCollection)
+	if err != nil {
+		log.Println("Error from generateCode: ", err)
+		return nil, err
+	}
+	signingKey := map[string]interface{}{
+		"code":       code,
+		"doctorId":   doctor["code"],
+		"hospitalId": doctor["createdBy"],
+		"tenantId":   doctor["tenantId"],
+		"algorithm":  SIGNATURE_ALGORITHM,
+		"publicKey":  publicPem,
+		"privateKey": encrypted,
+		"status":     SIGNING_KEY_STATUS_ACTIVE,
+		"createdAt":  time.Now(),
+	}
+	collection := db.OpenCollections(SigningKeyCollection)
+	inserted, err := db.CreateOne(c, collection, signingKey)
+	if err != nil {
+		log.Println("Error from createOne: ", err)
+		return nil, err
+	}
+	log.Println("Inserted signing key: ", inserted.InsertedID)
+	return signingKey, nil
+}
+
+/*
+* Return the active signing key of the user(doctor or lab verifier), the first signed document creates it
+ */
+func ensureSigningKey(c *gin.Context, doctor map[string]interface{}) (map[string]interface{}, error) {
+	signingKey := make(map[string]interface{})
+	collection := db.OpenCollections(SigningKeyCollection)
+	filter := bson.M{"doctorId": doctor["code"], "status": SIGNING_KEY_STATUS_ACTIVE}
+	err := db.FindOne(c, collection, filter, signingKey)
+	if err == nil {
+		return signingKey, nil
+	}
+	return createSigningKey(c, doctor)
+}
+
+/*
+* Public part of a signing key, the private key never leaves the service
+ */
+func publicSigningKey(signingKey map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"keyId":     signingKey["code"],
+		"doctorId":  signingKey["doctorId"],
+		"algorithm": signingKey["algorithm"],
+		"publicKey": signingKey["publicKey"],
+		"status":    signingKey["status"],
+		"createdAt": signingKey["createdAt"],
+		"rotatedAt": signingKey["rotatedAt"],
+	}
+}
+
+/*
+* Logged-in doctor fetches the active signing key(created if it doesnot exist yet)
+ */
+func FetchSigningKey(c *gin.Context) (map[string]interface{}, error) {
+	doctor, err := FetchDoctorByCode(c, c.GetString("code"))
+	if err != nil {
+		log.Println("Error from fetchDoctorByCode: ", err)
+		return nil, err
+	}
+	signingKey, err := ensureSigningKey(c, doctor)
+	if err != nil {
+		log.Println("Error from ensureSigningKey: ", err)
+		return nil, err
+	}
+	return publicSigningKey(signingKey), nil
+}
+
+/*
+* Logged-in doctor rotates the signing key(e.g. when the key is suspected to be compromised)
+* The old key is kept as ROTATED so the prescriptions signed with it still verify
+ */
+func RotateSigningKey(c *gin.Context) (map[string]interface{}, error) {
+	doctor, err := FetchDoctorByCode(c, c.GetString("code"))
+	if err != nil {
+		log.Println("Error from fetchDoctorByCode: ", err)
+		return nil, err
+	}
+	collection := db.OpenCollections(SigningKeyCollection)
+	filter := bson.M{"doctorId": doctor["code"], "status": SIGNING_KEY_STATUS_ACTIVE}
+	update := bson.M{"$set": bson.M{"status": SIGNING_KEY_STATUS_ROTATED, "rotatedAt": time.Now()}}
+	_, err = collection.UpdateMany(c, filter, update)
+	if err != nil {
+		log.Println("Error from updateMany: ", err)
+		return nil, err
+	}
+	signingKey, err := createSigningKey(c, doctor)
+	if err != nil {
+		log.Println("Error from createSigningKey: ", err)
+		return nil, err
+	}
+	return publicSigningKey(signingKey), nil
+}
+
+/*
+* Normalize the values read from mongo and the values built in the request to the same form
+* dates in UTC with millisecond precision(as stored in mongo), every number as float64
+ */
+func canonicalValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC().Truncate(time.Millisecond).Format("2006-01-02T15:04:05.000Z")
+	case primitive.DateTime:
+		return v.Time().UTC().Format("2006-01-02T15:04:05.000Z")
+	case int, int32, int64:
+		return float64(toInt(v))
+	case float32:
+		return float64(v)
+	case primitive.D:
+		return canonicalValue(v.Map())
+	case primitive.M:
+		return canonicalValue(map[string]interface{}(v))
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if item == nil {
+				continue
+			}
+			result[key] = canonicalValue(item)
+		}
+		return result
+	case primitive.A:
+		return canonicalValue([]interface{}(v))
+	case []map[string]interface{}:
+		result := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			result = append(result, canonicalValue(item))
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			result = append(result, canonicalValue(item))
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+/*
+* Canonical serialization of the signed fields
+* json encodes the map keys in sorted order so the same prescription always gives the same bytes
+ */
+func CanonicalPrescription(prescription map[string]interface{}) ([]byte, error) {
+	payload := make(map[string]interface{})
+	for _, field := range signedPrescriptionFields {
+		if value, exists := prescription[field]; exists && value != nil {
+			payload[field] = canonicalValue(value)
+		}
+	}
+	return json.Marshal(payload)
+}
+
+/*
+* Token printed in the QR code, the verification endpoint needs it along with the prescriptionId
+* so the prescriptions cannot be looked up just by guessing the codes
+ */
+func verificationToken(signatureValue string) string {
+	hash := sha256.Sum256([]byte(signatureValue))
+	return hex.EncodeToString(hash[:8])
+}
+
+/*
+* Base of the verification links printed in the QR codes, PUBLIC_BASE_URL or the local server
+ */
+func publicBaseURL() string {
+	base := strings.TrimRight(os.Getenv("PUBLIC_BASE_URL"), "/")
+	if base == "" {
+		base = "http://localhost:8080"
+	}
+	return base
+}
+
+func PrescriptionVerificationURL(prescription map[string]interface{}) string {
+	signature, _ := prescription["signature"].(map[string]interface{})
+	base := publicBaseURL()
+	return fmt.Sprintf("%s/verify/prescription/%s?token=%s", base, url.PathEscape(getString(prescription["code"])), verificationToken(getString(signature["value"])))
+}
+
+/*
+* Sign the canonical payload with the active key of the signer(doctor, lab verifier)
+* Returns the signature which is saved along with the signed document
+ */
+func signPayload(c *gin.Context, signer map[string]interface{}, payload []byte) (map[string]interface{}, error) {
+	signingKey, err := ensureSigningKey(c, signer)
+	if err != nil {
+		log.Println("Error from ensureSigningKey: ", err)
+		return nil, err
+	}
+	privateKey, err := decryptPrivateKey(getString(signingKey["privateKey"]))
+	if err != nil {
+		log.Println("Error from decryptPrivateKey: ", err)
+		return nil, err
+	}
+	value, err := SignData(payload, privateKey)
+	if err != nil {
+		log.Println("Error from signData: ", err)
+		return nil, err
+	}
+	hash := sha256.Sum256(payload)
+	return map[string]interface{}{
+		"keyId":       signingKey["code"],
+		"algorithm":   SIGNATURE_ALGORITHM,
+		"value":       value,
+		"payloadHash": hex.EncodeToString(hash[:]),
+		"signedBy":    signer["code"],
+		"signedAt":    time.Now(),
+	}, nil
+}
+
+/*
+* Sign the prescription with the active key of the doctor
+* Called after every signed field is set and before the prescription is saved
+ */
+func SignPrescription(c *gin.Context, doctor map[string]interface{}, prescription map[string]interface{}) error {
+	payload, err := CanonicalPrescription(prescription)
+	if err != nil {
+		log.Println("Error from canonicalPrescription: ", err)
+		return err
+	}
+	signature, err := signPayload(c, doctor, payload)
+	if err != nil {
+		log.Println("Error from signPayload: ", err)
+		return err
+	}
+	prescription["signature"] = signature
+	return nil
+}
+
+/*
+* Check the signature of the payload with the public key it was signed with
+* Returns the signing key, or the reason when the signature cannot be trusted
+* The caller checks the owner of the key(doctorId) against the signer of the document,
+* any valid key would pass otherwise
+ */
+func checkSignature(c context.Context, signature map[string]interface{}, payload []byte) (map[string]interface{}, string) {
+	signingKey, reason := fetchSignatureKey(c, signature)
+	if reason != "" {
+		return nil, reason
+	}
+	if reason := verifyWithSigningKey(signingKey, signature, payload); reason != "" {
+		return nil, reason
+	}
+	return signingKey, ""
+}
+
+func fetchSignatureKey(c context.Context, signature map[string]interface{}) (map[string]interface{}, string) {
+	signingKey := make(map[string]interface{})
+	keyColl := db.OpenCollections(SigningKeyCollection)
+	err := db.FindOne(c, keyColl, bson.M{"code": signature["keyId"]}, signingKey)
+	if err != nil {
+		log.Println("Error from findOne(signingKey): ", err)
+		return nil, SIGNING_KEY_NOT_FOUND
+	}
+	return signingKey, ""
+}
+
+/*
+* Check the signature with the public key of the signing key, the reason is empty when it verifies
+ */
+func verifyWithSigningKey(signingKey map[string]interface{}, signature map[string]interface{}, payload []byte) string {
+	publicKey, err := decodePublicKey(getString(signingKey["publicKey"]))
+	if err != nil {
+		log.Println("Error from decodePublicKey: ", err)
+		return UNABLE_TO_READ_SIGNING_KEY
+	}
+	if err := VerifySignature(payload, getString(signature["value"]), publicKey); err != nil {
+		log.Println("Error from verifySignature: ", err)
+		return SIGNATURE_INVALID
+	}
+	return ""
+}
+
+/*
+* Public verification used by the pharmacies(from the QR code on the printed prescription)
+* Recompute the canonical payload and check the signature with the public key of the doctor
+* Only the details needed to match the printed copy are returned, no patient details
+ */
+func VerifyPrescription(c *gin.Context, prescriptionId string, token string) (map[string]interface{}, error) {
+	prescription := make(map[string]interface{})
+	collection := db.OpenCollections(util.PrescriptionCollection)
+	err := db.FindOne(c, collection, bson.M{"code": prescriptionId}, prescription)
+	if err != nil {
+		log.Println("Error from findOne: ", err)
+		return nil, errors.New(INVALID_VERIFICATION_REQUEST)
+	}
+	signature, ok := prescription["signature"].(map[string]interface{})
+	if !ok || token != verificationToken(getString(signature["value"])) {
+		return nil, errors.New(INVALID_VERIFICATION_REQUEST)
+	}
+
+	result := map[string]interface{}{
+		"prescriptionId": prescription["code"],
+		"version":        prescription["version"],
+		"status":         prescription["status"],
+		"supersededBy":   prescription["supersededBy"],
+		"issuedAt":       prescription["issuedAt"],
+		"keyId":          signature["keyId"],
+		"signedAt":       signature["signedAt"],
+		"payloadHash":    signature["payloadHash"],
+		"isValid":        false,
+	}
+
+	payload, err := CanonicalPrescription(prescription)
+	if err != nil {
+		log.Println("Error from canonicalPrescription: ", err)
+		return nil, err
+	}
+	signingKey, reason := checkSignature(c, signature, payload)
+	if reason != "" {
+		result["reason"] = reason
+		return result, nil
+	}
+	if getString(signingKey["doctorId"]) != getString(prescription["createdBy"]) {
+		result["reason"] = SIGNING_KEY_NOT_OF_SIGNER
+		return result, nil
+	}
+	result["isValid"] = true
+	if getString(prescription["status"]) == PRESCRIPTION_STATUS_SUPERSEDED {
+		result["reason"] = PRESCRIPTION_ALREADY_SUPERSEDED + getString(prescription["supersededBy"])
+	}
+
+	doctor := make(map[string]interface{})
+	if err := db.FindOne(c, db.OpenCollections(util.DoctorCollection), bson.M{"code": signingKey["doctorId"]}, doctor); err == nil {
+		result["doctorName"] = doctor["name"]
+	}
+	hospital := make(map[string]interface{})
+	if err := db.FindOne(c, db.OpenCollections(util.HospitalCollection), bson.M{"code": prescription["hospitalId"]}, hospital); err == nil {
+		result["hospitalName"] = hospital["name"]
+	}
+	medicines, _ := ExtractMedicines(prescription)
+	lines := []map[string]interface{}{}
+	for _, m := range medicines {
+		line, ok := m.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		medicine := make(map[string]interface{})
+		db.FindOne(c, db.OpenCollections(util.MedicineCollection), bson.M{"code": line["medicineId"]}, medicine)
+		quantity, _, _ := CalculatePrescribedQuantity(line)
+		lines = append(lines, map[string]interface{}{
+			"medicineId":   line["medicineId"],
+			"medicineName": medicine["name"],
+			"quantity":     quantity,
+		})
+	}
+	result["medicines"] = lines
+	return result, nil
+}
+
+/*
+* Human readable dosage of a prescription line for the printed prescription
+ */
+func describeDosage(line map[string]interface{}) string {
+	schedule, ok := line["schedule"].(map[string]interface{})
+	if !ok {
+		freq, _ := line["frequency"].(map[string]interface{})
+		var times []string
+		for _, field := range frequencyFields {
+			if taken, _ := freq[field].(bool); taken {
+				times = append(times, field)
+			}
+		}
+		return fmt.Sprintf("%s at %s for %s days", getString(line["dosagePerFrequency"]), strings.Join(times, ", "), getString(line["noOfDays"]))
+	}
+	unit := strings.ToLower(getString(schedule["unit"]))
+	number := func(m map[string]interface{}, field string) string {
+		value, _ := scheduleNumber(m, field)
+		return fmt.Sprintf("%g", value)
+	}
+	switch schedule["type"] {
+	case SCHEDULE_FIXED_TIMES:
+		return fmt.Sprintf("%s %s, %s times a day for %s days", number(schedule, "dose"), unit, number(schedule, "timesPerDay"), number(schedule, "noOfDays"))
+	case SCHEDULE_INTERVAL:
+		return fmt.Sprintf("%s %s every %s hours for %s days", number(schedule, "dose"), unit, number(schedule, "everyHours"), number(schedule, "noOfDays"))
+	case SCHEDULE_WEEKLY:
+		return fmt.Sprintf("%s %s, %s times a week for %s weeks", number(schedule, "dose"), unit, number(schedule, "timesPerWeek"), number(schedule, "noOfWeeks"))
+	case SCHEDULE_PRN:
+		return fmt.Sprintf("%s %s as needed, at most %s times a day for %s days", number(schedule, "dose"), unit, number(schedule, "maxPerDay"), number(schedule, "noOfDays"))
+	default:
+		var steps []string
+		for _, s := range scheduleSteps(schedule) {
+			step, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			steps = append(steps, fmt.Sprintf("%s %s, %s times a day for %s days", number(step, "dose"), unit, number(step, "timesPerDay"), number(step, "noOfDays")))
+		}
+		return "Tapering: " + strings.Join(steps, ", then ")
+	}
+}
+
+/*
+* Print the signed prescription as a PDF with a QR code of the public verification url
+ */
+func GeneratePrescriptionPDF(c *gin.Context, prescriptionId string) ([]string, error) {
+	prescription, err := FetchPrescriptionByCode(c, prescriptionId)
+	if err != nil {
+		log.Println("Error from fetchPrescriptionByCode: ", err)
+		return nil, err
+	}
+	signature, ok := prescription["signature"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New(PRESCRIPTION_NOT_SIGNED)
+	}
+	doctor, err := FetchDoctorByCode(c, getString(prescription["createdBy"]))
+	if err != nil {
+		log.Println("Error from fetchDoctorByCode: ", err)
+		return nil, err
+	}
+	patient, err := FetchPatientByCode(c, getString(prescription["patientId"]))
+	if err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, err
+	}
+	hospital := make(map[string]interface{})
+	if err := db.FindOne(c, db.OpenCollections(util.HospitalCollection), bson.M{"code": prescription["hospitalId"]}, hospital); err != nil {
+		log.Println("Error from findOne(hospital): ", err)
+	}
+
+	medicines, err := ExtractMedicines(prescription)
+	if err != nil {
+		log.Println("Error from extractMedicines: ", err)
+		return nil, err
+	}
+	var lines []map[string]interface{}
+	for _, m := range medicines {
+		line, ok := m.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		medicine, err := FetchMedicineByCode(c, getString(line["medicineId"]))
+		if err != nil {
+			log.Println("Error from fetchMedicineByCode: ", err)
+			return nil, err
+		}
+		quantity, _, err := CalculatePrescribedQuantity(line)
+		if err != nil {
+			log.Println("Error from calculatePrescribedQuantity: ", err)
+			return nil, err
+		}
+		lines = append(lines, map[string]interface{}{
+			"MedicineName": medicine["name"],
+			"Dosage":       describeDosage(line),
+			"Quantity":     quantity,
+			"Instructions": line["instructions"],
+		})
+	}
+
+	issuedAt, _ := FormatedDateAndTime(prescription["issuedAt"])
+	qr, err := GenerateLocalQRCode(PrescriptionVerificationURL(prescription))
+	if err != nil {
+		log.Println("Error from generateLocalQRCode: ", err)
+		return nil, err
+	}
+	data := map[string]interface{}{
+		"HospitalName":       hospital["name"],
+		"HospitalAddress":    hospital["address"],
+		"HospitalContact":    hospital["phoneNo"],
+		"DoctorName":         doctor["name"],
+		"DoctorID":           doctor["code"],
+		"Department":         doctor["department"],
+		"PatientName":        patient["name"],
+		"PatientID":          patient["code"],
+		"Age":                patient["age"],
+		"Gender":             patient["gender"],
+		"PrescriptionID":     prescription["code"],
+		"Version":            prescription["version"],
+		"IssuedAt":           issuedAt,
+		"Diagnosis":          prescription["diagnosis"],
+		"Diagnoses":          prescription["diagnoses"],
+		"Medicines":          lines,
+		"Refills":            prescription["refills"],
+		"RefillIntervalDays": prescription["refillIntervalDays"],
+		"KeyID":              signature["keyId"],
+		"PayloadHash":        signature["payloadHash"],
+		"VerificationQR":     template.URL(qr),
+		"VerificationURL":    PrescriptionVerificationURL(prescription),
+	}
+
+	htmlPath := fmt.Sprintf("prescription_%s.html", prescriptionId)
+	pdfPath := fmt.Sprintf("%s_prescription.pdf", prescriptionId)
+	err = GenerateHTMLToPDF("./templates/prescription.html", data, htmlPath, pdfPath)
+	if err != nil {
+		log.Println("Error from generateHTMLToPDF: ", err)
+		return nil, err
+	}
+	return []string{pdfPath}, nil
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSigningKeyEncryption(t *testing.T) {
+	privateKey, publicKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("SIGNING_KEY_SECRET", "")
+	if _, err := encryptPrivateKey(privateKey); err == nil || err.Error() != SIGNING_KEY_SECRET_NOT_SET {
+		t.Fatalf("err without secret = %v", err)
+	}
+
+	t.Setenv("SIGNING_KEY_SECRET", "first-secret")
+	encrypted, err := encryptPrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := decryptPrivateKey(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decrypted.Equal(privateKey) {
+		t.Error("decrypted key doesnot match")
+	}
+
+	t.Setenv("SIGNING_KEY_SECRET", "other-secret")
+	if _, err := decryptPrivateKey(encrypted); err == nil {
+		t.Error("key decrypted with another secret")
+	}
+
+	encoded, err := encodePublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := decodePublicKey(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Equal(publicKey) {
+		t.Error("decoded public key doesnot match")
+	}
+	if _, err := decodePublicKey("not a pem"); err == nil {
+		t.Error("invalid pem decoded")
+	}
+}
+
+func samplePrescription() map[string]interface{} {
+	return map[string]interface{}{
+		"code":       "PR1",
+		"version":    2,
+		"patientId":  "P1",
+		"createdBy":  "D1",
+		"issuedAt":   time.Date(2026, 5, 4, 9, 30, 0, 250_000_000, time.UTC),
+		"medicines":  []interface{}{map[string]interface{}{"medicineId": "M1", "noOfDays": "5"}},
+		"status":     PRESCRIPTION_STATUS_ACTIVE,
+		"updatedAt":  time.Now(),
+		"diagnosis":  nil,
+		"refills":    int32(2),
+		"hospitalId": "H1",
+	}
+}
+
+func sampleDischarge() map[string]interface{} {
+	return map[string]interface{}{
+		"code":                 "DS1",
+		"patientId":            "P1",
+		"hospitalId":           "H1",
+		"admissionDate":        "2026-04-28",
+		"dischargeAt":          time.Date(2026, 5, 2, 11, 0, 0, 340_000_000, time.UTC),
+		"dischargeType":        DISCHARGE_TYPE_REFERRED,
+		"referredTo":           "City Hospital",
+		"finalDiagnoses":       []interface{}{map[string]interface{}{"code": "J18.9", "status": DIAGNOSIS_STATUS_FINAL}},
+		"procedures":           []interface{}{map[string]interface{}{"name": "Chest X-ray", "performedOn": "2026-04-29"}},
+		"conditionAtDischarge": "Stable",
+		"medications":          []interface{}{},
+		"dischargedBy":         "D1",
+		"createdAt":            time.Now(),
+	}
+}
+
+/*
+* Every signed document must give the same canonical bytes after it is saved to and read back from mongo,
+* the signature made on save verifies on the stored copy and a change of a signed field breaks it
+ */
+func TestCanonicalSignedDocuments(t *testing.T) {
+	privateKey, publicKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name      string
+		canonical func(map[string]interface{}) ([]byte, error)
+		doc       map[string]interface{}
+		tamper    func(map[string]interface{})
+	}{
+		{"prescription", CanonicalPrescription, samplePrescription(), func(doc map[string]interface{}) {
+			toList(doc["medicines"])[0].(map[string]interface{})["noOfDays"] = "10"
+		}},
+		// a millisecond ending in 0 was the case that broke with the cached copy
+		{"lab report", CanonicalLabReport, sampleLabReport(time.Date(2026, 3, 1, 10, 2, 4, 120_000_000, time.UTC)), func(doc map[string]interface{}) {
+			toList(doc["results"])[0].(map[string]interface{})["value"] = 9.1
+		}},
+		{"discharge", CanonicalDischarge, sampleDischarge(), func(doc map[string]interface{}) {
+			doc["dischargeType"] = DISCHARGE_TYPE_NORMAL
+		}},
+		{"consent", CanonicalConsent, sampleMinorConsent(), func(doc map[string]interface{}) {
+			doc["consentPermission"] = false
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			payload, err := tc.canonical(tc.doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			value, err := SignData(payload, privateKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stored := bsonRoundTrip(t, tc.doc)
+			check, err := tc.canonical(stored)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(payload) != string(check) {
+				t.Fatalf("canonical changed after mongo round trip:\n%s\n%s", payload, check)
+			}
+			if err := VerifySignature(check, value, publicKey); err != nil {
+				t.Fatalf("stored copy doesnot verify: %v", err)
+			}
+			tc.tamper(stored)
+			tampered, _ := tc.canonical(stored)
+			if err := VerifySignature(tampered, value, publicKey); err == nil {
+				t.Error("tampered copy verifies")
+			}
+		})
+	}
+}
+
+func TestCanonicalPrescription(t *testing.T) {
+	prescription := samplePrescription()
+	signed, err := CanonicalPrescription(prescription)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prescription["status"] = PRESCRIPTION_STATUS_SUPERSEDED
+	prescription["updatedAt"] = time.Now().Add(time.Hour)
+	if unsigned, _ := CanonicalPrescription(prescription); string(unsigned) != string(signed) {
+		t.Error("status and audit fields must not be signed")
+	}
+	prescription["createdBy"] = "D2"
+	if altered, _ := CanonicalPrescription(prescription); string(altered) == string(signed) {
+		t.Error("createdBy must be signed")
+	}
+}
@@ -0,0 +1,453 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	redis "github.com/KanapuramVaishnavi/Core/config/redis"
+	common "github.com/KanapuramVaishnavi/Core/coreServices"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var prescriptionLineFields = []string{"instructions", "dosagePerFrequency", "noOfDays", "schedule"}
+
+var frequencyFields = []string{"morning", "afternoon", "night"}
+
+/*
+* reason is mandatory for every amendment
+* Remove it from the data, so it is not copied into the medicines
+ */
+func fetchAmendmentReason(data map[string]interface{}) (string, error) {
+	reason, ok := data["reason"].(string)
+	if !ok || strings.TrimSpace(reason) == "" {
+		return "", errors.New(AMENDMENT_REASON_REQUIRED)
+	}
+	delete(data, "reason")
+	return strings.TrimSpace(reason), nil
+}
+
+/*
+* Fetch the prescription from db
+* Only the latest version can be amended, by the doctor who issued it
+ */
+func fetchPrescriptionForAmendment(c *gin.Context, prescriptionId string, doctorId string) (map[string]interface{}, error) {
+	collection := db.OpenCollections(util.PrescriptionCollection)
+	previous := make(map[string]interface{})
+	err := db.FindOne(c, collection, bson.M{"code": prescriptionId}, previous)
+	if err != nil {
+		log.Println("Error from findOne(while fetching prescription): ", err)
+		return nil, err
+	}
+	if getString(previous["status"]) == PRESCRIPTION_STATUS_SUPERSEDED {
+		return nil, errors.New(PRESCRIPTION_ALREADY_SUPERSEDED + getString(previous["supersededBy"]))
+	}
+	createdBy, ok := previous["createdBy"].(string)
+	if !ok {
+		log.Println("createdBy(doctor) field doesnot exists in prescription")
+		return nil, errors.New(util.UNABLE_TO_FETCH_CREATED_BY_FROM_PRESCRIPTION)
+	}
+	if doctorId != createdBy {
+		log.Println("This doctor doesnot have access")
+		return nil, errors.New(util.DOCTOR_DOESNOT_HAVE_ACCESS_TO_UPDATE)
+	}
+	return previous, nil
+}
+
+func prescriptionVersionOf(prescription map[string]interface{}) int {
+	version := toInt(prescription["version"])
+	if version <= 0 {
+		return 1
+	}
+	return version
+}
+
+func rootPrescriptionIdOf(prescription map[string]interface{}) string {
+	if root := getString(prescription["rootPrescriptionId"]); root != "" {
+		return root
+	}
+	return getString(prescription["code"])
+}
+
+/*
+* Copy the previous version and apply the changes(diagnosis/diagnoses/medicines)
+* Validate the medicines again, including the controlled medicine rules and the allergy check when they changed
+* Mark the previous version as superseded first(conditioned on it being the latest), so two amendments
+* of the same version cannot both create a new version, the previous one is restored when the save fails
+* Save as a new version linked to the previous one with the reason and the doctor, the coded diagnoses now belong to the new version
+* Point the medicalRecord to the new version
+* Save to db and cache
+ */
+func createPrescriptionVersion(c *gin.Context, previous map[string]interface{}, changes map[string]interface{}, reason string, doctorId string) (string, error) {
+	medicines, ok := changes["medicines"].([]interface{})
+	if !ok {
+		existing, err := ExtractMedicines(previous)
+		if err != nil {
+			log.Println("Error from extractMedicines: ", err)
+			return "", err
+		}
+		medicines = existing
+	}
+	err := ValidateMedicines(medicines)
+	if err != nil {
+		log.Println("Error from validateMedicines: ", err)
+		return "", err
+	}
+	doctor, err := FetchDoctorByCode(c, doctorId)
+	if err != nil {
+		log.Println("Error from fetchDoctorByCode: ", err)
+		return "", err
+	}
+	err = ValidateControlledMedicines(c, doctor, medicines)
+	if err != nil {
+		log.Println("Error from validateControlledMedicines: ", err)
+		return "", err
+	}
+	_, medicinesChanged := changes["medicines"]
+	var allergyOverride map[string]interface{}
+	if medicinesChanged {
+		allergyOverride, err = checkPrescriptionAllergies(c, getString(previous["patientId"]), medicines, getString(changes["allergyOverrideReason"]), previous["allergyOverride"])
+		if err != nil {
+			log.Println("Error from checkPrescriptionAllergies: ", err)
+			return "", err
+		}
+	}
+
+	coll := util.PrescriptionCollection
+	code, err := common.GenerateEmpCode(coll)
+	if err != nil {
+		log.Println("Error from generateEmpCode: ", err)
+		return "", err
+	}
+	previousId := getString(previous["code"])
+	version := make(map[string]interface{})
+	for key, value := range previous {
+		if key == "_id" || key == "supersededBy" || key == "amendment" {
+			continue
+		}
+		version[key] = value
+	}
+	if diagnosis, ok := changes["diagnosis"].(string); ok {
+		version["diagnosis"] = diagnosis
+	}
+	if diagnoses, ok := changes["diagnoses"]; ok {
+		version["diagnoses"] = diagnoses
+	}
+	for _, field := range []string{"refills", "refillIntervalDays", "isRepeatable"} {
+		if value, exists := changes[field]; exists {
+			version[field] = value
+		}
+	}
+	if version["isRepeatable"] != true {
+		delete(version, "refillIntervalDays")
+	}
+	version["medicines"] = medicines
+	if medicinesChanged {
+		delete(version, "allergyOverride")
+		if allergyOverride != nil {
+			version["allergyOverride"] = allergyOverride
+		}
+	}
+	version["code"] = code
+	version["version"] = prescriptionVersionOf(previous) + 1
+	version["previousVersionId"] = previousId
+	version["rootPrescriptionId"] = rootPrescriptionIdOf(previous)
+	version["status"] = PRESCRIPTION_STATUS_ACTIVE
+	version["amendment"] = map[string]interface{}{
+		"reason":    reason,
+		"amendedBy": doctorId,
+		"amendedAt": time.Now(),
+	}
+	version["createdBy"] = doctorId
+	version["updatedBy"] = doctorId
+	version["createdAt"] = time.Now()
+	version["updatedAt"] = time.Now()
+	err = SignPrescription(c, doctor, version)
+	if err != nil {
+		log.Println("Error from signPrescription: ", err)
+		return "", err
+	}
+
+	collection := db.OpenCollections(coll)
+	supersede := bson.M{"$set": bson.M{
+		"status":       PRESCRIPTION_STATUS_SUPERSEDED,
+		"supersededBy": code,
+		"supersededAt": time.Now(),
+	}}
+	result, err := db.UpdateOne(c, collection, bson.M{"code": previousId, "status": bson.M{"$in": bson.A{PRESCRIPTION_STATUS_ACTIVE, nil}}}, supersede)
+	if err != nil {
+		log.Println("Error from updateOne: ", err)
+		return "", err
+	}
+	if result.MatchedCount == 0 {
+		return "", errors.New(PRESCRIPTION_ALREADY_SUPERSEDED + previousId)
+	}
+	_, err = db.CreateOne(c, collection, version)
+	if err != nil {
+		log.Println("Error from createOne: ", err)
+		undo := bson.M{
+			"$set":   bson.M{"status": PRESCRIPTION_STATUS_ACTIVE},
+			"$unset": bson.M{"supersededBy": "", "supersededAt": ""},
+		}
+		if _, err := db.UpdateOne(c, collection, bson.M{"code": previousId, "supersededBy": code}, undo); err != nil {
+			log.Println("Error while restoring the previous version: ", err)
+		}
+		return "", err
+	}
+	if err := redis.DeleteCache(c, util.PrescriptionKey+previousId); err != nil {
+		log.Println("Error from deleteCache: ", err)
+	}
+	if err := redis.SetCache(c, util.PrescriptionKey+code, version); err != nil {
+		log.Println("Error while caching new prescription version: ", err)
+	}
+	if err := recordDiagnoses(c, version); err != nil {
+		log.Println("Error from recordDiagnoses: ", err)
+	}
+
+	medicalRecordId := getString(previous["medicalRecordId"])
+	if medicalRecordId == "" {
+		medicalRecord := make(map[string]interface{})
+		recordColl := db.OpenCollections(util.MedicalRecordCollection)
+		if err := db.FindOne(c, recordColl, bson.M{"prescriptionId": previousId}, medicalRecord); err == nil {
+			medicalRecordId = getString(medicalRecord["code"])
+		}
+	}
+	if medicalRecordId != "" {
+		_, err = UpdateMedicalRecord(c, medicalRecordId, map[string]interface{}{"prescriptionId": code})
+		if err != nil {
+			log.Println("Error from updateMedicalRecord: ", err)
+			return "", err
+		}
+	}
+	return code, nil
+}
+
+/*
+* Amend the diagnosis(text and/or coded), the whole list of medicines and/or the refills
+* reason is required
+ */
+func AmendPrescription(c *gin.Context, prescriptionId string, data map[string]interface{}) (string, error) {
+	doctorId, err := common.GetFromContext[string](c, "code")
+	if err != nil {
+		log.Println("Error from getFromContext: ", err)
+		return "", err
+	}
+	reason, err := fetchAmendmentReason(data)
+	if err != nil {
+		return "", err
+	}
+	changes := make(map[string]interface{})
+	_, hasDiagnosis := data["diagnosis"]
+	_, hasDiagnoses := data["diagnoses"]
+	if hasDiagnosis || hasDiagnoses {
+		if err := prepareDiagnosisFields(c, data); err != nil {
+			log.Println("Error from prepareDiagnosisFields: ", err)
+			return "", err
+		}
+		changes["diagnosis"] = data["diagnosis"]
+		if hasDiagnoses {
+			changes["diagnoses"] = data["diagnoses"]
+		}
+	}
+	if raw, exists := data["medicines"]; exists {
+		medicines, ok := raw.([]interface{})
+		if !ok {
+			return "", errors.New(util.MEDICINES_MUST_BE_ARRAY)
+		}
+		changes["medicines"] = medicines
+		changes["allergyOverrideReason"] = data["allergyOverrideReason"]
+	}
+	if _, exists := data["refills"]; exists {
+		if err := normalizeRepeatFields(data); err != nil {
+			log.Println("Error from normalizeRepeatFields: ", err)
+			return "", err
+		}
+		for _, field := range []string{"refills", "refillIntervalDays", "isRepeatable"} {
+			if value, exists := data[field]; exists {
+				changes[field] = value
+			}
+		}
+	}
+	if len(changes) == 0 {
+		return "", errors.New(AMENDMENT_HAS_NO_CHANGES)
+	}
+	previous, err := fetchPrescriptionForAmendment(c, prescriptionId, doctorId)
+	if err != nil {
+		log.Println("Error from fetchPrescriptionForAmendment: ", err)
+		return "", err
+	}
+	code, err := createPrescriptionVersion(c, previous, changes, reason, doctorId)
+	if err != nil {
+		log.Println("Error from createPrescriptionVersion: ", err)
+		return "", err
+	}
+	return fmt.Sprintf("Prescription amended as %s", code), nil
+}
+
+/*
+* Fetch the prescription with access check
+* All the versions share the rootPrescriptionId, return them in version order
+ */
+func FetchPrescriptionVersions(c *gin.Context, prescriptionId string) ([]interface{}, error) {
+	prescription, err := FetchPrescriptionByCode(c, prescriptionId)
+	if err != nil {
+		log.Println("Error from fetchPrescriptionByCode: ", err)
+		return nil, err
+	}
+	root := rootPrescriptionIdOf(prescription)
+	collection := db.OpenCollections(util.PrescriptionCollection)
+	filter := bson.M{"$or": []bson.M{
+		{"code": root},
+		{"rootPrescriptionId": root},
+	}}
+	opts := options.Find().SetSort(bson.D{{Key: "version", Value: 1}, {Key: "createdAt", Value: 1}})
+	versions, err := db.FindAll(c, collection, filter, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	return versions, nil
+}
+
+/*
+* Compare the prescription with another version(by default its previous version)
+* Both must be the versions of the same prescription
+* The older version is always the "from" side
+ */
+func DiffPrescriptionVersions(c *gin.Context, prescriptionId string, againstId string) (map[string]interface{}, error) {
+	current, err := FetchPrescriptionByCode(c, prescriptionId)
+	if err != nil {
+		log.Println("Error from fetchPrescriptionByCode: ", err)
+		return nil, err
+	}
+	if againstId == "" {
+		againstId = getString(current["previousVersionId"])
+		if againstId == "" {
+			return nil, errors.New(NO_PREVIOUS_PRESCRIPTION_VERSION)
+		}
+	}
+	other, err := FetchPrescriptionByCode(c, againstId)
+	if err != nil {
+		log.Println("Error from fetchPrescriptionByCode: ", err)
+		return nil, err
+	}
+	if rootPrescriptionIdOf(current) != rootPrescriptionIdOf(other) {
+		return nil, errors.New(PRESCRIPTION_VERSIONS_NOT_RELATED)
+	}
+	from, to := other, current
+	if prescriptionVersionOf(other) > prescriptionVersionOf(current) {
+		from, to = current, other
+	}
+	return DiffPrescriptions(from, to)
+}
+
+/*
+* Diagnosis is compared as it is
+* Medicines are matched by medicineId and reported as added, removed or changed(field wise)
+ */
+func DiffPrescriptions(from map[string]interface{}, to map[string]interface{}) (map[string]interface{}, error) {
+	fromMedicines, err := ExtractMedicines(from)
+	if err != nil {
+		return nil, err
+	}
+	toMedicines, err := ExtractMedicines(to)
+	if err != nil {
+		return nil, err
+	}
+	fromLines := indexMedicineLines(fromMedicines)
+	toLines := indexMedicineLines(toMedicines)
+
+	added := []interface{}{}
+	removed := []interface{}{}
+	changed := []interface{}{}
+	for _, m := range toMedicines {
+		line, ok := m.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		medicineId := getString(line["medicineId"])
+		old, exists := fromLines[medicineId]
+		if !exists {
+			added = append(added, line)
+			continue
+		}
+		if fields := diffMedicineLine(old, line); len(fields) > 0 {
+			changed = append(changed, map[string]interface{}{"medicineId": medicineId, "fields": fields})
+		}
+	}
+	for _, m := range fromMedicines {
+		line, ok := m.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, exists := toLines[getString(line["medicineId"])]; !exists {
+			removed = append(removed, line)
+		}
+	}
+	result := map[string]interface{}{
+		"from":      map[string]interface{}{"code": from["code"], "version": prescriptionVersionOf(from)},
+		"to":        map[string]interface{}{"code": to["code"], "version": prescriptionVersionOf(to)},
+		"amendment": to["amendment"],
+		"added":     added,
+		"removed":   removed,
+		"changed":   changed,
+	}
+	if getString(from["diagnosis"]) != getString(to["diagnosis"]) {
+		result["diagnosis"] = map[string]interface{}{"from": from["diagnosis"], "to": to["diagnosis"]}
+	}
+	if describeDiagnoses(from) != describeDiagnoses(to) {
+		result["diagnoses"] = map[string]interface{}{"from": from["diagnoses"], "to": to["diagnoses"]}
+	}
+	return result, nil
+}
+
+/*
+* Coded diagnoses as one comparable string(code type status chronic)
+ */
+func describeDiagnoses(prescription map[string]interface{}) string {
+	diagnoses, err := normalizeMongoArray(prescription["diagnoses"])
+	if err != nil {
+		return ""
+	}
+	parts := []string{}
+	for _, d := range diagnoses {
+		if diagnosis, ok := d.(map[string]interface{}); ok {
+			parts = append(parts, fmt.Sprintf("%s %s %s %v", diagnosis["icdCode"], diagnosis["type"], diagnosis["status"], diagnosis["chronic"]))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func indexMedicineLines(medicines []interface{}) map[string]map[string]interface{} {
+	lines := make(map[string]map[string]interface{})
+	for _, m := range medicines {
+		if line, ok := m.(map[string]interface{}); ok {
+			lines[getString(line["medicineId"])] = line
+		}
+	}
+	return lines
+}
+
+func diffMedicineLine(old map[string]interface{}, line map[string]interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	for _, field := range prescriptionLineFields {
+		if getString(old[field]) != getString(line[field]) {
+			fields[field] = map[string]interface{}{"from": old[field], "to": line[field]}
+		}
+	}
+	oldFreq, _ := old["frequency"].(map[string]interface{})
+	newFreq, _ := line["frequency"].(map[string]interface{})
+	for _, field := range frequencyFields {
+		if getString(oldFreq[field]) != getString(newFreq[field]) {
+			fields["frequency."+field] = map[string]interface{}{"from": oldFreq[field], "to": newFreq[field]}
+		}
+	}
+	return fields
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	common "github.com/KanapuramVaishnavi/Core/coreServices"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+* refills(0 to MAX_REFILLS) and refillIntervalDays make the prescription repeatable
+* refillIntervalDays is required when refills is more than 0
+ */
+func normalizeRepeatFields(data map[string]interface{}) error {
+	raw, exists := data["refills"]
+	if !exists {
+		return nil
+	}
+	refills, err := strconv.Atoi(strings.TrimSpace(getString(raw)))
+	if err != nil || refills < 0 || refills > MAX_REFILLS {
+		return errors.New(INVALID_REFILLS)
+	}
+	data["refills"] = refills
+	data["isRepeatable"] = refills > 0
+	if refills == 0 {
+		delete(data, "refillIntervalDays")
+		return nil
+	}
+	interval, err := strconv.Atoi(strings.TrimSpace(getString(data["refillIntervalDays"])))
+	if err != nil || interval <= 0 {
+		return errors.New(REFILL_INTERVAL_REQUIRED)
+	}
+	data["refillIntervalDays"] = interval
+	return nil
+}
+
+/*
+* Refills are tracked against the original prescription(rootPrescriptionId)
+* so amending a repeat prescription doesnot reset the used refills
+* The next refill is due refillIntervalDays after the last fill(or the issue date for the first refill)
+ */
+func BuildRefillStatus(c *gin.Context, prescription map[string]interface{}) (map[string]interface{}, []interface{}, error) {
+	root := rootPrescriptionIdOf(prescription)
+	collection := db.OpenCollections(RefillCollection)
+	opts := options.Find().SetSort(bson.D{{Key: "refillNo", Value: 1}})
+	refills, err := db.FindAll(c, collection, bson.M{"rootPrescriptionId": root}, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, nil, err
+	}
+	total := toInt(prescription["refills"])
+	interval := toInt(prescription["refillIntervalDays"])
+	lastFill, ok := toTime(prescription["issuedAt"])
+	if !ok {
+		lastFill, _ = toTime(prescription["createdAt"])
+	}
+	if len(refills) > 0 {
+		if last, ok := refills[len(refills)-1].(map[string]interface{}); ok {
+			if t, ok := toTime(last["createdAt"]); ok {
+				lastFill = t
+			}
+		}
+	}
+	remaining := total - len(refills)
+	if remaining < 0 {
+		remaining = 0
+	}
+	status := map[string]interface{}{
+		"prescriptionId":     prescription["code"],
+		"rootPrescriptionId": root,
+		"isRepeatable":       prescription["isRepeatable"] == true,
+		"totalRefills":       total,
+		"usedRefills":        len(refills),
+		"remainingRefills":   remaining,
+		"refillIntervalDays": interval,
+		"lastFillDate":       lastFill,
+		"nextEligibleDate":   lastFill.AddDate(0, 0, interval),
+	}
+	return status, refills, nil
+}
+
+/*
+* Claim the refill slot on the original prescription before anything is dispensed
+* refillsUsed is increased only while it is below the refills allowed, so two pharmacists cannot use the last refill twice
+* Prescriptions refilled before the counter was kept start from the refills saved so far
+ */
+func claimRefillSlot(c *gin.Context, status map[string]interface{}) error {
+	collection := db.OpenCollections(util.PrescriptionCollection)
+	root := status["rootPrescriptionId"]
+	legacy := bson.M{"code": root, "refillsUsed": bson.M{"$exists": false}}
+	if _, err := db.UpdateOne(c, collection, legacy, bson.M{"$set": bson.M{"refillsUsed": status["usedRefills"]}}); err != nil {
+		log.Println("Error from updateOne: ", err)
+		return err
+	}
+	filter := bson.M{"code": root, "refillsUsed": bson.M{"$lt": status["totalRefills"]}}
+	result, err := db.UpdateOne(c, collection, filter, bson.M{"$inc": bson.M{"refillsUsed": 1}})
+	if err != nil {
+		log.Println("Error from updateOne: ", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errors.New(NO_REFILLS_REMAINING)
+	}
+	return nil
+}
+
+/*
+* Give the slot back when the refill could not be dispensed
+ */
+func releaseRefillSlot(c *gin.Context, status map[string]interface{}) {
+	filter := bson.M{"code": status["rootPrescriptionId"], "refillsUsed": bson.M{"$gt": 0}}
+	if _, err := db.UpdateOne(c, db.OpenCollections(util.PrescriptionCollection), filter, bson.M{"$inc": bson.M{"refillsUsed": -1}}); err != nil {
+		log.Println("Error while releasing the refill slot: ", err)
+	}
+}
+
+/*
+* Fetch the prescription with access check and return the refill status and history
+ */
+func FetchRefillStatus(c *gin.Context, prescriptionId string) (map[string]interface{}, error) {
+	prescription, err := FetchPrescriptionByCode(c, prescriptionId)
+	if err != nil {
+		log.Println("Error from fetchPrescriptionByCode: ", err)
+		return nil, err
+	}
+	status, refills, err := BuildRefillStatus(c, prescription)
+	if err != nil {
+		log.Println("Error from buildRefillStatus: ", err)
+		return nil, err
+	}
+	status["refills"] = refills
+	return status, nil
+}
+
+/*
+* Pharmacist dispenses a refill without a new appointment or medicalRecord
+* Only the latest version of a repeatable prescription can be refilled
+* There must be refills remaining and the next eligible date must be reached
+* Check the pharmacist belongs to the hospital of the patient
+* Claim the refill slot, it is given back when the medicines cannot be dispensed or billed
+* Dispense every medicine like a regular bill(partial, pending and controlled rules apply)
+* the stock taken for the medicines is given back too when a later medicine or the bill fails
+* Save a refill bill and the refill entry linked with the original prescription
+ */
+func DispenseRefill(c *gin.Context, prescriptionId string) (map[string]interface{}, error) {
+	prescription, err := FetchPrescriptionByCode(c, prescriptionId)
+	if err != nil {
+		log.Println("Error from fetchPrescriptionByCode: ", err)
+		return nil, err
+	}
+	if getString(prescription["status"]) == PRESCRIPTION_STATUS_SUPERSEDED {
+		return nil, errors.New(PRESCRIPTION_ALREADY_SUPERSEDED + getString(prescription["supersededBy"]))
+	}
+	if prescription["isRepeatable"] != true {
+		return nil, errors.New(PRESCRIPTION_NOT_REPEATABLE)
+	}
+	status, _, err := BuildRefillStatus(c, prescription)
+	if err != nil {
+		log.Println("Error from buildRefillStatus: ", err)
+		return nil, err
+	}
+	if status["remainingRefills"].(int) <= 0 {
+		return nil, errors.New(NO_REFILLS_REMAINING)
+	}
+	nextEligible := status["nextEligibleDate"].(time.Time)
+	if time.Now().Before(nextEligible) {
+		return nil, errors.New(REFILL_NOT_DUE_YET + nextEligible.Format("2006-01-02"))
+	}
+	patientId, ok := prescription["patientId"].(string)
+	if !ok || patientId == "" {
+		medicalRecord := make(map[string]interface{})
+		recordColl := db.OpenCollections(util.MedicalRecordCollection)
+		if err := db.FindOne(c, recordColl, bson.M{"prescriptionId": prescription["code"]}, medicalRecord); err == nil {
+			patientId = getString(medicalRecord["patientId"])
+		}
+	}
+	if patientId == "" {
+		return nil, errors.New(UNABLE_TO_FETCH_PATIENT_ID_FROM_DOC)
+	}
+	patient, err := FetchPatientByCode(c, patientId)
+	if err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, err
+	}
+	err = CheckForAccess(c, patient)
+	if err != nil {
+		log.Println("Error from checkForAccess: ", err)
+		return nil, err
+	}
+
+	medicines, err := ExtractMedicines(prescription)
+	if err != nil {
+		log.Println("Error from extractMedicines: ", err)
+		return nil, err
+	}
+	billCode, err := common.GenerateEmpCode(util.BillCollection)
+	if err != nil {
+		log.Println("Error from generateEmpCode: ", err)
+		return nil, err
+	}
+	refillCode, err := GenerateCode(RefillCollection)
+	if err != nil {
+		log.Println("Error from generateCode: ", err)
+		return nil, err
+	}
+	if err := claimRefillSlot(c, status); err != nil {
+		return nil, err
+	}
+
+	var billMedicines []map[string]interface{}
+	total := 0
+	for _, m := range medicines {
+		item, price, err := processSingleMedicine(c, m)
+		if err != nil {
+			log.Println("Error from processSingleMedicine: ", err)
+			giveBackBillStock(c, billMedicines)
+			releaseRefillSlot(c, status)
+			return nil, err
+		}
+		billMedicines = append(billMedicines, item)
+		total += price
+	}
+
+	refillNo := status["usedRefills"].(int) + 1
+	pharmacistId := c.GetString("code")
+	bill := bson.M{
+		"code":                billCode,
+		"billType":            BILL_TYPE_REFILL,
+		"refillId":            refillCode,
+		"refillNo":            refillNo,
+		"medicines":           billMedicines,
+		"tests":               []interface{}{},
+		"amountForTests":      "0",
+		"amountForMedicine":   strconv.Itoa(total),
+		"amount":              strconv.Itoa(total),
+		"hasPendingMedicines": HasPendingMedicines(billMedicines),
+		"tenantId":            prescription["tenantId"],
+		"hospitalId":          patient["hospitalId"],
+		"prescripitonId":      prescription["code"],
+		"prescriptionVersion": prescriptionVersionOf(prescription),
+		"medicalId":           prescription["medicalRecordId"],
+		"patientId":           patientId,
+		"createdBy":           pharmacistId,
+		"updatedBy":           pharmacistId,
+		"createdAt":           time.Now(),
+		"updatedAt":           time.Now(),
+	}
+	saveErr := SaveBill(c, bill, billMedicines)
+	if saveErr != nil {
+		log.Println("Error from saveBill: ", saveErr)
+		if !billSaved(c, billCode) {
+			giveBackBillStock(c, billMedicines)
+			releaseRefillSlot(c, status)
+			return nil, saveErr
+		}
+		// the bill is saved and the stock taken, the refill is still recorded against the claimed slot
+	}
+
+	refill := map[string]interface{}{
+		"code":                refillCode,
+		"refillNo":            refillNo,
+		"rootPrescriptionId":  status["rootPrescriptionId"],
+		"prescriptionId":      prescription["code"],
+		"prescriptionVersion": prescriptionVersionOf(prescription),
+		"billId":              billCode,
+		"patientId":           patientId,
+		"remainingRefills":    status["remainingRefills"].(int) - 1,
+		"nextEligibleDate":    time.Now().AddDate(0, 0, toInt(prescription["refillIntervalDays"])),
+		"tenantId":            prescription["tenantId"],
+		"hospitalId":          patient["hospitalId"],
+		"dispensedBy":         pharmacistId,
+		"createdBy":           pharmacistId,
+		"createdAt":           time.Now(),
+	}
+	collection := db.OpenCollections(RefillCollection)
+	inserted, err := db.CreateOne(c, collection, refill)
+	if err != nil {
+		log.Println("Error from createOne: ", err)
+		return nil, err
+	}
+	log.Println("Inserted refill: ", inserted.InsertedID)
+	if saveErr != nil {
+		return nil, saveErr
+	}
+	return refill, nil
+}
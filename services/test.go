@@ -14,13 +14,31 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 )
 
-func ValidateTestInput(data map[string]interface{}) error {
-	fields := []string{"testname", "price"}
-	for _, f := range fields {
-		if err := common.GetTrimmedString(data, f); err != nil {
-			log.Println("Error from getTrimmedString:", err)
-			return err
-		}
+/*
+* testname is required, type defaults to SINGLE
+* price is required except for a panel priced per item
+ */
+func ValidateTestInput(c *gin.Context, data map[string]interface{}) error {
+	if err := common.GetTrimmedString(data, "testname"); err != nil {
+		log.Println("Error from getTrimmedString:", err)
+		return err
+	}
+	if _, exists := data["type"]; !exists {
+		data["type"] = TEST_TYPE_SINGLE
+	}
+	if err := normalizeTestCatalogFields(c, data, ""); err != nil {
+		log.Println("Error from normalizeTestCatalogFields:", err)
+		return err
+	}
+	if data["pricingMode"] == PANEL_PRICING_PER_ITEM {
+		return nil
+	}
+	if err := common.GetTrimmedString(data, "price"); err != nil {
+		log.Println("Error from getTrimmedString:", err)
+		return err
+	}
+	if _, err := testPriceOf(data); err != nil {
+		return err
 	}
 	return nil
 }
@@ -37,7 +55,7 @@ func ValidateTestInput(data map[string]interface{}) error {
  */
 func CreateTest(c *gin.Context, data map[string]interface{}) (string, error) {
 	val := ""
-	err := ValidateTestInput(data)
+	err := ValidateTestInput(c, data)
 	if err != nil {
 		log.Println("Error from ValidateUserInput:", err)
 		return val, err
@@ -92,12 +110,16 @@ func UpdateTest(c *gin.Context, data map[string]interface{}, code string) error
 			return err
 		}
 	}
+	if _, exists := data["price"]; exists {
+		if _, err := testPriceOf(data); err != nil {
+			return err
+		}
+	}
 	if err := common.HandleDOB(data); err != nil {
 		return err
 	}
 
 	hospitalCode := c.GetString("code")
-	updateFilter := common.BuildUpdateFilter(data, hospitalCode)
 	filter := bson.M{
 		"code": code,
 	}
@@ -116,6 +138,15 @@ func UpdateTest(c *gin.Context, data map[string]interface{}, code string) error
 		log.Println("This hospital does not have access to update test")
 		return errors.New(util.HOSPITAL_ADMIN_DOESNOT_HAVE_ACCESS_TO_UPDATE_TEST)
 	}
+	err = normalizeTestCatalogUpdate(c, data, value)
+	if err != nil {
+		log.Println("Error from normalizeTestCatalogUpdate: ", err)
+		return err
+	}
+	updateFilter := common.BuildUpdateFilter(data, hospitalCode)
+	if unset := testCatalogUnset(data, value); unset != nil {
+		updateFilter["$unset"] = unset
+	}
 	res, err := db.UpdateOne(c, collection, filter, updateFilter)
 	if err != nil {
 		log.Println("Error from updateOne:", err)
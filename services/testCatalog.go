@@ -0,0 +1,393 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func toList(raw interface{}) []interface{} {
+	switch v := raw.(type) {
+	case []interface{}:
+		return v
+	case primitive.A:
+		return []interface{}(v)
+	default:
+		return nil
+	}
+}
+
+/*
+* Catalog fields of a test
+* type         : SINGLE(default) or PANEL
+* specimenType : one of SpecimenTypes
+* turnaroundHours : hours from sample collection to the result
+* analytes     : [{code, name, unit, referenceRanges[{sex, minAgeYears, maxAgeYears, low, high}]}] for a SINGLE test
+*                optional criticalLow, criticalHigh and deltaCheckPercent are used to flag the results
+* components   : testIds of the SINGLE tests in a PANEL
+* pricingMode  : BUNDLE(price of the panel) or PER_ITEM(sum of the component prices) for a PANEL
+* code is the test being updated(empty on create), it cannot be its own component or become a panel
+* while it is a component of another panel
+ */
+func normalizeTestCatalogFields(c *gin.Context, data map[string]interface{}, code string) error {
+	if raw, exists := data["type"]; exists {
+		testType := strings.ToUpper(strings.TrimSpace(getString(raw)))
+		if testType != TEST_TYPE_SINGLE && testType != TEST_TYPE_PANEL {
+			return errors.New(INVALID_TEST_TYPE)
+		}
+		data["type"] = testType
+	}
+	if raw, exists := data["specimenType"]; exists {
+		specimen := strings.ToUpper(strings.TrimSpace(getString(raw)))
+		if !slices.Contains(SpecimenTypes, specimen) {
+			return errors.New(INVALID_SPECIMEN_TYPE + specimen)
+		}
+		data["specimenType"] = specimen
+	}
+	if raw, exists := data["turnaroundHours"]; exists {
+		hours, err := strconv.Atoi(strings.TrimSpace(getString(raw)))
+		if err != nil || hours <= 0 {
+			return errors.New(INVALID_TURNAROUND_HOURS)
+		}
+		data["turnaroundHours"] = hours
+	}
+	if raw, exists := data["analytes"]; exists {
+		analytes, err := validateAnalytes(raw)
+		if err != nil {
+			return err
+		}
+		data["analytes"] = analytes
+	}
+	if data["type"] != TEST_TYPE_PANEL {
+		delete(data, "components")
+		delete(data, "pricingMode")
+		return nil
+	}
+	if code != "" {
+		panel := make(map[string]interface{})
+		filter := bson.M{"components": code, "code": bson.M{"$ne": code}}
+		if err := db.FindOne(c, db.OpenCollections(util.TestCollection), filter, panel); err == nil {
+			return errors.New(TEST_IS_PANEL_COMPONENT + getString(panel["code"]))
+		}
+	}
+	mode := strings.ToUpper(strings.TrimSpace(getString(data["pricingMode"])))
+	if mode == "" {
+		mode = PANEL_PRICING_BUNDLE
+	}
+	if mode != PANEL_PRICING_BUNDLE && mode != PANEL_PRICING_PER_ITEM {
+		return errors.New(INVALID_PANEL_PRICING_MODE)
+	}
+	data["pricingMode"] = mode
+	if mode == PANEL_PRICING_PER_ITEM {
+		delete(data, "price")
+	}
+	components := toList(data["components"])
+	if len(components) == 0 {
+		return errors.New(PANEL_COMPONENTS_REQUIRED)
+	}
+	var testIds []string
+	for _, raw := range components {
+		testId := strings.TrimSpace(getString(raw))
+		if code != "" && testId == code {
+			return errors.New(PANEL_CANNOT_CONTAIN_ITSELF + testId)
+		}
+		component, err := FetchTestByCode(c, testId)
+		if err != nil {
+			log.Println("Error from fetchTestByCode: ", err)
+			return err
+		}
+		if getString(component["type"]) == TEST_TYPE_PANEL {
+			return errors.New(PANEL_CANNOT_CONTAIN_PANEL + testId)
+		}
+		testIds = append(testIds, testId)
+	}
+	data["components"] = testIds
+	delete(data, "analytes")
+	return nil
+}
+
+/*
+* Catalog fields on update are validated along with the stored type
+* A panel keeps its stored components and pricingMode when they are not sent
+* A panel changed back to SINGLE loses them, see testCatalogUnset
+ */
+func normalizeTestCatalogUpdate(c *gin.Context, data map[string]interface{}, existing map[string]interface{}) error {
+	if _, exists := data["type"]; !exists {
+		data["type"] = getString(existing["type"])
+		if existing["type"] == nil {
+			data["type"] = TEST_TYPE_SINGLE
+		}
+	}
+	if strings.ToUpper(getString(data["type"])) == TEST_TYPE_PANEL {
+		for _, field := range []string{"components", "pricingMode"} {
+			if _, exists := data[field]; !exists && existing[field] != nil {
+				data[field] = existing[field]
+			}
+		}
+	}
+	return normalizeTestCatalogFields(c, data, getString(existing["code"]))
+}
+
+/*
+* Panel fields to remove from the stored test when the update leaves it a SINGLE test
+ */
+func testCatalogUnset(data map[string]interface{}, existing map[string]interface{}) bson.M {
+	if data["type"] == TEST_TYPE_PANEL {
+		return nil
+	}
+	unset := bson.M{}
+	for _, field := range []string{"components", "pricingMode"} {
+		if existing[field] != nil {
+			unset[field] = ""
+		}
+	}
+	if len(unset) == 0 {
+		return nil
+	}
+	return unset
+}
+
+func validateAnalytes(raw interface{}) ([]interface{}, error) {
+	analytes := toList(raw)
+	if len(analytes) == 0 {
+		return nil, errors.New(ANALYTES_MUST_BE_ARRAY)
+	}
+	seen := map[string]bool{}
+	for _, a := range analytes {
+		analyte, ok := a.(map[string]interface{})
+		if !ok {
+			return nil, errors.New(ANALYTES_MUST_BE_ARRAY)
+		}
+		for _, field := range []string{"code", "name", "unit"} {
+			value := strings.TrimSpace(getString(analyte[field]))
+			if analyte[field] == nil || value == "" {
+				return nil, errors.New(ANALYTE_FIELD_REQUIRED + field)
+			}
+			analyte[field] = value
+		}
+		code := strings.ToUpper(getString(analyte["code"]))
+		if seen[code] {
+			return nil, errors.New(DUPLICATE_ANALYTE_CODE + code)
+		}
+		seen[code] = true
+		analyte["code"] = code
+		ranges := toList(analyte["referenceRanges"])
+		for _, r := range ranges {
+			if err := validateReferenceRange(r); err != nil {
+				return nil, err
+			}
+		}
+		analyte["referenceRanges"] = ranges
+		for _, field := range []string{"criticalLow", "criticalHigh", "deltaCheckPercent"} {
+			if _, exists := analyte[field]; !exists {
+				continue
+			}
+			value, err := strconv.ParseFloat(strings.TrimSpace(getString(analyte[field])), 64)
+			if err != nil || value < 0 {
+				return nil, errors.New(INVALID_ANALYTE_LIMIT + field)
+			}
+			analyte[field] = value
+		}
+	}
+	return analytes, nil
+}
+
+/*
+* sex is M, F or ANY(default), age limits are in years and optional
+* At least one of low and high is required
+ */
+func validateReferenceRange(raw interface{}) error {
+	refRange, ok := raw.(map[string]interface{})
+	if !ok {
+		return errors.New(INVALID_REFERENCE_RANGE)
+	}
+	sex := strings.ToUpper(strings.TrimSpace(getString(refRange["sex"])))
+	if refRange["sex"] == nil || sex == "" {
+		sex = REFERENCE_SEX_ANY
+	}
+	if sex != REFERENCE_SEX_ANY && sex != REFERENCE_SEX_MALE && sex != REFERENCE_SEX_FEMALE {
+		return errors.New(INVALID_REFERENCE_RANGE)
+	}
+	refRange["sex"] = sex
+	for _, field := range []string{"minAgeYears", "maxAgeYears", "low", "high"} {
+		if _, exists := refRange[field]; !exists {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(getString(refRange[field])), 64)
+		if err != nil || value < 0 {
+			return errors.New(INVALID_REFERENCE_RANGE)
+		}
+		refRange[field] = value
+	}
+	_, hasLow := refRange["low"]
+	_, hasHigh := refRange["high"]
+	if !hasLow && !hasHigh {
+		return errors.New(INVALID_REFERENCE_RANGE)
+	}
+	if hasLow && hasHigh && refRange["low"].(float64) > refRange["high"].(float64) {
+		return errors.New(INVALID_REFERENCE_RANGE)
+	}
+	return nil
+}
+
+/*
+* Pick the reference range matching the age and sex of the patient
+* A range for the exact sex is preferred over a range for ANY
+ */
+func ReferenceRangeFor(analyte map[string]interface{}, age int, gender string) map[string]interface{} {
+	sex := REFERENCE_SEX_ANY
+	if g := strings.ToUpper(strings.TrimSpace(gender)); g != "" {
+		sex = g[:1]
+	}
+	var match map[string]interface{}
+	for _, r := range toList(analyte["referenceRanges"]) {
+		refRange, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		rangeSex := getString(refRange["sex"])
+		if rangeSex != REFERENCE_SEX_ANY && rangeSex != sex {
+			continue
+		}
+		if minAge, ok := refRange["minAgeYears"].(float64); ok && float64(age) < minAge {
+			continue
+		}
+		if maxAge, ok := refRange["maxAgeYears"].(float64); ok && float64(age) > maxAge {
+			continue
+		}
+		if match == nil || (getString(match["sex"]) == REFERENCE_SEX_ANY && rangeSex != REFERENCE_SEX_ANY) {
+			match = refRange
+		}
+	}
+	return match
+}
+
+/*
+* Analytes measured by a test, a panel gives the analytes of every component
+* Older tests without analytes are treated as a single analyte named by the testname
+ */
+func ExpandTestAnalytes(c *gin.Context, test map[string]interface{}) ([]map[string]interface{}, error) {
+	fetch := func(testId string) (map[string]interface{}, error) {
+		return FetchTestByCode(c, testId)
+	}
+	return expandTestAnalytes(test, fetch, map[string]bool{})
+}
+
+/*
+* path holds the panels being expanded, a component already on the path is a cycle
+* and is rejected instead of recursing forever
+ */
+func expandTestAnalytes(test map[string]interface{}, fetch func(string) (map[string]interface{}, error), path map[string]bool) ([]map[string]interface{}, error) {
+	var result []map[string]interface{}
+	if getString(test["type"]) == TEST_TYPE_PANEL {
+		code := getString(test["code"])
+		if path[code] {
+			return nil, errors.New(PANEL_COMPONENT_CYCLE + code)
+		}
+		path[code] = true
+		defer delete(path, code)
+		for _, id := range toList(test["components"]) {
+			component, err := fetch(getString(id))
+			if err != nil {
+				log.Println("Error from fetchTestByCode: ", err)
+				return nil, err
+			}
+			analytes, err := expandTestAnalytes(component, fetch, path)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, analytes...)
+		}
+		return result, nil
+	}
+	analytes := toList(test["analytes"])
+	if len(analytes) == 0 {
+		return []map[string]interface{}{{
+			"code":   test["code"],
+			"name":   test["testname"],
+			"unit":   "",
+			"testId": test["code"],
+		}}, nil
+	}
+	for _, a := range analytes {
+		analyte, ok := a.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		item := make(map[string]interface{})
+		for key, value := range analyte {
+			item[key] = value
+		}
+		item["testId"] = test["code"]
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+func testPriceOf(test map[string]interface{}) (int, error) {
+	priceVal, ok := test["price"].(string)
+	if !ok {
+		return 0, errors.New(INVALID_TEST_PRICE + getString(test["code"]))
+	}
+	price, err := strconv.Atoi(strings.TrimSpace(priceVal))
+	if err != nil || price < 0 {
+		return 0, errors.New(INVALID_TEST_PRICE + getString(test["code"]))
+	}
+	return price, nil
+}
+
+/*
+* Bill line for a test
+* SINGLE and BUNDLE panels use the price of the test
+* PER_ITEM panels are billed as the sum of the components, each listed in items
+ */
+func BuildTestBillLine(c *gin.Context, test map[string]interface{}) (map[string]interface{}, int, error) {
+	line := map[string]interface{}{
+		"testId":   test["code"],
+		"testName": test["testname"],
+		"type":     test["type"],
+	}
+	if getString(test["type"]) != TEST_TYPE_PANEL || getString(test["pricingMode"]) != PANEL_PRICING_PER_ITEM {
+		price, err := testPriceOf(test)
+		if err != nil {
+			return nil, 0, err
+		}
+		line["price"] = strconv.Itoa(price)
+		if getString(test["type"]) == TEST_TYPE_PANEL {
+			line["pricingMode"] = PANEL_PRICING_BUNDLE
+		}
+		return line, price, nil
+	}
+	total := 0
+	var items []map[string]interface{}
+	for _, id := range toList(test["components"]) {
+		component, err := FetchTestByCode(c, getString(id))
+		if err != nil {
+			log.Println("Error from fetchTestByCode: ", err)
+			return nil, 0, err
+		}
+		price, err := testPriceOf(component)
+		if err != nil {
+			return nil, 0, err
+		}
+		items = append(items, map[string]interface{}{
+			"testId":   component["code"],
+			"testName": component["testname"],
+			"price":    strconv.Itoa(price),
+		})
+		total += price
+	}
+	line["pricingMode"] = PANEL_PRICING_PER_ITEM
+	line["items"] = items
+	line["price"] = strconv.Itoa(total)
+	return line, total, nil
+}
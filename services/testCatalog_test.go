@@ -0,0 +1,85 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func catalogFetcher(tests map[string]map[string]interface{}) func(string) (map[string]interface{}, error) {
+	return func(testId string) (map[string]interface{}, error) {
+		test, ok := tests[testId]
+		if !ok {
+			return nil, errors.New("test not found: " + testId)
+		}
+		return test, nil
+	}
+}
+
+func TestExpandTestAnalytes(t *testing.T) {
+	hb := map[string]interface{}{"code": "T1", "type": TEST_TYPE_SINGLE, "analytes": []interface{}{
+		map[string]interface{}{"code": "HGB", "name": "Hemoglobin", "unit": "g/dL"},
+	}}
+	wbc := map[string]interface{}{"code": "T2", "type": TEST_TYPE_SINGLE, "testname": "WBC"}
+	tests := map[string]map[string]interface{}{
+		"T1": hb,
+		"T2": wbc,
+		"P1": {"code": "P1", "type": TEST_TYPE_PANEL, "components": []interface{}{"T1", "T2"}},
+		"P2": {"code": "P2", "type": TEST_TYPE_PANEL, "components": []interface{}{"P2"}},
+		"P3": {"code": "P3", "type": TEST_TYPE_PANEL, "components": []interface{}{"P4"}},
+		"P4": {"code": "P4", "type": TEST_TYPE_PANEL, "components": []interface{}{"P3"}},
+		"P5": {"code": "P5", "type": TEST_TYPE_PANEL, "components": []interface{}{"T1", "T1"}},
+		"P6": {"code": "P6", "type": TEST_TYPE_PANEL, "components": []interface{}{"P1", "P1"}},
+		"P7": {"code": "P7", "type": TEST_TYPE_PANEL, "components": []interface{}{"T9"}},
+	}
+	cases := []struct {
+		name    string
+		testId  string
+		codes   []string
+		wantErr string
+	}{
+		{"single with analytes", "T1", []string{"HGB"}, ""},
+		{"legacy single without analytes", "T2", []string{"T2"}, ""},
+		{"panel", "P1", []string{"HGB", "T2"}, ""},
+		{"repeated component is not a cycle", "P5", []string{"HGB", "HGB"}, ""},
+		{"repeated sub panel is not a cycle", "P6", []string{"HGB", "T2", "HGB", "T2"}, ""},
+		{"panel containing itself", "P2", nil, PANEL_COMPONENT_CYCLE},
+		{"panels containing each other", "P3", nil, PANEL_COMPONENT_CYCLE},
+		{"missing component", "P7", nil, "test not found"},
+	}
+	fetch := catalogFetcher(tests)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			analytes, err := expandTestAnalytes(tests[tc.testId], fetch, map[string]bool{})
+			if tc.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tc.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			var codes []string
+			for _, analyte := range analytes {
+				codes = append(codes, getString(analyte["code"]))
+			}
+			if strings.Join(codes, ",") != strings.Join(tc.codes, ",") {
+				t.Errorf("codes = %v, want %v", codes, tc.codes)
+			}
+		})
+	}
+}
+
+func TestTestCatalogUnset(t *testing.T) {
+	panel := map[string]interface{}{"type": TEST_TYPE_PANEL, "components": []interface{}{"T1"}, "pricingMode": PANEL_PRICING_BUNDLE}
+	if unset := testCatalogUnset(map[string]interface{}{"type": TEST_TYPE_SINGLE}, panel); len(unset) != 2 {
+		t.Errorf("panel to single unset = %v", unset)
+	}
+	if unset := testCatalogUnset(map[string]interface{}{"type": TEST_TYPE_PANEL}, panel); unset != nil {
+		t.Errorf("panel to panel unset = %v", unset)
+	}
+	if unset := testCatalogUnset(map[string]interface{}{"type": TEST_TYPE_SINGLE}, map[string]interface{}{"type": TEST_TYPE_SINGLE}); unset != nil {
+		t.Errorf("single to single unset = %v", unset)
+	}
+}
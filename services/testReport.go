@@ -4,6 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"time"
 
 	db "github.com/KanapuramVaishnavi/Core/config/db"
 	redis "github.com/KanapuramVaishnavi/Core/config/redis"
@@ -12,6 +15,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func CreateTestReport(c *gin.Context, patientId string) ([]string, error) {
@@ -53,7 +57,7 @@ func CreateTestReport(c *gin.Context, patientId string) ([]string, error) {
 	}
 	var reportCodes []string
 	for _, testId := range testlist {
-		code, err := createSingleTestReport(c, coll, testId, patientId, doctorId)
+		code, err := createSingleTestReport(c, coll, testId, patient, doctorId)
 		if err != nil {
 			return nil, err
 		}
@@ -66,13 +70,156 @@ func CreateTestReport(c *gin.Context, patientId string) ([]string, error) {
 	return reportCodes, nil
 }
 
-// func FetchTestReportsofPatient(c *gin.Context, patientId string) ([]map[string]interface{}, error) {
-// 	filter := bson.M{
-// 		"patientId": patientId,
-// 	}
-// 	coll := db.OpenCollections(testReportCollection)
-// 	testReports, err := db.FindAll(c, coll)
-// }
+/*
+* Filter on the patient documents(test reports, vitals...) the logged-in user can see
+* doctor: the reports ordered by the doctor, patient: own reports, guardian: reports of the wards
+* tenant/hospital: their reports, other staff(lab, nurse...): reports of their hospital
+ */
+func patientDataScopeFilter(c *gin.Context) (bson.M, error) {
+	code := c.GetString("code")
+	switch c.GetString("collection") {
+	case util.DoctorCollection:
+		return bson.M{"doctorId": code}, nil
+	case util.PatientCollection:
+		return bson.M{"patientId": code}, nil
+	case util.GuardianCollection:
+		collection := db.OpenCollections(util.PatientCollection)
+		patients, err := db.FindAll(c, collection, bson.M{"listOfGuardians": code}, nil)
+		if err != nil {
+			log.Println("Error from findAll: ", err)
+			return nil, err
+		}
+		patientIds := []string{}
+		for _, p := range patients {
+			if patient, ok := p.(map[string]interface{}); ok {
+				patientIds = append(patientIds, getString(patient["code"]))
+			}
+		}
+		return bson.M{"patientId": bson.M{"$in": patientIds}}, nil
+	}
+	return labScopeFilter(c)
+}
+
+/*
+* Test reports visible to the user, newest first
+* Optional filters: patientId, testId, status, medicalRecordId and the order date range from/to(YYYY-MM-DD)
+* Results are hidden from patients and guardians until they are verified
+ */
+func FetchAllTestReports(c *gin.Context, query map[string]string) ([]interface{}, error) {
+	filter, err := patientDataScopeFilter(c)
+	if err != nil {
+		return nil, err
+	}
+	conditions := []bson.M{filter}
+	if patientId := query["patientId"]; patientId != "" {
+		conditions = append(conditions, bson.M{"patientId": patientId})
+	}
+	if testId := query["testId"]; testId != "" {
+		conditions = append(conditions, bson.M{"testId": testId})
+	}
+	if status := query["status"]; status != "" {
+		conditions = append(conditions, bson.M{"status": strings.ToUpper(status)})
+	}
+	if medicalRecordId := query["medicalRecordId"]; medicalRecordId != "" {
+		medicalRecord, err := FetchMedicalRecordByCode(c, medicalRecordId)
+		if err != nil {
+			log.Println("Error from fetchMedicalRecordByCode: ", err)
+			return nil, err
+		}
+		reportIds := []string{}
+		for _, id := range toList(medicalRecord["testReports"]) {
+			reportIds = append(reportIds, getString(id))
+		}
+		conditions = append(conditions, bson.M{"code": bson.M{"$in": reportIds}})
+	}
+	createdAt := bson.M{}
+	if from := query["from"]; from != "" {
+		start, err := time.Parse(QUERY_DATE_FORMAT, from)
+		if err != nil {
+			return nil, errors.New(INVALID_DATE_FILTER + from)
+		}
+		createdAt["$gte"] = start
+	}
+	if to := query["to"]; to != "" {
+		end, err := time.Parse(QUERY_DATE_FORMAT, to)
+		if err != nil {
+			return nil, errors.New(INVALID_DATE_FILTER + to)
+		}
+		createdAt["$lt"] = end.AddDate(0, 0, 1)
+	}
+	if len(createdAt) > 0 {
+		conditions = append(conditions, bson.M{"createdAt": createdAt})
+	}
+
+	collection := db.OpenCollections(util.TestReportCollection)
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	docs, err := db.FindAll(c, collection, bson.M{"$and": conditions}, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	for i, d := range docs {
+		if report, ok := d.(map[string]interface{}); ok {
+			docs[i] = hideUnreleasedResults(c, report)
+		}
+	}
+	return docs, nil
+}
+
+/*
+* Cumulative view of one analyte of a patient over time
+* Only the verified results are used, oldest first, with the flag and the reference range of each result
+ */
+func FetchAnalyteTrend(c *gin.Context, patientId string, analyteCode string) (map[string]interface{}, error) {
+	filter, err := patientDataScopeFilter(c)
+	if err != nil {
+		return nil, err
+	}
+	analyteCode = strings.ToUpper(strings.TrimSpace(analyteCode))
+	conditions := []bson.M{filter, {
+		"patientId":           patientId,
+		"status":              TEST_REPORT_STATUS_VERIFIED,
+		"results.analyteCode": analyteCode,
+	}}
+	collection := db.OpenCollections(util.TestReportCollection)
+	opts := options.Find().SetSort(bson.D{{Key: "verifiedAt", Value: 1}})
+	docs, err := db.FindAll(c, collection, bson.M{"$and": conditions}, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	trend := map[string]interface{}{
+		"patientId":   patientId,
+		"analyteCode": analyteCode,
+	}
+	points := []map[string]interface{}{}
+	for _, d := range docs {
+		report, ok := d.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, r := range toList(report["results"]) {
+			row, ok := r.(map[string]interface{})
+			if !ok || strings.ToUpper(getString(row["analyteCode"])) != analyteCode || row["value"] == nil {
+				continue
+			}
+			trend["analyteName"] = row["analyteName"]
+			trend["unit"] = row["unit"]
+			points = append(points, map[string]interface{}{
+				"testReportId":   report["code"],
+				"testName":       report["testName"],
+				"collectedAt":    report["collectedAt"],
+				"verifiedAt":     report["verifiedAt"],
+				"value":          row["value"],
+				"unit":           row["unit"],
+				"flag":           row["flag"],
+				"referenceRange": row["referenceRange"],
+			})
+		}
+	}
+	trend["points"] = points
+	return trend, nil
+}
 
 func getLatestAppointmentID(patient map[string]interface{}) (string, error) {
 	rawApps, ok := patient["appointments"]
@@ -97,22 +244,19 @@ func getLatestAppointmentID(patient map[string]interface{}) (string, error) {
 }
 
 func getMedicalRecordTestList(c *gin.Context, medicalRecord map[string]interface{}) ([]string, error) {
-	consentId := medicalRecord["consentId"].(string)
+	consentId := getString(medicalRecord["consentId"])
+	if consentId == "" {
+		return nil, errors.New(CONSENT_REQUIRED + getString(medicalRecord["code"]))
+	}
 	consent, err := FetchConsentByCode(c, consentId)
 	if err != nil {
 		log.Println("Error from FetchConsentByCode: ", err)
 		return nil, err
 	}
-	isConsentVerified, ok := consent["isConsentVerified"].(bool)
-	if !ok {
-		log.Println("Unable to fetch isConsentVerified from consent ")
-		return nil, errors.New(util.IS_CONSENT_VERIFIED_UNABLE_TO_FETCH)
-	}
-	if !isConsentVerified {
-		log.Println("isConsentVerified field is not approved ")
-		return nil, errors.New(util.CONSENT_NOT_APPROVED)
+	if err := requireActiveConsent(consent); err != nil {
+		log.Println("Consent is not active: ", err)
+		return nil, err
 	}
-	log.Println("After")
 	rawTestList, ok := medicalRecord["testList"]
 	if !ok {
 		return nil, errors.New("testList missing in medicalRecord")
@@ -164,16 +308,61 @@ func normalizeMongoArray(raw interface{}) ([]interface{}, error) {
 	}
 }
 
-func createSingleTestReport(c *gin.Context, coll interface{}, testId string, patientId string, doctorId string) (string, error) {
-	dummyTest, err := FetchTestByCode(c, testId)
+/*
+* Report of a test from the catalog
+* Every analyte(of the test or of each component of a panel) gets a result row
+* with its unit and the reference range for the age and sex of the patient
+ */
+func createSingleTestReport(c *gin.Context, coll interface{}, testId string, patient map[string]interface{}, doctorId string) (string, error) {
+	test, err := FetchTestByCode(c, testId)
+	if err != nil {
+		return "", err
+	}
+	analytes, err := ExpandTestAnalytes(c, test)
+	if err != nil {
+		return "", err
+	}
+	billLine, _, err := BuildTestBillLine(c, test)
 	if err != nil {
 		return "", err
 	}
+	age, _ := strconv.Atoi(getString(patient["age"]))
+	var results []map[string]interface{}
+	for _, analyte := range analytes {
+		result := map[string]interface{}{
+			"analyteCode":    analyte["code"],
+			"analyteName":    analyte["name"],
+			"testId":         analyte["testId"],
+			"unit":           analyte["unit"],
+			"referenceRange": ReferenceRangeFor(analyte, age, getString(patient["gender"])),
+			"value":          nil,
+		}
+		for _, field := range []string{"criticalLow", "criticalHigh", "deltaCheckPercent"} {
+			if value, exists := analyte[field]; exists {
+				result[field] = value
+			}
+		}
+		results = append(results, result)
+	}
 	testReport := map[string]interface{}{
-		"testName":  testId,
-		"price":     dummyTest["price"],
-		"patientId": patientId,
-		"doctorId":  doctorId,
+		"testId":          testId,
+		"testName":        test["testname"],
+		"type":            test["type"],
+		"specimenType":    test["specimenType"],
+		"turnaroundHours": test["turnaroundHours"],
+		"results":         results,
+		"status":          TEST_REPORT_STATUS_ORDERED,
+		"statusHistory": []map[string]interface{}{{
+			"status": TEST_REPORT_STATUS_ORDERED,
+			"by":     c.GetString("code"),
+			"at":     time.Now(),
+		}},
+		"price":      billLine["price"],
+		"patientId":  patient["code"],
+		"doctorId":   doctorId,
+		"tenantId":   patient["tenantId"],
+		"hospitalId": patient["hospitalId"],
+		"createdAt":  time.Now(),
 	}
 
 	collName := coll.(string)
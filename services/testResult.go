@@ -0,0 +1,407 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	redis "github.com/KanapuramVaishnavi/Core/config/redis"
+	common "github.com/KanapuramVaishnavi/Core/coreServices"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func resultNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int, int32, int64:
+		return float64(toInt(v)), true
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return parsed, err == nil
+	default:
+		return 0, false
+	}
+}
+
+/*
+* Flag a numeric value with the critical limits first and then the reference range
+* LL/HH critical, L/H outside the reference range, N normal
+* No flag when the value is not numeric(e.g. POSITIVE) or there is no range
+ */
+func FlagResult(row map[string]interface{}, value float64) string {
+	if limit, ok := resultNumber(row["criticalLow"]); ok && row["criticalLow"] != nil && value <= limit {
+		return RESULT_FLAG_CRITICAL_LOW
+	}
+	if limit, ok := resultNumber(row["criticalHigh"]); ok && row["criticalHigh"] != nil && value >= limit {
+		return RESULT_FLAG_CRITICAL_HIGH
+	}
+	refRange, ok := row["referenceRange"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	if low, ok := resultNumber(refRange["low"]); ok && refRange["low"] != nil && value < low {
+		return RESULT_FLAG_LOW
+	}
+	if high, ok := resultNumber(refRange["high"]); ok && refRange["high"] != nil && value > high {
+		return RESULT_FLAG_HIGH
+	}
+	return RESULT_FLAG_NORMAL
+}
+
+/*
+* Latest verified value of the analyte for the patient, used for the delta check
+ */
+func previousAnalyteResult(c context.Context, patientId string, analyteCode string, excludeReportId string) (map[string]interface{}, string) {
+	collection := db.OpenCollections(util.TestReportCollection)
+	filter := bson.M{
+		"patientId":           patientId,
+		"status":              TEST_REPORT_STATUS_VERIFIED,
+		"code":                bson.M{"$ne": excludeReportId},
+		"results.analyteCode": analyteCode,
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "verifiedAt", Value: -1}}).SetLimit(1)
+	reports, err := db.FindAll(c, collection, filter, opts)
+	if err != nil || len(reports) == 0 {
+		return nil, ""
+	}
+	report, ok := reports[0].(map[string]interface{})
+	if !ok {
+		return nil, ""
+	}
+	for _, r := range toList(report["results"]) {
+		row, ok := r.(map[string]interface{})
+		if ok && getString(row["analyteCode"]) == analyteCode && row["value"] != nil {
+			return row, getString(report["code"])
+		}
+	}
+	return nil, ""
+}
+
+/*
+* Delta check: the change from the previous verified value in percent
+* deltaCheckPercent of the analyte(or DELTA_CHECK_DEFAULT_PERCENT) is the allowed change
+ */
+func applyDeltaCheck(c context.Context, patientId string, reportId string, row map[string]interface{}, value float64) {
+	previous, previousReportId := previousAnalyteResult(c, patientId, getString(row["analyteCode"]), reportId)
+	deltaCheckRow(row, value, previous, previousReportId)
+}
+
+/*
+* Set previousValue, deltaPercent and deltaFailed on the row from the previous result(nothing when there is none)
+ */
+func deltaCheckRow(row map[string]interface{}, value float64, previous map[string]interface{}, previousReportId string) {
+	if previous == nil {
+		return
+	}
+	previousValue, ok := resultNumber(previous["value"])
+	if !ok {
+		return
+	}
+	threshold := DELTA_CHECK_DEFAULT_PERCENT
+	if limit, ok := resultNumber(row["deltaCheckPercent"]); ok && row["deltaCheckPercent"] != nil {
+		threshold = limit
+	}
+	row["previousValue"] = previousValue
+	row["previousReportId"] = previousReportId
+	if previousValue == 0 {
+		row["deltaFailed"] = value != 0
+		return
+	}
+	delta := math.Abs(value-previousValue) / math.Abs(previousValue) * 100
+	row["deltaPercent"] = math.Round(delta*100) / 100
+	row["deltaFailed"] = delta > threshold
+}
+
+/*
+* Lab staff enter the analyte values of a test report
+* results: [{analyteCode, value, comment}], values are numbers or text(e.g. POSITIVE)
+* Each value is flagged from the reference range and delta checked against the last verified value
+* The report waits for verification by another user before it is released
+* Critical values are notified to the ordering doctor immediately
+ */
+func EnterTestResults(c *gin.Context, testReportId string, data map[string]interface{}) (map[string]interface{}, error) {
+	report, err := FetchTestReportsofPatientById(c, testReportId)
+	if err != nil {
+		log.Println("Error from fetchTestReportsofPatientById: ", err)
+		return nil, err
+	}
+	return applyTestResults(c, report, toList(data["results"]), c.GetString("code"))
+}
+
+/*
+* Flag, delta check and save the entered results, used by the manual entry and the HL7 import
+ */
+func applyTestResults(ctx context.Context, report map[string]interface{}, entries []interface{}, userId string) (map[string]interface{}, error) {
+	testReportId := getString(report["code"])
+	status := getString(report["status"])
+	if status == TEST_REPORT_STATUS_VERIFIED {
+		return nil, errors.New(TEST_REPORT_ALREADY_VERIFIED)
+	}
+	if status != TEST_REPORT_STATUS_IN_PROCESS && status != TEST_REPORT_STATUS_RESULTED {
+		return nil, errors.New(SAMPLE_NOT_IN_PROCESS)
+	}
+	if len(entries) == 0 {
+		return nil, errors.New(RESULTS_MUST_BE_ARRAY)
+	}
+	rows := map[string]map[string]interface{}{}
+	var results []interface{}
+	for _, r := range toList(report["results"]) {
+		row, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		rows[strings.ToUpper(getString(row["analyteCode"]))] = row
+		results = append(results, row)
+	}
+
+	patientId := getString(report["patientId"])
+	var criticals []map[string]interface{}
+	for _, e := range entries {
+		entry, ok := e.(map[string]interface{})
+		if !ok || entry["value"] == nil {
+			return nil, errors.New(RESULTS_MUST_BE_ARRAY)
+		}
+		analyteCode := strings.ToUpper(strings.TrimSpace(getString(entry["analyteCode"])))
+		row, ok := rows[analyteCode]
+		if !ok {
+			return nil, errors.New(ANALYTE_NOT_IN_REPORT + analyteCode)
+		}
+		for _, field := range []string{"flag", "isCritical", "previousValue", "previousReportId", "deltaPercent", "deltaFailed"} {
+			delete(row, field)
+		}
+		row["comment"] = entry["comment"]
+		row["enteredBy"] = userId
+		row["enteredAt"] = time.Now()
+		value, numeric := resultNumber(entry["value"])
+		if !numeric {
+			row["value"] = strings.TrimSpace(getString(entry["value"]))
+			continue
+		}
+		row["value"] = value
+		flag := FlagResult(row, value)
+		row["flag"] = flag
+		row["isCritical"] = flag == RESULT_FLAG_CRITICAL_LOW || flag == RESULT_FLAG_CRITICAL_HIGH
+		applyDeltaCheck(ctx, patientId, testReportId, row, value)
+		if row["isCritical"] == true {
+			criticals = append(criticals, row)
+		}
+	}
+
+	update := bson.M{
+		"results":     results,
+		"status":      TEST_REPORT_STATUS_RESULTED,
+		"hasCritical": hasCriticalResult(results),
+		"resultedBy":  userId,
+		"resultedAt":  time.Now(),
+		"verifiedBy":  nil,
+		"verifiedAt":  nil,
+		"updatedBy":   userId,
+		"updatedAt":   time.Now(),
+	}
+	if len(criticals) > 0 {
+		update["criticalNotifiedAt"] = time.Now()
+	}
+	updated, err := saveTestReport(ctx, testReportId, bson.M{"status": status}, update, userId, "")
+	if err != nil {
+		return nil, err
+	}
+	if len(criticals) > 0 {
+		notifyCriticalResults(ctx, report, criticals)
+	}
+	return updated, nil
+}
+
+func hasCriticalResult(results []interface{}) bool {
+	for _, r := range results {
+		if row, ok := r.(map[string]interface{}); ok && row["isCritical"] == true {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+* Save the changes of a test report, a status change is appended to the statusHistory
+* expected(e.g. the current status) is added to the filter, the change is not saved when the report no longer matches it
+ */
+func saveTestReport(c context.Context, testReportId string, expected bson.M, set bson.M, userId string, note string) (map[string]interface{}, error) {
+	collection := db.OpenCollections(util.TestReportCollection)
+	filter := bson.M{"code": testReportId}
+	for key, value := range expected {
+		filter[key] = value
+	}
+	update := bson.M{"$set": set}
+	if status, ok := set["status"]; ok {
+		update["$push"] = bson.M{"statusHistory": map[string]interface{}{
+			"status": status,
+			"by":     userId,
+			"at":     time.Now(),
+			"note":   note,
+		}}
+	}
+	updated, err := db.UpdateOne(c, collection, filter, update)
+	if err != nil {
+		log.Println("Error from updateOne: ", err)
+		return nil, err
+	}
+	result := make(map[string]interface{})
+	err = db.FindOne(c, collection, bson.M{"code": testReportId}, result)
+	if err != nil {
+		log.Println("Error from findOne: ", err)
+		return nil, err
+	}
+	if updated.MatchedCount == 0 {
+		return nil, errors.New(INVALID_SAMPLE_STATUS + getString(result["status"]))
+	}
+	key := util.TestReportKey + testReportId
+	if err := redis.DeleteCache(c, key); err != nil {
+		log.Println("Error from deleteCache: ", err)
+	}
+	if err := redis.SetCache(c, key, result); err != nil {
+		log.Println("Error from setCache: ", err)
+	}
+	return result, nil
+}
+
+/*
+* Mail the ordering doctor about the critical values without waiting for the verification
+ */
+func notifyCriticalResults(c context.Context, report map[string]interface{}, criticals []map[string]interface{}) {
+	doctor := make(map[string]interface{})
+	collection := db.OpenCollections(util.DoctorCollection)
+	if err := db.FindOne(c, collection, bson.M{"code": report["doctorId"]}, doctor); err != nil {
+		log.Println("Error from findOne(doctor): ", err)
+		return
+	}
+	email, ok := doctor["email"].(string)
+	if !ok || email == "" {
+		log.Println("Doctor doesnot have an email to notify the critical result")
+		return
+	}
+	var lines []string
+	for _, row := range criticals {
+		lines = append(lines, fmt.Sprintf("%s: %v %s (%s)", getString(row["analyteName"]), row["value"], getString(row["unit"]), getString(row["flag"])))
+	}
+	subject := "Critical lab result for patient " + getString(report["patientId"])
+	body := fmt.Sprintf("Hello %s,\n\nThe test report %s(%s) of the patient %s has critical values:\n%s\n\nThe results are awaiting verification. Please review the patient immediately.", getString(doctor["name"]), getString(report["code"]), getString(report["testName"]), getString(report["patientId"]), strings.Join(lines, "\n"))
+	if err := common.SendOTPToMail(email, subject, body); err != nil {
+		log.Println("Critical result mail failed: ", err)
+	}
+}
+
+/*
+* The user resulted the report or entered any of its rows(rows can be entered by different users before the report is resulted)
+ */
+func enteredResults(report map[string]interface{}, userId string) bool {
+	if getString(report["resultedBy"]) == userId {
+		return true
+	}
+	for _, r := range toList(report["results"]) {
+		if row, ok := r.(map[string]interface{}); ok && getString(row["enteredBy"]) == userId {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+* A second user, who entered none of the results, verifies the entered results and releases the report
+ */
+func VerifyTestResults(c *gin.Context, testReportId string) (map[string]interface{}, error) {
+	report, err := FetchTestReportsofPatientById(c, testReportId)
+	if err != nil {
+		log.Println("Error from fetchTestReportsofPatientById: ", err)
+		return nil, err
+	}
+	if getString(report["status"]) != TEST_REPORT_STATUS_RESULTED {
+		return nil, errors.New(TEST_REPORT_NOT_RESULTED)
+	}
+	userId := c.GetString("code")
+	if enteredResults(report, userId) {
+		return nil, errors.New(VERIFIER_MUST_BE_ANOTHER_USER)
+	}
+	update := bson.M{
+		"status":               TEST_REPORT_STATUS_VERIFIED,
+		"verifiedBy":           userId,
+		"verifiedByCollection": c.GetString("collection"),
+		"verifiedAt":           time.Now(),
+		"releasedAt":           time.Now(),
+		"updatedBy":            userId,
+		"updatedAt":            time.Now(),
+	}
+	return saveTestReport(c, testReportId, bson.M{"status": TEST_REPORT_STATUS_RESULTED}, update, userId, "")
+}
+
+/*
+* The verifier(who entered none of the results) sends the results back to the lab(IN_PROCESS) for re-entry with a reason
+ */
+func RejectTestResults(c *gin.Context, testReportId string, data map[string]interface{}) (map[string]interface{}, error) {
+	if err := common.GetTrimmedString(data, "reason"); err != nil {
+		return nil, errors.New(REJECTION_REASON_REQUIRED)
+	}
+	report, err := FetchTestReportsofPatientById(c, testReportId)
+	if err != nil {
+		log.Println("Error from fetchTestReportsofPatientById: ", err)
+		return nil, err
+	}
+	if getString(report["status"]) != TEST_REPORT_STATUS_RESULTED {
+		return nil, errors.New(TEST_REPORT_NOT_RESULTED)
+	}
+	userId := c.GetString("code")
+	if enteredResults(report, userId) {
+		return nil, errors.New(VERIFIER_MUST_BE_ANOTHER_USER)
+	}
+	update := bson.M{
+		"status": TEST_REPORT_STATUS_IN_PROCESS,
+		"rejection": map[string]interface{}{
+			"reason":     data["reason"],
+			"rejectedBy": userId,
+			"rejectedAt": time.Now(),
+		},
+		"updatedBy": userId,
+		"updatedAt": time.Now(),
+	}
+	return saveTestReport(c, testReportId, bson.M{"status": TEST_REPORT_STATUS_RESULTED}, update, userId, getString(data["reason"]))
+}
+
+/*
+* Patients and guardians see the results only after they are verified
+ */
+func hideUnreleasedResults(c *gin.Context, report map[string]interface{}) map[string]interface{} {
+	collection := c.GetString("collection")
+	if getString(report["status"]) == TEST_REPORT_STATUS_VERIFIED ||
+		(collection != util.PatientCollection && collection != util.GuardianCollection) {
+		return report
+	}
+	result := make(map[string]interface{})
+	for key, value := range report {
+		if key == "results" {
+			continue
+		}
+		result[key] = value
+	}
+	return result
+}
+
+/*
+* Test report with the access check, results hidden until they are released
+ */
+func FetchTestReportByCode(c *gin.Context, testReportId string) (map[string]interface{}, error) {
+	report, err := FetchTestReportsofPatientById(c, testReportId)
+	if err != nil {
+		log.Println("Error from fetchTestReportsofPatientById: ", err)
+		return nil, err
+	}
+	return hideUnreleasedResults(c, report), nil
+}
@@ -0,0 +1,106 @@
+package services
+
+import "testing"
+
+func TestEnteredResults(t *testing.T) {
+	report := map[string]interface{}{
+		"resultedBy": "N2",
+		"results": []interface{}{
+			map[string]interface{}{"analyteCode": "HGB", "enteredBy": "N1"},
+			map[string]interface{}{"analyteCode": "WBC", "enteredBy": "N2"},
+			map[string]interface{}{"analyteCode": "PLT"},
+		},
+	}
+	cases := []struct {
+		userId  string
+		entered bool
+	}{
+		{"N1", true},
+		{"N2", true},
+		{"D1", false},
+	}
+	for _, tc := range cases {
+		if got := enteredResults(bsonRoundTrip(t, report), tc.userId); got != tc.entered {
+			t.Errorf("enteredResults(%s) = %v, want %v", tc.userId, got, tc.entered)
+		}
+	}
+}
+
+func TestFlagResult(t *testing.T) {
+	row := map[string]interface{}{
+		"criticalLow":    7.0,
+		"criticalHigh":   "20",
+		"referenceRange": map[string]interface{}{"low": 12.0, "high": int32(16)},
+	}
+	cases := []struct {
+		value float64
+		flag  string
+	}{
+		{6.9, RESULT_FLAG_CRITICAL_LOW},
+		{7, RESULT_FLAG_CRITICAL_LOW},
+		{7.1, RESULT_FLAG_LOW},
+		{11.9, RESULT_FLAG_LOW},
+		{12, RESULT_FLAG_NORMAL},
+		{16, RESULT_FLAG_NORMAL},
+		{16.1, RESULT_FLAG_HIGH},
+		{19.9, RESULT_FLAG_HIGH},
+		{20, RESULT_FLAG_CRITICAL_HIGH},
+		{25, RESULT_FLAG_CRITICAL_HIGH},
+	}
+	for _, tc := range cases {
+		if got := FlagResult(row, tc.value); got != tc.flag {
+			t.Errorf("FlagResult(%g) = %q, want %q", tc.value, got, tc.flag)
+		}
+	}
+
+	others := []struct {
+		name string
+		row  map[string]interface{}
+		flag string
+	}{
+		{"no range", map[string]interface{}{}, ""},
+		{"only low", map[string]interface{}{"referenceRange": map[string]interface{}{"low": 2.0, "high": nil}}, RESULT_FLAG_NORMAL},
+		{"nil critical limits", map[string]interface{}{"criticalLow": nil, "criticalHigh": nil, "referenceRange": map[string]interface{}{"high": 1.0}}, RESULT_FLAG_HIGH},
+		{"critical without range", map[string]interface{}{"criticalHigh": 3.0}, RESULT_FLAG_CRITICAL_HIGH},
+	}
+	for _, tc := range others {
+		if got := FlagResult(tc.row, 3); got != tc.flag {
+			t.Errorf("%s: FlagResult(3) = %q, want %q", tc.name, got, tc.flag)
+		}
+	}
+}
+
+func TestDeltaCheckRow(t *testing.T) {
+	cases := []struct {
+		name      string
+		row       map[string]interface{}
+		value     float64
+		previous  map[string]interface{}
+		percent   interface{}
+		failed    interface{}
+		hasResult bool
+	}{
+		{"no previous", map[string]interface{}{}, 10, nil, nil, nil, false},
+		{"text previous", map[string]interface{}{}, 10, map[string]interface{}{"value": "POSITIVE"}, nil, nil, false},
+		{"within default", map[string]interface{}{}, 14, map[string]interface{}{"value": 10.0}, 40.0, false, true},
+		{"at default", map[string]interface{}{}, 15, map[string]interface{}{"value": 10.0}, 50.0, false, true},
+		{"above default", map[string]interface{}{}, 16, map[string]interface{}{"value": 10.0}, 60.0, true, true},
+		{"decrease", map[string]interface{}{}, 4, map[string]interface{}{"value": "10"}, 60.0, true, true},
+		{"analyte threshold", map[string]interface{}{"deltaCheckPercent": 30.0}, 14, map[string]interface{}{"value": 10.0}, 40.0, true, true},
+		{"rounded percent", map[string]interface{}{"deltaCheckPercent": 1.0}, 1, map[string]interface{}{"value": 3.0}, 66.67, true, true},
+		{"previous zero same", map[string]interface{}{}, 0, map[string]interface{}{"value": 0.0}, nil, false, true},
+		{"previous zero changed", map[string]interface{}{}, 1, map[string]interface{}{"value": 0.0}, nil, true, true},
+	}
+	for _, tc := range cases {
+		deltaCheckRow(tc.row, tc.value, tc.previous, "TR0001")
+		if !tc.hasResult {
+			if _, ok := tc.row["previousValue"]; ok {
+				t.Errorf("%s: delta check set on %v", tc.name, tc.row)
+			}
+			continue
+		}
+		if tc.row["previousReportId"] != "TR0001" || tc.row["deltaPercent"] != tc.percent || tc.row["deltaFailed"] != tc.failed {
+			t.Errorf("%s: row = %v, want deltaPercent %v deltaFailed %v", tc.name, tc.row, tc.percent, tc.failed)
+		}
+	}
+}
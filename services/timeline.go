@@ -0,0 +1,312 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+* A collection which gives one timeline event per document of the patient
+* timeField is when the event happened, fields are copied to the details of the event
+ */
+type timelineSource struct {
+	eventType string
+	category  string
+	coll      string
+	timeField string
+	fields    []string
+	filter    bson.M
+}
+
+var timelineSources = []timelineSource{
+	{TIMELINE_PRESCRIPTION, TIMELINE_CLINICAL, util.PrescriptionCollection, "createdAt", []string{"version", "status", "diagnosis", "doctorId", "medicalRecordId"}, nil},
+	{TIMELINE_TEST_REPORT, TIMELINE_CLINICAL, util.TestReportCollection, "createdAt", []string{"testId", "testName", "type", "status", "hasCritical", "doctorId", "medicalRecordId"}, nil},
+	{TIMELINE_VITALS, TIMELINE_CLINICAL, VitalsCollection, "takenAt", []string{"systolic", "diastolic", "pulse", "temperature", "spo2", "respiratoryRate", "weight", "news2", "escalationRequired", "medicalRecordId"}, nil},
+	{TIMELINE_DIAGNOSIS, TIMELINE_CLINICAL, DiagnosisCollection, "diagnosedAt", []string{"icdCode", "description", "type", "status", "doctorId", "prescriptionId"}, nil},
+	{TIMELINE_CLINICAL_NOTE, TIMELINE_CLINICAL, ClinicalNoteCollection, "createdAt", []string{"templateId", "status", "createdBy", "medicalRecordId"}, nil},
+	{TIMELINE_ALLERGY, TIMELINE_CLINICAL, AllergyCollection, "createdAt", []string{"substance", "category", "reaction", "severity", "status", "verificationStatus"}, bson.M{"status": bson.M{"$ne": ALLERGY_STATUS_ENTERED_IN_ERROR}}},
+	{TIMELINE_IMMUNIZATION, TIMELINE_CLINICAL, ImmunizationCollection, "administeredDate", []string{"vaccine", "doseNumber", "lotNumber", "nextDueDate"}, nil},
+	{TIMELINE_ATTACHMENT, TIMELINE_CLINICAL, AttachmentCollection, "createdAt", []string{"fileName", "category", "contentType", "description", "medicalRecordId"}, nil},
+	{TIMELINE_BILL, TIMELINE_FINANCIAL, util.BillCollection, "createdAt", []string{"amount", "amountForMedicine", "amountForTests", "billType", "hasPendingMedicines", "medicalId"}, nil},
+}
+
+/*
+* Event types each role can see on the timeline, roles which are not listed see every type
+* Front desk sees the visits and the bills, pharmacy sees what is needed for dispensing
+* Doctors and nurses see the clinical events and not the bills
+ */
+var timelineVisibility = map[string][]string{
+	util.ReceptionistCollection: {TIMELINE_APPOINTMENT, TIMELINE_BILL},
+	util.PharmacistCollection:   {TIMELINE_APPOINTMENT, TIMELINE_PRESCRIPTION, TIMELINE_ALLERGY, TIMELINE_BILL},
+	util.DoctorCollection:       clinicalTimelineTypes(),
+	util.NurseCollection:        clinicalTimelineTypes(),
+}
+
+func clinicalTimelineTypes() []string {
+	types := []string{TIMELINE_APPOINTMENT}
+	for _, source := range timelineSources {
+		if source.category == TIMELINE_CLINICAL {
+			types = append(types, source.eventType)
+		}
+	}
+	return types
+}
+
+func timelineTypes() []string {
+	types := []string{TIMELINE_APPOINTMENT}
+	for _, source := range timelineSources {
+		types = append(types, source.eventType)
+	}
+	return types
+}
+
+/*
+* Requested types(comma separated, all when empty) limited to what the role can see
+ */
+func visibleTimelineTypes(c *gin.Context, requested string) ([]string, error) {
+	visible := timelineTypes()
+	if allowed, ok := timelineVisibility[c.GetString("collection")]; ok && !c.GetBool("isSuperAdmin") {
+		visible = allowed
+	}
+	if strings.TrimSpace(requested) == "" {
+		return visible, nil
+	}
+	types := []string{}
+	for _, raw := range strings.Split(requested, ",") {
+		eventType := strings.ToUpper(strings.TrimSpace(raw))
+		if eventType == "" {
+			continue
+		}
+		if !slices.Contains(timelineTypes(), eventType) {
+			return nil, errors.New(INVALID_TIMELINE_TYPE + eventType)
+		}
+		if slices.Contains(visible, eventType) && !slices.Contains(types, eventType) {
+			types = append(types, eventType)
+		}
+	}
+	return types, nil
+}
+
+func inTimelineRange(occurredAt time.Time, from time.Time, to time.Time) bool {
+	return (from.IsZero() || !occurredAt.Before(from)) && (to.IsZero() || occurredAt.Before(to))
+}
+
+/*
+* Appointments are not stored with the patientId, they are listed in patient.appointments
+* date(YYYY-MM-DD) and time(HH:MM) of the slot give the time of the event, so from/to are checked here
+ */
+func appointmentEvents(c *gin.Context, patient map[string]interface{}, from time.Time, to time.Time) ([]map[string]interface{}, error) {
+	// the patient can come from the cache, so the list is not always a primitive.A
+	codes, _ := normalizeMongoArray(patient["appointments"])
+	if len(codes) == 0 {
+		return nil, nil
+	}
+	collection := db.OpenCollections(util.AppointmentCollection)
+	appointments, err := db.FindAll(c, collection, bson.M{"code": bson.M{"$in": codes}}, nil)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	events := []map[string]interface{}{}
+	for _, a := range appointments {
+		appointment, ok := a.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		date := getString(appointment["date"])
+		occurredAt, err := time.Parse(QUERY_DATE_FORMAT+" 15:04", date+" "+getString(appointment["time"]))
+		if err != nil {
+			occurredAt, _ = time.Parse(QUERY_DATE_FORMAT, date)
+		}
+		if !inTimelineRange(occurredAt, from, to) {
+			continue
+		}
+		events = append(events, map[string]interface{}{
+			"type":        TIMELINE_APPOINTMENT,
+			"category":    TIMELINE_CLINICAL,
+			"referenceId": appointment["code"],
+			"occurredAt":  occurredAt,
+			"details": map[string]interface{}{
+				"doctorId":        appointment["doctorId"],
+				"hospitalId":      appointment["hospitalId"],
+				"time":            appointment["time"],
+				"medicalRecordId": appointment["medicalId"],
+			},
+		})
+	}
+	return events, nil
+}
+
+/*
+* Prescriptions saved before the patientId was stored on them are found through the medical records of the patient
+ */
+func patientPrescriptionFilter(c *gin.Context, patientId string) (bson.M, error) {
+	records, err := db.FindAll(c, db.OpenCollections(util.MedicalRecordCollection), bson.M{"patientId": patientId}, nil)
+	if err != nil {
+		log.Println("Error from findAll(medicalRecord): ", err)
+		return nil, err
+	}
+	medicalRecordIds := []interface{}{}
+	for _, r := range records {
+		if record, ok := r.(map[string]interface{}); ok {
+			medicalRecordIds = append(medicalRecordIds, record["code"])
+		}
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{"patientId": patientId},
+		bson.M{"medicalRecordId": bson.M{"$in": medicalRecordIds}},
+	}}, nil
+}
+
+/*
+* Newest events of the source between from and to(when given), at most limit of them
+* total is the number of events of the source in the range
+ */
+func sourceEvents(c *gin.Context, source timelineSource, patientId string, from time.Time, to time.Time, limit int64) ([]map[string]interface{}, int64, error) {
+	filter := bson.M{"patientId": patientId}
+	if source.coll == util.PrescriptionCollection {
+		prescriptionFilter, err := patientPrescriptionFilter(c, patientId)
+		if err != nil {
+			return nil, 0, err
+		}
+		filter = prescriptionFilter
+	}
+	for key, value := range source.filter {
+		filter[key] = value
+	}
+	occurred := bson.M{}
+	if !from.IsZero() {
+		occurred["$gte"] = from
+	}
+	if !to.IsZero() {
+		occurred["$lt"] = to
+	}
+	if len(occurred) > 0 {
+		filter[source.timeField] = occurred
+	}
+	collection := db.OpenCollections(source.coll)
+	total, err := collection.CountDocuments(c, filter)
+	if err != nil {
+		log.Println("Error from countDocuments: ", err)
+		return nil, 0, err
+	}
+	opts := options.Find().SetSort(bson.D{{Key: source.timeField, Value: -1}}).SetLimit(limit)
+	docs, err := db.FindAll(c, collection, filter, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, 0, err
+	}
+	events := []map[string]interface{}{}
+	for _, d := range docs {
+		doc, ok := d.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		occurredAt, ok := toTime(doc[source.timeField])
+		if !ok {
+			occurredAt, _ = toTime(doc["createdAt"])
+		}
+		details := map[string]interface{}{}
+		for _, field := range source.fields {
+			if value, exists := doc[field]; exists {
+				details[field] = value
+			}
+		}
+		events = append(events, map[string]interface{}{
+			"type":        source.eventType,
+			"category":    source.category,
+			"referenceId": doc["code"],
+			"occurredAt":  occurredAt,
+			"details":     details,
+		})
+	}
+	return events, total, nil
+}
+
+/*
+* Clinical and financial events of the patient, newest first
+* Query: types(comma separated), from/to(YYYY-MM-DD), page(from 1, at most TIMELINE_MAX_PAGE) and pageSize
+* Access to the patient follows CanAccess, the event types follow the role(timelineVisibility)
+ */
+func FetchPatientTimeline(c *gin.Context, patientId string, query map[string]string) (map[string]interface{}, error) {
+	patient, err := FetchPatientByCode(c, patientId)
+	if err != nil {
+		log.Println("Error from fetchPatientByCode: ", err)
+		return nil, err
+	}
+	types, err := visibleTimelineTypes(c, query["types"])
+	if err != nil {
+		return nil, err
+	}
+	var from, to time.Time
+	if raw := strings.TrimSpace(query["from"]); raw != "" {
+		if from, err = time.Parse(QUERY_DATE_FORMAT, raw); err != nil {
+			return nil, errors.New(INVALID_DATE_FILTER + raw)
+		}
+	}
+	if raw := strings.TrimSpace(query["to"]); raw != "" {
+		if to, err = time.Parse(QUERY_DATE_FORMAT, raw); err != nil {
+			return nil, errors.New(INVALID_DATE_FILTER + raw)
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+	page, pageSize := 1, TIMELINE_DEFAULT_PAGE_SIZE
+	if n, err := strconv.Atoi(query["page"]); err == nil && n > 0 {
+		page = min(n, TIMELINE_MAX_PAGE)
+	}
+	if n, err := strconv.Atoi(query["pageSize"]); err == nil && n > 0 {
+		pageSize = min(n, TIMELINE_MAX_PAGE_SIZE)
+	}
+
+	// the newest page*pageSize events of every source are enough to merge the page
+	limit := int64(page * pageSize)
+	events := []map[string]interface{}{}
+	total := 0
+	if slices.Contains(types, TIMELINE_APPOINTMENT) {
+		appointments, err := appointmentEvents(c, patient, from, to)
+		if err != nil {
+			log.Println("Error from appointmentEvents: ", err)
+			return nil, err
+		}
+		events = append(events, appointments...)
+		total += len(appointments)
+	}
+	for _, source := range timelineSources {
+		if !slices.Contains(types, source.eventType) {
+			continue
+		}
+		sourced, count, err := sourceEvents(c, source, patientId, from, to, limit)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, sourced...)
+		total += int(count)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i]["occurredAt"].(time.Time).After(events[j]["occurredAt"].(time.Time))
+	})
+	start := min((page-1)*pageSize, len(events))
+	end := min(start+pageSize, len(events))
+	return map[string]interface{}{
+		"patientId": patientId,
+		"types":     types,
+		"page":      page,
+		"pageSize":  pageSize,
+		"total":     total,
+		"hasMore":   end < total,
+		"events":    events[start:end],
+	}, nil
+}
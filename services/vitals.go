@@ -0,0 +1,408 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+* Accepted range of every vital sign, readings outside the range are rejected as entry errors
+ */
+var vitalRanges = map[string][2]float64{
+	"systolic":        {40, 300},
+	"diastolic":       {20, 200},
+	"pulse":           {20, 300},
+	"temperature":     {25, 45},
+	"spo2":            {50, 100},
+	"respiratoryRate": {4, 80},
+	"height":          {30, 250},
+	"weight":          {0.5, 400},
+	"painScore":       {0, 10},
+	"bloodGlucose":    {10, 1000},
+}
+
+/*
+* Order of the vital signs in the trend, also the fields which can be recorded
+ */
+var vitalFields = []string{"systolic", "diastolic", "pulse", "temperature", "spo2", "respiratoryRate", "height", "weight", "bmi", "painScore", "bloodGlucose"}
+
+/*
+* ACVPU scale, anything other than ALERT scores 3 in NEWS2
+ */
+var ConsciousnessLevels = []string{"ALERT", "CONFUSION", "VOICE", "PAIN", "UNRESPONSIVE"}
+
+/*
+* Validate the readings of a vitals entry
+* temperature in celsius, height in cm, weight in kg, bloodGlucose in mg/dL
+* consciousness(ACVPU), onOxygen and spo2Scale(1, or 2 for hypercapnic respiratory failure) are used for NEWS2
+ */
+func validateVitals(data map[string]interface{}) (map[string]interface{}, error) {
+	readings := make(map[string]interface{})
+	for field, limits := range vitalRanges {
+		raw, exists := data[field]
+		if !exists || raw == nil || strings.TrimSpace(getString(raw)) == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(getString(raw)), 64)
+		if err != nil || value < limits[0] || value > limits[1] {
+			return nil, fmt.Errorf("%s%s(%g - %g)", INVALID_VITAL_READING, field, limits[0], limits[1])
+		}
+		readings[field] = value
+	}
+	_, hasSystolic := readings["systolic"]
+	_, hasDiastolic := readings["diastolic"]
+	if hasSystolic != hasDiastolic {
+		return nil, errors.New(BP_NEEDS_BOTH_READINGS)
+	}
+	if hasSystolic && readings["diastolic"].(float64) >= readings["systolic"].(float64) {
+		return nil, errors.New(DIASTOLIC_ABOVE_SYSTOLIC)
+	}
+	if raw, exists := data["consciousness"]; exists && raw != nil {
+		level := strings.ToUpper(strings.TrimSpace(getString(raw)))
+		if !slices.Contains(ConsciousnessLevels, level) {
+			return nil, errors.New(INVALID_CONSCIOUSNESS_LEVEL)
+		}
+		readings["consciousness"] = level
+	}
+	if len(readings) == 0 {
+		return nil, errors.New(VITALS_REQUIRED)
+	}
+	if raw, exists := data["onOxygen"]; exists {
+		onOxygen, ok := raw.(bool)
+		if !ok {
+			return nil, errors.New(INVALID_ON_OXYGEN)
+		}
+		readings["onOxygen"] = onOxygen
+	}
+	readings["spo2Scale"] = 1
+	if raw, exists := data["spo2Scale"]; exists {
+		scale := toInt(raw)
+		if scale != 1 && scale != 2 {
+			return nil, errors.New(INVALID_SPO2_SCALE)
+		}
+		readings["spo2Scale"] = scale
+	}
+	return readings, nil
+}
+
+/*
+* Last recorded height of the patient, used for the BMI when only the weight is measured
+ */
+func lastPatientHeight(c *gin.Context, patientId string) (float64, bool) {
+	collection := db.OpenCollections(VitalsCollection)
+	opts := options.FindOne().SetSort(bson.D{{Key: "takenAt", Value: -1}})
+	last := make(map[string]interface{})
+	err := collection.FindOne(c, bson.M{"patientId": patientId, "height": bson.M{"$exists": true}}, opts).Decode(&last)
+	if err != nil {
+		return 0, false
+	}
+	height, ok := last["height"].(float64)
+	return height, ok
+}
+
+/*
+* Score of one parameter from the NEWS2 bands, bands are {upper limit, score} in ascending order
+ */
+func bandScore(value float64, bands [][2]float64, above float64) int {
+	for _, band := range bands {
+		if value <= band[0] {
+			return int(band[1])
+		}
+	}
+	return int(above)
+}
+
+/*
+* National Early Warning Score 2(Royal College of Physicians)
+* Needs respiratory rate, spo2, systolic, pulse, consciousness and temperature
+* Risk: LOW(0-4), LOW_MEDIUM(a single parameter scoring 3), MEDIUM(5-6), HIGH(7 or more)
+ */
+func ComputeNEWS2(readings map[string]interface{}) (map[string]interface{}, bool) {
+	for _, field := range []string{"respiratoryRate", "spo2", "systolic", "pulse", "consciousness", "temperature"} {
+		if _, exists := readings[field]; !exists {
+			return nil, false
+		}
+	}
+	onOxygen, _ := readings["onOxygen"].(bool)
+	spo2 := readings["spo2"].(float64)
+	components := map[string]int{
+		"respiratoryRate": bandScore(readings["respiratoryRate"].(float64), [][2]float64{{8, 3}, {11, 1}, {20, 0}, {24, 2}}, 3),
+		"systolic":        bandScore(readings["systolic"].(float64), [][2]float64{{90, 3}, {100, 2}, {110, 1}, {219, 0}}, 3),
+		"pulse":           bandScore(readings["pulse"].(float64), [][2]float64{{40, 3}, {50, 1}, {90, 0}, {110, 1}, {130, 2}}, 3),
+		"temperature":     bandScore(readings["temperature"].(float64), [][2]float64{{35.0, 3}, {36.0, 1}, {38.0, 0}, {39.0, 1}}, 2),
+		"consciousness":   0,
+		"airOrOxygen":     0,
+	}
+	if readings["consciousness"] != "ALERT" {
+		components["consciousness"] = 3
+	}
+	if onOxygen {
+		components["airOrOxygen"] = 2
+	}
+	if toInt(readings["spo2Scale"]) == 2 {
+		if spo2 >= 93 && onOxygen {
+			components["spo2"] = bandScore(spo2, [][2]float64{{94, 1}, {96, 2}}, 3)
+		} else {
+			components["spo2"] = bandScore(spo2, [][2]float64{{83, 3}, {85, 2}, {87, 1}}, 0)
+		}
+	} else {
+		components["spo2"] = bandScore(spo2, [][2]float64{{91, 3}, {93, 2}, {95, 1}}, 0)
+	}
+
+	score := 0
+	singleThree := false
+	for _, value := range components {
+		score += value
+		if value == 3 {
+			singleThree = true
+		}
+	}
+	risk := NEWS2_RISK_LOW
+	switch {
+	case score >= 7:
+		risk = NEWS2_RISK_HIGH
+	case score >= 5:
+		risk = NEWS2_RISK_MEDIUM
+	case singleThree:
+		risk = NEWS2_RISK_LOW_MEDIUM
+	}
+	return map[string]interface{}{
+		"score":      score,
+		"risk":       risk,
+		"components": components,
+	}, true
+}
+
+func isAdmitted(patient map[string]interface{}) bool {
+	return strings.TrimSpace(getString(patient["admissionDate"])) != ""
+}
+
+/*
+* Nurse of the hospital records the vitals of a medical record
+* takenAt(RFC3339) is optional for readings taken earlier, it cannot be in the future
+* BMI is derived from the weight and the height(or the last recorded height)
+* NEWS2 is computed for the admitted patients when all the parameters are measured
+* bp and weight of the medical record are kept as the latest readings
+ */
+func RecordVitals(c *gin.Context, medicalRecordId string, data map[string]interface{}) (map[string]interface{}, error) {
+	if c.GetString("collection") != util.NurseCollection {
+		return nil, errors.New(ONLY_NURSE_CAN_RECORD_VITALS)
+	}
+	medicalRecord := make(map[string]interface{})
+	mrColl := db.OpenCollections(util.MedicalRecordCollection)
+	if err := db.FindOne(c, mrColl, bson.M{"code": medicalRecordId}, medicalRecord); err != nil {
+		log.Println("Error from findOne(medicalRecord): ", err)
+		return nil, err
+	}
+	hospitalId, err := fetchStaffHospital(c)
+	if err != nil {
+		return nil, err
+	}
+	if hospitalId != getString(medicalRecord["hospitalId"]) {
+		return nil, errors.New(util.NURSE_DOESNOT_HAVE_ACCESS_TO_UPDATE)
+	}
+	readings, err := validateVitals(data)
+	if err != nil {
+		return nil, err
+	}
+	takenAt := time.Now()
+	if raw := strings.TrimSpace(getString(data["takenAt"])); raw != "" {
+		takenAt, err = time.Parse(time.RFC3339, raw)
+		if err != nil || takenAt.After(time.Now()) {
+			return nil, errors.New(INVALID_TAKEN_AT)
+		}
+	}
+	patientId := getString(medicalRecord["patientId"])
+	if weight, ok := readings["weight"].(float64); ok {
+		height, hasHeight := readings["height"].(float64)
+		if !hasHeight {
+			height, hasHeight = lastPatientHeight(c, patientId)
+		}
+		if hasHeight {
+			meters := height / 100
+			readings["bmi"] = math.Round(weight/(meters*meters)*10) / 10
+		}
+	}
+
+	code, err := GenerateCode(VitalsCollection)
+	if err != nil {
+		log.Println("Error from generateCode: ", err)
+		return nil, err
+	}
+	vitals := map[string]interface{}{
+		"code":            code,
+		"medicalRecordId": medicalRecordId,
+		"patientId":       patientId,
+		"doctorId":        medicalRecord["doctorId"],
+		"hospitalId":      medicalRecord["hospitalId"],
+		"tenantId":        medicalRecord["tenantId"],
+		"recordedBy":      c.GetString("code"),
+		"takenAt":         takenAt,
+		"createdAt":       time.Now(),
+	}
+	for key, value := range readings {
+		vitals[key] = value
+	}
+	patient := make(map[string]interface{})
+	if err := db.FindOne(c, db.OpenCollections(util.PatientCollection), bson.M{"code": patientId}, patient); err != nil {
+		log.Println("Error from findOne(patient): ", err)
+	}
+	if isAdmitted(patient) {
+		if news2, ok := ComputeNEWS2(readings); ok {
+			vitals["news2"] = news2
+			vitals["escalationRequired"] = news2["risk"] != NEWS2_RISK_LOW
+		}
+	}
+	collection := db.OpenCollections(VitalsCollection)
+	inserted, err := db.CreateOne(c, collection, vitals)
+	if err != nil {
+		log.Println("Error from createOne: ", err)
+		return nil, err
+	}
+	log.Println("Inserted vitals: ", inserted.InsertedID)
+
+	latest := bson.M{"latestVitalsId": code, "updatedBy": c.GetString("code"), "updatedAt": time.Now()}
+	if systolic, ok := readings["systolic"].(float64); ok {
+		latest["bp"] = fmt.Sprintf("%g/%g", systolic, readings["diastolic"])
+	}
+	if weight, ok := readings["weight"].(float64); ok {
+		latest["weight"] = weight
+	}
+	if _, err := updateMedicalRecordWithHistory(c, medicalRecordId, bson.M{"$set": latest}, HISTORY_ACTION_VITALS); err != nil {
+		log.Println("Error from updateMedicalRecordWithHistory: ", err)
+		return nil, err
+	}
+	return vitals, nil
+}
+
+/*
+* Vitals of a patient for the charts, oldest first
+* Optional parameters(comma separated e.g. pulse,spo2) and the date range from/to(YYYY-MM-DD)
+* Each parameter is a series of {takenAt, value}, NEWS2 scores are returned as their own series
+ */
+func FetchVitalsTrend(c *gin.Context, patientId string, parameters string, from string, to string) (map[string]interface{}, error) {
+	filter, err := patientDataScopeFilter(c)
+	if err != nil {
+		return nil, err
+	}
+	fields := vitalFields
+	if parameters != "" {
+		fields = nil
+		for _, p := range strings.Split(parameters, ",") {
+			p = strings.TrimSpace(p)
+			if !slices.Contains(vitalFields, p) {
+				return nil, errors.New(INVALID_VITAL_PARAMETER + p)
+			}
+			fields = append(fields, p)
+		}
+	}
+	conditions := []bson.M{filter, {"patientId": patientId}}
+	takenAt := bson.M{}
+	if from != "" {
+		start, err := time.Parse(QUERY_DATE_FORMAT, from)
+		if err != nil {
+			return nil, errors.New(INVALID_DATE_FILTER + from)
+		}
+		takenAt["$gte"] = start
+	}
+	if to != "" {
+		end, err := time.Parse(QUERY_DATE_FORMAT, to)
+		if err != nil {
+			return nil, errors.New(INVALID_DATE_FILTER + to)
+		}
+		takenAt["$lt"] = end.AddDate(0, 0, 1)
+	}
+	if len(takenAt) > 0 {
+		conditions = append(conditions, bson.M{"takenAt": takenAt})
+	}
+	collection := db.OpenCollections(VitalsCollection)
+	opts := options.Find().SetSort(bson.D{{Key: "takenAt", Value: 1}})
+	docs, err := db.FindAll(c, collection, bson.M{"$and": conditions}, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	series := make(map[string][]map[string]interface{})
+	for _, field := range fields {
+		series[field] = []map[string]interface{}{}
+	}
+	news2 := []map[string]interface{}{}
+	for _, d := range docs {
+		vitals, ok := d.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, field := range fields {
+			if value, exists := vitals[field]; exists && value != nil {
+				series[field] = append(series[field], map[string]interface{}{
+					"takenAt": vitals["takenAt"],
+					"value":   value,
+				})
+			}
+		}
+		if score, ok := vitals["news2"].(map[string]interface{}); ok {
+			news2 = append(news2, map[string]interface{}{
+				"takenAt": vitals["takenAt"],
+				"score":   score["score"],
+				"risk":    score["risk"],
+			})
+		}
+	}
+	return map[string]interface{}{
+		"patientId": patientId,
+		"series":    series,
+		"news2":     news2,
+	}, nil
+}
+
+/*
+* Latest NEWS2 of every admitted patient in the last 24 hours, highest score first
+* Used by the ward to see the patients who need escalation
+ */
+func FetchEarlyWarningBoard(c *gin.Context) ([]interface{}, error) {
+	filter, err := labScopeFilter(c)
+	if err != nil {
+		return nil, err
+	}
+	filter["news2"] = bson.M{"$exists": true}
+	filter["takenAt"] = bson.M{"$gte": time.Now().Add(-24 * time.Hour)}
+	collection := db.OpenCollections(VitalsCollection)
+	opts := options.Find().SetSort(bson.D{{Key: "takenAt", Value: -1}})
+	docs, err := db.FindAll(c, collection, filter, opts)
+	if err != nil {
+		log.Println("Error from findAll: ", err)
+		return nil, err
+	}
+	seen := map[string]bool{}
+	board := []interface{}{}
+	for _, d := range docs {
+		vitals, ok := d.(map[string]interface{})
+		if !ok || seen[getString(vitals["patientId"])] {
+			continue
+		}
+		seen[getString(vitals["patientId"])] = true
+		board = append(board, vitals)
+	}
+	scoreOf := func(v interface{}) int {
+		news2, _ := v.(map[string]interface{})["news2"].(map[string]interface{})
+		return toInt(news2["score"])
+	}
+	sort.SliceStable(board, func(i, j int) bool {
+		return scoreOf(board[i]) > scoreOf(board[j])
+	})
+	return board, nil
+}
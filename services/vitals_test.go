@@ -0,0 +1,77 @@
+package services
+
+import "testing"
+
+func news2Readings(changes map[string]interface{}) map[string]interface{} {
+	readings := map[string]interface{}{
+		"respiratoryRate": 16.0,
+		"spo2":            97.0,
+		"systolic":        120.0,
+		"pulse":           70.0,
+		"consciousness":   "ALERT",
+		"temperature":     37.0,
+	}
+	for key, value := range changes {
+		readings[key] = value
+	}
+	return readings
+}
+
+func TestComputeNEWS2(t *testing.T) {
+	cases := []struct {
+		name      string
+		changes   map[string]interface{}
+		score     int
+		risk      string
+		component string
+		points    int
+	}{
+		{"normal", nil, 0, NEWS2_RISK_LOW, "", 0},
+		{"respiratory rate 8", map[string]interface{}{"respiratoryRate": 8.0}, 3, NEWS2_RISK_LOW_MEDIUM, "respiratoryRate", 3},
+		{"respiratory rate 21", map[string]interface{}{"respiratoryRate": 21.0}, 2, NEWS2_RISK_LOW, "respiratoryRate", 2},
+		{"respiratory rate 25", map[string]interface{}{"respiratoryRate": 25.0}, 3, NEWS2_RISK_LOW_MEDIUM, "respiratoryRate", 3},
+		{"spo2 95", map[string]interface{}{"spo2": 95.0}, 1, NEWS2_RISK_LOW, "spo2", 1},
+		{"spo2 91", map[string]interface{}{"spo2": 91.0}, 3, NEWS2_RISK_LOW_MEDIUM, "spo2", 3},
+		{"scale 2 on air at 90", map[string]interface{}{"spo2": 90.0, "spo2Scale": 2.0}, 0, NEWS2_RISK_LOW, "spo2", 0},
+		{"scale 2 on air at 85", map[string]interface{}{"spo2": 85.0, "spo2Scale": 2.0}, 2, NEWS2_RISK_LOW, "spo2", 2},
+		{"scale 2 on oxygen at 97", map[string]interface{}{"spo2": 97.0, "spo2Scale": 2.0, "onOxygen": true}, 5, NEWS2_RISK_MEDIUM, "spo2", 3},
+		{"scale 2 on oxygen at 93", map[string]interface{}{"spo2": 93.0, "spo2Scale": 2.0, "onOxygen": true}, 3, NEWS2_RISK_LOW, "spo2", 1},
+		{"scale 1 on oxygen", map[string]interface{}{"onOxygen": true}, 2, NEWS2_RISK_LOW, "airOrOxygen", 2},
+		{"systolic 90", map[string]interface{}{"systolic": 90.0}, 3, NEWS2_RISK_LOW_MEDIUM, "systolic", 3},
+		{"systolic 105", map[string]interface{}{"systolic": 105.0}, 1, NEWS2_RISK_LOW, "systolic", 1},
+		{"systolic 220", map[string]interface{}{"systolic": 220.0}, 3, NEWS2_RISK_LOW_MEDIUM, "systolic", 3},
+		{"pulse 40", map[string]interface{}{"pulse": 40.0}, 3, NEWS2_RISK_LOW_MEDIUM, "pulse", 3},
+		{"pulse 120", map[string]interface{}{"pulse": 120.0}, 2, NEWS2_RISK_LOW, "pulse", 2},
+		{"pulse 131", map[string]interface{}{"pulse": 131.0}, 3, NEWS2_RISK_LOW_MEDIUM, "pulse", 3},
+		{"temperature 35.0", map[string]interface{}{"temperature": 35.0}, 3, NEWS2_RISK_LOW_MEDIUM, "temperature", 3},
+		{"temperature 38.5", map[string]interface{}{"temperature": 38.5}, 1, NEWS2_RISK_LOW, "temperature", 1},
+		{"temperature 39.1", map[string]interface{}{"temperature": 39.1}, 2, NEWS2_RISK_LOW, "temperature", 2},
+		{"new confusion", map[string]interface{}{"consciousness": "CONFUSED"}, 3, NEWS2_RISK_LOW_MEDIUM, "consciousness", 3},
+		{"medium", map[string]interface{}{"respiratoryRate": 22.0, "pulse": 115.0, "temperature": 38.5}, 5, NEWS2_RISK_MEDIUM, "", 0},
+		{"high", map[string]interface{}{"respiratoryRate": 26.0, "systolic": 95.0, "pulse": 115.0}, 7, NEWS2_RISK_HIGH, "", 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			news2, ok := ComputeNEWS2(news2Readings(tc.changes))
+			if !ok {
+				t.Fatal("news2 not computed")
+			}
+			if news2["score"] != tc.score || news2["risk"] != tc.risk {
+				t.Errorf("score = %v risk = %v, want %d %s", news2["score"], news2["risk"], tc.score, tc.risk)
+			}
+			if tc.component != "" {
+				if points := news2["components"].(map[string]int)[tc.component]; points != tc.points {
+					t.Errorf("%s = %d, want %d", tc.component, points, tc.points)
+				}
+			}
+		})
+	}
+}
+
+func TestComputeNEWS2NeedsEveryParameter(t *testing.T) {
+	readings := news2Readings(nil)
+	delete(readings, "consciousness")
+	if _, ok := ComputeNEWS2(readings); ok {
+		t.Error("news2 computed without consciousness")
+	}
+}
@@ -0,0 +1,567 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	db "github.com/KanapuramVaishnavi/Core/config/db"
+	util "github.com/KanapuramVaishnavi/Core/util"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+* Hospital whose wards the user works with
+* hospital admin is the hospital itself, the staff belong to the hospital which created them
+* superAdmin gives the hospitalId as a query param
+ */
+func wardHospital(c *gin.Context) (string, error) {
+	switch c.GetString("collection") {
+	case util.HospitalCollection:
+		return c.GetString("code"), nil
+	case util.DoctorCollection, util.NurseCollection, util.ReceptionistCollection:
+		return fetchStaffHospital(c)
+	}
+	if c.GetBool("isSuperAdmin") {
+		hospitalId := strings.TrimSpace(c.Query("hospitalId"))
+		if hospitalId == "" {
+			return "", errors.New(HOSPITAL_ID_REQUIRED)
+		}
+		return hospitalId, nil
+	}
+	return "", errors.New(ONLY_STAFF_CAN_MOVE_PATIENTS)
+}
+
+/*
+* dailyTariff is a whole amount like the other amounts of the bill, fallback is used when it is not given
+ */
+func parseTariff(raw interface{}, fallback int) (int, error) {
+	if raw == nil || strings.TrimSpace(getString(raw)) == "" {
+		if fallback > 0 {
+			return fallback, nil
+		}
+		return 0, errors.New(INVALID_DAILY_TARIFF)
+	}
+	var tariff int
+	switch v := raw.(type) {
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, errors.New(INVALID_DAILY_TARIFF)
+		}
+		tariff = int(v)
+	case string:
+		value, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return 0, errors.New(INVALID_DAILY_TARIFF)
+		}
+		tariff = value
+	default:
+		return 0, errors.New(INVALID_DAILY_TARIFF)
+	}
+	if tariff <= 0 {
+		return 0, errors.New(INVALID_DAILY_TARIFF)
+	}
+	return tariff, nil
+}
+
+func fetchWard(c *gin.Context, wardId string, hospitalId string) (map[string]interface{}, error) {
+	ward := make(map[string]interface{})
+	err := db.FindOne(c, db.OpenCollections(WardCollection), bson.M{"code": wardId, "hospitalId": hospitalId}, ward)
+	if err != nil {
+		log.Println("Error from findOne(ward): ", err)
+		return nil, errors.New(WARD_NOT_FOUND + wardId)
+	}
+	return ward, nil
+}
+
+func fetchRoom(c *gin.Context, roomId string, hospitalId string) (map[string]interface{}, error) {
+	room := make(map[string]interface{})
+	err := db.FindOne(c, db.OpenCollections(RoomCollection), bson.M{"code": roomId, "hospitalId": hospitalId}, room)
+	if err != nil {
+		log.Println("Error from findOne(room): ", err)
+		return nil, errors.New(ROOM_NOT_FOUND + roomId)
+	}
+	return room, nil
+}
+
+func fetchBed(c *gin.Context, bedId string, hospitalId string) (map[string]interface{}, error) {
+	bed := make(map[string]interface{})
+	err := db.FindOne(c, db.OpenCollections(BedCollection), bson.M{"code": bedId, "hospitalId": hospitalId}, bed)
+	if err != nil {
+		log.Println("Error from findOne(bed): ", err)
+		return nil, errors.New(BED_NOT_FOUND + bedId)
+	}
+	return bed, nil
+}
+
+/*
+* Hospital admin creates a ward{name, wardType, floor, dailyTariff}
+* dailyTariff of the ward is used for the rooms and beds which do not have their own
+ */
+func CreateWard(c *gin.Context, data map[string]interface{}) (map[string]interface{}, error) {
+	if c.GetString("collection") != util.HospitalCollection {
+		return nil, errors.New(ONLY_HOSPITAL_CAN_MANAGE_BEDS)
+	}
+	hospitalId := c.GetString("code")
+	name := strings.TrimSpace(getString(data["name"]))
+	if name == "" {
+		return nil, errors.New(WARD_NAME_REQUIRED)
+	}
+	wardType, err := upperChoice(data, "wardType", WardTypes, INVALID_WARD_TYPE)
+	if err != nil {
+		return nil, err
+	}
+	tariff, err := parseTariff(data["dailyTariff"], 0)
+	if err != nil {
+		return nil, err
+	}
+	collection := db.OpenCollections(WardCollection)
+	existing := make(map[string]interface{})
+	if err := db.FindOne(c, collection, bson.M{"hospitalId": hospitalId, "name": name}, existing); err == nil {
+		return nil, errors.New(WARD_ALREADY_EXISTS + name)
+	}
+	code, err := GenerateCode(WardCollection)
+	if err != nil {
+		log.Println("Error from generateCode: ", err)
+		return nil, err
+	}
+	ward := map[string]interface{}{
+		"code":        code,
+		"name":        name,
+		"wardType":    wardType,
+		"floor":       strings.TrimSpace(getString(data["floor"])),
+		"dailyTariff": tariff,
+		"hospitalId":  hospitalId,
+		"tenantId":    c.GetString("tenantId"),
+		"createdBy":   hospitalId,
+		"createdAt":   time.Now(),
+	}
+	if _, err := db.CreateOne(c, collection, ward); err != nil {
+		log.Println("Error from createOne: ", err)
+		return nil, err
+	}
+	return ward, nil
+}
+
+/*
+* Room{roomNo, roomType, dailyTariff} of the ward, dailyTariff defaults to the tariff of the ward
+ */
+func CreateRoom(c *gin.Context, wardId string, data map[string]interface{}) (map[string]interface{}, error) {
+	if c.GetString("collection") != util.HospitalCollection {
+		return nil, errors.New(ONLY_HOSPITAL_CAN_MANAGE_BEDS)
+	}
+	hospitalId := c.GetString("code")
+	ward, err := fetchWard(c, wardId, hospitalId)
+	if err != nil {
+		return nil, err
+	}
+	roomNo := strings.TrimSpace(getString(data["roomNo"]))
+	if roomNo == "" {
+		return nil, errors.New(ROOM_NO_REQUIRED)
+	}
+	roomType, err := upperChoice(data, "roomType", RoomTypes, INVALID_ROOM_TYPE)
+	if err != nil {
+		return nil, err
+	}
+	tariff, err := parseTariff(data["dailyTariff"], toInt(ward["dailyTariff"]))
+	if err != nil {
+		return nil, err
+	}
+	collection := db.OpenCollections(RoomCollection)
+	existing := make(map[string]interface{})
+	if err := db.FindOne(c, collection, bson.M{"wardId": wardId, "roomNo": roomNo}, existing); err == nil {
+		return nil, errors.New(ROOM_ALREADY_EXISTS + roomNo)
+	}
+	code, err := GenerateCode(RoomCollection)
+	if err != nil {
+		log.Println("Error from generateCode: ", err)
+		return nil, err
+	}
+	room := map[string]interface{}{
+		"code":        code,
+		"wardId":      wardId,
+		"roomNo":      roomNo,
+		"roomType":    roomType,
+		"dailyTariff": tariff,
+		"hospitalId":  hospitalId,
+		"tenantId":    ward["tenantId"],
+		"createdBy":   hospitalId,
+		"createdAt":   time.Now(),
+	}
+	if _, err := db.CreateOne(c, collection, room); err != nil {
+		log.Println("Error from createOne: ", err)
+		return nil, err
+	}
+	return room, nil
+}
+
+/*
+* Bed{bedNo, bedType, dailyTariff} of the room, dailyTariff defaults to the tariff of the room
+* The tariff of the bed is taken when the patient is put in the bed
+ */
+func CreateBed(c *gin.Context, roomId string, data map[string]interface{}) (map[string]interface{}, error) {
+	if c.GetString("collection") != util.HospitalCollection {
+		return nil, errors.New(ONLY_HOSPITAL_CAN_MANAGE_BEDS)
+	}
+	hospitalId := c.GetString("code")
+	room, err := fetchRoom(c, roomId, hospitalId)
+	if err != nil {
+		return nil, err
+	}
+	bedNo := strings.TrimSpace(getString(data["bedNo"]))
+	if bedNo == "" {
+		return nil, errors.New(BED_NO_REQUIRED)
+	}
+	bedType, err := upperChoice(data, "bedType", BedTypes, INVALID_BED_TYPE)
+	if err != nil {
+		return nil, err
+	}
+	tariff, err := parseTariff(data["dailyTariff"], toInt(room["dailyTariff"]))
+	if err != nil {
+		return nil, err
+	}
+	collection := db.OpenCollections(BedCollection)
+	existing := make(map[string]interface{})
+	if err := db.FindOne(c, collection, bson.M{"roomId": roomId, "bedNo": bedNo}, existing); err == nil {
+		return nil, errors.New(BED_ALREADY_EXISTS + bedNo)
+	}
+	code, err := GenerateCode(BedCollection)
+	if err != nil {
+		log.Println("Error from generateCode: ", err)
+		return nil, err
+	}
+	bed := map[string]interface{}{
+		"code":        code,
+		"wardId":      room["wardId"],
+		"roomId":      roomId,
+		"roomNo":      room["roomNo"],
+		"bedNo":       bedNo,
+		"bedType":     bedType,
+		"dailyTariff": tariff,
+		"status":      BED_STATUS_AVAILABLE,
+		"hospitalId":  hospitalId,
+		"tenantId":    room["tenantId"],
+		"createdBy":   hospitalId,
+		"createdAt":   time.Now(),
+	}
+	if _, err := db.CreateOne(c, collection, bed); err != nil {
+		log.Println("Error from createOne: ", err)
+		return nil, err
+	}
+	return bed, nil
+}
+
+/*
+* Take the bed out for maintenance or put it back, an occupied bed cannot be changed
+ */
+func UpdateBedStatus(c *gin.Context, bedId string, data map[string]interface{}) (map[string]interface{}, error) {
+	if c.GetString("collection") != util.HospitalCollection {
+		return nil, errors.New(ONLY_HOSPITAL_CAN_MANAGE_BEDS)
+	}
+	hospitalId := c.GetString("code")
+	status, err := upperChoice(data, "status", []string{BED_STATUS_AVAILABLE, BED_STATUS_MAINTENANCE}, INVALID_BED_STATUS)
+	if err != nil {
+		return nil, err
+	}
+	collection := db.OpenCollections(BedCollection)
+	filter := bson.M{"code": bedId, "hospitalId": hospitalId, "status": bson.M{"$ne": BED_STATUS_OCCUPIED}}
+	update := bson.M{"$set": bson.M{"status": status, "updatedBy": hospitalId, "updatedAt": time.Now()}}
+	result, err := db.UpdateOne(c, collection, filter, update)
+	if err != nil {
+		log.Println("Error from updateOne: ", err)
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		if _, err := fetchBed(c, bedId, hospitalId); err != nil {
+			return nil, err
+		}
+		return nil, errors.New(BED_IS_OCCUPIED + bedId)
+	}
+	return fetchBed(c, bedId, hospitalId)
+}
+
+/*
+* Wards of the hospital with their rooms
+ */
+func FetchWards(c *gin.Context) ([]interface{}, error) {
+	hospitalId, err := wardHospital(c)
+	if err != nil {
+		return nil, err
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	wards, err := db.FindAll(c, db.OpenCollections(WardCollection), bson.M{"hospitalId": hospitalId}, opts)
+	if err != nil {
+		log.Println("Error from findAll(ward): ", err)
+		return nil, err
+	}
+	opts = options.Find().SetSort(bson.D{{Key: "roomNo", Value: 1}})
+	rooms, err := db.FindAll(c, db.OpenCollections(RoomCollection), bson.M{"hospitalId": hospitalId}, opts)
+	if err != nil {
+		log.Println("Error from findAll(room): ", err)
+		return nil, err
+	}
+	roomsByWard := map[string][]interface{}{}
+	for _, r := range rooms {
+		room := r.(map[string]interface{})
+		wardId := getString(room["wardId"])
+		roomsByWard[wardId] = append(roomsByWard[wardId], room)
+	}
+	for _, w := range wards {
+		ward := w.(map[string]interface{})
+		ward["rooms"] = roomsByWard[getString(ward["code"])]
+	}
+	return wards, nil
+}
+
+/*
+* Beds of the hospital by ward with the patient in each occupied bed
+* Filters(optional) : wardId, bedType, status
+ */
+func FetchBedBoard(c *gin.Context, query map[string]string) (map[string]interface{}, error) {
+	hospitalId, err := wardHospital(c)
+	if err != nil {
+		return nil, err
+	}
+	wardFilter := bson.M{"hospitalId": hospitalId}
+	bedFilter := bson.M{"hospitalId": hospitalId}
+	if wardId := strings.TrimSpace(query["wardId"]); wardId != "" {
+		wardFilter["code"] = wardId
+		bedFilter["wardId"] = wardId
+	}
+	if bedType := strings.ToUpper(strings.TrimSpace(query["bedType"])); bedType != "" {
+		bedFilter["bedType"] = bedType
+	}
+	if status := strings.ToUpper(strings.TrimSpace(query["status"])); status != "" {
+		bedFilter["status"] = status
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	wards, err := db.FindAll(c, db.OpenCollections(WardCollection), wardFilter, opts)
+	if err != nil {
+		log.Println("Error from findAll(ward): ", err)
+		return nil, err
+	}
+	opts = options.Find().SetSort(bson.D{{Key: "roomNo", Value: 1}, {Key: "bedNo", Value: 1}})
+	beds, err := db.FindAll(c, db.OpenCollections(BedCollection), bedFilter, opts)
+	if err != nil {
+		log.Println("Error from findAll(bed): ", err)
+		return nil, err
+	}
+
+	patientIds := []string{}
+	for _, b := range beds {
+		if patientId := getString(b.(map[string]interface{})["patientId"]); patientId != "" {
+			patientIds = append(patientIds, patientId)
+		}
+	}
+	patientNames := map[string]interface{}{}
+	if len(patientIds) > 0 {
+		patients, err := db.FindAll(c, db.OpenCollections(util.PatientCollection), bson.M{"code": bson.M{"$in": patientIds}}, nil)
+		if err != nil {
+			log.Println("Error from findAll(patient): ", err)
+			return nil, err
+		}
+		for _, p := range patients {
+			patient := p.(map[string]interface{})
+			patientNames[getString(patient["code"])] = patient["name"]
+		}
+	}
+
+	bedsByWard := map[string][]interface{}{}
+	for _, b := range beds {
+		bed := b.(map[string]interface{})
+		entry := map[string]interface{}{
+			"bedId":       bed["code"],
+			"roomId":      bed["roomId"],
+			"roomNo":      bed["roomNo"],
+			"bedNo":       bed["bedNo"],
+			"bedType":     bed["bedType"],
+			"dailyTariff": bed["dailyTariff"],
+			"status":      bed["status"],
+		}
+		if patientId := getString(bed["patientId"]); patientId != "" {
+			entry["patientId"] = patientId
+			entry["patientName"] = patientNames[patientId]
+			entry["occupiedSince"] = bed["occupiedSince"]
+		}
+		wardId := getString(bed["wardId"])
+		bedsByWard[wardId] = append(bedsByWard[wardId], entry)
+	}
+
+	totals := map[string]int{"total": 0, BED_STATUS_AVAILABLE: 0, BED_STATUS_OCCUPIED: 0, BED_STATUS_MAINTENANCE: 0}
+	board := []interface{}{}
+	for _, w := range wards {
+		ward := w.(map[string]interface{})
+		wardBeds := bedsByWard[getString(ward["code"])]
+		counts := map[string]int{BED_STATUS_AVAILABLE: 0, BED_STATUS_OCCUPIED: 0, BED_STATUS_MAINTENANCE: 0}
+		for _, b := range wardBeds {
+			counts[getString(b.(map[string]interface{})["status"])]++
+		}
+		totals["total"] += len(wardBeds)
+		for status, count := range counts {
+			totals[status] += count
+		}
+		board = append(board, map[string]interface{}{
+			"wardId":      ward["code"],
+			"name":        ward["name"],
+			"wardType":    ward["wardType"],
+			"floor":       ward["floor"],
+			"total":       len(wardBeds),
+			"available":   counts[BED_STATUS_AVAILABLE],
+			"occupied":    counts[BED_STATUS_OCCUPIED],
+			"maintenance": counts[BED_STATUS_MAINTENANCE],
+			"beds":        wardBeds,
+		})
+	}
+	return map[string]interface{}{
+		"hospitalId":  hospitalId,
+		"total":       totals["total"],
+		"available":   totals[BED_STATUS_AVAILABLE],
+		"occupied":    totals[BED_STATUS_OCCUPIED],
+		"maintenance": totals[BED_STATUS_MAINTENANCE],
+		"wards":       board,
+	}, nil
+}
+
+/*
+* Census of the hospital for the date(YYYY-MM-DD, default today)
+* occupied is the midnight census(beds occupied at the end of the day, now for today)
+* admissions, transfers and discharges are the bed movements during the day
+ */
+func FetchCensus(c *gin.Context, date string) (map[string]interface{}, error) {
+	hospitalId, err := wardHospital(c)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if date = strings.TrimSpace(date); date != "" {
+		day, err = time.ParseInLocation(QUERY_DATE_FORMAT, date, time.Local)
+		if err != nil || day.After(now) {
+			return nil, errors.New(INVALID_CENSUS_DATE)
+		}
+	}
+	dayEnd := day.AddDate(0, 0, 1)
+	censusAt := dayEnd
+	if censusAt.After(now) {
+		censusAt = now
+	}
+
+	wards, err := db.FindAll(c, db.OpenCollections(WardCollection), bson.M{"hospitalId": hospitalId}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		log.Println("Error from findAll(ward): ", err)
+		return nil, err
+	}
+	beds, err := db.FindAll(c, db.OpenCollections(BedCollection), bson.M{"hospitalId": hospitalId, "createdAt": bson.M{"$lt": censusAt}}, nil)
+	if err != nil {
+		log.Println("Error from findAll(bed): ", err)
+		return nil, err
+	}
+	filter := bson.M{
+		"hospitalId": hospitalId,
+		"from":       bson.M{"$lt": dayEnd},
+		"$or":        []bson.M{{"to": nil}, {"to": bson.M{"$gte": day}}},
+	}
+	assignments, err := db.FindAll(c, db.OpenCollections(BedAssignmentCollection), filter, nil)
+	if err != nil {
+		log.Println("Error from findAll(bedAssignment): ", err)
+		return nil, err
+	}
+
+	type wardCensus struct {
+		beds, occupied, admissions, transfersIn, transfersOut, discharges int
+	}
+	census := map[string]*wardCensus{}
+	for _, w := range wards {
+		census[getString(w.(map[string]interface{})["code"])] = &wardCensus{}
+	}
+	for _, b := range beds {
+		if wc, ok := census[getString(b.(map[string]interface{})["wardId"])]; ok {
+			wc.beds++
+		}
+	}
+	inpatients := []interface{}{}
+	for _, a := range assignments {
+		assignment := a.(map[string]interface{})
+		wc, ok := census[getString(assignment["wardId"])]
+		if !ok {
+			continue
+		}
+		from, _ := toTime(assignment["from"])
+		to, closed := toTime(assignment["to"])
+		if !from.After(censusAt) && (!closed || to.After(censusAt)) {
+			wc.occupied++
+			inpatients = append(inpatients, map[string]interface{}{
+				"patientId":     assignment["patientId"],
+				"bedId":         assignment["bedId"],
+				"wardId":        assignment["wardId"],
+				"admissionDate": assignment["admissionDate"],
+				"since":         assignment["from"],
+			})
+		}
+		if !from.Before(day) {
+			if getString(assignment["startReason"]) == BED_MOVE_ADMIT {
+				wc.admissions++
+			} else {
+				wc.transfersIn++
+			}
+		}
+		if closed && !to.Before(day) && to.Before(dayEnd) {
+			if getString(assignment["endReason"]) == BED_MOVE_DISCHARGE {
+				wc.discharges++
+			} else {
+				wc.transfersOut++
+			}
+		}
+	}
+
+	result := []interface{}{}
+	var totalBeds, totalOccupied, totalAdmissions, totalDischarges int
+	for _, w := range wards {
+		ward := w.(map[string]interface{})
+		wc := census[getString(ward["code"])]
+		totalBeds += wc.beds
+		totalOccupied += wc.occupied
+		totalAdmissions += wc.admissions
+		totalDischarges += wc.discharges
+		result = append(result, map[string]interface{}{
+			"wardId":        ward["code"],
+			"name":          ward["name"],
+			"wardType":      ward["wardType"],
+			"beds":          wc.beds,
+			"occupied":      wc.occupied,
+			"occupancyRate": occupancyRate(wc.occupied, wc.beds),
+			"admissions":    wc.admissions,
+			"transfersIn":   wc.transfersIn,
+			"transfersOut":  wc.transfersOut,
+			"discharges":    wc.discharges,
+		})
+	}
+	return map[string]interface{}{
+		"hospitalId":    hospitalId,
+		"date":          day.Format(QUERY_DATE_FORMAT),
+		"censusAt":      censusAt,
+		"beds":          totalBeds,
+		"occupied":      totalOccupied,
+		"occupancyRate": occupancyRate(totalOccupied, totalBeds),
+		"admissions":    totalAdmissions,
+		"discharges":    totalDischarges,
+		"wards":         result,
+		"inpatients":    inpatients,
+	}, nil
+}
+
+/*
+* Percentage of the occupied beds rounded to one decimal
+ */
+func occupancyRate(occupied int, beds int) float64 {
+	if beds == 0 {
+		return 0
+	}
+	return math.Round(float64(occupied)*1000/float64(beds)) / 10
+}
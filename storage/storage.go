@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+)
+
+/*
+* Blob storage for uploaded files(medical record attachments and their thumbnails)
+* Keys are slash separated paths like attachments/P0001/AT0001.pdf
+ */
+
+var (
+	ErrNotFound   = errors.New("object not found in storage")
+	ErrInvalidKey = errors.New("invalid storage key")
+)
+
+type Store interface {
+	Put(ctx context.Context, key string, contentType string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+/*
+* STORAGE_DRIVER selects the store: local(default) or s3
+* local: STORAGE_LOCAL_DIR(default uploads)
+* s3: S3_ENDPOINT, S3_REGION(default us-east-1), S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY
+ */
+func FromEnv() (Store, error) {
+	switch strings.ToLower(os.Getenv("STORAGE_DRIVER")) {
+	case "", "local":
+		dir := os.Getenv("STORAGE_LOCAL_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		return NewLocalStore(dir), nil
+	case "s3":
+		region := os.Getenv("S3_REGION")
+		if region == "" {
+			region = "us-east-1"
+		}
+		return NewS3Store(os.Getenv("S3_ENDPOINT"), region, os.Getenv("S3_BUCKET"), os.Getenv("S3_ACCESS_KEY"), os.Getenv("S3_SECRET_KEY"))
+	}
+	return nil, errors.New("unknown STORAGE_DRIVER: " + os.Getenv("STORAGE_DRIVER"))
+}
+
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}